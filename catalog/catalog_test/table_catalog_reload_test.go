@@ -7,11 +7,17 @@ import (
 	"fmt"
 	"github.com/ryogrid/SamehadaDB/catalog"
 	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/recovery"
+	"github.com/ryogrid/SamehadaDB/recovery/log_recovery"
 	"github.com/ryogrid/SamehadaDB/samehada"
+	"github.com/ryogrid/SamehadaDB/storage/access"
 	"github.com/ryogrid/SamehadaDB/storage/buffer"
+	"github.com/ryogrid/SamehadaDB/storage/disk"
 	"github.com/ryogrid/SamehadaDB/storage/index/index_constants"
+	"github.com/ryogrid/SamehadaDB/storage/page"
 	"github.com/ryogrid/SamehadaDB/storage/table/column"
 	"github.com/ryogrid/SamehadaDB/storage/table/schema"
+	"github.com/ryogrid/SamehadaDB/storage/tuple"
 	testingpkg "github.com/ryogrid/SamehadaDB/testing"
 	"github.com/ryogrid/SamehadaDB/types"
 	"os"
@@ -36,7 +42,12 @@ func TestTableCatalogReload(t *testing.T) {
 
 	columnA := column.NewColumn("a", types.Integer, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
 	columnB := column.NewColumn("b", types.Integer, true, index_constants.INDEX_KIND_HASH, types.PageID(-1), nil)
-	schema_ := schema.NewSchema([]*column.Column{columnA, columnB})
+	columnC := column.NewColumn("c", types.Varchar, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	columnC.SetVariableLength(10)
+	columnD := column.NewColumn("d", types.Varchar, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	columnD.SetVariableLength(4)
+	columnD.SetIsFixedChar(true)
+	schema_ := schema.NewSchema([]*column.Column{columnA, columnB, columnC, columnD})
 
 	catalog_old.CreateTable("test_1", schema_, txn)
 	bpm.FlushAllPages()
@@ -56,7 +67,213 @@ func TestTableCatalogReload(t *testing.T) {
 	testingpkg.Assert(t, columnToCheck.GetType() == 4, "")
 	testingpkg.Assert(t, columnToCheck.HasIndex() == true, "")
 
+	// declared lengths of VARCHAR(10) and CHAR(4)
+	columnToCheck = catalog_recov.GetTableByOID(1).Schema().GetColumn(2)
+	testingpkg.Equals(t, uint32(10), columnToCheck.VariableLength())
+	testingpkg.Assert(t, !columnToCheck.IsFixedChar(), "")
+	columnToCheck = catalog_recov.GetTableByOID(1).Schema().GetColumn(3)
+	testingpkg.Equals(t, uint32(4), columnToCheck.VariableLength())
+	testingpkg.Assert(t, columnToCheck.IsFixedChar(), "")
+
 	common.TempSuppressOnMemStorage = false
 	//samehada_instance.Shutdown(true)
 	common.TempSuppressOnMemStorageMutex.Unlock()
 }
+
+// pages of entries of skip list index made at last launch are freed at reload only when db was shut down cleanly
+func TestSkipListIndexPagesFreedAtReload(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+
+	os.Remove(t.Name() + ".db")
+	os.Remove(t.Name() + ".log")
+	samehada_instance := samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	bpm := samehada_instance.GetBufferPoolManager()
+	txn := samehada_instance.GetTransactionManager().Begin(nil)
+	catalog_old := catalog.BootstrapCatalog(bpm, samehada_instance.GetLogManager(), samehada_instance.GetLockManager(), txn)
+
+	columnA := column.NewColumn("a", types.Integer, true, index_constants.INDEX_KIND_SKIP_LIST, types.PageID(-1), nil)
+	schema_ := schema.NewSchema([]*column.Column{columnA})
+	tableMetadata := catalog_old.CreateTable("test_1", schema_, txn)
+	headerPageId := columnA.IndexHeaderPageId()
+	testingpkg.Assert(t, headerPageId != types.InvalidPageID, "header page of skip list index should be recorded")
+
+	// entries over some nodes
+	for ii := 0; ii < 3000; ii++ {
+		tuple_ := tuple.NewTupleFromSchema([]types.Value{types.NewInteger(int32(ii))}, schema_)
+		tableMetadata.GetIndex(0).InsertEntry(tuple_, page.RID{PageId: types.PageID(ii), SlotNum: 0}, txn)
+	}
+	samehada_instance.GetTransactionManager().Commit(txn)
+	samehada_instance.Shutdown(false)
+
+	samehada_instance = samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	bpm = samehada_instance.GetBufferPoolManager()
+	testingpkg.Assert(t, bpm.WasShutDownCleanly(), "")
+	txn = samehada_instance.GetTransactionManager().Begin(nil)
+	catalog_recov := catalog.RecoveryCatalogFromCatalogPage(bpm, samehada_instance.GetLogManager(), samehada_instance.GetLockManager(), txn)
+	columnToCheck := catalog_recov.GetTableByOID(1).Schema().GetColumn(0)
+	testingpkg.Equals(t, headerPageId, columnToCheck.IndexHeaderPageId())
+	// nodes of old list are freed and two of them are reused for start and sentinel node of new list
+	testingpkg.Assert(t, len(bpm.GetFreePageIds()) > 0, "pages of old entries should be freed")
+
+	// index is empty and usable
+	index_ := catalog_recov.GetTableByOID(1).GetIndex(0)
+	key := tuple.NewTupleFromSchema([]types.Value{types.NewInteger(10)}, schema_)
+	testingpkg.Equals(t, 0, len(index_.ScanKey(key, txn)))
+	index_.InsertEntry(key, page.RID{PageId: 10, SlotNum: 0}, txn)
+	testingpkg.Equals(t, 1, len(index_.ScanKey(key, txn)))
+	samehada_instance.GetTransactionManager().Commit(txn)
+	// crash
+	samehada_instance.CloseFilesForTesting()
+
+	// pages on disk may be inconsistent after crash. so they are not followed
+	samehada_instance = samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	bpm = samehada_instance.GetBufferPoolManager()
+	testingpkg.Assert(t, !bpm.WasShutDownCleanly(), "")
+	txn = samehada_instance.GetTransactionManager().Begin(nil)
+	catalog.RecoveryCatalogFromCatalogPage(bpm, samehada_instance.GetLogManager(), samehada_instance.GetLockManager(), txn)
+	testingpkg.Equals(t, 0, len(bpm.GetFreePageIds()))
+	samehada_instance.GetTransactionManager().Commit(txn)
+	samehada_instance.CloseFilesForTesting()
+
+	common.TempSuppressOnMemStorage = false
+	common.TempSuppressOnMemStorageMutex.Unlock()
+	os.Remove(t.Name() + ".db")
+	os.Remove(t.Name() + ".log")
+}
+
+func TestMigrateTupleFormat(t *testing.T) {
+	samehada_instance := samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	txn := samehada_instance.GetTransactionManager().Begin(nil)
+	catalog_ := catalog.BootstrapCatalog(samehada_instance.GetBufferPoolManager(), samehada_instance.GetLogManager(), samehada_instance.GetLockManager(), txn)
+	testingpkg.Assert(t, !catalog_.HasLegacyFormatTuples(txn), "")
+
+	columnA := column.NewColumn("a", types.Integer, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	columnB := column.NewColumn("b", types.Varchar, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	schema_ := schema.NewSchema([]*column.Column{columnA, columnB})
+	tableMetadata := catalog_.CreateTable("test_1", schema_, txn)
+
+	// tuples of legacy format: each value has null flag
+	legacyTuples := [][]byte{
+		{0, 1, 0, 0, 0, 9, 0, 0, 0, 0, 3, 0, 'a', 'b', 'c'},
+		{0, 2, 0, 0, 0, 9, 0, 0, 0, 1, 0, 0},
+	}
+	for _, data := range legacyTuples {
+		_, err := tableMetadata.Table().InsertTuple(tuple.NewTuple(nil, uint32(len(data)), data), txn)
+		testingpkg.Ok(t, err)
+	}
+
+	catalog_.MigrateTupleFormat(txn)
+
+	cnt := 0
+	it := tableMetadata.Table().Iterator(txn)
+	for tuple_ := it.Current(); !it.End(); tuple_ = it.Next() {
+		testingpkg.Assert(t, !tuple_.IsLegacyFormat(), "")
+		testingpkg.Equals(t, int32(cnt+1), tuple_.GetValue(schema_, 0).ToInteger())
+		if cnt == 0 {
+			testingpkg.Equals(t, "abc", tuple_.GetValue(schema_, 1).ToVarchar())
+		} else {
+			testingpkg.Assert(t, tuple_.GetValue(schema_, 1).IsNull(), "")
+		}
+		cnt++
+	}
+	testingpkg.Equals(t, 2, cnt)
+
+	samehada_instance.GetTransactionManager().Commit(txn)
+	samehada_instance.CloseFilesForTesting()
+}
+
+func TestMigrateTupleFormatRolledBackAtCrash(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+
+	os.Remove(t.Name() + ".db")
+	os.Remove(t.Name() + ".log")
+	samehada_instance := samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	txn := samehada_instance.GetTransactionManager().Begin(nil)
+	catalog_ := catalog.BootstrapCatalog(samehada_instance.GetBufferPoolManager(), samehada_instance.GetLogManager(), samehada_instance.GetLockManager(), txn)
+
+	columnA := column.NewColumn("a", types.Integer, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	columnB := column.NewColumn("b", types.Varchar, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	schema_ := schema.NewSchema([]*column.Column{columnA, columnB})
+	tableMetadata := catalog_.CreateTable("test_1", schema_, txn)
+	for ii := 0; ii < 100; ii++ {
+		data := []byte{0, byte(ii), 0, 0, 0, 9, 0, 0, 0, 0, 3, 0, 'a', 'b', 'c'}
+		_, err := tableMetadata.Table().InsertTuple(tuple.NewTuple(nil, uint32(len(data)), data), txn)
+		testingpkg.Ok(t, err)
+	}
+	samehada_instance.GetTransactionManager().Commit(txn)
+	samehada_instance.GetBufferPoolManager().FlushAllPages()
+
+	// migration is logged as done at launch. system crashes before it is committed
+	samehada_instance.GetLogManager().ActivateLogging()
+	txn = samehada_instance.GetTransactionManager().Begin(nil)
+	catalog_.MigrateTupleFormat(txn)
+	samehada_instance.GetLogManager().Flush()
+	samehada_instance.GetBufferPoolManager().FlushAllPages()
+	samehada_instance.CloseFilesForTesting()
+
+	// checks values of tuples and returns number of ones of legacy format
+	checkTuples := func(tableMetadata *catalog.TableMetadata, txn *access.Transaction) int {
+		cnt := 0
+		legacyCnt := 0
+		it := tableMetadata.Table().Iterator(txn)
+		for tuple_ := it.Current(); !it.End(); tuple_ = it.Next() {
+			if tuple_.IsLegacyFormat() {
+				legacyCnt++
+			}
+			testingpkg.Equals(t, int32(cnt), tuple_.GetValue(schema_, 0).ToInteger())
+			testingpkg.Equals(t, "abc", tuple_.GetValue(schema_, 1).ToVarchar())
+			cnt++
+		}
+		testingpkg.Equals(t, 100, cnt)
+		return legacyCnt
+	}
+
+	// the migration is rolled back and it can be done again
+	samehada_instance = samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	samehada_instance.GetLogManager().DeactivateLogging()
+	log_recovery_ := log_recovery.NewLogRecovery(samehada_instance.GetDiskManager(), samehada_instance.GetBufferPoolManager(), samehada_instance.GetLogManager())
+	log_recovery_.Redo()
+	log_recovery_.Undo()
+	txn = samehada_instance.GetTransactionManager().Begin(nil)
+	catalog_ = catalog.RecoveryCatalogFromCatalogPage(samehada_instance.GetBufferPoolManager(), samehada_instance.GetLogManager(), samehada_instance.GetLockManager(), txn)
+	testingpkg.Equals(t, 100, checkTuples(catalog_.GetTableByName("test_1"), txn))
+	samehada_instance.GetLogManager().ActivateLogging()
+	catalog_.MigrateTupleFormat(txn)
+	testingpkg.Equals(t, 0, checkTuples(catalog_.GetTableByName("test_1"), txn))
+	samehada_instance.GetTransactionManager().Commit(txn)
+	samehada_instance.CloseFilesForTesting()
+
+	common.TempSuppressOnMemStorage = false
+	common.TempSuppressOnMemStorageMutex.Unlock()
+	os.Remove(t.Name() + ".db")
+	os.Remove(t.Name() + ".log")
+}
+
+func TestHashIndexOnlyOnDefaultPageSize(t *testing.T) {
+	dm := disk.NewVirtualDiskManagerImplWithPageSize(t.Name()+".db", 2*common.PageSize)
+	defer dm.ShutDown()
+	log_manager := recovery.NewLogManager(&dm)
+	bpm := buffer.NewBufferPoolManager(common.BufferPoolMaxFrameNumForTest, dm, log_manager)
+	lock_manager := access.NewLockManager(access.STRICT, access.SS2PL_MODE)
+	txn_mgr := access.NewTransactionManager(lock_manager, log_manager)
+	txn := txn_mgr.Begin(nil)
+	catalog_ := catalog.BootstrapCatalog(bpm, log_manager, lock_manager, txn)
+
+	// skip list index can be used on larger page
+	columnA := column.NewColumn("a", types.Integer, true, index_constants.INDEX_KIND_SKIP_LIST, types.PageID(-1), nil)
+	catalog_.CreateTable("test_1", schema.NewSchema([]*column.Column{columnA}), txn)
+
+	// hash index is rejected because layouts of its pages are fixed to common.PageSize
+	columnB := column.NewColumn("b", types.Integer, true, index_constants.INDEX_KIND_HASH, types.PageID(-1), nil)
+	func() {
+		defer func() {
+			testingpkg.Assert(t, recover() != nil, "hash index should be rejected")
+		}()
+		catalog_.CreateTable("test_2", schema.NewSchema([]*column.Column{columnB}), txn)
+	}()
+	testingpkg.Assert(t, catalog_.GetTableByName("test_2") == nil, "")
+
+	txn_mgr.Commit(txn)
+}
@@ -4,7 +4,11 @@
 package catalog
 
 import (
+	"fmt"
+	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/storage/index"
 	"github.com/ryogrid/SamehadaDB/storage/index/index_constants"
+	"math"
 	"sync/atomic"
 
 	"github.com/ryogrid/SamehadaDB/recovery"
@@ -16,13 +20,8 @@ import (
 	"github.com/ryogrid/SamehadaDB/types"
 )
 
-// TableCatalogPageId indicates the page where the table catalog can be found
-// The first page is reserved for the table catalog
-const TableCatalogPageId = 0
-
-// ColumnsCatalogPageId indicates the page where the columns catalog can be found
-// The second page is reserved for the table catalog
-const ColumnsCatalogPageId = 1
+// first pages of the table catalog and the columns catalog are recorded in header of db file
+// (see DiskManager::SetCatalogRootPageIds)
 
 const ColumnsCatalogOID = 0
 
@@ -51,13 +50,18 @@ func Int32toBool(val int32) bool {
 func BootstrapCatalog(bpm *buffer.BufferPoolManager, log_manager *recovery.LogManager, lock_manager *access.LockManager, txn *access.Transaction) *Catalog {
 	tableCatalogHeap := access.NewTableHeap(bpm, log_manager, lock_manager, txn)
 	tableCatalog := &Catalog{bpm, make(map[uint32]*TableMetadata), make(map[string]*TableMetadata), 0, tableCatalogHeap, log_manager, lock_manager}
-	tableCatalog.CreateTable("columns_catalog", ColumnsCatalogSchema(), txn)
+	columnsCatalog := tableCatalog.CreateTable("columns_catalog", ColumnsCatalogSchema(), txn)
+	bpm.SetCatalogRootPageIds(tableCatalogHeap.GetFirstPageId(), columnsCatalog.Table().GetFirstPageId())
 	return tableCatalog
 }
 
 // RecoveryCatalogFromCatalogPage get all information about tables and columns from disk and put it on memory
 func RecoveryCatalogFromCatalogPage(bpm *buffer.BufferPoolManager, log_manager *recovery.LogManager, lock_manager *access.LockManager, txn *access.Transaction) *Catalog {
-	tableCatalogHeapIt := access.InitTableHeap(bpm, TableCatalogPageId, log_manager, lock_manager).Iterator(txn)
+	tableCatalogPageId, columnsCatalogPageId := bpm.GetCatalogRootPageIds()
+	if tableCatalogPageId == types.InvalidPageID || columnsCatalogPageId == types.InvalidPageID {
+		panic("catalog is not recorded in header of db file")
+	}
+	tableCatalogHeapIt := access.InitTableHeap(bpm, tableCatalogPageId, log_manager, lock_manager).Iterator(txn)
 
 	tableIds := make(map[uint32]*TableMetadata)
 	tableNames := make(map[string]*TableMetadata)
@@ -68,7 +72,7 @@ func RecoveryCatalogFromCatalogPage(bpm *buffer.BufferPoolManager, log_manager *
 		firstPage := tuple.GetValue(TableCatalogSchema(), TableCatalogSchema().GetColIndex("first_page")).ToInteger()
 
 		columns := []*column.Column{}
-		columnsCatalogHeapIt := access.InitTableHeap(bpm, ColumnsCatalogPageId, log_manager, lock_manager).Iterator(txn)
+		columnsCatalogHeapIt := access.InitTableHeap(bpm, columnsCatalogPageId, log_manager, lock_manager).Iterator(txn)
 		for tuple := columnsCatalogHeapIt.Current(); !columnsCatalogHeapIt.End(); tuple = columnsCatalogHeapIt.Next() {
 			tableOid := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("table_oid")).ToInteger()
 			if tableOid != oid {
@@ -76,17 +80,16 @@ func RecoveryCatalogFromCatalogPage(bpm *buffer.BufferPoolManager, log_manager *
 			}
 			columnType := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("type")).ToInteger()
 			columnName := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("name")).ToVarchar()
-			fixedLength := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("fixed_length")).ToInteger()
 			variableLength := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("variable_length")).ToInteger()
-			columnOffset := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("offset")).ToInteger()
 			hasIndex := Int32toBool(tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("has_index")).ToInteger())
 			indexKind := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("index_kind")).ToInteger()
 			indexHeaderPageId := tuple.GetValue(ColumnsCatalogSchema(), ColumnsCatalogSchema().GetColIndex("index_header_page_id")).ToInteger()
 
+			// fixed length and offset are decided by column types (values in catalog of legacy tuple format are stale
+			// until MigrateTupleFormat is called)
 			column_ := column.NewColumn(columnName, types.TypeID(columnType), false, index_constants.INDEX_KIND_INVAID, types.PageID(indexHeaderPageId), nil)
-			column_.SetFixedLength(uint32(fixedLength))
-			column_.SetVariableLength(uint32(variableLength))
-			column_.SetOffset(uint32(columnOffset))
+			column_.SetVariableLength(decodeVariableLength(variableLength))
+			column_.SetIsFixedChar(variableLength < 0)
 			column_.SetHasIndex(hasIndex)
 			column_.SetIndexKind(index_constants.IndexKind(indexKind))
 			column_.SetIndexHeaderPageId(types.PageID(indexHeaderPageId))
@@ -104,7 +107,7 @@ func RecoveryCatalogFromCatalogPage(bpm *buffer.BufferPoolManager, log_manager *
 		tableNames[name] = tableMetadata
 	}
 
-	return &Catalog{bpm, tableIds, tableNames, 1, access.InitTableHeap(bpm, 0, log_manager, lock_manager), log_manager, lock_manager}
+	return &Catalog{bpm, tableIds, tableNames, 1, access.InitTableHeap(bpm, tableCatalogPageId, log_manager, lock_manager), log_manager, lock_manager}
 
 }
 
@@ -132,6 +135,13 @@ func (c *Catalog) GetAllTables() []*TableMetadata {
 
 // CreateTable creates a new table and return its metadata
 func (c *Catalog) CreateTable(name string, schema *schema.Schema, txn *access.Transaction) *TableMetadata {
+	// layouts of hash index pages are fixed to common.PageSize (see page.BlockArraySize)
+	for _, column_ := range schema.GetColumns() {
+		if column_.HasIndex() && column_.IndexKind() == index_constants.INDEX_KIND_HASH && c.bpm.GetPageSize() != common.PageSize {
+			panic(fmt.Sprintf("hash index can be used only on db whose page size is %d (page size of db: %d)", common.PageSize, c.bpm.GetPageSize()))
+		}
+	}
+
 	oid := c.nextTableId
 	atomic.AddUint32(&c.nextTableId, 1)
 
@@ -153,6 +163,21 @@ func boolToInt32(val bool) int32 {
 	}
 }
 
+// declared length of CHAR(n) column is stored as negative value in variable_length column of columns catalog
+func encodeVariableLength(column_ *column.Column) int32 {
+	if column_.IsFixedChar() {
+		return -int32(column_.VariableLength())
+	}
+	return int32(column_.VariableLength())
+}
+
+func decodeVariableLength(val int32) uint32 {
+	if val < 0 {
+		return uint32(-val)
+	}
+	return uint32(val)
+}
+
 func (c *Catalog) insertTable(tableMetadata *TableMetadata, txn *access.Transaction) {
 	row := make([]types.Value, 0)
 
@@ -161,7 +186,7 @@ func (c *Catalog) insertTable(tableMetadata *TableMetadata, txn *access.Transact
 	row = append(row, types.NewInteger(int32(tableMetadata.table.GetFirstPageId())))
 	first_tuple := tuple.NewTupleFromSchema(row, TableCatalogSchema())
 
-	// insert entry to TableCatalogPage (PageId = 0)
+	// insert entry to table catalog
 	c.tableHeap.InsertTuple(first_tuple, txn)
 	for _, column_ := range tableMetadata.schema.GetColumns() {
 		row := make([]types.Value, 0)
@@ -169,18 +194,125 @@ func (c *Catalog) insertTable(tableMetadata *TableMetadata, txn *access.Transact
 		row = append(row, types.NewInteger(int32(column_.GetType())))
 		row = append(row, types.NewVarchar(column_.GetColumnName()))
 		row = append(row, types.NewInteger(int32(column_.FixedLength())))
-		row = append(row, types.NewInteger(int32(column_.VariableLength())))
+		row = append(row, types.NewInteger(encodeVariableLength(column_)))
 		row = append(row, types.NewInteger(int32(column_.GetOffset())))
 		row = append(row, types.NewInteger(boolToInt32(column_.HasIndex())))
 		row = append(row, types.NewInteger(int32(column_.IndexKind())))
 		row = append(row, types.NewInteger(int32(column_.IndexHeaderPageId())))
 		new_tuple := tuple.NewTupleFromSchema(row, ColumnsCatalogSchema())
 
-		// insert entry to ColumnsCatalogPage (PageId = 1)
+		// insert entry to columns catalog
 		c.tableIds[ColumnsCatalogOID].Table().InsertTuple(new_tuple, txn)
 	}
 	// flush a page having table definitions
-	c.bpm.FlushPage(TableCatalogPageId)
+	c.bpm.FlushPage(c.tableHeap.GetFirstPageId())
 	// flush a page having columns definitions on table
-	c.bpm.FlushPage(ColumnsCatalogPageId)
+	c.bpm.FlushPage(c.tableIds[ColumnsCatalogOID].Table().GetFirstPageId())
+}
+
+// HasLegacyFormatTuples returns true when tuples of legacy tuple format (written with db format version 1 and older)
+// may remain. table catalog is converted last by MigrateTupleFormat, so checking its first tuple is enough
+func (c *Catalog) HasLegacyFormatTuples(txn *access.Transaction) bool {
+	firstTuple := c.tableHeap.GetFirstTuple(txn)
+	return firstTuple != nil && firstTuple.IsLegacyFormat()
+}
+
+// MigrateTupleFormat converts tuples of legacy tuple format in all tables to current format.
+// fixed_length and offset values in columns catalog are also updated because they are changed by the format
+// PAY ATTENTION: logging should be active and txn should be committed after this. tuples which do not fit
+// in their pages are moved with delete and insert, so tables are broken when system crashes during unlogged migration
+func (c *Catalog) MigrateTupleFormat(txn *access.Transaction) {
+	for _, tableMetadata := range c.GetAllTables() {
+		if tableMetadata.OID() == ColumnsCatalogOID {
+			continue
+		}
+		migrateTuplesOfTable(tableMetadata.Table(), tableMetadata.Schema(), tableMetadata.Indexes(), nil, txn)
+	}
+
+	columnsCatalog := c.tableIds[ColumnsCatalogOID]
+	migrateTuplesOfTable(columnsCatalog.Table(), ColumnsCatalogSchema(), columnsCatalog.Indexes(), c.updateColumnLayout, txn)
+	migrateTuplesOfTable(c.tableHeap, TableCatalogSchema(), nil, nil, txn)
+}
+
+// RecordIndexHeaderPageIds writes header pages of indexes to columns catalog when they differ from recorded ones.
+// header pages of skip list indexes were not recorded by older versions and they are allocated at open.
+// recorded header page is reused at next launch and pages of old index entries are freed (see NewSkipListIndex)
+func (c *Catalog) RecordIndexHeaderPageIds(txn *access.Transaction) {
+	colIdxOfPageId := ColumnsCatalogSchema().GetColIndex("index_header_page_id")
+	columnsCatalog := c.tableIds[ColumnsCatalogOID].Table()
+	it := columnsCatalog.Iterator(txn)
+	for tuple_ := it.Current(); !it.End(); tuple_ = it.Next() {
+		row := make([]types.Value, 0)
+		for ii := uint32(0); ii < ColumnsCatalogSchema().GetColumnCount(); ii++ {
+			row = append(row, tuple_.GetValue(ColumnsCatalogSchema(), ii))
+		}
+		tableMetadata := c.GetTableByOID(uint32(row[ColumnsCatalogSchema().GetColIndex("table_oid")].ToInteger()))
+		if tableMetadata == nil {
+			continue
+		}
+		colIndex := tableMetadata.Schema().GetColIndex(row[ColumnsCatalogSchema().GetColIndex("name")].ToVarchar())
+		if colIndex == math.MaxUint32 {
+			continue
+		}
+		pageId := tableMetadata.Schema().GetColumn(colIndex).IndexHeaderPageId()
+		if types.PageID(row[colIdxOfPageId].ToInteger()) == pageId {
+			continue
+		}
+		// size of the tuple is not changed. so it is updated in place
+		row[colIdxOfPageId] = types.NewInteger(int32(pageId))
+		if isUpdated, _ := columnsCatalog.UpdateTuple(tuple.NewTupleFromSchema(row, ColumnsCatalogSchema()), nil, nil, *tuple_.GetRID(), txn); !isUpdated {
+			panic("update of columns catalog failed")
+		}
+	}
+}
+
+// sets current fixed length and offset of the column to a row of columns catalog
+func (c *Catalog) updateColumnLayout(row []types.Value) {
+	tableMetadata := c.GetTableByOID(uint32(row[ColumnsCatalogSchema().GetColIndex("table_oid")].ToInteger()))
+	if tableMetadata == nil {
+		return
+	}
+	colIndex := tableMetadata.Schema().GetColIndex(row[ColumnsCatalogSchema().GetColIndex("name")].ToVarchar())
+	if colIndex == math.MaxUint32 {
+		return
+	}
+	column_ := tableMetadata.Schema().GetColumn(colIndex)
+	row[ColumnsCatalogSchema().GetColIndex("fixed_length")] = types.NewInteger(int32(column_.FixedLength()))
+	row[ColumnsCatalogSchema().GetColIndex("offset")] = types.NewInteger(int32(column_.GetOffset()))
+}
+
+// rewrites tuples of legacy tuple format in the table. updateRow can modify values of each tuple before it is written
+func migrateTuplesOfTable(tableHeap *access.TableHeap, schema_ *schema.Schema, indexes []index.Index, updateRow func([]types.Value), txn *access.Transaction) {
+	it := tableHeap.Iterator(txn)
+	for tuple_ := it.Current(); !it.End(); tuple_ = it.Next() {
+		if !tuple_.IsLegacyFormat() {
+			continue
+		}
+		row := make([]types.Value, 0)
+		for ii := uint32(0); ii < schema_.GetColumnCount(); ii++ {
+			row = append(row, tuple_.GetValue(schema_, ii))
+		}
+		if updateRow != nil {
+			updateRow(row)
+		}
+		newTuple := tuple.NewTupleFromSchema(row, schema_)
+
+		rid := tuple_.GetRID()
+		isUpdated, newRID := tableHeap.UpdateTuple(newTuple, nil, nil, *rid, txn)
+		if !isUpdated {
+			panic("tuple format migration failed")
+		}
+		if newRID != nil {
+			// keys of index entries are not changed by the format. only RID is changed when the tuple is moved
+			for _, index_ := range indexes {
+				if index_ != nil {
+					index_.DeleteEntry(tuple_, *rid, txn)
+					index_.InsertEntry(newTuple, *newRID, txn)
+					if txn.GetState() == access.ABORTED {
+						panic("tuple format migration failed: " + fmt.Sprint(txn.GetAbortReason()))
+					}
+				}
+			}
+		}
+	}
 }
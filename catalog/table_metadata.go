@@ -33,22 +33,24 @@ func NewTableMetadata(schema *schema.Schema, name string, table *access.TableHea
 		if column_.HasIndex() {
 			switch column_.IndexKind() {
 			case index_constants.INDEX_KIND_HASH:
-				// TODO: (SDB) index bucket size is common.BucketSizeOfHashIndex (auto size extending is needed...)
-				//             note: one bucket is used pages for storing index key/value pairs for a column.
-				//                   one page can store 512 key/value pair
+				// initial bucket num is common.BucketSizeOfHashIndex and buckets are split when these are full
+				// note: one bucket is a page for storing index key/value pairs for a column.
+				//       one page can store 126 key/value pair
 				im := index.NewIndexMetadata(column_.GetColumnName()+"_index", name, schema, []uint32{uint32(idx)})
-				hIdx := index.NewLinearProbeHashTableIndex(im, table.GetBufferPoolManager(), uint32(idx), common.BucketSizeOfHashIndex, column_.IndexHeaderPageId())
+				hIdx := index.NewLinearProbeHashTableIndex(im, table.GetBufferPoolManager(), table.GetLogManager(), uint32(idx), common.BucketSizeOfHashIndex, column_.IndexHeaderPageId())
 				indexes = append(indexes, hIdx)
 				// at first allocation of pages for index, column's indexHeaderPageID is -1 at above code (column_.IndexHeaderPageId() == -1)
 				// because first allocation occurs when table creation is processed (not launched DB instace from existing db file which has difinition of this table)
 				// so, for first allocation case, allocated page ID of header page need to be set to column info here
 				column_.SetIndexHeaderPageId(hIdx.GetHeaderPageId())
 			case index_constants.INDEX_KIND_SKIP_LIST:
-				// currently, SkipList Index always use new pages even if relaunch
+				// entries of SkipList Index are not loaded at relaunch. only its header page is reused
+				// and entries are inserted again (see ReconstructAllIndexData)
 				im := index.NewIndexMetadata(column_.GetColumnName()+"_index", name, schema, []uint32{uint32(idx)})
-				slIdx := index.NewSkipListIndex(im, table.GetBufferPoolManager(), uint32(idx))
+				slIdx := index.NewSkipListIndex(im, table.GetBufferPoolManager(), uint32(idx), column_.IndexHeaderPageId())
 				indexes = append(indexes, slIdx)
-				//column_.SetIndexHeaderPageId(slIdx.GetHeaderPageId())
+				// header page is recorded for freeing pages of old entries at relaunch
+				column_.SetIndexHeaderPageId(slIdx.GetHeaderPageId())
 			default:
 				panic("illegal index kind!")
 			}
@@ -66,6 +68,10 @@ func (t *TableMetadata) Schema() *schema.Schema {
 	return t.schema
 }
 
+func (t *TableMetadata) Name() string {
+	return t.name
+}
+
 func (t *TableMetadata) OID() uint32 {
 	return t.oid
 }
@@ -0,0 +1,17 @@
+package common
+
+import "hash/crc32"
+
+// size of checksum field in byte
+const SizeOfChecksum = 4
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+var zeroChecksum = [SizeOfChecksum]byte{}
+
+// returns CRC32C of data. checksum field at offset in data is treated as 0
+func CalcChecksum(data []byte, offset uint32) uint32 {
+	crc := crc32.Update(0, crc32cTable, data[:offset])
+	crc = crc32.Update(crc, crc32cTable, zeroChecksum[:])
+	return crc32.Update(crc, crc32cTable, data[offset+SizeOfChecksum:])
+}
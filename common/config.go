@@ -8,7 +8,19 @@ import (
 	"time"
 )
 
-var LogTimeout time.Duration
+// interval of flushing log buffer by flush thread of LogManager
+var LogTimeout time.Duration = time.Second
+
+// minimum interval between flushes for commits by flush thread of LogManager.
+// commit records appended in this interval are flushed together (group commit).
+// when this is 0, commit records appended while the previous flush is running are flushed together
+var LogFlushInterval time.Duration = 0
+
+// flush thread of LogManager flushes log buffer without waiting when log data in it reaches this size in byte
+var LogFlushSize uint32 = LogBufferSize / 2
+
+// the number of pages which sequential scan of a table reads ahead asynchronously (0 disables read-ahead)
+var ReadAheadPageNum = 8
 
 // var EnableLogging bool = false //true
 const EnableDebug bool = false //true
@@ -29,14 +41,21 @@ const (
 	InvalidLSN = -1
 	// the header page id
 	HeaderPageID = 0
-	// size of a data page in byte
-	PageSize                     = 4096 //1024 //512
+	// default size of a data page in byte. page size can be decided per database (power of 2 from this to MaxPageSize).
+	// this is also the minimum page size and layouts of hash index pages are fixed to this size
+	PageSize = 4096 //1024 //512
+	// upper limit of page size (offsets in a page must fit in uint16)
+	MaxPageSize                  = 32768
 	BufferPoolMaxFrameNumForTest = 32
 	// number for calculate log buffer size (number of page size)
 	LogBufferSizeBase = 32
 	// size of a log buffer in byte
 	LogBufferSize = ((LogBufferSizeBase + 1) * PageSize)
-	// size of hash bucket
+	// log file is split into segment files. a segment is sealed when its size reaches this (number of log buffer size)
+	LogSegmentSizeBase = 8
+	// size of a log segment file in byte
+	LogSegmentSize = LogSegmentSizeBase * LogBufferSize
+	// initial number of hash buckets (rounded up to power of 2)
 	BucketSizeOfHashIndex = 10
 	// probability used for determin node level on SkipList
 	SkipListProb    = 0.5  //0.25
@@ -1,14 +1,19 @@
 package concurrency
 
 import (
+	"github.com/ryogrid/SamehadaDB/common"
 	"github.com/ryogrid/SamehadaDB/recovery"
 	"github.com/ryogrid/SamehadaDB/storage/access"
 	"github.com/ryogrid/SamehadaDB/storage/buffer"
+	"github.com/ryogrid/SamehadaDB/types"
+	"sync"
 	"time"
 )
 
 /**
- * CheckpointManager creates consistent checkpoints by blocking all other transactions temporarily.
+ * CheckpointManager creates fuzzy checkpoints (ARIES style).
+ * Transactions keep running during checkpointing. Active transaction table and dirty page table
+ * at the time of the checkpoint are logged and recovery starts from the last complete checkpoint.
  */
 type CheckpointManager struct {
 	transaction_manager *access.TransactionManager
@@ -16,13 +21,17 @@ type CheckpointManager struct {
 	buffer_pool_manager *buffer.BufferPoolManager
 	// checkpointing thread works when this flag is true
 	isCheckpointActive bool
+	// LSN of BEGIN_CHECKPOINT record of running checkpoint
+	beginLSN types.LSN
+	// serializes checkpoints and blocks them while backup is running
+	mutex *sync.Mutex
 }
 
 func NewCheckpointManager(
 	transaction_manager *access.TransactionManager,
 	log_manager *recovery.LogManager,
 	buffer_pool_manager *buffer.BufferPoolManager) *CheckpointManager {
-	return &CheckpointManager{transaction_manager, log_manager, buffer_pool_manager, true}
+	return &CheckpointManager{transaction_manager, log_manager, buffer_pool_manager, true, common.InvalidLSN, new(sync.Mutex)}
 }
 
 func (checkpoint_manager *CheckpointManager) StartCheckpointTh() {
@@ -32,24 +41,101 @@ func (checkpoint_manager *CheckpointManager) StartCheckpointTh() {
 			if !checkpoint_manager.IsCheckpointActive() {
 				break
 			}
-			checkpoint_manager.BeginCheckpoint()
-			checkpoint_manager.EndCheckpoint()
+			checkpoint_manager.Checkpoint()
 		}
 	}()
 }
 
+// takes a checkpoint. returns the oldest LSN needed at recovery from it (InvalidLSN when logging is disabled)
+func (checkpoint_manager *CheckpointManager) Checkpoint() types.LSN {
+	checkpoint_manager.mutex.Lock()
+	defer checkpoint_manager.mutex.Unlock()
+
+	checkpoint_manager.BeginCheckpoint()
+	return checkpoint_manager.EndCheckpoint()
+}
+
+// Checkpoint waits until ResumeCheckpointing is called.
+// log is not truncated during the period because truncation is done by checkpoint
+func (checkpoint_manager *CheckpointManager) BlockCheckpointing() {
+	checkpoint_manager.mutex.Lock()
+}
+
+func (checkpoint_manager *CheckpointManager) ResumeCheckpointing() {
+	checkpoint_manager.mutex.Unlock()
+}
+
 func (checkpoint_manager *CheckpointManager) BeginCheckpoint() {
-	// Block all the transactions and ensure that both the WAL and all dirty buffer pool pages are persisted to disk,
-	// creating a consistent checkpoint. Do NOT allow transactions to resume at the end of this method, resume them
-	// in CheckpointManager::EndCheckpoint() instead. This is for grading purposes.
-	checkpoint_manager.transaction_manager.BlockAllTransactions()
-	checkpoint_manager.buffer_pool_manager.FlushAllPages()
-	checkpoint_manager.log_manager.Flush()
+	// flush dirty pages beforehand for making recovery start point newer.
+	// transactions are not blocked and pages dirtied after this are listed in dirty page table.
+	checkpoint_manager.buffer_pool_manager.FlushAllDirtyPagesConcurrently()
+	if !checkpoint_manager.log_manager.IsEnabledLogging() {
+		checkpoint_manager.beginLSN = common.InvalidLSN
+		return
+	}
+	lsn, err := checkpoint_manager.log_manager.AppendLogRecord(recovery.NewLogRecordBeginCheckpoint())
+	if err != nil {
+		lsn = common.InvalidLSN
+	}
+	checkpoint_manager.beginLSN = lsn
 }
 
-func (checkpoint_manager *CheckpointManager) EndCheckpoint() {
-	// Allow transactions to resume, completing the checkpoint.
-	checkpoint_manager.transaction_manager.ResumeTransactions()
+// returns the oldest LSN needed at recovery from this checkpoint (InvalidLSN when checkpoint is not done)
+func (checkpoint_manager *CheckpointManager) EndCheckpoint() types.LSN {
+	beginLSN := checkpoint_manager.beginLSN
+	if beginLSN == common.InvalidLSN {
+		return common.InvalidLSN
+	}
+	checkpoint_manager.beginLSN = common.InvalidLSN
+
+	// log records of active transactions and records which may be not reflected to pages on disk
+	// are needed at recovery. recovery starts from oldest one of them.
+	oldestLSN := beginLSN
+	activeTxnTable := make(map[types.TxnID]types.LSN)
+	for _, txn := range checkpoint_manager.transaction_manager.GetActiveTransactions() {
+		if txn.GetFirstLSN() == common.InvalidLSN {
+			// transaction has not written log records yet
+			continue
+		}
+		activeTxnTable[txn.GetTransactionId()] = txn.GetPrevLSN()
+		if txn.GetFirstLSN() < oldestLSN {
+			oldestLSN = txn.GetFirstLSN()
+		}
+	}
+	dirtyPageTable := checkpoint_manager.buffer_pool_manager.GetDirtyPageTable()
+	for _, recLSN := range dirtyPageTable {
+		if recLSN < oldestLSN {
+			oldestLSN = recLSN
+		}
+	}
+
+	freePageIds := checkpoint_manager.buffer_pool_manager.GetFreePageIds()
+	// pages which are not released yet are logged again because records before the checkpoint may not be read
+	if err := checkpoint_manager.buffer_pool_manager.LogPendingReleases(); err != nil {
+		return common.InvalidLSN
+	}
+
+	// the tables can be larger than log buffer (ex: free page list after VACUUM of a large table).
+	// so they are split to records which fit in it
+	tableRecords := recovery.NewLogRecordsCheckpointTables(beginLSN, activeTxnTable, dirtyPageTable, freePageIds,
+		checkpoint_manager.log_manager.GetMaxLogRecordSize())
+	for _, log_record := range tableRecords {
+		if _, err := checkpoint_manager.log_manager.AppendLogRecord(log_record); err != nil {
+			// END_CHECKPOINT is not written. so recovery uses the previous checkpoint
+			return common.InvalidLSN
+		}
+	}
+	recoveryStartOffset := checkpoint_manager.log_manager.GetLogFileOffsetOfLSN(oldestLSN)
+	if _, err := checkpoint_manager.log_manager.AppendLogRecord(recovery.NewLogRecordEndCheckpoint(beginLSN, recoveryStartOffset)); err != nil {
+		return common.InvalidLSN
+	}
+	checkpoint_manager.log_manager.Flush()
+
+	// checkpoint is complete
+	checkpoint_manager.log_manager.WriteCheckpointLocation(beginLSN)
+	checkpoint_manager.log_manager.TruncateLogBefore(oldestLSN)
+	checkpoint_manager.log_manager.DiscardLSNOffsetsBefore(oldestLSN)
+	return oldestLSN
 }
 
 func (checkpoint_manager *CheckpointManager) StopCheckpointTh() {
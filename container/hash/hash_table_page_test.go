@@ -24,7 +24,9 @@ func TestHashTableHeaderPage(t *testing.T) {
 	var diskManager disk.DiskManager
 	if !common.TempSuppressOnMemStorage || common.TempSuppressOnMemStorage {
 		os.Remove(t.Name() + ".db")
-		diskManager = disk.NewDiskManagerImpl(t.Name() + ".db")
+		var err error
+		diskManager, err = disk.NewDiskManagerImpl(t.Name() + ".db")
+		testingpkg.Ok(t, err)
 	} else {
 		diskManager = disk.NewVirtualDiskManagerImpl(t.Name() + ".db")
 	}
@@ -34,12 +36,15 @@ func TestHashTableHeaderPage(t *testing.T) {
 	newPage := bpm.NewPage()
 	newPageData := newPage.Data()
 
-	headerPage := (*page.HashTableHeaderPage)(unsafe.Pointer(newPageData))
+	headerPage := (*page.HashTableHeaderPage)(unsafe.Pointer(&newPageData[0]))
 
 	for i := 0; i < 11; i++ {
-		headerPage.SetSize(i)
-		if i != headerPage.GetSize() {
-			t.Errorf("GetSize shoud be %d, but got %d", i, headerPage.GetSize())
+		headerPage.SetGlobalDepth(uint32(i))
+		if uint32(i) != headerPage.GetGlobalDepth() {
+			t.Errorf("GetGlobalDepth shoud be %d, but got %d", i, headerPage.GetGlobalDepth())
+		}
+		if uint32(1<<i) != headerPage.GetDirectorySize() {
+			t.Errorf("GetDirectorySize shoud be %d, but got %d", 1<<i, headerPage.GetDirectorySize())
 		}
 
 		//headerPage.SetPageId(page.PageID(i))
@@ -48,24 +53,24 @@ func TestHashTableHeaderPage(t *testing.T) {
 			t.Errorf("GetPageId shoud be %d, but got %d", types.PageID(i), headerPage.GetPageId())
 		}
 
-		//headerPage.SetLSN(i)
-		//if i != headerPage.GetLSN() {
-		//	t.Errorf("GetLSN shoud be %d, but got %d", i, headerPage.GetLSN())
-		//}
+		headerPage.SetLSN(types.LSN(i))
+		if types.LSN(i) != headerPage.GetLSN() {
+			t.Errorf("GetLSN shoud be %d, but got %d", i, headerPage.GetLSN())
+		}
 	}
 
-	// add a few hypothetical block pages
+	// add a few hypothetical directory pages
 	for i := 0; i < 10; i++ {
-		headerPage.AddBlockPageId(types.PageID(i))
-		if uint32(i+1) != headerPage.NumBlocks() {
-			t.Errorf("NumBlocks shoud be %d, but got %d", i+1, headerPage.NumBlocks())
+		headerPage.AddDirectoryPageId(types.PageID(i))
+		if uint32(i+1) != headerPage.NumDirectoryPages() {
+			t.Errorf("NumDirectoryPages shoud be %d, but got %d", i+1, headerPage.NumDirectoryPages())
 		}
 	}
 
-	// check for correct block page IDs
+	// check for correct directory page IDs
 	for i := 0; i < 10; i++ {
-		if types.PageID(i) != headerPage.GetBlockPageId(uint32(i)) {
-			t.Errorf("GetBlockPageId shoud be %d, but got %d", i, headerPage.GetBlockPageId(uint32(i)))
+		if types.PageID(i) != headerPage.GetDirectoryPageId(uint32(i)) {
+			t.Errorf("GetDirectoryPageId shoud be %d, but got %d", i, headerPage.GetDirectoryPageId(uint32(i)))
 		}
 	}
 
@@ -84,7 +89,9 @@ func TestHashTableHeaderPage(t *testing.T) {
 func TestHashTableBlockPage(t *testing.T) {
 	var diskManager disk.DiskManager
 	if !common.TempSuppressOnMemStorage || common.TempSuppressOnMemStorage {
-		diskManager = disk.NewDiskManagerImpl(t.Name() + ".db")
+		var err error
+		diskManager, err = disk.NewDiskManagerImpl(t.Name() + ".db")
+		testingpkg.Ok(t, err)
 	} else {
 		diskManager = disk.NewVirtualDiskManagerImpl(t.Name() + ".db")
 	}
@@ -95,17 +102,30 @@ func TestHashTableBlockPage(t *testing.T) {
 	newPage := bpm.NewPage()
 	newPageData := newPage.Data()
 
-	blockPage := (*page.HashTableBlockPage)(unsafe.Pointer(newPageData))
+	blockPage := (*page.HashTableBlockPage)(unsafe.Pointer(&newPageData[0]))
+
+	testingpkg.Assert(t, unsafe.Sizeof(*blockPage) <= common.PageSize, "block page should fit in a page")
+	testingpkg.Assert(t, unsafe.Sizeof(page.HashTableOverflowPage{}) == common.PageSize, "overflow page should fit in a page")
 
 	for i := 0; i < 10; i++ {
-		blockPage.Insert(uint32(i), uint32(i), uint32(i))
+		blockPage.Insert(uint32(i), page.NewHashTablePair(uint32(i), uint64(i), IntToBytes(i), types.InvalidPageID, 0))
 	}
 
 	for i := 0; i < 10; i++ {
 		//testingpkg.Assert(t, uint32(i) == blockPage.KeyAt(uint32(i)), "")
-		testingpkg.Assert(t, uint32(i) == blockPage.ValueAt(uint32(i)), "")
+		testingpkg.Assert(t, uint64(i) == blockPage.ValueAt(uint32(i)), "")
+		testingpkg.Assert(t, blockPage.PairAt(uint32(i)).IsSameInlineKey(IntToBytes(i)), "")
 	}
 
+	// key longer than inline area keeps location on overflow page
+	longKey := []byte("this key is stored on overflow page")
+	longPair := page.NewHashTablePair(100, 100, longKey, types.PageID(7), 123)
+	testingpkg.Assert(t, !longPair.IsInlineKey(), "")
+	testingpkg.Equals(t, uint32(len(longKey)), longPair.GetKeyLen())
+	overflowPageId, overflowOffset := longPair.GetOverflowLocation()
+	testingpkg.Equals(t, types.PageID(7), overflowPageId)
+	testingpkg.Equals(t, uint32(123), overflowOffset)
+
 	for i := 0; i < 10; i++ {
 		if i%2 == 1 {
 			blockPage.Remove(uint32(i))
@@ -6,6 +6,8 @@ package hash
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
+	"github.com/ryogrid/SamehadaDB/storage/page"
 	"github.com/ryogrid/SamehadaDB/types"
 	"testing"
 
@@ -26,15 +28,15 @@ func TestLinearProbeHashTable(t *testing.T) {
 	defer diskManager.ShutDown()
 	bpm := buffer.NewBufferPoolManager(uint32(10), diskManager, recovery.NewLogManager(&diskManager))
 
-	ht := NewLinearProbeHashTable(bpm, 1000, types.InvalidPageID)
+	ht := NewLinearProbeHashTable(bpm, nil, 1000, types.InvalidPageID)
 
 	for i := 0; i < 5; i++ {
-		ht.Insert(IntToBytes(i), uint32(i))
+		ht.Insert(IntToBytes(i), uint64(i), nil)
 		res := ht.GetValue(IntToBytes(i))
 		if len(res) == 0 {
 			t.Errorf("result should not be nil")
 		} else {
-			testingpkg.Equals(t, uint32(i), res[0])
+			testingpkg.Equals(t, uint64(i), res[0])
 		}
 	}
 
@@ -43,29 +45,29 @@ func TestLinearProbeHashTable(t *testing.T) {
 		if len(res) == 0 {
 			t.Errorf("result should not be nil")
 		} else {
-			testingpkg.Equals(t, uint32(i), res[0])
+			testingpkg.Equals(t, uint64(i), res[0])
 		}
 	}
 
 	// test for duplicate values
 	for i := 0; i < 5; i++ {
 		if i == 0 {
-			testingpkg.Nok(t, ht.Insert(IntToBytes(i), uint32(2*i)))
+			testingpkg.Nok(t, ht.Insert(IntToBytes(i), uint64(2*i), nil))
 		} else {
-			testingpkg.Ok(t, ht.Insert(IntToBytes(i), uint32(2*i)))
+			testingpkg.Ok(t, ht.Insert(IntToBytes(i), uint64(2*i), nil))
 		}
-		ht.Insert(IntToBytes(i), uint32(2*i))
+		ht.Insert(IntToBytes(i), uint64(2*i), nil)
 		res := ht.GetValue(IntToBytes(i))
 		if i == 0 {
 			testingpkg.Equals(t, 1, len(res))
-			testingpkg.Equals(t, uint32(i), res[0])
+			testingpkg.Equals(t, uint64(i), res[0])
 		} else {
 			testingpkg.Equals(t, 2, len(res))
-			if res[0] == uint32(i) {
-				testingpkg.Equals(t, uint32(2*i), res[1])
+			if res[0] == uint64(i) {
+				testingpkg.Equals(t, uint64(2*i), res[1])
 			} else {
-				testingpkg.Equals(t, uint32(2*i), res[0])
-				testingpkg.Equals(t, uint32(i), res[1])
+				testingpkg.Equals(t, uint64(2*i), res[0])
+				testingpkg.Equals(t, uint64(i), res[1])
 			}
 		}
 	}
@@ -76,26 +78,198 @@ func TestLinearProbeHashTable(t *testing.T) {
 
 	// delete some values
 	for i := 0; i < 5; i++ {
-		ht.Remove(IntToBytes(i), uint32(i))
+		ht.Remove(IntToBytes(i), uint64(i), nil)
 		res := ht.GetValue(IntToBytes(i))
 
 		if i == 0 {
 			testingpkg.Equals(t, 0, len(res))
 		} else {
 			testingpkg.Equals(t, 1, len(res))
-			testingpkg.Equals(t, uint32(2*i), res[0])
+			testingpkg.Equals(t, uint64(2*i), res[0])
 		}
 	}
 
 	// remove several entries and re-insert these entry and check got value
 	for i := 1; i < 5; i++ {
-		ht.Remove(IntToBytes(i), uint32(i*2))
-		ht.Insert(IntToBytes(i), uint32(i*3))
+		ht.Remove(IntToBytes(i), uint64(i*2), nil)
+		ht.Insert(IntToBytes(i), uint64(i*3), nil)
 		res := ht.GetValue(IntToBytes(i))
 
 		testingpkg.Equals(t, 1, len(res))
-		testingpkg.Equals(t, uint32(3*i), res[0])
+		testingpkg.Equals(t, uint64(3*i), res[0])
 	}
 
 	bpm.FlushAllPages()
 }
+
+func TestLinearProbeHashTableGrowing(t *testing.T) {
+	diskManager := disk.NewDiskManagerTest()
+	defer diskManager.ShutDown()
+	bpm := buffer.NewBufferPoolManager(uint32(64), diskManager, recovery.NewLogManager(&diskManager))
+
+	// table starts with only one bucket
+	ht := NewLinearProbeHashTable(bpm, nil, 1, types.InvalidPageID)
+
+	keyNum := 1000000
+	if testing.Short() {
+		keyNum = 100000
+	}
+
+	for i := 0; i < keyNum; i++ {
+		testingpkg.Ok(t, ht.Insert(IntToBytes(i), uint64(i), nil))
+	}
+
+	for i := 0; i < keyNum; i++ {
+		testingpkg.Equals(t, []uint64{uint64(i)}, ht.GetValue(IntToBytes(i)))
+	}
+
+	// remove half of entries
+	for i := 0; i < keyNum; i += 2 {
+		ht.Remove(IntToBytes(i), uint64(i), nil)
+	}
+
+	for i := 0; i < keyNum; i++ {
+		res := ht.GetValue(IntToBytes(i))
+		if i%2 == 0 {
+			testingpkg.Equals(t, 0, len(res))
+		} else {
+			testingpkg.Equals(t, []uint64{uint64(i)}, res)
+		}
+	}
+
+	// reopen the table and check entries are kept
+	ht = NewLinearProbeHashTable(bpm, nil, 0, ht.GetHeaderPageId())
+	for i := 1; i < keyNum; i += 2 {
+		testingpkg.Equals(t, []uint64{uint64(i)}, ht.GetValue(IntToBytes(i)))
+	}
+}
+
+// returns pairs of distinct keys whose hash values are same
+func findCollidedKeys(pairNum int, keyLen int) [][2][]byte {
+	ret := make([][2][]byte, 0)
+	hashToKey := make(map[uint32][]byte)
+	for ii := 0; len(ret) < pairNum; ii++ {
+		key := []byte(fmt.Sprintf("%0*d", keyLen, ii))
+		hash := GenHashMurMur(key)
+		if collided, ok := hashToKey[hash]; ok {
+			ret = append(ret, [2][]byte{collided, key})
+		} else {
+			hashToKey[hash] = key
+		}
+	}
+	return ret
+}
+
+func TestLinearProbeHashTableCollidedKeys(t *testing.T) {
+	diskManager := disk.NewDiskManagerTest()
+	defer diskManager.ShutDown()
+	bpm := buffer.NewBufferPoolManager(uint32(32), diskManager, recovery.NewLogManager(&diskManager))
+
+	ht := NewLinearProbeHashTable(bpm, nil, 1, types.InvalidPageID)
+
+	// short keys are stored in slots and long keys are stored on overflow pages
+	for _, keyLen := range []int{8, 40} {
+		collidedKeys := findCollidedKeys(10, keyLen)
+		for ii, keys := range collidedKeys {
+			testingpkg.Equals(t, GenHashMurMur(keys[0]), GenHashMurMur(keys[1]))
+			testingpkg.Ok(t, ht.Insert(keys[0], uint64(2*ii), nil))
+			testingpkg.Ok(t, ht.Insert(keys[1], uint64(2*ii+1), nil))
+		}
+
+		// only value of searched key is returned
+		for ii, keys := range collidedKeys {
+			testingpkg.Equals(t, []uint64{uint64(2 * ii)}, ht.GetValue(keys[0]))
+			testingpkg.Equals(t, []uint64{uint64(2*ii + 1)}, ht.GetValue(keys[1]))
+		}
+
+		// removing a key does not affect collided one
+		for ii, keys := range collidedKeys {
+			ht.Remove(keys[0], uint64(2*ii+1), nil)
+			testingpkg.Equals(t, []uint64{uint64(2*ii + 1)}, ht.GetValue(keys[1]))
+			ht.Remove(keys[0], uint64(2*ii), nil)
+			testingpkg.Equals(t, 0, len(ht.GetValue(keys[0])))
+			testingpkg.Equals(t, []uint64{uint64(2*ii + 1)}, ht.GetValue(keys[1]))
+		}
+	}
+
+	bpm.FlushAllPages()
+}
+
+func TestLinearProbeHashTableLongKeys(t *testing.T) {
+	diskManager := disk.NewDiskManagerTest()
+	defer diskManager.ShutDown()
+	bpm := buffer.NewBufferPoolManager(uint32(32), diskManager, recovery.NewLogManager(&diskManager))
+
+	ht := NewLinearProbeHashTable(bpm, nil, 1, types.InvalidPageID)
+
+	// many overflow pages are chained and buckets are split
+	keyNum := 50000
+	genKey := func(i int) []byte {
+		return []byte(fmt.Sprintf("long key which is stored on overflow page %d", i))
+	}
+	for i := 0; i < keyNum; i++ {
+		testingpkg.Ok(t, ht.Insert(genKey(i), uint64(i), nil))
+	}
+	for i := 0; i < keyNum; i++ {
+		testingpkg.Equals(t, []uint64{uint64(i)}, ht.GetValue(genKey(i)))
+	}
+
+	// too long key can not be inserted
+	testingpkg.Nok(t, ht.Insert(make([]byte, page.OverflowPageDataSize+1), 0, nil))
+
+	for i := 0; i < keyNum; i += 2 {
+		ht.Remove(genKey(i), uint64(i), nil)
+	}
+	for i := 0; i < keyNum; i++ {
+		if i%2 == 0 {
+			testingpkg.Equals(t, 0, len(ht.GetValue(genKey(i))))
+		} else {
+			testingpkg.Equals(t, []uint64{uint64(i)}, ht.GetValue(genKey(i)))
+		}
+	}
+
+	bpm.FlushAllPages()
+}
+
+func TestLinearProbeHashTableManyDuplicatedKeys(t *testing.T) {
+	diskManager := disk.NewDiskManagerTest()
+	defer diskManager.ShutDown()
+	bpm := buffer.NewBufferPoolManager(uint32(10), diskManager, recovery.NewLogManager(&diskManager))
+
+	ht := NewLinearProbeHashTable(bpm, nil, 10, types.InvalidPageID)
+
+	// values of same key can't be separated by bucket split. so block pages are chained to the bucket.
+	// other keys are inserted together for splitting buckets which have chained pages
+	dupNum := 3000
+	otherKeyNum := 20000
+	for i := 0; i < dupNum; i++ {
+		testingpkg.Ok(t, ht.Insert(IntToBytes(7), uint64(i), nil))
+		for j := i * otherKeyNum / dupNum; j < (i+1)*otherKeyNum/dupNum; j++ {
+			testingpkg.Ok(t, ht.Insert(IntToBytes(j+100), uint64(j), nil))
+		}
+	}
+	testingpkg.Equals(t, dupNum, len(ht.GetValue(IntToBytes(7))))
+	for j := 0; j < otherKeyNum; j++ {
+		testingpkg.Equals(t, []uint64{uint64(j)}, ht.GetValue(IntToBytes(j+100)))
+	}
+
+	// duplicated value is not allowed also on chained pages
+	testingpkg.Nok(t, ht.Insert(IntToBytes(7), uint64(dupNum-1), nil))
+
+	for i := 0; i < dupNum; i += 2 {
+		testingpkg.Ok(t, ht.Remove(IntToBytes(7), uint64(i), nil))
+	}
+	res := ht.GetValue(IntToBytes(7))
+	testingpkg.Equals(t, dupNum/2, len(res))
+	for _, val := range res {
+		testingpkg.SimpleAssert(t, val%2 == 1)
+	}
+
+	// removed slots are reused
+	for i := 0; i < dupNum; i += 2 {
+		testingpkg.Ok(t, ht.Insert(IntToBytes(7), uint64(i), nil))
+	}
+	testingpkg.Equals(t, dupNum, len(ht.GetValue(IntToBytes(7))))
+
+	bpm.FlushAllPages()
+}
@@ -4,169 +4,947 @@
 package hash
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"github.com/ryogrid/SamehadaDB/storage/page"
 	"unsafe"
 
 	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/recovery"
+	"github.com/ryogrid/SamehadaDB/storage/access"
 	"github.com/ryogrid/SamehadaDB/storage/buffer"
 	"github.com/ryogrid/SamehadaDB/types"
 	"github.com/spaolacci/murmur3"
 )
 
 /**
- * Implementation of linear probing hash table that is backed by a buffer pool
+ * Implementation of extendible hash table that is backed by a buffer pool
  * manager. Non-unique keys are supported. Supports insert and delete. The
- * table dynamically grows once full.
+ * table dynamically grows once a bucket is full.
+ *
+ * Each bucket is a block page and slots in a bucket are searched with linear probing.
+ * When a bucket is full, the bucket is split into two buckets and
+ * the directory is doubled if needed. Entries of same hash can not be separated by split
+ * (e.g. many values of a key). so when most of the bucket is occupied by entries of
+ * one hash, these are moved to a block page which is chained to the bucket instead.
+ * Chained pages store entries of only one hash, so these are moved to new bucket
+ * without changing their content at split. Slots of each page of the bucket are
+ * searched with linear probing independently.
  */
-// TODO: (SDB) LinearProbeHashTable does not dynamically grows...
 type LinearProbeHashTable struct {
 	headerPageId types.PageID
 	bpm          *buffer.BufferPoolManager
+	log_manager  *recovery.LogManager
 	table_latch  common.ReaderWriterLatch
+	// true when pages of old format were discarded at opening
+	isFormatMigrated bool
 }
 
-func NewLinearProbeHashTable(bpm *buffer.BufferPoolManager, numBuckets int, headerPageId types.PageID) *LinearProbeHashTable {
+// numBuckets is initial number of buckets and it is rounded up to power of 2
+func NewLinearProbeHashTable(bpm *buffer.BufferPoolManager, log_manager *recovery.LogManager, numBuckets int, headerPageId types.PageID) *LinearProbeHashTable {
 	if headerPageId == types.InvalidPageID {
 		header := bpm.NewPage()
-		headerData := header.Data()
-		headerPage := (*page.HashTableHeaderPage)(unsafe.Pointer(headerData))
-
+		headerPage := (*page.HashTableHeaderPage)(unsafe.Pointer(&header.Data()[0]))
 		headerPage.SetPageId(header.ID())
-		headerPage.SetSize(numBuckets * page.BlockArraySize)
-
-		for i := 0; i < numBuckets; i++ {
-			np := bpm.NewPage()
-			headerPage.AddBlockPageId(np.ID())
-			bpm.UnpinPage(np.ID(), true)
-		}
-		bpm.UnpinPage(header.ID(), true)
 
-		// on current not expandable HashTable impl
-		// flush of header page is needed only creating time
-		// because, content of header page is changed only creatting time
-		bpm.FlushPage(header.ID())
+		ht := &LinearProbeHashTable{header.ID(), bpm, log_manager, common.NewRWLatch(), false}
+		ht.initialize(headerPage, numBuckets)
 
-		return &LinearProbeHashTable{header.ID(), bpm, common.NewRWLatch()}
+		return ht
 	} else {
 		header := bpm.FetchPage(headerPageId)
-		bpm.UnpinPage(header.ID(), true)
+		headerPage := (*page.HashTableHeaderPage)(unsafe.Pointer(&header.Data()[0]))
+
+		ht := &LinearProbeHashTable{header.ID(), bpm, log_manager, common.NewRWLatch(), false}
+		if headerPage.GetFormatVersion() != page.HashTableFormatVersion {
+			// values in pages of old format can't be read correctly.
+			// so the table is initialized again with header page and entries
+			// should be inserted again by caller (see IsFormatMigrated)
+			headerPage.Reset()
+			ht.initialize(headerPage, 1)
+			ht.isFormatMigrated = true
+		} else {
+			bpm.UnpinPage(header.ID(), true)
+		}
+
+		return ht
+	}
+}
+
+// allocates directory and bucket pages. header page must be pinned and it is unpinned in this method
+func (ht *LinearProbeHashTable) initialize(headerPage *page.HashTableHeaderPage, numBuckets int) {
+	headerPage.SetLSN(common.InvalidLSN)
+	headerPage.SetFormatVersion(page.HashTableFormatVersion)
+	globalDepth := uint32(0)
+	for (1<<globalDepth) < numBuckets && globalDepth < page.HashTableMaxGlobalDepth {
+		globalDepth++
+	}
+	headerPage.SetGlobalDepth(globalDepth)
 
-		return &LinearProbeHashTable{header.ID(), bpm, common.NewRWLatch()}
+	// buffer pool is not expected to be exhausted at creation of the table
+	if err := ht.allocateDirectoryPages(headerPage, headerPage.GetDirectorySize()); err != nil {
+		panic("directory pages of hash table can not be allocated")
+	}
+
+	for i := uint32(0); i < headerPage.GetDirectorySize(); i++ {
+		np := ht.newBucketPage(globalDepth)
+		if np == nil {
+			panic("bucket pages of hash table can not be allocated")
+		}
+		if _, err := ht.setBucketPageId(headerPage, i, np.ID()); err != nil {
+			panic("directory page of hash table can not be pinned")
+		}
+		ht.bpm.UnpinPage(np.ID(), true)
+		// block pages are written to disk at creation time
+		// because redo of hash index operations fetches these pages
+		ht.bpm.FlushPage(np.ID())
+	}
+	for i := uint32(0); i < headerPage.NumDirectoryPages(); i++ {
+		ht.bpm.FlushPage(headerPage.GetDirectoryPageId(i))
 	}
+	ht.bpm.UnpinPage(ht.headerPageId, true)
+
+	// header and directory pages are not logged
+	// so these are written to disk at creation time and at each bucket split
+	ht.bpm.FlushPage(ht.headerPageId)
+}
+
+// returns true when the table was written in old on-disk format and it was initialized
+// at opening. in this case, caller should insert all entries again
+func (ht *LinearProbeHashTable) IsFormatMigrated() bool {
+	return ht.isFormatMigrated
+}
+
+func (ht *LinearProbeHashTable) GetValue(key []byte) []uint64 {
+	ret, _ := ht.GetValueWithErr(key)
+	return ret
 }
 
-func (ht *LinearProbeHashTable) GetValue(key []byte) []uint32 {
+// GetValueWithErr is same as GetValue but buffer.ErrBufferPoolExhausted is returned
+// when pages of the table can not be pinned
+func (ht *LinearProbeHashTable) GetValueWithErr(key []byte) ([]uint64, error) {
 	ht.table_latch.RLock()
 	defer ht.table_latch.RUnlock()
-	hPageData := ht.bpm.FetchPage(ht.headerPageId).Data()
-	headerPage := (*page.HashTableHeaderPage)(unsafe.Pointer(hPageData))
 
 	hash := ht.hash(key)
 
-	originalBucketIndex := hash % headerPage.NumBlocks()
-	originalBucketOffset := hash % page.BlockArraySize
-
-	iterator := newHashTableIterator(ht.bpm, headerPage, originalBucketIndex, originalBucketOffset)
+	blockPageId, blockPage := ht.fetchBucketPage(hash)
+	if blockPage == nil {
+		return nil, buffer.ErrBufferPoolExhausted
+	}
 
-	result := []uint32{}
-	blockPage, offset := iterator.blockPage, iterator.offset
-	var bucket uint32
-	for blockPage.IsOccupied(offset) { // stop the search and we find an empty spot
-		if blockPage.IsReadable(offset) && blockPage.KeyAt(offset) == hash {
-			result = append(result, blockPage.ValueAt(offset))
+	result := []uint64{}
+	for {
+		for ii := uint32(0); ii < page.BlockArraySize; ii++ {
+			offset := (hash%page.BlockArraySize + ii) % page.BlockArraySize
+			if !blockPage.IsOccupied(offset) {
+				// stop the search and we find an empty spot
+				break
+			}
+			// hash is used as fingerprint and original key is checked only when it matches
+			if blockPage.IsReadable(offset) && blockPage.KeyAt(offset) == hash {
+				isSame, err := ht.isSameKey(blockPage.PairAt(offset), key)
+				if err != nil {
+					ht.bpm.UnpinPage(blockPageId, false)
+					return nil, err
+				}
+				if isSame {
+					result = append(result, blockPage.ValueAt(offset))
+				}
+			}
 		}
 
-		iterator.next()
-		blockPage, bucket, offset = iterator.blockPage, iterator.bucket, iterator.offset
-		if bucket == originalBucketIndex && offset == originalBucketOffset {
+		nextPageId := blockPage.GetNextBucketPageId()
+		ht.bpm.UnpinPage(blockPageId, false)
+		if nextPageId == types.InvalidPageID {
 			break
 		}
+		blockPageId, blockPage = nextPageId, ht.fetchBlockPage(nextPageId)
+		if blockPage == nil {
+			return nil, buffer.ErrBufferPoolExhausted
+		}
 	}
 
-	ht.bpm.UnpinPage(iterator.blockId, true)
-	ht.bpm.UnpinPage(ht.headerPageId, false)
-
-	return result
+	return result, nil
 }
 
-func (ht *LinearProbeHashTable) Insert(key []byte, value uint32) (err error) {
+func (ht *LinearProbeHashTable) Insert(key []byte, value uint64, txn *access.Transaction) (err error) {
 	ht.table_latch.WLock()
 	defer ht.table_latch.WUnlock()
-	hPageData := ht.bpm.FetchPage(ht.headerPageId).Data()
-	headerPage := (*page.HashTableHeaderPage)(unsafe.Pointer(hPageData))
+
+	return ht.insertKey(key, value, txn)
+}
+
+func (ht *LinearProbeHashTable) insertKey(key []byte, value uint64, txn *access.Transaction) (err error) {
+	if len(key) > page.OverflowPageDataSize {
+		return errors.New("key is too long")
+	}
 
 	hash := ht.hash(key)
+	for {
+		blockPageId, blockPage := ht.fetchBucketPage(hash)
+		if blockPage == nil {
+			return buffer.ErrBufferPoolExhausted
+		}
+		localDepth := blockPage.GetLocalDepth()
+
+		// search duplicated entry and free slot (empty or deleted marked one) on all pages of the bucket.
+		// page which has the free slot is kept pinned
+		freePageId := types.InvalidPageID
+		var freePage *page.HashTableBlockPage = nil
+		freeOffset := -1
+		// when no free slot is found, all slots of first page are visited. so counts are valid in that case
+		hashCounts := make(map[uint32]int)
+		// new chained page for a hash is placed next to this page for keeping pages of same hash together
+		lastChainPageIds := make(map[uint32]types.PageID)
+		isFirstPage := true
+		for {
+			// entries of other hash can't be stored on chained page
+			isStorable := isFirstPage
+			if !isFirstPage {
+				chainHash, ok := getChainHash(blockPage)
+				isStorable = !ok || chainHash == hash
+				if ok {
+					lastChainPageIds[chainHash] = blockPageId
+				}
+			}
+			for ii := uint32(0); ii < page.BlockArraySize; ii++ {
+				offset := (hash%page.BlockArraySize + ii) % page.BlockArraySize
+				if !blockPage.IsOccupied(offset) {
+					if isStorable && freeOffset < 0 {
+						freePageId, freePage, freeOffset = blockPageId, blockPage, int(offset)
+					}
+					break
+				}
+				if blockPage.IsReadable(offset) {
+					if isFirstPage {
+						hashCounts[blockPage.KeyAt(offset)]++
+					}
+					if blockPage.KeyAt(offset) == hash && blockPage.ValueAt(offset) == value {
+						isSame, err := ht.isSameKey(blockPage.PairAt(offset), key)
+						if err == nil && isSame {
+							err = errors.New("duplicated values on the same key are not allowed")
+						}
+						if err != nil {
+							ht.bpm.UnpinPage(blockPageId, false)
+							if freePage != nil && freePageId != blockPageId {
+								ht.bpm.UnpinPage(freePageId, false)
+							}
+							return err
+						}
+					}
+				} else if isStorable && freeOffset < 0 {
+					freePageId, freePage, freeOffset = blockPageId, blockPage, int(offset)
+				}
+			}
+
+			nextPageId := blockPage.GetNextBucketPageId()
+			if freePageId != blockPageId {
+				ht.bpm.UnpinPage(blockPageId, false)
+			}
+			if nextPageId == types.InvalidPageID {
+				break
+			}
+			blockPageId, blockPage = nextPageId, ht.fetchBlockPage(nextPageId)
+			if blockPage == nil {
+				if freePage != nil {
+					ht.bpm.UnpinPage(freePageId, false)
+				}
+				return buffer.ErrBufferPoolExhausted
+			}
+			isFirstPage = false
+		}
+
+		if freeOffset >= 0 {
+			return ht.insertToSlot(freePageId, freePage, uint32(freeOffset), hash, key, value, txn)
+		}
+
+		// bucket is full
+		maxCountHash, maxCount := uint32(0), 0
+		for keyHash, count := range hashCounts {
+			if count > maxCount {
+				maxCountHash, maxCount = keyHash, count
+			}
+		}
+		if maxCount > page.BlockArraySize/2 || localDepth >= page.HashTableMaxGlobalDepth {
+			// split can not separate the entries. so these are moved to chained page
+			prevPageId, ok := lastChainPageIds[maxCountHash]
+			if !ok {
+				prevPageId = types.InvalidPageID
+			}
+			ht.bpm.BeginStructureModification()
+			err := ht.moveToChainedPage(hash, maxCountHash, prevPageId)
+			ht.bpm.EndStructureModification()
+			if err != nil {
+				return err
+			}
+		} else {
+			ht.bpm.BeginStructureModification()
+			err := ht.splitBucket(hash)
+			ht.bpm.EndStructureModification()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// inserts entry to the free slot of pinned block page. the page is unpinned in this method
+func (ht *LinearProbeHashTable) insertToSlot(blockPageId types.PageID, blockPage *page.HashTableBlockPage, offset uint32, hash uint32, key []byte, value uint64, txn *access.Transaction) error {
+	overflowPageId := types.InvalidPageID
+	overflowOffset := uint32(0)
+	if len(key) > page.HashTableInlineKeySize {
+		overflowPageId, overflowOffset = ht.reserveOverflowSpace(blockPage, uint32(len(key)))
+		if overflowPageId == types.InvalidPageID {
+			ht.bpm.UnpinPage(blockPageId, true)
+			return buffer.ErrBufferPoolExhausted
+		}
+	}
+	// overflow page is pinned before logging because the operation can't be cancelled after that
+	var overflowPage *page.HashTableOverflowPage = nil
+	if overflowPageId != types.InvalidPageID {
+		pg := ht.bpm.FetchPage(overflowPageId)
+		if pg == nil {
+			ht.bpm.UnpinPage(blockPageId, true)
+			return buffer.ErrBufferPoolExhausted
+		}
+		overflowPage = (*page.HashTableOverflowPage)(unsafe.Pointer(&pg.Data()[0]))
+	}
+	pair := page.NewHashTablePair(hash, value, key, overflowPageId, overflowOffset)
+	lsn := ht.writeLog(recovery.HASH_TABLE_INSERT, blockPageId, offset, pair, key, txn)
+	if overflowPage != nil {
+		overflowPage.WriteKey(overflowOffset, key)
+		if lsn != common.InvalidLSN {
+			overflowPage.SetLSN(lsn)
+		}
+		ht.bpm.UnpinPage(overflowPageId, true)
+	}
+	blockPage.Insert(offset, pair)
+	if lsn != common.InvalidLSN {
+		// LSN is updated after modification because page may be flushed concurrently by checkpointing
+		blockPage.SetLSN(lsn)
+	}
+	ht.bpm.UnpinPage(blockPageId, true)
+	return nil
+}
+
+func (ht *LinearProbeHashTable) Remove(key []byte, value uint64, txn *access.Transaction) error {
+	ht.table_latch.WLock()
+	defer ht.table_latch.WUnlock()
 
-	originalBucketIndex := hash % headerPage.NumBlocks()
-	originalBucketOffset := hash % page.BlockArraySize
+	return ht.removeKey(key, value, txn)
+}
 
-	iterator := newHashTableIterator(ht.bpm, headerPage, originalBucketIndex, originalBucketOffset)
+func (ht *LinearProbeHashTable) removeKey(key []byte, value uint64, txn *access.Transaction) error {
+	hash := ht.hash(key)
+	blockPageId, blockPage := ht.fetchBucketPage(hash)
+	if blockPage == nil {
+		return buffer.ErrBufferPoolExhausted
+	}
 
-	blockPage, offset := iterator.blockPage, iterator.offset
-	var bucket uint32
 	for {
-		if blockPage.IsOccupied(offset) && blockPage.IsReadable(offset) && blockPage.ValueAt(offset) == value {
-			err = errors.New("duplicated values on the same key are not allowed")
-			break
+		isRemoved := false
+		for ii := uint32(0); ii < page.BlockArraySize; ii++ {
+			offset := (hash%page.BlockArraySize + ii) % page.BlockArraySize
+			if !blockPage.IsOccupied(offset) {
+				// stop the search and we find an empty spot
+				break
+			}
+			if blockPage.IsReadable(offset) && blockPage.KeyAt(offset) == hash && blockPage.ValueAt(offset) == value {
+				isSame, err := ht.isSameKey(blockPage.PairAt(offset), key)
+				if err != nil {
+					ht.bpm.UnpinPage(blockPageId, isRemoved)
+					return err
+				}
+				if !isSame {
+					continue
+				}
+				lsn := ht.writeLog(recovery.HASH_TABLE_REMOVE, blockPageId, offset, blockPage.PairAt(offset), key, txn)
+				blockPage.Remove(offset)
+				if lsn != common.InvalidLSN {
+					blockPage.SetLSN(lsn)
+				}
+				isRemoved = true
+			}
 		}
 
-		// insert to deleted marked slot
-		if blockPage.IsOccupied(offset) && !blockPage.IsReadable(offset) {
-			blockPage.Insert(offset, hash, value)
-			err = nil
-			break
+		nextPageId := blockPage.GetNextBucketPageId()
+		ht.bpm.UnpinPage(blockPageId, isRemoved)
+		if nextPageId == types.InvalidPageID {
+			return nil
 		}
+		blockPageId, blockPage = nextPageId, ht.fetchBlockPage(nextPageId)
+		if blockPage == nil {
+			return buffer.ErrBufferPoolExhausted
+		}
+	}
+}
 
-		if !blockPage.IsOccupied(offset) {
-			blockPage.Insert(offset, hash, value)
-			err = nil
-			break
+// checks whether pair is entry of key. key data on overflow page is read if needed
+// (buffer.ErrBufferPoolExhausted is returned when the overflow page can not be pinned)
+func (ht *LinearProbeHashTable) isSameKey(pair page.HashTablePair, key []byte) (bool, error) {
+	if pair.GetKeyLen() != uint32(len(key)) {
+		return false, nil
+	}
+	if pair.IsInlineKey() {
+		return pair.IsSameInlineKey(key), nil
+	}
+
+	overflowPageId, overflowOffset := pair.GetOverflowLocation()
+	pg := ht.bpm.FetchPage(overflowPageId)
+	if pg == nil {
+		return false, buffer.ErrBufferPoolExhausted
+	}
+	overflowPage := (*page.HashTableOverflowPage)(unsafe.Pointer(&pg.Data()[0]))
+	ret := bytes.Equal(overflowPage.ReadKey(overflowOffset, pair.GetKeyLen()), key)
+	ht.bpm.UnpinPage(overflowPageId, false)
+	return ret, nil
+}
+
+// returns location on overflow page of the bucket where a key of keyLen bytes can be written.
+// when current overflow page does not have enough space, new overflow page is chained.
+// InvalidPageID is returned when overflow page can not be pinned or allocated.
+// caller must hold write lock of table_latch
+func (ht *LinearProbeHashTable) reserveOverflowSpace(blockPage *page.HashTableBlockPage, keyLen uint32) (types.PageID, uint32) {
+	overflowPageId := blockPage.GetOverflowPageId()
+	if overflowPageId != types.InvalidPageID {
+		pg := ht.bpm.FetchPage(overflowPageId)
+		if pg == nil {
+			return types.InvalidPageID, 0
+		}
+		overflowPage := (*page.HashTableOverflowPage)(unsafe.Pointer(&pg.Data()[0]))
+		freeSpacePointer := overflowPage.GetFreeSpacePointer()
+		hasSpace := overflowPage.GetFreeSpaceRemaining() >= keyLen
+		ht.bpm.UnpinPage(overflowPageId, false)
+		if hasSpace {
+			return overflowPageId, freeSpacePointer
 		}
-		iterator.next()
+	}
 
-		blockPage, bucket, offset = iterator.blockPage, iterator.bucket, iterator.offset
-		if bucket == originalBucketIndex && offset == originalBucketOffset {
-			break
+	np := ht.bpm.NewPage()
+	if np == nil {
+		return types.InvalidPageID, 0
+	}
+	newOverflowPage := (*page.HashTableOverflowPage)(unsafe.Pointer(&np.Data()[0]))
+	newOverflowPage.SetPageId(np.ID())
+	newOverflowPage.SetLSN(common.InvalidLSN)
+	newOverflowPage.SetNextPageId(overflowPageId)
+	newOverflowPage.SetFreeSpacePointer(0)
+	blockPage.SetOverflowPageId(np.ID())
+
+	// chaining of overflow page is not logged as bucket split is not.
+	// so LSN of these pages are set to persistent LSN and these are written to disk
+	// before the key is written (see comment in splitBucket)
+	if ht.log_manager != nil && ht.log_manager.IsEnabledLogging() {
+		ht.log_manager.Flush()
+		blockPage.SetLSN(ht.log_manager.GetPersistentLSN())
+	}
+	newOverflowPage.SetLSN(blockPage.GetLSN())
+	ht.bpm.UnpinPage(np.ID(), true)
+	ht.bpm.FlushPage(np.ID())
+	// pin count is decremented on FlushPage, so block page is pinned additionally beforehand
+	ht.bpm.FetchPage(blockPage.GetPageId())
+	ht.bpm.FlushPage(blockPage.GetPageId())
+
+	return np.ID(), 0
+}
+
+// split the bucket which hash belongs to. directory is doubled if local depth of the bucket equals global depth.
+// pages which are needed for the split are allocated and pinned before modification of the table,
+// so the table is not changed when an error is returned.
+// caller must hold write lock of table_latch and call bpm.BeginStructureModification
+func (ht *LinearProbeHashTable) splitBucket(hash uint32) error {
+	headerPage := ht.fetchHeaderPage()
+	if headerPage == nil {
+		return buffer.ErrBufferPoolExhausted
+	}
+	// pages which are pinned in this method. on error, these are unpinned
+	// and the page allocated for new bucket is deallocated
+	pinnedPageIds := []types.PageID{ht.headerPageId}
+	newPageId := types.InvalidPageID
+	abort := func(err error) error {
+		for _, pageId := range pinnedPageIds {
+			// directory pages may be added to header page
+			ht.bpm.UnpinPage(pageId, pageId == ht.headerPageId)
+		}
+		if newPageId != types.InvalidPageID {
+			ht.bpm.DeletePage(newPageId)
+		}
+		return err
+	}
+
+	bucketIdx := hash & (headerPage.GetDirectorySize() - 1)
+	oldPageId := ht.getBucketPageId(headerPage, bucketIdx)
+	var oldPage *page.HashTableBlockPage = nil
+	if oldPageId != types.InvalidPageID {
+		oldPage = ht.fetchBlockPage(oldPageId)
+	}
+	if oldPage == nil {
+		return abort(buffer.ErrBufferPoolExhausted)
+	}
+	pinnedPageIds = append(pinnedPageIds, oldPageId)
+	localDepth := oldPage.GetLocalDepth()
+
+	oldSize := headerPage.GetDirectorySize()
+	newSize := oldSize
+	if localDepth == headerPage.GetGlobalDepth() {
+		if headerPage.GetGlobalDepth() >= page.HashTableMaxGlobalDepth {
+			return abort(errors.New("hash table can not be extended any more"))
+		}
+		newSize = oldSize * 2
+	}
+
+	// directory pages which are added here and entries of new half of directory
+	// are not referred until global depth is updated. so errors on doubling leave the table valid
+	if err := ht.allocateDirectoryPages(headerPage, newSize); err != nil {
+		return abort(err)
+	}
+	dirtyDirPageIds := make(map[types.PageID]bool)
+	for ii := oldSize; ii < newSize; ii++ {
+		// new half of entries point same buckets with old half
+		bucketPageId := ht.getBucketPageId(headerPage, ii-oldSize)
+		if bucketPageId == types.InvalidPageID {
+			return abort(buffer.ErrBufferPoolExhausted)
+		}
+		dirPageId, err := ht.setBucketPageId(headerPage, ii, bucketPageId)
+		if err != nil {
+			return abort(err)
+		}
+		dirtyDirPageIds[dirPageId] = true
+	}
+
+	// directory pages which have entries pointing new bucket are pinned beforehand
+	splitBit := uint32(1) << localDepth
+	dirPages := make(map[types.PageID]*page.HashTableDirectoryPage)
+	for ii := (bucketIdx & (splitBit - 1)) | splitBit; ii < newSize; ii += splitBit << 1 {
+		dirPageId := headerPage.GetDirectoryPageId(ii / page.DirectoryArraySize)
+		if _, ok := dirPages[dirPageId]; ok {
+			continue
+		}
+		pg := ht.bpm.FetchPage(dirPageId)
+		if pg == nil {
+			return abort(buffer.ErrBufferPoolExhausted)
+		}
+		pinnedPageIds = append(pinnedPageIds, dirPageId)
+		dirPages[dirPageId] = (*page.HashTableDirectoryPage)(unsafe.Pointer(&pg.Data()[0]))
+	}
+
+	// chained pages are divided into two chains with hash of their entries.
+	// only pages whose next page is changed are pinned and modified
+	chainPageIds := make([]types.PageID, 0)
+	isMovedPage := make(map[types.PageID]bool)
+	for pageId := oldPage.GetNextBucketPageId(); pageId != types.InvalidPageID; {
+		blockPage := ht.fetchBlockPage(pageId)
+		if blockPage == nil {
+			return abort(buffer.ErrBufferPoolExhausted)
+		}
+		chainHash, ok := getChainHash(blockPage)
+		chainPageIds = append(chainPageIds, pageId)
+		isMovedPage[pageId] = ok && chainHash&splitBit != 0
+		nextPageId := blockPage.GetNextBucketPageId()
+		ht.bpm.UnpinPage(pageId, false)
+		pageId = nextPageId
+	}
+	oldChainHeadId, newChainHeadId := types.InvalidPageID, types.InvalidPageID
+	newNextPageIds := make(map[types.PageID]types.PageID)
+	for ii := len(chainPageIds) - 1; ii >= 0; ii-- {
+		pageId := chainPageIds[ii]
+		if isMovedPage[pageId] {
+			newNextPageIds[pageId] = newChainHeadId
+			newChainHeadId = pageId
+		} else {
+			newNextPageIds[pageId] = oldChainHeadId
+			oldChainHeadId = pageId
 		}
 	}
+	relinkedPages := make(map[types.PageID]*page.HashTableBlockPage)
+	for ii, pageId := range chainPageIds {
+		nextPageId := types.InvalidPageID
+		if ii+1 < len(chainPageIds) {
+			nextPageId = chainPageIds[ii+1]
+		}
+		if newNextPageIds[pageId] == nextPageId {
+			continue
+		}
+		blockPage := ht.fetchBlockPage(pageId)
+		if blockPage == nil {
+			return abort(buffer.ErrBufferPoolExhausted)
+		}
+		pinnedPageIds = append(pinnedPageIds, pageId)
+		relinkedPages[pageId] = blockPage
+	}
+
+	newPage := ht.newBucketPage(localDepth + 1)
+	if newPage == nil {
+		return abort(buffer.ErrBufferPoolExhausted)
+	}
+	newPageId = newPage.ID()
+	pinnedPageIds = append(pinnedPageIds, newPageId)
+	newBlockPage := (*page.HashTableBlockPage)(unsafe.Pointer(&newPage.Data()[0]))
+
+	// from here, the table is modified and no error occurs
+	if newSize != oldSize {
+		headerPage.SetGlobalDepth(headerPage.GetGlobalDepth() + 1)
+	}
+	oldPage.SetLocalDepth(localDepth + 1)
+
+	// redistribute entries with a bit of hash which is newly used
+	// (deleted marked entries are dropped)
+	// key data on overflow pages of old bucket is not moved. moved entries keep pointing it
+	pairs := make([]page.HashTablePair, 0)
+	for ii := uint32(0); ii < page.BlockArraySize; ii++ {
+		if oldPage.IsReadable(ii) {
+			pairs = append(pairs, oldPage.PairAt(ii))
+		}
+	}
+	oldPage.Reset()
+	for _, pair := range pairs {
+		if pair.GetKey()&splitBit == 0 {
+			insertToFreeSlot(oldPage, pair)
+		} else {
+			insertToFreeSlot(newBlockPage, pair)
+		}
+	}
+	oldPage.SetNextBucketPageId(oldChainHeadId)
+	newBlockPage.SetNextBucketPageId(newChainHeadId)
+	for pageId, blockPage := range relinkedPages {
+		blockPage.SetNextBucketPageId(newNextPageIds[pageId])
+	}
+
+	// update directory entries which pointed the old bucket
+	for ii := (bucketIdx & (splitBit - 1)) | splitBit; ii < newSize; ii += splitBit << 1 {
+		dirPageId := headerPage.GetDirectoryPageId(ii / page.DirectoryArraySize)
+		dirPages[dirPageId].SetBucketPageId(ii%page.DirectoryArraySize, newPageId)
+		dirtyDirPageIds[dirPageId] = true
+	}
+
+	// offsets of entries are changed without logging, so log records of previous operations
+	// must not be applied to these pages at redo. for that, LSN of these pages
+	// are set to persistent LSN and pages are written to disk before releasing table_latch
+	if ht.log_manager != nil && ht.log_manager.IsEnabledLogging() {
+		ht.log_manager.Flush()
+		oldPage.SetLSN(ht.log_manager.GetPersistentLSN())
+	}
+	newBlockPage.SetLSN(oldPage.GetLSN())
+	for _, blockPage := range relinkedPages {
+		blockPage.SetLSN(oldPage.GetLSN())
+	}
+
+	for _, pageId := range pinnedPageIds {
+		ht.bpm.UnpinPage(pageId, true)
+	}
+
+	// write order is considered for keeping index data valid when system crash occurs during this sequence
+	ht.bpm.FlushPage(newPageId)
+	for dirPageId, _ := range dirtyDirPageIds {
+		ht.bpm.FlushPage(dirPageId)
+	}
+	ht.bpm.FlushPage(ht.headerPageId)
+	for pageId, _ := range relinkedPages {
+		ht.bpm.FlushPage(pageId)
+	}
+	ht.bpm.FlushPage(oldPageId)
+
+	return nil
+}
+
+// moves entries of chainHash on first page of the bucket which hash belongs to
+// to new block page which is chained next to prevPageId (InvalidPageID means first page).
+// this is used when entries of the bucket can not be separated by split.
+// local depth of chained page is not used.
+// caller must hold write lock of table_latch and call bpm.BeginStructureModification
+func (ht *LinearProbeHashTable) moveToChainedPage(hash uint32, chainHash uint32, prevPageId types.PageID) error {
+	blockPageId, blockPage := ht.fetchBucketPage(hash)
+	if blockPage == nil {
+		return buffer.ErrBufferPoolExhausted
+	}
+	if prevPageId == types.InvalidPageID {
+		prevPageId = blockPageId
+	}
+	prevPage := blockPage
+	if prevPageId != blockPageId {
+		prevPage = ht.fetchBlockPage(prevPageId)
+		if prevPage == nil {
+			ht.bpm.UnpinPage(blockPageId, false)
+			return buffer.ErrBufferPoolExhausted
+		}
+	}
+	np := ht.newBucketPage(blockPage.GetLocalDepth())
+	if np == nil {
+		if prevPageId != blockPageId {
+			ht.bpm.UnpinPage(prevPageId, false)
+		}
+		ht.bpm.UnpinPage(blockPageId, false)
+		return buffer.ErrBufferPoolExhausted
+	}
+	newPageId := np.ID()
+	newBlockPage := (*page.HashTableBlockPage)(unsafe.Pointer(&np.Data()[0]))
+
+	// remaining entries are stored again for keeping probing sequences valid
+	// (deleted marked entries are dropped)
+	pairs := make([]page.HashTablePair, 0)
+	for ii := uint32(0); ii < page.BlockArraySize; ii++ {
+		if blockPage.IsReadable(ii) {
+			pairs = append(pairs, blockPage.PairAt(ii))
+		}
+	}
+	blockPage.Reset()
+	for _, pair := range pairs {
+		if pair.GetKey() == chainHash {
+			insertToFreeSlot(newBlockPage, pair)
+		} else {
+			insertToFreeSlot(blockPage, pair)
+		}
+	}
+	newBlockPage.SetNextBucketPageId(prevPage.GetNextBucketPageId())
+	prevPage.SetNextBucketPageId(newPageId)
+
+	// moving entries is not logged as bucket split is not (see comment in splitBucket)
+	if ht.log_manager != nil && ht.log_manager.IsEnabledLogging() {
+		ht.log_manager.Flush()
+		blockPage.SetLSN(ht.log_manager.GetPersistentLSN())
+	}
+	newBlockPage.SetLSN(blockPage.GetLSN())
+	prevPage.SetLSN(blockPage.GetLSN())
+
+	ht.bpm.UnpinPage(newPageId, true)
+	if prevPageId != blockPageId {
+		ht.bpm.UnpinPage(prevPageId, true)
+	}
+	ht.bpm.UnpinPage(blockPageId, true)
+
+	// write order is considered for keeping index data valid when system crash occurs during this sequence
+	ht.bpm.FlushPage(newPageId)
+	if prevPageId != blockPageId {
+		ht.bpm.FlushPage(prevPageId)
+	}
+	ht.bpm.FlushPage(blockPageId)
+
+	return nil
+}
+
+// returns hash of entries on chained block page. false is returned when the page has no entry
+func getChainHash(blockPage *page.HashTableBlockPage) (uint32, bool) {
+	for ii := uint32(0); ii < page.BlockArraySize; ii++ {
+		if blockPage.IsOccupied(ii) {
+			return blockPage.KeyAt(ii), true
+		}
+	}
+	return 0, false
+}
+
+// insert a entry to a free slot which is found with linear probing. bucket must not be full
+func insertToFreeSlot(blockPage *page.HashTableBlockPage, pair page.HashTablePair) {
+	for ii := uint32(0); ii < page.BlockArraySize; ii++ {
+		offset := (pair.GetKey()%page.BlockArraySize + ii) % page.BlockArraySize
+		if !blockPage.IsReadable(offset) {
+			blockPage.Insert(offset, pair)
+			return
+		}
+	}
+	panic("bucket is full!")
+}
+
+// returns pinned header page (nil when buffer pool is exhausted)
+func (ht *LinearProbeHashTable) fetchHeaderPage() *page.HashTableHeaderPage {
+	pg := ht.bpm.FetchPage(ht.headerPageId)
+	if pg == nil {
+		return nil
+	}
+	return (*page.HashTableHeaderPage)(unsafe.Pointer(&pg.Data()[0]))
+}
 
-	ht.bpm.UnpinPage(iterator.blockId, true)
+// returns pinned bucket page which hash belongs to (nil when buffer pool is exhausted)
+func (ht *LinearProbeHashTable) fetchBucketPage(hash uint32) (types.PageID, *page.HashTableBlockPage) {
+	headerPage := ht.fetchHeaderPage()
+	if headerPage == nil {
+		return types.InvalidPageID, nil
+	}
+	blockPageId := ht.getBucketPageId(headerPage, hash&(headerPage.GetDirectorySize()-1))
 	ht.bpm.UnpinPage(ht.headerPageId, false)
+	if blockPageId == types.InvalidPageID {
+		return types.InvalidPageID, nil
+	}
+
+	pg := ht.bpm.FetchPage(blockPageId)
+	if pg == nil {
+		return types.InvalidPageID, nil
+	}
+	blockPage := (*page.HashTableBlockPage)(unsafe.Pointer(&pg.Data()[0]))
+	return blockPageId, blockPage
+}
+
+// returns pinned block page (nil when buffer pool is exhausted)
+func (ht *LinearProbeHashTable) fetchBlockPage(blockPageId types.PageID) *page.HashTableBlockPage {
+	pg := ht.bpm.FetchPage(blockPageId)
+	if pg == nil {
+		return nil
+	}
+	return (*page.HashTableBlockPage)(unsafe.Pointer(&pg.Data()[0]))
+}
+
+// returns InvalidPageID when directory page can not be pinned
+func (ht *LinearProbeHashTable) getBucketPageId(headerPage *page.HashTableHeaderPage, bucketIdx uint32) types.PageID {
+	dirPageId := headerPage.GetDirectoryPageId(bucketIdx / page.DirectoryArraySize)
+	pg := ht.bpm.FetchPage(dirPageId)
+	if pg == nil {
+		return types.InvalidPageID
+	}
+	dirPage := (*page.HashTableDirectoryPage)(unsafe.Pointer(&pg.Data()[0]))
+	ret := dirPage.GetBucketPageId(bucketIdx % page.DirectoryArraySize)
+	ht.bpm.UnpinPage(dirPageId, false)
+	return ret
+}
+
+// returns page id of updated directory page
+// (buffer.ErrBufferPoolExhausted is returned when the directory page can not be pinned)
+func (ht *LinearProbeHashTable) setBucketPageId(headerPage *page.HashTableHeaderPage, bucketIdx uint32, bucketPageId types.PageID) (types.PageID, error) {
+	dirPageId := headerPage.GetDirectoryPageId(bucketIdx / page.DirectoryArraySize)
+	pg := ht.bpm.FetchPage(dirPageId)
+	if pg == nil {
+		return types.InvalidPageID, buffer.ErrBufferPoolExhausted
+	}
+	dirPage := (*page.HashTableDirectoryPage)(unsafe.Pointer(&pg.Data()[0]))
+	dirPage.SetBucketPageId(bucketIdx%page.DirectoryArraySize, bucketPageId)
+	ht.bpm.UnpinPage(dirPageId, true)
+	return dirPageId, nil
+}
 
-	return
+// allocate directory pages until these can store dirSize entries of directory
+// (buffer.ErrBufferPoolExhausted is returned when new page can not be allocated)
+func (ht *LinearProbeHashTable) allocateDirectoryPages(headerPage *page.HashTableHeaderPage, dirSize uint32) error {
+	for headerPage.NumDirectoryPages()*page.DirectoryArraySize < dirSize {
+		np := ht.bpm.NewPage()
+		if np == nil {
+			return buffer.ErrBufferPoolExhausted
+		}
+		dirPage := (*page.HashTableDirectoryPage)(unsafe.Pointer(&np.Data()[0]))
+		dirPage.SetPageId(np.ID())
+		dirPage.SetLSN(common.InvalidLSN)
+		headerPage.AddDirectoryPageId(np.ID())
+		ht.bpm.UnpinPage(np.ID(), true)
+	}
+	return nil
 }
 
-func (ht *LinearProbeHashTable) Remove(key []byte, value uint32) {
+// returns pinned new bucket page
+func (ht *LinearProbeHashTable) newBucketPage(localDepth uint32) *page.Page {
+	np := ht.bpm.NewPage()
+	if np == nil {
+		return nil
+	}
+	blockPage := (*page.HashTableBlockPage)(unsafe.Pointer(&np.Data()[0]))
+	blockPage.SetPageId(np.ID())
+	blockPage.SetLSN(common.InvalidLSN)
+	blockPage.SetLocalDepth(localDepth)
+	blockPage.SetOverflowPageId(types.InvalidPageID)
+	blockPage.SetNextBucketPageId(types.InvalidPageID)
+	return np
+}
+
+// write log record of operation to a slot of block page
+// returned value is LSN of the log record (InvalidLSN if logging is not done).
+// caller should set it to the block page after the modification
+// while txn is rolled back, the record is written as a CLR (also at undo phase of recovery)
+// caller must hold write lock of table_latch
+func (ht *LinearProbeHashTable) writeLog(log_record_type recovery.LogRecordType, blockPageId types.PageID,
+	offset uint32, pair page.HashTablePair, key []byte, txn *access.Transaction) types.LSN {
+	if ht.log_manager == nil || txn == nil ||
+		(!ht.log_manager.IsEnabledLogging() && txn.GetUndoNextLSN() == common.InvalidLSN) {
+		return common.InvalidLSN
+	}
+
+	overflowPageId := types.InvalidPageID
+	overflowOffset := uint32(0)
+	if !pair.IsInlineKey() {
+		overflowPageId, overflowOffset = pair.GetOverflowLocation()
+	}
+	log_record := recovery.NewLogRecordHashTable(txn.GetTransactionId(), txn.GetPrevLSN(), log_record_type,
+		ht.headerPageId, blockPageId, offset, pair.GetKey(), pair.GetValue(), overflowPageId, overflowOffset, key)
+	if txn.GetUndoNextLSN() != common.InvalidLSN {
+		log_record = recovery.NewLogRecordCLR(log_record, txn.GetUndoNextLSN())
+	}
+	lsn, err := ht.log_manager.AppendLogRecord(log_record)
+	common.SH_Assert(err == nil, "log record of hash table can't be appended")
+	txn.SetPrevLSN(lsn)
+	return lsn
+}
+
+// UndoInsert rollbacks a insertion which is recorded on a HASH_TABLE_INSERT log record.
+// this is used at undo phase of recovery. the removal is logged as a CLR of txn
+// (txn.GetUndoNextLSN() must be set) when txn is not nil.
+// buffer.ErrBufferPoolExhausted is returned when pages of the table can not be pinned
+func (ht *LinearProbeHashTable) UndoInsert(blockPageId types.PageID, offset uint32, key []byte, value uint64, txn *access.Transaction) error {
 	ht.table_latch.WLock()
 	defer ht.table_latch.WUnlock()
-	hPageData := ht.bpm.FetchPage(ht.headerPageId).Data()
-	headerPage := (*page.HashTableHeaderPage)(unsafe.Pointer(hPageData))
 
 	hash := ht.hash(key)
+	pg := ht.bpm.FetchPage(blockPageId)
+	if pg == nil {
+		return buffer.ErrBufferPoolExhausted
+	}
+	blockPage := (*page.HashTableBlockPage)(unsafe.Pointer(&pg.Data()[0]))
+	if blockPage.IsReadable(offset) && blockPage.KeyAt(offset) == hash && blockPage.ValueAt(offset) == value {
+		isSame, err := ht.isSameKey(blockPage.PairAt(offset), key)
+		if err != nil {
+			ht.bpm.UnpinPage(blockPageId, false)
+			return err
+		}
+		if isSame {
+			lsn := ht.writeLog(recovery.HASH_TABLE_REMOVE, blockPageId, offset, blockPage.PairAt(offset), key, txn)
+			blockPage.Remove(offset)
+			if lsn != common.InvalidLSN {
+				blockPage.SetLSN(lsn)
+			}
+			ht.bpm.UnpinPage(blockPageId, true)
+			return nil
+		}
+	}
+	ht.bpm.UnpinPage(blockPageId, false)
 
-	originalBucketIndex := hash % headerPage.NumBlocks()
-	originalBucketOffset := hash % page.BlockArraySize
+	// entry was moved by bucket split, so the entry is searched and removed
+	return ht.removeKey(key, value, txn)
+}
 
-	iterator := newHashTableIterator(ht.bpm, headerPage, originalBucketIndex, originalBucketOffset)
+// UndoRemove rollbacks a removal which is recorded on a HASH_TABLE_REMOVE log record.
+// this is used at undo phase of recovery. the insertion is logged as a CLR of txn
+// (txn.GetUndoNextLSN() must be set) when txn is not nil.
+// buffer.ErrBufferPoolExhausted is returned when pages of the table can not be pinned
+func (ht *LinearProbeHashTable) UndoRemove(blockPageId types.PageID, offset uint32, key []byte, value uint64, txn *access.Transaction) error {
+	ht.table_latch.WLock()
+	defer ht.table_latch.WUnlock()
 
-	blockPage, offset := iterator.blockPage, iterator.offset
-	var bucket uint32
-	for blockPage.IsOccupied(offset) { // stop the search and we find an empty spot
-		if blockPage.IsOccupied(offset) && blockPage.KeyAt(offset) == hash && blockPage.ValueAt(offset) == value {
-			blockPage.Remove(offset)
+	hash := ht.hash(key)
+	pg := ht.bpm.FetchPage(blockPageId)
+	if pg == nil {
+		return buffer.ErrBufferPoolExhausted
+	}
+	blockPage := (*page.HashTableBlockPage)(unsafe.Pointer(&pg.Data()[0]))
+	if blockPage.IsOccupied(offset) && !blockPage.IsReadable(offset) &&
+		blockPage.KeyAt(offset) == hash && blockPage.ValueAt(offset) == value {
+		isSame, err := ht.isSameKey(blockPage.PairAt(offset), key)
+		if err != nil {
+			ht.bpm.UnpinPage(blockPageId, false)
+			return err
 		}
-
-		iterator.next()
-		blockPage, bucket, offset = iterator.blockPage, iterator.bucket, iterator.offset
-		if bucket == originalBucketIndex && offset == originalBucketOffset {
-			break
+		if isSame {
+			// slot is not reused yet (key data on overflow page is never overwritten)
+			pair := blockPage.PairAt(offset)
+			lsn := ht.writeLog(recovery.HASH_TABLE_INSERT, blockPageId, offset, pair, key, txn)
+			blockPage.Insert(offset, pair)
+			if lsn != common.InvalidLSN {
+				blockPage.SetLSN(lsn)
+			}
+			ht.bpm.UnpinPage(blockPageId, true)
+			return nil
 		}
 	}
+	ht.bpm.UnpinPage(blockPageId, false)
 
-	ht.bpm.UnpinPage(iterator.blockId, true)
-	ht.bpm.UnpinPage(ht.headerPageId, false)
+	// slot was reused by other entry or dropped by bucket split,
+	// so the entry is inserted again with probing
+	return ht.insertKey(key, value, txn)
 }
 
 //func (ht *LinearProbeHashTable) hash(key int) int {
@@ -7,6 +7,7 @@ import (
 	"github.com/ryogrid/SamehadaDB/types"
 	"math"
 	"math/rand"
+	"sync"
 )
 
 type SkipListOpType int32
@@ -35,6 +36,11 @@ type SkipList struct {
 	SentinelNodeID  types.PageID
 	bpm             *buffer.BufferPoolManager
 	headerPageLatch common.ReaderWriterLatch
+	// pages of nodes removed from the list are freed when no operation is running on the list
+	// because other operations may still have their page ids (see exitOperation)
+	reclaimMutex   sync.Mutex
+	runningOpCnt   int32
+	removedNodeIds []types.PageID
 }
 
 func NewSkipList(bpm *buffer.BufferPoolManager, keyType types.TypeID) *SkipList {
@@ -50,6 +56,91 @@ func NewSkipList(bpm *buffer.BufferPoolManager, keyType types.TypeID) *SkipList
 	return ret
 }
 
+// NewSkipListOnHeaderPage makes empty skip list whose header page is headerPageId (header page of a list made at last launch).
+// nodes of the old list are not used anymore. when isOldNodesFreed is true, they are freed.
+// it must be true only when all pages of the old list were written to disk at last shutdown
+// because the list is followed with the pages on disk
+func NewSkipListOnHeaderPage(bpm *buffer.BufferPoolManager, keyType types.TypeID, headerPageId types.PageID, isOldNodesFreed bool) *SkipList {
+	ret := new(SkipList)
+	ret.bpm = bpm
+	ret.headerPage = skip_list_page.FetchAndCastToHeaderPage(bpm, headerPageId)
+	if ret.headerPage == nil {
+		panic("SkipList::NewSkipListOnHeaderPage: header page can't be fetched")
+	}
+	if isOldNodesFreed {
+		freeNodesOnDisk(bpm, ret.headerPage.GetListStartPageId())
+	}
+	var sentinelNode *skip_list_page.SkipListBlockPage
+	ret.startNode, sentinelNode = skip_list_page.NewSkipListStartBlockPage(bpm, keyType)
+	ret.SentinelNodeID = sentinelNode.GetPageId()
+	ret.headerPage.SetListStartPageId(ret.startNode.GetPageId())
+	ret.headerPage.SetKeyType(keyType)
+	bpm.FlushPage(headerPageId)
+	// header page is kept pinned as NewSkipListHeaderPage does (pin count is decremented on FlushPage)
+	bpm.IncPinOfPage(ret.headerPage)
+
+	return ret
+}
+
+// frees all nodes of a list which is not used from start node to sentinel node.
+// following is stopped at a page which can't be read as a node (the rest are not freed)
+func freeNodesOnDisk(bpm *buffer.BufferPoolManager, startPageId types.PageID) {
+	pageId := startPageId
+	for pageId != types.InvalidPageID {
+		node := skip_list_page.FetchAndCastToBlockPage(bpm, pageId)
+		if node == nil {
+			return
+		}
+		isValid := node.GetPageId() == pageId
+		nextPageId := node.GetForwardEntry(0)
+		bpm.UnpinPage(pageId, false)
+		if !isValid || bpm.DeletePage(pageId) != nil {
+			return
+		}
+		pageId = nextPageId
+	}
+}
+
+// operations which traverse the list are surrounded by enterOperation and exitOperation
+func (sl *SkipList) enterOperation() {
+	sl.reclaimMutex.Lock()
+	sl.runningOpCnt++
+	sl.reclaimMutex.Unlock()
+}
+
+// pages of removed nodes are freed when no operation is running.
+// operations started after the removal can't reach the nodes because they are unlinked from all levels already
+func (sl *SkipList) exitOperation() {
+	sl.reclaimMutex.Lock()
+	sl.runningOpCnt--
+	if sl.runningOpCnt > 0 || len(sl.removedNodeIds) == 0 {
+		sl.reclaimMutex.Unlock()
+		return
+	}
+	removedNodeIds := sl.removedNodeIds
+	sl.removedNodeIds = nil
+	sl.reclaimMutex.Unlock()
+
+	retryIds := make([]types.PageID, 0)
+	for _, pageId := range removedNodeIds {
+		if err := sl.bpm.DeletePage(pageId); err != nil {
+			// pinned by other than operations on the list (ex: writing back at checkpoint)
+			retryIds = append(retryIds, pageId)
+		}
+	}
+	if len(retryIds) > 0 {
+		sl.reclaimMutex.Lock()
+		sl.removedNodeIds = append(sl.removedNodeIds, retryIds...)
+		sl.reclaimMutex.Unlock()
+	}
+}
+
+func (sl *SkipList) addRemovedNode(pageId types.PageID) {
+	sl.reclaimMutex.Lock()
+	sl.removedNodeIds = append(sl.removedNodeIds, pageId)
+	sl.reclaimMutex.Unlock()
+}
+
 func (sl *SkipList) getHeaderPage() *skip_list_page.SkipListHeaderPage {
 	return sl.headerPage
 }
@@ -79,9 +170,11 @@ func latchOpWithOpType(node *skip_list_page.SkipListBlockPage, getOrUnlatch Latc
 	}
 }
 
+// search is done with (key, value) pair because entries which have same key are ordered by value.
+// when value is 0, found node is one which should contain first entry of the key
 // ATTENTION:
 // this method returns with keep having RLatch or WLatch of corners_[0] and not Unping corners_[0]
-func (sl *SkipList) FindNode(key *types.Value, opType SkipListOpType) (isSuccess bool, foundNode *skip_list_page.SkipListBlockPage, predOfCorners_ []skip_list_page.SkipListCornerInfo, corners_ []skip_list_page.SkipListCornerInfo) {
+func (sl *SkipList) FindNode(key *types.Value, value uint64, opType SkipListOpType) (isSuccess bool, foundNode *skip_list_page.SkipListBlockPage, predOfCorners_ []skip_list_page.SkipListCornerInfo, corners_ []skip_list_page.SkipListCornerInfo) {
 	if common.EnableDebug {
 		common.ShPrintf(common.DEBUG_INFO, "FindNode: start. key=%v opType=%d\n", key.ToIFValue(), opType)
 	}
@@ -98,6 +191,8 @@ func (sl *SkipList) FindNode(key *types.Value, opType SkipListOpType) (isSuccess
 	//pred.IncPinCount()
 	sl.bpm.IncPinOfPage(pred)
 
+	searchEntry := skip_list_page.SkipListPair{Key: *key, Value: value}
+
 	// loop invariant: pred.key < searchKey
 	//fmt.Println("---")
 	//fmt.Println(key.ToInteger())
@@ -121,7 +216,7 @@ func (sl *SkipList) FindNode(key *types.Value, opType SkipListOpType) (isSuccess
 				panic("SkipList::FindNode: FetchAndCastToBlockPage returned nil!")
 			}
 			latchOpWithOpType(curr, SKIP_LIST_UTIL_GET_LATCH, opType)
-			if !curr.GetSmallestKey(key.ValueType()).CompareLessThanOrEqual(*key) {
+			if !curr.GetSmallestEntry(key.ValueType()).CompareLessThanOrEqual(searchEntry) {
 				//  (ii + 1) level's corner node or target node has been identified (= pred)
 				break
 			} else {
@@ -135,7 +230,7 @@ func (sl *SkipList) FindNode(key *types.Value, opType SkipListOpType) (isSuccess
 				pred = curr
 			}
 		}
-		if opType == SKIP_LIST_OP_REMOVE && ii != 0 && pred.GetEntryCnt() == 1 && key.CompareEquals(pred.GetSmallestKey(key.ValueType())) {
+		if opType == SKIP_LIST_OP_REMOVE && ii != 0 && pred.GetEntryCnt() == 1 && searchEntry.CompareEquals(pred.GetSmallestEntry(key.ValueType())) {
 			// pred is already reached goal, so change pred to appropriate node
 			common.ShPrintf(common.DEBUG_INFO, "SkipList::FindNode: node should be removed found!\n")
 			predOfCorners[ii] = skip_list_page.SkipListCornerInfo{types.InvalidPageID, -1}
@@ -256,50 +351,92 @@ func (sl *SkipList) FindNode(key *types.Value, opType SkipListOpType) (isSuccess
 	return true, pred, predOfCorners, corners
 }
 
+// returned idx points the entry just before first entry whose key is equal or larger than key arg
 // ATTENTION:
 // this method returns with keep having RLatch of corners_[0] and pinned corners_[0]
 func (sl *SkipList) FindNodeWithEntryIdxForItr(key *types.Value) (isSuccess_ bool, idx_ int32, predOfCorners_ []skip_list_page.SkipListCornerInfo, corners_ []skip_list_page.SkipListCornerInfo) {
 	// get idx of target entry or one of nearest smaller entry
-	_, node, predOfCorners, corners := sl.FindNode(key, SKIP_LIST_OP_GET)
+	// value 0 is smallest value. so search with it reaches first entry of the key
+	_, node, predOfCorners, corners := sl.FindNode(key, 0, SKIP_LIST_OP_GET)
 
 	//node := skip_list_page.FetchAndCastToBlockPage(sl.bpm, corners[0].PageId)
 	// locking is not needed because already have lock with FindNode method call
-	_, _, idx := node.FindEntryByKey(key)
+	found, _, idx := node.FindEntry(&skip_list_page.SkipListPair{Key: *key, Value: 0})
+	if found {
+		// iterator returns next entry of idx. so idx is decremented for returning found entry
+		idx--
+	}
 	//// this unpin is needed because node is already pinned at FindNode
 	//sl.bpm.UnpinPage(node.GetPageId(), false)
 	return true, idx, predOfCorners, corners
 }
 
-func (sl *SkipList) GetValue(key *types.Value) uint32 {
+// returns one of values which are associated with key arg
+// when there is no entry for key, math.MaxUint64 is returned
+func (sl *SkipList) GetValue(key *types.Value) uint64 {
+	values := sl.GetValues(key)
+	if len(values) == 0 {
+		return math.MaxUint64
+	}
+	return values[0]
+}
+
+// returns all values which are associated with key arg
+// values are ordered in ascending order
+func (sl *SkipList) GetValues(key *types.Value) []uint64 {
 	if common.EnableDebug {
-		common.ShPrintf(common.DEBUG_INFO, "SkipList::GetValue: start. key=%v\n", key.ToIFValue())
+		common.ShPrintf(common.DEBUG_INFO, "SkipList::GetValues: start. key=%v\n", key.ToIFValue())
 	}
-	_, node, _, _ := sl.FindNode(key, SKIP_LIST_OP_GET)
-	//node := skip_list_page.FetchAndCastToBlockPage(sl.bpm, corners[0].PageId)
+	sl.enterOperation()
+	defer sl.exitOperation()
+	// value 0 is smallest value. so search with it reaches first entry of the key
+	_, node, _, _ := sl.FindNode(key, 0, SKIP_LIST_OP_GET)
 	// locking is not needed because already have lock with FindNode method call
-	found, entry, _ := node.FindEntryByKey(key)
+	found, _, idx := node.FindEntry(&skip_list_page.SkipListPair{Key: *key, Value: 0})
+	if !found {
+		// idx points nearest smaller entry
+		idx++
+	}
+
+	ret := make([]uint64, 0)
+	for {
+		if idx >= node.GetEntryCnt() {
+			// entries of the key may continue to next node
+			// latch of next node is got before releasing current one as FindNode does
+			next := skip_list_page.FetchAndCastToBlockPage(sl.bpm, node.GetForwardEntry(0))
+			next.RLatch()
+			sl.bpm.UnpinPage(node.GetPageId(), false)
+			node.RUnlatch()
+			node = next
+			idx = 0
+			continue
+		}
+		entry := node.GetEntry(int(idx), key.ValueType())
+		if key.CompareLessThan(entry.Key) {
+			break
+		}
+		ret = append(ret, entry.Value)
+		idx++
+	}
 	sl.bpm.UnpinPage(node.GetPageId(), false)
 	node.RUnlatch()
-	//sl.bpm.UnpinPage(node.GetPageId(), false)
 
 	if common.EnableDebug {
-		common.ShPrintf(common.DEBUG_INFO, "SkipList::GetValue: finish. key=%v\n", key.ToIFValue())
-	}
-	if found {
-		return entry.Value
-	} else {
-		return math.MaxUint32
+		common.ShPrintf(common.DEBUG_INFO, "SkipList::GetValues: finish. key=%v\n", key.ToIFValue())
 	}
+	return ret
 }
 
-func (sl *SkipList) Insert(key *types.Value, value uint32) (err error) {
+func (sl *SkipList) Insert(key *types.Value, value uint64) (err error) {
 	if common.EnableDebug {
 		common.ShPrintf(common.DEBUG_INFO, "SkipList::Insert: start. key=%v\n", key.ToIFValue())
 	}
+	sl.enterOperation()
+	defer sl.exitOperation()
 	isNeedRetry := true
 
 	for isNeedRetry {
-		isSuccess, node, _, corners := sl.FindNode(key, SKIP_LIST_OP_INSERT)
+		isSuccess, node, _, corners := sl.FindNode(key, value, SKIP_LIST_OP_INSERT)
 		if !isSuccess {
 			// when isSuccess == false, all latch and pin is released already
 			common.ShPrintf(common.DEBUG_INFO, "SkipList::Insert: retry. key=%v\n", key.ToIFValue())
@@ -320,29 +457,33 @@ func (sl *SkipList) Insert(key *types.Value, value uint32) (err error) {
 	return nil
 }
 
-func (sl *SkipList) Remove(key *types.Value, value uint32) (isDeleted_ bool) {
+// only the entry which has same key and value is removed
+func (sl *SkipList) Remove(key *types.Value, value uint64) (isDeleted_ bool) {
 	if common.EnableDebug {
 		common.ShPrintf(common.DEBUG_INFO, "SkipList::Remove: start. key=%v\n", key.ToIFValue())
 	}
+	sl.enterOperation()
+	defer sl.exitOperation()
 	isNodeShouldBeDeleted := false
 	isDeleted := false
 	isNeedRetry := true
 
 	for isNeedRetry {
-		isSuccess, node, predOfCorners, corners := sl.FindNode(key, SKIP_LIST_OP_REMOVE)
+		isSuccess, node, predOfCorners, corners := sl.FindNode(key, value, SKIP_LIST_OP_REMOVE)
 		if !isSuccess {
 			// any latch and pin have here
 			continue
 		}
 		//node := skip_list_page.FetchAndCastToBlockPage(sl.bpm, corners[0].PageId)
 		// locking is not needed because already have lock with FindNode method call
-		isNodeShouldBeDeleted, isDeleted, isNeedRetry = node.Remove(sl.bpm, key, predOfCorners, corners)
+		isNodeShouldBeDeleted, isDeleted, isNeedRetry = node.Remove(sl.bpm, key, value, predOfCorners, corners)
 		// lock and pin which is got FindNode is released on Remove method
 		// except isNodeShouldBeDeleted == true case
 
 		//sl.bpm.UnpinPage(node.GetPageId(), true)
 		if isNodeShouldBeDeleted {
-			//sl.bpm.DeletePage(corners[0].PageId)
+			// other operations may be referring the node yet. so it is freed later
+			sl.addRemovedNode(corners[0].PageId)
 		}
 	}
 
@@ -354,8 +495,11 @@ func (sl *SkipList) Remove(key *types.Value, value uint32) (isDeleted_ bool) {
 
 // TODO: (SDB) cuncurrent iterator need RID list when iterator is created
 
+// ATTENTION:
+// pages of removed nodes are not freed until Next of returned iterator returns done == true
 func (sl *SkipList) Iterator(rangeStartKey *types.Value, rangeEndKey *types.Value) *SkipListIterator {
 	ret := new(SkipListIterator)
+	sl.enterOperation()
 
 	//headerPage := skip_list_page.FetchAndCastToHeaderPage(sl.bpm, sl.headerPageID)
 	headerPage := sl.getHeaderPage()
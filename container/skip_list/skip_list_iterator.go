@@ -16,13 +16,22 @@ type SkipListIterator struct {
 	rangeStartKey *types.Value
 	rangeEndKey   *types.Value
 	keyType       types.TypeID
+	// iterator is counted as a running operation on the list until it reaches the end
+	isFinished bool
+}
+
+func (itr *SkipListIterator) finish() {
+	if !itr.isFinished {
+		itr.isFinished = true
+		itr.sl.exitOperation()
+	}
 }
 
 // TODO: (SDB) cuncurrent iterator need RID list when iterator is created
 
 // ATTENTION:
 // caller must call this until getting "done" is true
-func (itr *SkipListIterator) Next() (done bool, err error, key *types.Value, val uint32) {
+func (itr *SkipListIterator) Next() (done bool, err error, key *types.Value, val uint64) {
 	if itr.rangeStartKey != nil && itr.curNode == nil {
 		var corners []skip_list_page.SkipListCornerInfo
 		_, itr.curIdx, _, corners = itr.sl.FindNodeWithEntryIdxForItr(itr.rangeStartKey)
@@ -52,7 +61,8 @@ func (itr *SkipListIterator) Next() (done bool, err error, key *types.Value, val
 				itr.bpm.UnpinPage(itr.curNode.GetPageId(), false)
 			}
 			itr.curNode.RUnlatch()
-			return true, nil, nil, math.MaxUint32
+			itr.finish()
+			return true, nil, nil, math.MaxUint64
 		}
 	}
 
@@ -63,7 +73,8 @@ func (itr *SkipListIterator) Next() (done bool, err error, key *types.Value, val
 	if itr.rangeEndKey != nil && itr.curNode.GetEntry(int(itr.curIdx), itr.keyType).Key.CompareGreaterThan(*itr.rangeEndKey) {
 		itr.bpm.UnpinPage(itr.curNode.GetPageId(), false)
 		itr.curNode.RUnlatch()
-		return true, nil, nil, math.MaxUint32
+		itr.finish()
+		return true, nil, nil, math.MaxUint64
 	}
 
 	tmpKey := itr.curNode.GetEntry(int(itr.curIdx), itr.keyType).Key
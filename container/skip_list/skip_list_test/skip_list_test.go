@@ -16,6 +16,9 @@ import (
 import (
 	"fmt"
 	"github.com/ryogrid/SamehadaDB/container/skip_list"
+	"github.com/ryogrid/SamehadaDB/recovery"
+	"github.com/ryogrid/SamehadaDB/storage/buffer"
+	"github.com/ryogrid/SamehadaDB/storage/disk"
 	"math/rand"
 	"sync"
 	"time"
@@ -43,7 +46,7 @@ func TestSerializationOfSkipLisBlockPage(t *testing.T) {
 	bpage.SetForwardEntry(5, types.PageID(11))
 	bpage.SetFreeSpacePointer(common.PageSize - 9)
 	// EntryCnt is incremented to 2
-	// freeSpacePointer is decremented size of entry (1+2+7+4 => 14)
+	// freeSpacePointer is decremented size of entry (1+2+7+8 => 18)
 	bpage.SetEntry(1, &skip_list_page.SkipListPair{types.NewVarchar("abcdeff"), 12345})
 
 	testingpkg.SimpleAssert(t, bpage.GetPageId() == 7)
@@ -52,7 +55,7 @@ func TestSerializationOfSkipLisBlockPage(t *testing.T) {
 	testingpkg.SimpleAssert(t, bpage.GetLevel() == 4)
 	testingpkg.SimpleAssert(t, bpage.GetForwardEntry(5) == types.PageID(11))
 
-	testingpkg.SimpleAssert(t, bpage.GetFreeSpacePointer() == (common.PageSize-9-14))
+	testingpkg.SimpleAssert(t, bpage.GetFreeSpacePointer() == (common.PageSize-9-18))
 	entry := bpage.GetEntry(1, types.Varchar)
 	testingpkg.SimpleAssert(t, entry.Key.CompareEquals(types.NewVarchar("abcdeff")))
 	testingpkg.SimpleAssert(t, entry.Value == 12345)
@@ -209,18 +212,18 @@ func TestBSearchOfSkipLisBlockPage(t *testing.T) {
 	}))
 	// set entries
 	for ii := 1; ii < 50; ii++ {
-		bpage.SetEntries(append(bpage.GetEntries(types.Integer), &skip_list_page.SkipListPair{types.NewInteger(int32(ii * 10)), uint32(ii * 10)}))
+		bpage.SetEntries(append(bpage.GetEntries(types.Integer), &skip_list_page.SkipListPair{types.NewInteger(int32(ii * 10)), uint64(ii * 10)}))
 	}
 	bpage.SetEntryCnt(int32(len(bpage.GetEntries(types.Integer))))
 
 	for ii := 1; ii < 100; ii++ {
 		key := types.NewInteger(int32(ii * 5))
-		found, entry, idx := bpage.FindEntryByKey(&key)
+		found, entry, idx := bpage.FindEntry(&skip_list_page.SkipListPair{Key: key, Value: uint64(key.ToInteger())})
 		//fmt.Println(ii)
 		if ii%2 == 0 {
-			testingpkg.SimpleAssert(t, found == true && entry.Value == uint32(key.ToInteger()))
+			testingpkg.SimpleAssert(t, found == true && entry.Value == uint64(key.ToInteger()))
 		} else {
-			testingpkg.SimpleAssert(t, found == false && uint32(key.ToInteger())-bpage.ValueAt(idx, types.Integer) == 5)
+			testingpkg.SimpleAssert(t, found == false && uint64(key.ToInteger())-bpage.ValueAt(idx, types.Integer) == 5)
 		}
 	}
 
@@ -232,18 +235,18 @@ func TestBSearchOfSkipLisBlockPage(t *testing.T) {
 	}))
 	// set entries
 	for ii := 1; ii < 51; ii++ {
-		bpage.SetEntries(append(bpage.GetEntries(types.Integer), &skip_list_page.SkipListPair{types.NewInteger(int32(ii * 10)), uint32(ii * 10)}))
+		bpage.SetEntries(append(bpage.GetEntries(types.Integer), &skip_list_page.SkipListPair{types.NewInteger(int32(ii * 10)), uint64(ii * 10)}))
 	}
 	bpage.SetEntryCnt(int32(len(bpage.GetEntries(types.Integer))))
 
 	for ii := 1; ii < 102; ii++ {
 		key := types.NewInteger(int32(ii * 5))
-		found, entry, idx := bpage.FindEntryByKey(&key)
+		found, entry, idx := bpage.FindEntry(&skip_list_page.SkipListPair{Key: key, Value: uint64(key.ToInteger())})
 		//fmt.Println(ii)
 		if ii%2 == 0 {
-			testingpkg.SimpleAssert(t, found == true && entry.Value == uint32(key.ToInteger()))
+			testingpkg.SimpleAssert(t, found == true && entry.Value == uint64(key.ToInteger()))
 		} else {
-			testingpkg.SimpleAssert(t, found == false && uint32(key.ToInteger())-bpage.ValueAt(idx, types.Integer) == 5)
+			testingpkg.SimpleAssert(t, found == false && uint64(key.ToInteger())-bpage.ValueAt(idx, types.Integer) == 5)
 		}
 	}
 
@@ -273,7 +276,7 @@ func TestBSearchOfSkipLisBlockPage2(t *testing.T) {
 	// set entries
 	for ii := 1; ii < 50; ii++ {
 		bpage.WLatch()
-		bpage.Insert(samehada_util.GetPonterOfValue(types.NewInteger(int32(ii*10))), uint32(ii*10), bpm, nil, 1)
+		bpage.Insert(samehada_util.GetPonterOfValue(types.NewInteger(int32(ii*10))), uint64(ii*10), bpm, nil, 1)
 		//bpage.SetEntries(append(bpage.GetEntries(types.Integer), &skip_list_page.SkipListPair{types.NewInteger(int32(ii * 10)), uint32(ii * 10)}))
 	}
 	bpage.WLatch()
@@ -281,12 +284,12 @@ func TestBSearchOfSkipLisBlockPage2(t *testing.T) {
 
 	for ii := 1; ii < 100; ii++ {
 		key := types.NewInteger(int32(ii * 5))
-		found, entry, idx := bpage.FindEntryByKey(&key)
+		found, entry, idx := bpage.FindEntry(&skip_list_page.SkipListPair{Key: key, Value: uint64(key.ToInteger())})
 		//fmt.Println(ii)
 		if ii%2 == 0 {
-			testingpkg.SimpleAssert(t, found == true && entry.Value == uint32(key.ToInteger()))
+			testingpkg.SimpleAssert(t, found == true && entry.Value == uint64(key.ToInteger()))
 		} else {
-			testingpkg.SimpleAssert(t, found == false && uint32(key.ToInteger())-bpage.ValueAt(idx, types.Integer) == 5)
+			testingpkg.SimpleAssert(t, found == false && uint64(key.ToInteger())-bpage.ValueAt(idx, types.Integer) == 5)
 		}
 	}
 	bpage.WUnlatch()
@@ -302,7 +305,7 @@ func TestBSearchOfSkipLisBlockPage2(t *testing.T) {
 	// set entries
 	for ii := 1; ii < 51; ii++ {
 		bpage.WLatch()
-		bpage.Insert(samehada_util.GetPonterOfValue(types.NewInteger(int32(ii*10))), uint32(ii*10), bpm, nil, 1)
+		bpage.Insert(samehada_util.GetPonterOfValue(types.NewInteger(int32(ii*10))), uint64(ii*10), bpm, nil, 1)
 		//bpage.SetEntries(append(bpage.GetEntries(types.Integer), &skip_list_page.SkipListPair{types.NewInteger(int32(ii * 10)), uint32(ii * 10)}))
 	}
 	bpage.WLatch()
@@ -310,12 +313,12 @@ func TestBSearchOfSkipLisBlockPage2(t *testing.T) {
 
 	for ii := 1; ii < 102; ii++ {
 		key := types.NewInteger(int32(ii * 5))
-		found, entry, idx := bpage.FindEntryByKey(&key)
+		found, entry, idx := bpage.FindEntry(&skip_list_page.SkipListPair{Key: key, Value: uint64(key.ToInteger())})
 		//fmt.Println(ii)
 		if ii%2 == 0 {
-			testingpkg.SimpleAssert(t, found == true && entry.Value == uint32(key.ToInteger()))
+			testingpkg.SimpleAssert(t, found == true && entry.Value == uint64(key.ToInteger()))
 		} else {
-			testingpkg.SimpleAssert(t, found == false && uint32(key.ToInteger())-bpage.ValueAt(idx, types.Integer) == 5)
+			testingpkg.SimpleAssert(t, found == false && uint64(key.ToInteger())-bpage.ValueAt(idx, types.Integer) == 5)
 		}
 	}
 	bpage.WUnlatch()
@@ -323,6 +326,82 @@ func TestBSearchOfSkipLisBlockPage2(t *testing.T) {
 	shi.Shutdown(false)
 }
 
+func TestSkipListDuplicateKeys(t *testing.T) {
+	t.Parallel()
+	if !common.EnableOnMemStorage {
+		os.Remove(t.Name() + ".db")
+		os.Remove(t.Name() + ".log")
+	}
+
+	shi := samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	bpm := shi.GetBufferPoolManager()
+	sl := skip_list.NewSkipList(bpm, types.Integer)
+
+	// 1000 keys and each key has 20 values. entries span many nodes
+	keyNum := int32(1000)
+	dupNum := uint64(20)
+	for ii := int32(0); ii < keyNum; ii++ {
+		for jj := uint64(0); jj < dupNum; jj++ {
+			key := types.NewInteger(ii)
+			sl.Insert(&key, uint64(ii)*dupNum+(dupNum-jj))
+		}
+	}
+	// inserting same key and value pair again does not make new entry
+	dupKey := types.NewInteger(7)
+	sl.Insert(&dupKey, uint64(7)*dupNum+1)
+
+	testingpkg.SimpleAssert(t, countSkipListContent(sl) == keyNum*int32(dupNum))
+
+	for ii := int32(0); ii < keyNum; ii++ {
+		key := types.NewInteger(ii)
+		values := sl.GetValues(&key)
+		testingpkg.SimpleAssert(t, uint64(len(values)) == dupNum)
+		for jj, val := range values {
+			// values of same key are returned in ascending order
+			testingpkg.SimpleAssert(t, val == uint64(ii)*dupNum+uint64(jj)+1)
+		}
+	}
+	notExistKey := types.NewInteger(keyNum)
+	testingpkg.SimpleAssert(t, len(sl.GetValues(&notExistKey)) == 0)
+	testingpkg.SimpleAssert(t, sl.GetValue(&notExistKey) == math.MaxUint64)
+
+	// remove only odd values of even keys
+	for ii := int32(0); ii < keyNum; ii += 2 {
+		key := types.NewInteger(ii)
+		for jj := uint64(1); jj <= dupNum; jj += 2 {
+			testingpkg.SimpleAssert(t, sl.Remove(&key, uint64(ii)*dupNum+jj))
+		}
+		// pair which does not exist is not removed
+		testingpkg.SimpleAssert(t, !sl.Remove(&key, uint64(ii)*dupNum+1))
+	}
+
+	for ii := int32(0); ii < keyNum; ii++ {
+		key := types.NewInteger(ii)
+		values := sl.GetValues(&key)
+		if ii%2 == 0 {
+			testingpkg.SimpleAssert(t, uint64(len(values)) == dupNum/2)
+			for _, val := range values {
+				testingpkg.SimpleAssert(t, val%2 == 0)
+			}
+		} else {
+			testingpkg.SimpleAssert(t, uint64(len(values)) == dupNum)
+		}
+	}
+
+	// range iteration yields every duplicated entry
+	startKey := types.NewInteger(10)
+	endKey := types.NewInteger(19)
+	itr := sl.Iterator(&startKey, &endKey)
+	entryCnt := 0
+	for done, _, key, _ := itr.Next(); !done; done, _, key, _ = itr.Next() {
+		testingpkg.SimpleAssert(t, 10 <= key.ToInteger() && key.ToInteger() <= 19)
+		entryCnt++
+	}
+	testingpkg.SimpleAssert(t, entryCnt == 5*int(dupNum)/2+5*int(dupNum))
+
+	shi.CloseFilesForTesting()
+}
+
 func confirmSkipListContent(t *testing.T, sl *skip_list.SkipList, step int32) int32 {
 	entryCnt := int32(0)
 	lastKeyVal := int32(-1)
@@ -384,7 +463,7 @@ func confirmSkipListContent(t *testing.T, sl *skip_list.SkipList, step int32) in
 //	for i := 0; i < 250; i++ {
 //		//fmt.Printf("get entry i=%d key=%d\n", i, i*11)
 //		res := sl.GetValue(samehada_util.GetPonterOfValue(types.NewInteger(int32(i * 11))))
-//		if res == math.MaxUint32 {
+//		if res == math.MaxUint64 {
 //			t.Errorf("result should not be nil")
 //		} else {
 //			testingpkg.SimpleAssert(t, uint32(i*11) == res)
@@ -395,7 +474,7 @@ func confirmSkipListContent(t *testing.T, sl *skip_list.SkipList, step int32) in
 //	for i := 0; i < 100; i++ {
 //		// check existance before delete
 //		res := sl.GetValue(samehada_util.GetPonterOfValue(types.NewInteger(int32(i * 11))))
-//		if res == math.MaxUint32 {
+//		if res == math.MaxUint64 {
 //			panic("result should not be nil")
 //		} else {
 //			testingpkg.SimpleAssert(t, uint32(i*11) == res)
@@ -405,7 +484,7 @@ func confirmSkipListContent(t *testing.T, sl *skip_list.SkipList, step int32) in
 //		sl.Remove(samehada_util.GetPonterOfValue(types.NewInteger(int32(i*11))), uint32(i*11))
 //
 //		res = sl.GetValue(samehada_util.GetPonterOfValue(types.NewInteger(int32(i * 11))))
-//		testingpkg.SimpleAssert(t, math.MaxUint32 == res)
+//		testingpkg.SimpleAssert(t, math.MaxUint64 == res)
 //		//fmt.Println("contents listing after delete")
 //		//confirmSkipListContent(t, sl, -1)
 //	}
@@ -450,7 +529,7 @@ func confirmSkipListContent(t *testing.T, sl *skip_list.SkipList, step int32) in
 //	for i := 0; i < 5000; i++ {
 //		//fmt.Printf("get entry i=%d key=%d\n", i, i*11)
 //		res := sl.GetValue(samehada_util.GetPonterOfValue(types.NewInteger(int32(i * 11))))
-//		if res == math.MaxUint32 {
+//		if res == math.MaxUint64 {
 //			t.Errorf("result should not be nil")
 //		} else {
 //			testingpkg.SimpleAssert(t, uint32(i*11) == res)
@@ -467,7 +546,7 @@ func confirmSkipListContent(t *testing.T, sl *skip_list.SkipList, step int32) in
 //		// check no existance after delete
 //		res := sl.GetValue(samehada_util.GetPonterOfValue(types.NewInteger(int32(i * 11))))
 //		common.ShPrintf(common.DEBUG_INFO, "i=%d i*11=%d res=%d\n", i, i*11, res)
-//		testingpkg.SimpleAssert(t, math.MaxUint32 == res)
+//		testingpkg.SimpleAssert(t, math.MaxUint64 == res)
 //	}
 //
 //	//////////// remove from head ///////
@@ -484,7 +563,7 @@ func confirmSkipListContent(t *testing.T, sl *skip_list.SkipList, step int32) in
 //	for i := 0; i < 5000; i++ {
 //		//fmt.Printf("get entry i=%d key=%d\n", i, i*11)
 //		res := sl.GetValue(samehada_util.GetPonterOfValue(types.NewInteger(int32(i * 11))))
-//		if res == math.MaxUint32 {
+//		if res == math.MaxUint64 {
 //			t.Errorf("result should not be nil")
 //		} else {
 //			testingpkg.SimpleAssert(t, uint32(i*11) == res)
@@ -501,7 +580,7 @@ func confirmSkipListContent(t *testing.T, sl *skip_list.SkipList, step int32) in
 //		// check no existance after delete
 //		res := sl.GetValue(samehada_util.GetPonterOfValue(types.NewInteger(int32(i * 11))))
 //		common.ShPrintf(common.DEBUG_INFO, "i=%d i*11=%d res=%d\n", i, i*11, res)
-//		testingpkg.SimpleAssert(t, math.MaxUint32 == res)
+//		testingpkg.SimpleAssert(t, math.MaxUint64 == res)
 //	}
 //
 //	shi.Shutdown(false)
@@ -672,15 +751,15 @@ func confirmSkipListContent(t *testing.T, sl *skip_list.SkipList, step int32) in
 //	})
 //}
 
-func getValueForSkipListEntry(val interface{}) uint32 {
-	var ret uint32
+func getValueForSkipListEntry(val interface{}) uint64 {
+	var ret uint64
 	switch val.(type) {
 	case int32:
-		ret = uint32(val.(int32))
+		ret = uint64(val.(int32))
 	case float32:
-		ret = uint32(val.(float32))
+		ret = uint64(val.(float32))
 	case string:
-		ret = uint32(len(val.(string)))
+		ret = uint64(len(val.(string)))
 	default:
 		panic("unsupported type!")
 	}
@@ -973,7 +1052,7 @@ func testSkipListMix[T int32 | float32 | string](t *testing.T, keyType types.Typ
 					panic("entries num on list is strange!")
 					//common.RuntimeStack()
 				}
-				if gotVal == math.MaxUint32 {
+				if gotVal == math.MaxUint64 {
 					fmt.Printf("%v is not found!\n", insVals[tmpIdx])
 					panic("sl.GetValue could not target key!")
 				}
@@ -1168,7 +1247,7 @@ func testSkipListMixParallel[T int32 | float32 | string](t *testing.T, keyType t
 
 				common.ShPrintf(common.DEBUGGING, "Get op start.")
 				gotVal := sl.GetValue(&getTgt)
-				if gotVal == math.MaxUint32 {
+				if gotVal == math.MaxUint64 {
 					removedValsMutex.RLock()
 					if ok := isAlreadyRemoved(getTgtBase, removedVals); !ok {
 						removedValsMutex.RUnlock()
@@ -1372,7 +1451,7 @@ func testSkipListMixParallelBulk[T int32 | float32 | string](t *testing.T, keyTy
 
 					common.ShPrintf(common.DEBUGGING, "Get op start.")
 					gotVal := sl.GetValue(&getTgt)
-					if gotVal == math.MaxUint32 {
+					if gotVal == math.MaxUint64 {
 						removedValsMutex.RLock()
 						if ok := isAlreadyRemoved(getTgtBase, removedVals); !ok {
 							removedValsMutex.RUnlock()
@@ -1609,7 +1688,7 @@ func testSkipListMixParallelStride[T int32 | float32 | string](t *testing.T, key
 
 					common.ShPrintf(common.DEBUGGING, "Get op start.")
 					gotVal := sl.GetValue(&getTgtVal)
-					if gotVal == math.MaxUint32 {
+					if gotVal == math.MaxUint64 {
 						removedValsForGetMutex.RLock()
 						if _, ok := removedValsForGetAndRemove[getTgt]; !ok {
 							removedValsForGetMutex.RUnlock()
@@ -1718,6 +1797,39 @@ func testSkipListMixParallelStrideRoot[T int32 | float32 | string](t *testing.T,
 	fmt.Println("test finished 5/5.")
 }
 
+// larger page has more entries and skip list has fewer nodes
+func TestSkipListLargePageSize(t *testing.T) {
+	t.Parallel()
+
+	keyNum := int32(5000)
+	pageNums := make([]int64, 0)
+	for _, pageSize := range []int{common.PageSize, 4 * common.PageSize} {
+		dm := disk.NewVirtualDiskManagerImplWithPageSize(t.Name()+".db", pageSize)
+		bpm := buffer.NewBufferPoolManager(common.BufferPoolMaxFrameNumForTest, dm, recovery.NewLogManager(&dm))
+		sl := skip_list.NewSkipList(bpm, types.Integer)
+
+		for ii := int32(0); ii < keyNum; ii++ {
+			key := types.NewInteger(ii)
+			sl.Insert(&key, uint64(ii))
+		}
+		testingpkg.SimpleAssert(t, countSkipListContent(sl) == keyNum)
+		for ii := int32(0); ii < keyNum; ii++ {
+			key := types.NewInteger(ii)
+			testingpkg.SimpleAssert(t, sl.GetValue(&key) == uint64(ii))
+		}
+		for ii := int32(0); ii < keyNum; ii += 2 {
+			key := types.NewInteger(ii)
+			testingpkg.SimpleAssert(t, sl.Remove(&key, uint64(ii)))
+		}
+		testingpkg.SimpleAssert(t, countSkipListContent(sl) == keyNum/2)
+
+		bpm.FlushAllPages()
+		pageNums = append(pageNums, dm.Size()/int64(pageSize))
+		dm.ShutDown()
+	}
+	testingpkg.SimpleAssert(t, pageNums[1] < pageNums[0])
+}
+
 func TestSkipListMixInteger(t *testing.T) {
 	t.Parallel()
 	if testing.Short() {
@@ -1845,9 +1957,9 @@ func TestSkipListMixParallsStrideVarcharLikeFuzzer(t *testing.T) {
 
 func testSkipListInsertGetEven(t *testing.T, sl *skip_list.SkipList, ch chan string) {
 	for ii := int32(0); ii < 10000; ii = ii + 2 {
-		sl.Insert(samehada_util.GetPonterOfValue(types.NewInteger(ii)), uint32(ii))
+		sl.Insert(samehada_util.GetPonterOfValue(types.NewInteger(ii)), uint64(ii))
 		gotVal := sl.GetValue(samehada_util.GetPonterOfValue(types.NewInteger(ii)))
-		if gotVal == math.MaxUint32 {
+		if gotVal == math.MaxUint64 {
 			t.Fail()
 			fmt.Printf("value %d is not found!\n", ii)
 			panic("inserted value not found!")
@@ -1859,9 +1971,9 @@ func testSkipListInsertGetEven(t *testing.T, sl *skip_list.SkipList, ch chan str
 
 func testSkipListInsertGetOdd(t *testing.T, sl *skip_list.SkipList, ch chan string) {
 	for ii := int32(1); ii < 10000; ii = ii + 2 {
-		sl.Insert(samehada_util.GetPonterOfValue(types.NewInteger(ii)), uint32(ii))
+		sl.Insert(samehada_util.GetPonterOfValue(types.NewInteger(ii)), uint64(ii))
 		gotVal := sl.GetValue(samehada_util.GetPonterOfValue(types.NewInteger(ii)))
-		if gotVal == math.MaxUint32 {
+		if gotVal == math.MaxUint64 {
 			fmt.Printf("value %d is not found!\n", ii)
 		}
 	}
@@ -1871,11 +1983,11 @@ func testSkipListInsertGetOdd(t *testing.T, sl *skip_list.SkipList, ch chan stri
 
 func testSkipListInsertGetEvenSeparate(t *testing.T, sl *skip_list.SkipList, ch chan string) {
 	for ii := int32(0); ii < 100000; ii = ii + 2 {
-		sl.Insert(samehada_util.GetPonterOfValue(types.NewInteger(ii)), uint32(ii))
+		sl.Insert(samehada_util.GetPonterOfValue(types.NewInteger(ii)), uint64(ii))
 	}
 	for ii := int32(0); ii < 100000; ii = ii + 2 {
 		gotVal := sl.GetValue(samehada_util.GetPonterOfValue(types.NewInteger(ii)))
-		if gotVal == math.MaxUint32 {
+		if gotVal == math.MaxUint64 {
 			t.Fail()
 			fmt.Printf("value %d is not found!\n", ii)
 			panic("inserted value not found!")
@@ -1887,12 +1999,12 @@ func testSkipListInsertGetEvenSeparate(t *testing.T, sl *skip_list.SkipList, ch
 
 func testSkipListInsertGetOddSeparate(t *testing.T, sl *skip_list.SkipList, ch chan string) {
 	for ii := int32(1); ii < 100000; ii = ii + 2 {
-		sl.Insert(samehada_util.GetPonterOfValue(types.NewInteger(ii)), uint32(ii))
+		sl.Insert(samehada_util.GetPonterOfValue(types.NewInteger(ii)), uint64(ii))
 	}
 
 	for ii := int32(1); ii < 100000; ii = ii + 2 {
 		gotVal := sl.GetValue(samehada_util.GetPonterOfValue(types.NewInteger(ii)))
-		if gotVal == math.MaxUint32 {
+		if gotVal == math.MaxUint64 {
 			fmt.Printf("value %d is not found!\n", ii)
 		}
 	}
@@ -1905,18 +2017,18 @@ func testSkipListInsertGetInsert3stride1and3(t *testing.T, sl *skip_list.SkipLis
 	// insert 012345678...
 	//        ^  ^  ^
 	for ii := int32(0); ii < 10000; ii++ {
-		sl.Insert(samehada_util.GetPonterOfValue(types.NewInteger(3*ii)), uint32(3*ii))
+		sl.Insert(samehada_util.GetPonterOfValue(types.NewInteger(3*ii)), uint64(3*ii))
 		gotVal := sl.GetValue(samehada_util.GetPonterOfValue(types.NewInteger(3 * ii)))
-		if gotVal == math.MaxUint32 {
+		if gotVal == math.MaxUint64 {
 			fmt.Printf("value %d is not found!\n", ii)
 		}
 	}
 	// insert 012345678...
 	//          ^  ^  ^
 	for ii := int32(0); ii < 10000; ii++ {
-		sl.Insert(samehada_util.GetPonterOfValue(types.NewInteger(3*ii+2)), uint32(3*ii+2))
+		sl.Insert(samehada_util.GetPonterOfValue(types.NewInteger(3*ii+2)), uint64(3*ii+2))
 		gotVal := sl.GetValue(samehada_util.GetPonterOfValue(types.NewInteger(3*ii + 2)))
-		if gotVal == math.MaxUint32 {
+		if gotVal == math.MaxUint64 {
 			fmt.Printf("value %d is not found!\n", ii)
 		}
 	}
@@ -1928,9 +2040,9 @@ func testSkipListInsertGetRemove3stride2(t *testing.T, sl *skip_list.SkipList, c
 	// insert 012345678...
 	//         ^  ^  ^
 	for ii := int32(0); ii < 10000; ii++ {
-		sl.Insert(samehada_util.GetPonterOfValue(types.NewInteger(3*ii+1)), uint32(3*ii+1))
+		sl.Insert(samehada_util.GetPonterOfValue(types.NewInteger(3*ii+1)), uint64(3*ii+1))
 		gotVal := sl.GetValue(samehada_util.GetPonterOfValue(types.NewInteger(3*ii + 1)))
-		if gotVal == math.MaxUint32 {
+		if gotVal == math.MaxUint64 {
 			fmt.Printf("value %d is not found!\n", ii)
 			panic("inserted value not found!")
 		}
@@ -1938,13 +2050,13 @@ func testSkipListInsertGetRemove3stride2(t *testing.T, sl *skip_list.SkipList, c
 	// remove 012345678... from tail
 	//        ^^ ^^ ^^
 	for ii := int32(10000 - 1); ii >= 0; ii-- {
-		sl.Remove(samehada_util.GetPonterOfValue(types.NewInteger(3*ii+1)), uint32(3*ii+1))
+		sl.Remove(samehada_util.GetPonterOfValue(types.NewInteger(3*ii+1)), uint64(3*ii+1))
 		gotVal := sl.GetValue(samehada_util.GetPonterOfValue(types.NewInteger(3*ii + 1)))
-		if gotVal != math.MaxUint32 {
+		if gotVal != math.MaxUint64 {
 			fmt.Printf("value %d should be not found!\n", 3*ii+1)
 			panic("remove should be failed!")
 		}
-		sl.Remove(samehada_util.GetPonterOfValue(types.NewInteger(3*ii)), uint32(3*ii))
+		sl.Remove(samehada_util.GetPonterOfValue(types.NewInteger(3*ii)), uint64(3*ii))
 		// no check because another thread have not finished insert
 	}
 
@@ -43,7 +43,7 @@ func (e *DeleteExecutor) Next() (*tuple.Tuple, Done, error) {
 	for t := e.it.Current(); !e.it.End(); t = e.it.Next() {
 		if t == nil {
 			err := errors.New("e.it.Next returned nil")
-			return nil, true, err
+			return nil, true, abortReasonOr(e.txn, err)
 		}
 		if e.selects(t, e.plan.GetPredicate()) {
 			// change e.it.Current() value for subsequent call
@@ -54,7 +54,7 @@ func (e *DeleteExecutor) Next() (*tuple.Tuple, Done, error) {
 			is_marked := e.tableMetadata.Table().MarkDelete(rid, e.txn)
 			if !is_marked {
 				err := errors.New("tuple update failed. PageId:SlotNum = " + string(rid.GetPageId()) + ":" + fmt.Sprint(rid.GetSlotNum()))
-				return nil, false, err
+				return nil, false, abortReasonOr(e.txn, err)
 			}
 
 			colNum := e.tableMetadata.GetColumnNum()
@@ -72,7 +72,8 @@ func (e *DeleteExecutor) Next() (*tuple.Tuple, Done, error) {
 		}
 	}
 
-	return nil, true, nil
+	// iteration is stopped when txn is aborted
+	return nil, true, abortReasonOr(e.txn, nil)
 }
 
 // select evaluates an expression on the tuple
@@ -58,6 +58,8 @@ func (e *ExecutionEngine) CreateExecutor(plan plans.Plan, context *ExecutorConte
 		return NewOrderbyExecutor(context, p, e.CreateExecutor(plan.GetChildAt(0), context))
 	case *plans.FilterPlanNode:
 		return NewFilterExecutor(context, p, e.CreateExecutor(plan.GetChildAt(0), context))
+	case *plans.VacuumPlanNode:
+		return NewVacuumExecutor(context, p)
 	}
 	return nil
 }
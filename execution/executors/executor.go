@@ -4,8 +4,10 @@
 package executors
 
 import (
+	"github.com/ryogrid/SamehadaDB/storage/access"
 	"github.com/ryogrid/SamehadaDB/storage/table/schema"
 	"github.com/ryogrid/SamehadaDB/storage/tuple"
+	"github.com/ryogrid/SamehadaDB/types"
 )
 
 type Done bool
@@ -21,3 +23,39 @@ type Executor interface {
 	Next() (*tuple.Tuple, Done, error)
 	GetOutputSchema() *schema.Schema
 }
+
+// returns the error which caused abort of txn (ex: buffer.ErrBufferPoolExhausted) if it is recorded.
+// otherwise err is returned
+func abortReasonOr(txn *access.Transaction, err error) error {
+	if txn != nil && txn.GetAbortReason() != nil {
+		return txn.GetAbortReason()
+	}
+	return err
+}
+
+// checks values against declared lengths of columns (see column.ValueTooLongError).
+// only columns of colIdxs are checked when it is not nil. txn is aborted when a value is too long
+func checkValueLengths(values []types.Value, colIdxs []int, schema_ *schema.Schema, txn *access.Transaction) error {
+	check := func(idx int) error {
+		if err := schema_.GetColumn(uint32(idx)).CheckValueLength(values[idx]); err != nil {
+			txn.SetState(access.ABORTED)
+			txn.SetAbortReason(err)
+			return err
+		}
+		return nil
+	}
+	if colIdxs != nil {
+		for _, idx := range colIdxs {
+			if err := check(idx); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for idx := range values {
+		if err := check(idx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
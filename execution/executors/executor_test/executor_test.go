@@ -19,6 +19,7 @@ import (
 	"github.com/ryogrid/SamehadaDB/storage/access"
 	"github.com/ryogrid/SamehadaDB/storage/buffer"
 	"github.com/ryogrid/SamehadaDB/storage/disk"
+	"github.com/ryogrid/SamehadaDB/storage/index"
 	"github.com/ryogrid/SamehadaDB/storage/table/column"
 	"github.com/ryogrid/SamehadaDB/storage/table/schema"
 	testingpkg "github.com/ryogrid/SamehadaDB/testing"
@@ -2433,14 +2434,23 @@ func TestInsertNullValueAndSeqScanWithNullComparison(t *testing.T) {
 	txn_mgr.Commit(txn)
 
 	cases := []executors.SeqScanTestCase{{
-		"select a, b ... WHERE b = NULL",
+		"select a, b ... WHERE b IS NULL",
 		executionEngine,
 		executorContext,
 		tableMetadata,
 		[]executors.Column{{"a", types.Integer}, {"b", types.Varchar}},
-		executors.Predicate{"b", expression.Equal, types.NewVarchar("").SetNull()},
+		executors.Predicate{"b", expression.IsNull, types.NewVarchar("").SetNull()},
 		[]executors.Assertion{{"a", 20}},
 		1,
+	}, {
+		"select a, b ... WHERE b = NULL",
+		executionEngine,
+		executorContext,
+		tableMetadata,
+		[]executors.Column{{"a", types.Integer}, {"b", types.Varchar}},
+		executors.Predicate{"b", expression.Equal, types.NewVarchar("").SetNull()},
+		[]executors.Assertion{},
+		0,
 	}, {
 		"select a, b ... WHERE a = 20",
 		executionEngine,
@@ -2458,3 +2468,346 @@ func TestInsertNullValueAndSeqScanWithNullComparison(t *testing.T) {
 		})
 	}
 }
+
+func countTablePages(bpm *buffer.BufferPoolManager, tableMetadata *catalog.TableMetadata) int {
+	cnt := 0
+	pageId := tableMetadata.Table().GetFirstPageId()
+	for pageId.IsValid() {
+		page_ := access.CastPageAsTablePage(bpm.FetchPage(pageId))
+		nextPageId := page_.GetNextPageId()
+		bpm.UnpinPage(pageId, false)
+		pageId = nextPageId
+		cnt++
+	}
+	return cnt
+}
+
+func TestVacuum(t *testing.T) {
+	diskManager := disk.NewDiskManagerTest()
+	defer diskManager.ShutDown()
+	log_mgr := recovery.NewLogManager(&diskManager)
+	bpm := buffer.NewBufferPoolManager(uint32(32), diskManager, log_mgr)
+	txn_mgr := access.NewTransactionManager(access.NewLockManager(access.REGULAR, access.DETECTION), log_mgr)
+	txn := txn_mgr.Begin(nil)
+
+	c := catalog.BootstrapCatalog(bpm, log_mgr, access.NewLockManager(access.REGULAR, access.PREVENTION), txn)
+
+	columnA := column.NewColumn("a", types.Integer, true, index_constants.INDEX_KIND_HASH, types.PageID(-1), nil)
+	columnB := column.NewColumn("b", types.Varchar, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	schema_ := schema.NewSchema([]*column.Column{columnA, columnB})
+
+	tableMetadata := c.CreateTable("test_1", schema_, txn)
+
+	rows := make([][]types.Value, 0)
+	for ii := 0; ii < 200; ii++ {
+		row := make([]types.Value, 0)
+		row = append(row, types.NewInteger(int32(ii)))
+		row = append(row, types.NewVarchar(fmt.Sprintf("%0200d", ii)))
+		rows = append(rows, row)
+	}
+
+	insertPlanNode := plans.NewInsertPlanNode(rows, tableMetadata.OID())
+
+	executionEngine := &executors.ExecutionEngine{}
+	executorContext := executors.NewExecutorContext(c, bpm, txn)
+	executionEngine.Execute(insertPlanNode, executorContext)
+
+	txn_mgr.Commit(txn)
+
+	// delete rows on pages at the head of the table
+	txn = txn_mgr.Begin(nil)
+	executorContext.SetTransaction(txn)
+
+	pred := executors.Predicate{"a", expression.LessThan, 190}
+	tmpColVal := new(expression.ColumnValue)
+	tmpColVal.SetTupleIndex(0)
+	tmpColVal.SetColIndex(tableMetadata.Schema().GetColIndex(pred.LeftColumn))
+	expression_ := expression.NewComparison(tmpColVal, expression.NewConstantValue(executors.GetValue(pred.RightColumn), executors.GetValueType(pred.RightColumn)), pred.Operator, types.Boolean)
+
+	deletePlanNode := plans.NewDeletePlanNode(expression_, tableMetadata.OID())
+	executionEngine.Execute(deletePlanNode, executorContext)
+
+	txn_mgr.Commit(txn)
+
+	pageCntBefore := countTablePages(bpm, tableMetadata)
+	testingpkg.Assert(t, pageCntBefore > 2, "table should have some pages")
+
+	// remaining rows are moved to the first page
+	txn = txn_mgr.Begin(nil)
+	executorContext.SetTransaction(txn)
+
+	vacuumPlanNode := plans.NewVacuumPlanNode([]uint32{tableMetadata.OID()})
+	executionEngine.Execute(vacuumPlanNode, executorContext)
+	testingpkg.Assert(t, txn.GetState() != access.ABORTED, "VACUUM should not be aborted")
+
+	txn_mgr.Commit(txn)
+
+	txn_mgr.BlockAllTransactions()
+	releasedCnt, err := tableMetadata.Table().ReleaseEmptyPages()
+	txn_mgr.ResumeTransactions()
+	testingpkg.Ok(t, err)
+
+	pageCntAfter := countTablePages(bpm, tableMetadata)
+	testingpkg.Equals(t, 1, pageCntAfter)
+	testingpkg.Equals(t, pageCntBefore-1, releasedCnt)
+	testingpkg.Equals(t, releasedCnt, len(bpm.GetFreePageIds()))
+
+	// check data and index entries of moved rows
+	txn = txn_mgr.Begin(nil)
+	executorContext.SetTransaction(txn)
+
+	seqPlan := plans.NewSeqScanPlanNode(schema_, nil, tableMetadata.OID())
+	results := executionEngine.Execute(seqPlan, executorContext)
+	testingpkg.Equals(t, 10, len(results))
+
+	for ii := 190; ii < 200; ii++ {
+		executors.ExecuteHashIndexScanTestCase(t, executors.HashIndexScanTestCase{
+			fmt.Sprintf("select b ... WHERE a = %d", ii),
+			executionEngine,
+			executorContext,
+			tableMetadata,
+			[]executors.Column{{"b", types.Varchar}},
+			executors.Predicate{"a", expression.Equal, ii},
+			[]executors.Assertion{{"b", fmt.Sprintf("%0200d", ii)}},
+			1,
+		})
+	}
+
+	txn_mgr.Commit(txn)
+}
+
+func TestBufferPoolExhaustion(t *testing.T) {
+	diskManager := disk.NewDiskManagerTest()
+	defer diskManager.ShutDown()
+	log_mgr := recovery.NewLogManager(&diskManager)
+	bpm := buffer.NewBufferPoolManager(uint32(32), diskManager, log_mgr)
+	txn_mgr := access.NewTransactionManager(access.NewLockManager(access.REGULAR, access.DETECTION), log_mgr)
+	txn := txn_mgr.Begin(nil)
+
+	c := catalog.BootstrapCatalog(bpm, log_mgr, access.NewLockManager(access.REGULAR, access.PREVENTION), txn)
+
+	columnA := column.NewColumn("a", types.Integer, true, index_constants.INDEX_KIND_HASH, types.PageID(-1), nil)
+	columnB := column.NewColumn("b", types.Varchar, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	schema_ := schema.NewSchema([]*column.Column{columnA, columnB})
+	tableMetadata := c.CreateTable("test_1", schema_, txn)
+
+	rows := make([][]types.Value, 0)
+	for ii := 0; ii < 100; ii++ {
+		rows = append(rows, []types.Value{types.NewInteger(int32(ii)), types.NewVarchar(fmt.Sprintf("%0200d", ii))})
+	}
+	executionEngine := &executors.ExecutionEngine{}
+	executorContext := executors.NewExecutorContext(c, bpm, txn)
+	executionEngine.Execute(plans.NewInsertPlanNode(rows, tableMetadata.OID()), executorContext)
+	txn_mgr.Commit(txn)
+
+	// all frames are pinned (pages of the table and the index are evicted)
+	pinnedPageIds := make([]types.PageID, 0)
+	for pg := bpm.NewPage(); pg != nil; pg = bpm.NewPage() {
+		pinnedPageIds = append(pinnedPageIds, pg.GetPageId())
+	}
+
+	executeForTesting := func(plan plans.Plan) (int, error) {
+		txn := txn_mgr.Begin(nil)
+		executorContext.SetTransaction(txn)
+		executor := executionEngine.CreateExecutor(plan, executorContext)
+		executor.Init()
+		cnt := 0
+		for {
+			tuple_, done, err := executor.Next()
+			if err != nil {
+				testingpkg.Assert(t, txn.GetState() == access.ABORTED, "txn should be aborted")
+				txn_mgr.Abort(txn)
+				return cnt, err
+			}
+			if done {
+				break
+			}
+			if tuple_ != nil {
+				cnt++
+			}
+		}
+		txn_mgr.Commit(txn)
+		return cnt, nil
+	}
+
+	tmpColVal := expression.NewColumnValue(0, tableMetadata.Schema().GetColIndex("a"), types.Integer)
+	pred := expression.NewComparison(tmpColVal, expression.NewConstantValue(types.NewInteger(10), types.Integer), expression.Equal, types.Boolean)
+	outSchema := schema.NewSchema([]*column.Column{column.NewColumn("a", types.Integer, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)})
+
+	// Scenario: operations which need a frame fail with the typed error instead of panic
+	_, err := executeForTesting(plans.NewSeqScanPlanNode(outSchema, nil, tableMetadata.OID()))
+	testingpkg.Equals(t, buffer.ErrBufferPoolExhausted, err)
+	_, err = executeForTesting(plans.NewHashScanIndexPlanNode(outSchema, pred.(*expression.Comparison), tableMetadata.OID()))
+	testingpkg.Equals(t, buffer.ErrBufferPoolExhausted, err)
+	_, err = executeForTesting(plans.NewInsertPlanNode([][]types.Value{{types.NewInteger(1000), types.NewVarchar("a")}}, tableMetadata.OID()))
+	testingpkg.Equals(t, buffer.ErrBufferPoolExhausted, err)
+
+	// Scenario: the pool can be used again after the frames are released
+	for _, pageId := range pinnedPageIds {
+		bpm.UnpinPage(pageId, false)
+		testingpkg.Ok(t, bpm.DeletePage(pageId))
+	}
+	cnt, err := executeForTesting(plans.NewSeqScanPlanNode(outSchema, nil, tableMetadata.OID()))
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, 100, cnt)
+	cnt, err = executeForTesting(plans.NewHashScanIndexPlanNode(outSchema, pred.(*expression.Comparison), tableMetadata.OID()))
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, 1, cnt)
+	testingpkg.Equals(t, 0, len(bpm.GetPinLeaks()))
+}
+
+func TestSkipListIndexChurn(t *testing.T) {
+	diskManager := disk.NewDiskManagerTest()
+	defer diskManager.ShutDown()
+	log_mgr := recovery.NewLogManager(&diskManager)
+	bpm := buffer.NewBufferPoolManager(uint32(32), diskManager, log_mgr)
+	txn_mgr := access.NewTransactionManager(access.NewLockManager(access.REGULAR, access.DETECTION), log_mgr)
+	txn := txn_mgr.Begin(nil)
+
+	c := catalog.BootstrapCatalog(bpm, log_mgr, access.NewLockManager(access.REGULAR, access.PREVENTION), txn)
+
+	columnA := column.NewColumn("a", types.Integer, true, index_constants.INDEX_KIND_SKIP_LIST, types.PageID(-1), nil)
+	columnB := column.NewColumn("b", types.Varchar, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	schema_ := schema.NewSchema([]*column.Column{columnA, columnB})
+
+	tableMetadata := c.CreateTable("test_1", schema_, txn)
+	txn_mgr.Commit(txn)
+
+	executionEngine := &executors.ExecutionEngine{}
+	executorContext := executors.NewExecutorContext(c, bpm, txn)
+
+	// all rows are inserted and deleted at each round. nodes of the index are emptied and removed
+	dbSizes := make([]int64, 0)
+	for round := 0; round < 8; round++ {
+		txn = txn_mgr.Begin(nil)
+		executorContext.SetTransaction(txn)
+		rows := make([][]types.Value, 0)
+		for ii := 0; ii < 2000; ii++ {
+			row := make([]types.Value, 0)
+			row = append(row, types.NewInteger(int32(round*2000+ii)))
+			row = append(row, types.NewVarchar(fmt.Sprintf("%020d", ii)))
+			rows = append(rows, row)
+		}
+		executionEngine.Execute(plans.NewInsertPlanNode(rows, tableMetadata.OID()), executorContext)
+		txn_mgr.Commit(txn)
+
+		txn = txn_mgr.Begin(nil)
+		executorContext.SetTransaction(txn)
+		tmpColVal := new(expression.ColumnValue)
+		tmpColVal.SetTupleIndex(0)
+		tmpColVal.SetColIndex(tableMetadata.Schema().GetColIndex("a"))
+		expression_ := expression.NewComparison(tmpColVal, expression.NewConstantValue(executors.GetValue(0), types.Integer), expression.GreaterThanOrEqual, types.Boolean)
+		executionEngine.Execute(plans.NewDeletePlanNode(expression_, tableMetadata.OID()), executorContext)
+		txn_mgr.Commit(txn)
+
+		dbSizes = append(dbSizes, diskManager.Size())
+	}
+
+	// pages of removed nodes of the index are reused. so db file does not grow after the first round
+	for _, dbSize := range dbSizes[1:] {
+		testingpkg.Assert(t, dbSize <= dbSizes[0], fmt.Sprintf("db file grows: %v", dbSizes))
+	}
+
+	txn = txn_mgr.Begin(nil)
+	executorContext.SetTransaction(txn)
+	results := executionEngine.Execute(plans.NewSeqScanPlanNode(schema_, nil, tableMetadata.OID()), executorContext)
+	testingpkg.Equals(t, 0, len(results))
+	txn_mgr.Commit(txn)
+}
+
+func TestSkipListIndexWithNullKeys(t *testing.T) {
+	diskManager := disk.NewDiskManagerTest()
+	defer diskManager.ShutDown()
+	log_mgr := recovery.NewLogManager(&diskManager)
+	bpm := buffer.NewBufferPoolManager(uint32(32), diskManager, log_mgr)
+	txn_mgr := access.NewTransactionManager(access.NewLockManager(access.REGULAR, access.DETECTION), log_mgr)
+	txn := txn_mgr.Begin(nil)
+
+	c := catalog.BootstrapCatalog(bpm, log_mgr, access.NewLockManager(access.REGULAR, access.PREVENTION), txn)
+
+	// column a is nullable
+	columnA := column.NewColumn("a", types.Integer, true, index_constants.INDEX_KIND_SKIP_LIST, types.PageID(-1), nil)
+	columnB := column.NewColumn("b", types.Varchar, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	schema_ := schema.NewSchema([]*column.Column{columnA, columnB})
+
+	tableMetadata := c.CreateTable("test_1", schema_, txn)
+	txn_mgr.Commit(txn)
+
+	executionEngine := &executors.ExecutionEngine{}
+	executorContext := executors.NewExecutorContext(c, bpm, txn)
+
+	// rows whose key is NULL are inserted between ones which have keys
+	txn = txn_mgr.Begin(nil)
+	executorContext.SetTransaction(txn)
+	rows := make([][]types.Value, 0)
+	for ii := 0; ii < 100; ii++ {
+		rows = append(rows, []types.Value{types.NewInteger(int32(ii)), types.NewVarchar(fmt.Sprintf("key %d", ii))})
+		rows = append(rows, []types.Value{types.NewNull(types.Integer), types.NewVarchar(fmt.Sprintf("null %d", ii))})
+	}
+	executionEngine.Execute(plans.NewInsertPlanNode(rows, tableMetadata.OID()), executorContext)
+	txn_mgr.Commit(txn)
+
+	colIdxA := tableMetadata.Schema().GetColIndex("a")
+	colIdxB := tableMetadata.Schema().GetColIndex("b")
+	// returns values of column b of rows found with the index
+	scanKey := func(key int32) []string {
+		txn = txn_mgr.Begin(nil)
+		executorContext.SetTransaction(txn)
+		tmpColVal := expression.NewColumnValue(0, colIdxA, types.Integer)
+		pred := expression.NewComparison(tmpColVal, expression.NewConstantValue(types.NewInteger(key), types.Integer), expression.Equal, types.Boolean)
+		results := executionEngine.Execute(plans.NewHashScanIndexPlanNode(schema_, pred.(*expression.Comparison), tableMetadata.OID()), executorContext)
+		txn_mgr.Commit(txn)
+		ret := make([]string, 0)
+		for _, result := range results {
+			ret = append(ret, result.GetValue(schema_, colIdxB).ToVarchar())
+		}
+		return ret
+	}
+	// checks that entries of the index are in ascending order and returns number of them
+	countEntries := func() int {
+		itr := tableMetadata.GetIndex(int(colIdxA)).(*index.SkipListIndex).Iterator(nil, nil, nil)
+		cnt := 0
+		var prevKey *types.Value = nil
+		for done, _, key, _ := itr.Next(); !done; done, _, key, _ = itr.Next() {
+			testingpkg.Assert(t, !key.IsNull(), "NULL key is stored on the index")
+			testingpkg.Assert(t, prevKey == nil || prevKey.CompareLessThan(*key), "entries of the index are not in order")
+			prevKey = key
+			cnt++
+		}
+		return cnt
+	}
+
+	testingpkg.Equals(t, 100, countEntries())
+	for ii := int32(0); ii < 100; ii++ {
+		testingpkg.Equals(t, []string{fmt.Sprintf("key %d", ii)}, scanKey(ii))
+	}
+
+	// Scenario: key of a row is updated from NULL and one of another row is updated to NULL
+	txn = txn_mgr.Begin(nil)
+	executorContext.SetTransaction(txn)
+	tmpColValB := expression.NewColumnValue(0, colIdxB, types.Varchar)
+	pred := expression.NewComparison(tmpColValB, expression.NewConstantValue(types.NewVarchar("null 5"), types.Varchar), expression.Equal, types.Boolean)
+	executionEngine.Execute(plans.NewUpdatePlanNode([]types.Value{types.NewInteger(1000), types.NewVarchar("")}, []int{int(colIdxA)}, pred, tableMetadata.OID()), executorContext)
+	pred = expression.NewComparison(tmpColValB, expression.NewConstantValue(types.NewVarchar("key 7"), types.Varchar), expression.Equal, types.Boolean)
+	executionEngine.Execute(plans.NewUpdatePlanNode([]types.Value{types.NewNull(types.Integer), types.NewVarchar("")}, []int{int(colIdxA)}, pred, tableMetadata.OID()), executorContext)
+	txn_mgr.Commit(txn)
+
+	testingpkg.Equals(t, 100, countEntries())
+	testingpkg.Equals(t, []string{"null 5"}, scanKey(1000))
+	testingpkg.Equals(t, 0, len(scanKey(7)))
+
+	// Scenario: rows whose key is NULL are deleted
+	txn = txn_mgr.Begin(nil)
+	executorContext.SetTransaction(txn)
+	tmpColValA := expression.NewColumnValue(0, colIdxA, types.Integer)
+	pred = expression.NewComparison(tmpColValA, expression.NewConstantValue(types.NewNull(types.Integer), types.Integer), expression.IsNull, types.Boolean)
+	executionEngine.Execute(plans.NewDeletePlanNode(pred, tableMetadata.OID()), executorContext)
+	txn_mgr.Commit(txn)
+
+	testingpkg.Equals(t, 100, countEntries())
+	txn = txn_mgr.Begin(nil)
+	executorContext.SetTransaction(txn)
+	results := executionEngine.Execute(plans.NewSeqScanPlanNode(schema_, nil, tableMetadata.OID()), executorContext)
+	testingpkg.Equals(t, 100, len(results))
+	txn_mgr.Commit(txn)
+}
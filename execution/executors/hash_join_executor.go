@@ -6,6 +6,8 @@ import (
 	"github.com/ryogrid/SamehadaDB/container/hash"
 	"github.com/ryogrid/SamehadaDB/execution/expression"
 	"github.com/ryogrid/SamehadaDB/execution/plans"
+	"github.com/ryogrid/SamehadaDB/storage/access"
+	"github.com/ryogrid/SamehadaDB/storage/buffer"
 	"github.com/ryogrid/SamehadaDB/storage/table/schema"
 	"github.com/ryogrid/SamehadaDB/storage/tuple"
 	"github.com/ryogrid/SamehadaDB/types"
@@ -101,9 +103,12 @@ func (e *HashJoinExecutor) Init() {
 			// create new tmp page
 			tmp_page = hash.CastPageAsTmpTuplePage(e.context.GetBufferPoolManager().NewPage())
 			if tmp_page == nil {
-				panic("fail to create new tmp page when doing hash join")
+				// Next reports the error
+				e.context.GetTransaction().SetState(access.ABORTED)
+				e.context.GetTransaction().SetAbortReason(buffer.ErrBufferPoolExhausted)
+				return
 			}
-			tmp_page.Init(tmp_page.GetPageId(), common.PageSize)
+			tmp_page.Init(tmp_page.GetPageId(), uint32(len(tmp_page.Data())))
 			tmp_page_id = tmp_page.GetPageId()
 			e.tmp_page_ids_ = append(e.tmp_page_ids_, tmp_page_id)
 			// reinsert the tuple
@@ -114,11 +119,19 @@ func (e *HashJoinExecutor) Init() {
 			e.jht_.Insert(hash.HashValue(&valueAsKey), &tmp_tuple)
 		}
 	}
+	// tmp pages are fetched again when they are read
+	if tmp_page_id != common.InvalidPageID {
+		e.context.GetBufferPoolManager().UnpinPage(tmp_page_id, true)
+	}
 }
 
 // TODO: (SDB) need to refactor HashJoinExecutor::Next method to use GetExpr method of Column class
 //             current impl is avoiding the method because it does not exist when this code was wrote
 func (e *HashJoinExecutor) Next() (*tuple.Tuple, Done, error) {
+	if e.context.GetTransaction().GetState() == access.ABORTED {
+		e.deleteTmpPages()
+		return nil, true, abortReasonOr(e.context.GetTransaction(), errors.New("transaction is aborted"))
+	}
 	inner_next_cnt := 0
 	for {
 		for int(e.index_) == len(e.tmp_tuples_) {
@@ -135,9 +148,7 @@ func (e *HashJoinExecutor) Next() (*tuple.Tuple, Done, error) {
 				}
 
 				// hash join finished, delete all the tmp page we created
-				for _, tmp_page_id := range e.tmp_page_ids_ {
-					e.context.GetBufferPoolManager().DeletePage(tmp_page_id)
-				}
+				e.deleteTmpPages()
 				return tmp_tuple, true, nil
 			}
 			inner_next_cnt++
@@ -151,14 +162,20 @@ func (e *HashJoinExecutor) Next() (*tuple.Tuple, Done, error) {
 		// traverse corresponding left tuples stored in the tmp pages util we find one satisfying the predicate with current right tuple
 		left_tmp_tuple := e.tmp_tuples_[e.index_]
 		var left_tuple tuple.Tuple
-		e.FetchTupleFromTmpTuplePage(&left_tuple, &left_tmp_tuple)
+		if !e.FetchTupleFromTmpTuplePage(&left_tuple, &left_tmp_tuple) {
+			e.deleteTmpPages()
+			return nil, true, abortReasonOr(e.context.GetTransaction(), nil)
+		}
 		for !e.IsValidCombination(&left_tuple, &e.right_tuple_) {
 			e.index_++
 			if int(e.index_) == len(e.tmp_tuples_) {
 				break
 			}
 			left_tmp_tuple = e.tmp_tuples_[e.index_]
-			e.FetchTupleFromTmpTuplePage(&left_tuple, &left_tmp_tuple)
+			if !e.FetchTupleFromTmpTuplePage(&left_tuple, &left_tmp_tuple) {
+				e.deleteTmpPages()
+				return nil, true, abortReasonOr(e.context.GetTransaction(), nil)
+			}
 		}
 		if int(e.index_) < len(e.tmp_tuples_) {
 			// valid combination found
@@ -170,15 +187,26 @@ func (e *HashJoinExecutor) Next() (*tuple.Tuple, Done, error) {
 	}
 }
 
-func (e *HashJoinExecutor) FetchTupleFromTmpTuplePage(tuple_ *tuple.Tuple, tmp_tuple *hash.TmpTuple) {
+// returns false when the tmp page can not be fetched (txn is aborted)
+func (e *HashJoinExecutor) FetchTupleFromTmpTuplePage(tuple_ *tuple.Tuple, tmp_tuple *hash.TmpTuple) bool {
 	tmp_page := hash.CastPageAsTmpTuplePage(e.context.GetBufferPoolManager().FetchPage(tmp_tuple.GetPageId()))
 	if tmp_page == nil {
-		panic("fail to fetch tmp page when doing hash join")
+		e.context.GetTransaction().SetState(access.ABORTED)
+		e.context.GetTransaction().SetAbortReason(buffer.ErrBufferPoolExhausted)
+		return false
 	}
 	// tmp_page content is copied and accessed from currrent transaction only
 	// so tuple locking is not needed
 	tmp_page.Get(tuple_, tmp_tuple.GetOffset())
 	e.context.GetBufferPoolManager().UnpinPage(tmp_tuple.GetPageId(), false)
+	return true
+}
+
+func (e *HashJoinExecutor) deleteTmpPages() {
+	for _, tmp_page_id := range e.tmp_page_ids_ {
+		e.context.GetBufferPoolManager().DeletePage(tmp_page_id)
+	}
+	e.tmp_page_ids_ = nil
 }
 
 func (e *HashJoinExecutor) IsValidCombination(left_tuple *tuple.Tuple, right_tuple *tuple.Tuple) bool {
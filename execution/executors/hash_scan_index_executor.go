@@ -82,7 +82,8 @@ func (e *HashScanIndexExecutor) Next() (*tuple.Tuple, Done, error) {
 		return e.projects(tuple_), false, nil
 	}
 
-	return nil, true, nil
+	// no tuple is found when txn is aborted
+	return nil, true, abortReasonOr(e.txn, nil)
 }
 
 // project applies the projection operator defined by the output schema
@@ -4,8 +4,11 @@
 package executors
 
 import (
+	"errors"
+
 	"github.com/ryogrid/SamehadaDB/catalog"
 	"github.com/ryogrid/SamehadaDB/execution/plans"
+	"github.com/ryogrid/SamehadaDB/storage/access"
 	"github.com/ryogrid/SamehadaDB/storage/table/schema"
 	"github.com/ryogrid/SamehadaDB/storage/tuple"
 )
@@ -38,6 +41,9 @@ func (e *InsertExecutor) Next() (*tuple.Tuple, Done, error) {
 	// let's assume it is raw insert
 
 	for _, values := range e.plan.GetRawValues() {
+		if err := checkValueLengths(values, nil, e.tableMetadata.Schema(), e.context.txn); err != nil {
+			return nil, true, err
+		}
 		tuple_ := tuple.NewTupleFromSchema(values, e.tableMetadata.Schema())
 		tableHeap := e.tableMetadata.Table()
 		rid, err := tableHeap.InsertTuple(tuple_, e.context.txn)
@@ -55,6 +61,9 @@ func (e *InsertExecutor) Next() (*tuple.Tuple, Done, error) {
 				index_.InsertEntry(tuple_, *rid, e.context.txn)
 			}
 		}
+		if e.context.txn.GetState() == access.ABORTED {
+			return nil, true, abortReasonOr(e.context.txn, errors.New("transaction is aborted"))
+		}
 	}
 
 	return nil, true, nil
@@ -48,7 +48,7 @@ func (e *SeqScanExecutor) Next() (*tuple.Tuple, Done, error) {
 	for t := e.it.Current(); !e.it.End(); t = e.it.Next() {
 		if t == nil {
 			err := errors.New("e.it.Next returned nil")
-			return nil, true, err
+			return nil, true, abortReasonOr(e.txn, err)
 		}
 		if e.selects(t, e.plan.GetPredicate()) {
 			break
@@ -63,7 +63,8 @@ func (e *SeqScanExecutor) Next() (*tuple.Tuple, Done, error) {
 		return ret, false, nil
 	}
 
-	return nil, true, nil
+	// iteration is stopped when txn is aborted
+	return nil, true, abortReasonOr(e.txn, nil)
 }
 
 // select evaluates an expression on the tuple
@@ -44,7 +44,7 @@ func (e *UpdateExecutor) Next() (*tuple.Tuple, Done, error) {
 	for t := e.it.Current(); !e.it.End(); t = e.it.Next() {
 		if t == nil {
 			err := errors.New("e.it.Next returned nil")
-			return nil, true, err
+			return nil, true, abortReasonOr(e.txn, err)
 		}
 		if e.selects(t, e.plan.GetPredicate()) {
 			// change e.it.Current() value for subsequent call
@@ -53,6 +53,9 @@ func (e *UpdateExecutor) Next() (*tuple.Tuple, Done, error) {
 			}
 			rid := e.it.Current().GetRID()
 			values := e.plan.GetRawValues()
+			if err := checkValueLengths(values, e.plan.GetUpdateColIdxs(), e.tableMetadata.Schema(), e.txn); err != nil {
+				return nil, true, err
+			}
 			new_tuple := tuple.NewTupleFromSchema(values, e.tableMetadata.Schema())
 
 			var is_updated bool = false
@@ -65,7 +68,7 @@ func (e *UpdateExecutor) Next() (*tuple.Tuple, Done, error) {
 
 			if !is_updated {
 				err := errors.New("tuple update failed. PageId:SlotNum = " + string(rid.GetPageId()) + ":" + fmt.Sprint(rid.GetSlotNum()))
-				return nil, false, err
+				return nil, false, abortReasonOr(e.txn, err)
 			}
 
 			colNum := e.tableMetadata.GetColumnNum()
@@ -91,7 +94,8 @@ func (e *UpdateExecutor) Next() (*tuple.Tuple, Done, error) {
 		}
 	}
 
-	return nil, true, nil
+	// iteration is stopped when txn is aborted
+	return nil, true, abortReasonOr(e.txn, nil)
 }
 
 // select evaluates an expression on the tuple
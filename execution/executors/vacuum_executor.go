@@ -0,0 +1,56 @@
+package executors
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ryogrid/SamehadaDB/execution/plans"
+	"github.com/ryogrid/SamehadaDB/storage/access"
+	"github.com/ryogrid/SamehadaDB/storage/table/schema"
+	"github.com/ryogrid/SamehadaDB/storage/tuple"
+)
+
+/**
+ * VacuumExecutor compacts table heaps of specified tables and updates index entries of moved tuples.
+ * empty pages are not released here because they are accessed by the transaction until commit
+ * (see TableHeap::ReleaseEmptyPages)
+ */
+type VacuumExecutor struct {
+	context *ExecutorContext
+	plan    *plans.VacuumPlanNode
+	txn     *access.Transaction
+}
+
+func NewVacuumExecutor(context *ExecutorContext, plan *plans.VacuumPlanNode) Executor {
+	return &VacuumExecutor{context, plan, context.GetTransaction()}
+}
+
+func (e *VacuumExecutor) Init() {}
+
+func (e *VacuumExecutor) Next() (*tuple.Tuple, Done, error) {
+	for _, oid := range e.plan.GetTableOIDs() {
+		tableMetadata := e.context.GetCatalog().GetTableByOID(oid)
+		moves := tableMetadata.Table().Compact(e.txn)
+		if e.txn.GetState() == access.ABORTED {
+			return nil, true, abortReasonOr(e.txn, errors.New("compaction of table failed. OID = "+fmt.Sprint(oid)))
+		}
+
+		// index entries are updated after all moves succeeded
+		// because changes to indexes are not rolled back at abort
+		colNum := int(tableMetadata.GetColumnNum())
+		for _, move := range moves {
+			for ii := 0; ii < colNum; ii++ {
+				index_ := tableMetadata.GetIndex(ii)
+				if index_ == nil {
+					continue
+				}
+				index_.DeleteEntry(move.Tuple, move.OldRID, e.txn)
+				index_.InsertEntry(move.Tuple, move.NewRID, e.txn)
+			}
+		}
+	}
+
+	return nil, true, nil
+}
+
+func (e *VacuumExecutor) GetOutputSchema() *schema.Schema { return e.plan.OutputSchema() }
@@ -19,6 +19,8 @@ const (
 	GreaterThanOrEqual // A >= B
 	LessThan           // A < B
 	LessThanOrEqual    // A <= B
+	IsNull             // A IS NULL
+	IsNotNull          // A IS NOT NULL
 )
 
 /**
@@ -41,6 +43,18 @@ func (c *Comparison) Evaluate(tuple_ *tuple.Tuple, schema_ *schema.Schema) types
 }
 
 func (c *Comparison) performComparison(lhs types.Value, rhs types.Value) bool {
+	switch c.comparisonType {
+	case IsNull:
+		return lhs.IsNull()
+	case IsNotNull:
+		return !lhs.IsNull()
+	}
+
+	// comparison with NULL is evaluated to UNKNOWN in SQL and UNKNOWN does not satisfy predicates
+	if lhs.IsNull() || rhs.IsNull() {
+		return false
+	}
+
 	switch c.comparisonType {
 	case Equal:
 		return lhs.CompareEquals(rhs)
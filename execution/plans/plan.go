@@ -20,6 +20,7 @@ const (
 	Aggregation
 	Orderby
 	Filter
+	Vacuum
 )
 
 type Plan interface {
@@ -0,0 +1,21 @@
+package plans
+
+/**
+ * VacuumPlanNode identifies tables to be compacted.
+ */
+type VacuumPlanNode struct {
+	*AbstractPlanNode
+	tableOIDs []uint32
+}
+
+func NewVacuumPlanNode(oids []uint32) Plan {
+	return &VacuumPlanNode{&AbstractPlanNode{nil, nil}, oids}
+}
+
+func (p *VacuumPlanNode) GetTableOIDs() []uint32 {
+	return p.tableOIDs
+}
+
+func (p *VacuumPlanNode) GetType() PlanType {
+	return Vacuum
+}
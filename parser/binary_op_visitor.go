@@ -54,12 +54,12 @@ func (v *BinaryOpVisitor) Enter(in ast.Node) (ast.Node, bool) {
 
 		v.BinaryOpExpression_.LogicalOperationType_ = -1
 		if node.Not {
-			v.BinaryOpExpression_.ComparisonOperationType_ = expression.NotEqual
+			v.BinaryOpExpression_.ComparisonOperationType_ = expression.IsNotNull
 		} else {
-			v.BinaryOpExpression_.ComparisonOperationType_ = expression.Equal
+			v.BinaryOpExpression_.ComparisonOperationType_ = expression.IsNull
 		}
 
-		null_val := types.NewNull()
+		null_val := types.NewNull(types.Null)
 		v.BinaryOpExpression_.Left_ = cdv.ChildDatas_[0]
 		v.BinaryOpExpression_.Right_ = &null_val
 		return in, true
@@ -6,6 +6,7 @@ import (
 	"github.com/pingcap/parser/ast"
 	_ "github.com/pingcap/tidb/types/parser_driver"
 	"github.com/ryogrid/SamehadaDB/types"
+	"strings"
 )
 
 type QueryInfo struct {
@@ -18,7 +19,7 @@ type QueryInfo struct {
 	TargetCols_          []*string                // INSERT
 	Values_              []*types.Value           // INSERT
 	OnExpressions_       *BinaryOpExpression      // SELECT (with JOIN)
-	JoinTables_          []*string                // SELECT
+	JoinTables_          []*string                // SELECT, VACUUM (empty means all tables)
 	WhereExpression_     *BinaryOpExpression      // SELECT, UPDATE, DELETE
 	LimitNum_            int32                    // SELECT
 	OffsetNum_           int32                    // SELECT
@@ -42,7 +43,26 @@ func parse(sqlStr *string) (*ast.StmtNode, error) {
 	return &stmtNodes[0], nil
 }
 
+// VACUUM is not supported by the parser library. so "VACUUM [table]" is handled here
+func processVacuumStr(sqlStr *string) *QueryInfo {
+	tokens := strings.Fields(strings.TrimSuffix(strings.TrimSpace(*sqlStr), ";"))
+	if len(tokens) == 0 || len(tokens) > 2 || !strings.EqualFold(tokens[0], "VACUUM") {
+		return nil
+	}
+
+	qi := NewRootSQLVisitor().QueryInfo_
+	*qi.QueryType_ = VACUUM
+	if len(tokens) == 2 {
+		qi.JoinTables_ = append(qi.JoinTables_, &tokens[1])
+	}
+	return qi
+}
+
 func ProcessSQLStr(sqlStr *string) *QueryInfo {
+	if qi := processVacuumStr(sqlStr); qi != nil {
+		return qi
+	}
+
 	astNode, err := parse(sqlStr)
 	if err != nil {
 		fmt.Printf("parse error: %v\n", err.Error())
@@ -21,6 +21,10 @@ type SetExpression struct {
 type ColDefExpression struct {
 	ColName_ *string
 	ColType_ *types.TypeID
+	// declared length of VARCHAR(n) and CHAR(n). 0 means no limit (ex: TEXT)
+	ColLength_ uint32
+	// true when the column is CHAR(n)
+	IsFixedChar_ bool
 }
 
 type IndexDefExpression struct {
@@ -243,7 +243,7 @@ func TestIsNullIsNotNullSelectQuery(t *testing.T) {
 	// (a IS NULL)
 	aIsNull := queryInfo.WhereExpression_.Left_.(*BinaryOpExpression)
 	// (a *IS* NULL)
-	testingpkg.SimpleAssert(t, aIsNull.ComparisonOperationType_ == expression.Equal)
+	testingpkg.SimpleAssert(t, aIsNull.ComparisonOperationType_ == expression.IsNull)
 	testingpkg.SimpleAssert(t, aIsNull.LogicalOperationType_ == -1)
 
 	testingpkg.SimpleAssert(t, *aIsNull.Left_.(*string) == "a")
@@ -274,7 +274,7 @@ func TestIsNullIsNotNullSelectQuery(t *testing.T) {
 	aIsNotNull := queryInfo.WhereExpression_.Left_.(*BinaryOpExpression)
 
 	// (a *IS NOT* NULL)
-	testingpkg.SimpleAssert(t, aIsNotNull.ComparisonOperationType_ == expression.NotEqual)
+	testingpkg.SimpleAssert(t, aIsNotNull.ComparisonOperationType_ == expression.IsNotNull)
 	testingpkg.SimpleAssert(t, aIsNotNull.LogicalOperationType_ == -1)
 
 	testingpkg.SimpleAssert(t, *aIsNotNull.Left_.(*string) == "a")
@@ -355,6 +355,18 @@ func TestSimpleCreateTableQuery(t *testing.T) {
 	testingpkg.SimpleAssert(t, *queryInfo.ColDefExpressions_[0].ColType_ == types.Varchar)
 	testingpkg.SimpleAssert(t, *queryInfo.ColDefExpressions_[1].ColName_ == "age")
 	testingpkg.SimpleAssert(t, *queryInfo.ColDefExpressions_[1].ColType_ == types.Integer)
+	testingpkg.SimpleAssert(t, queryInfo.ColDefExpressions_[0].ColLength_ == 256)
+	testingpkg.SimpleAssert(t, !queryInfo.ColDefExpressions_[0].IsFixedChar_)
+
+	sqlStr = "CREATE TABLE chars(a CHAR(4), b CHAR, c TEXT);"
+	queryInfo = ProcessSQLStr(&sqlStr)
+	testingpkg.SimpleAssert(t, *queryInfo.ColDefExpressions_[0].ColType_ == types.Varchar)
+	testingpkg.SimpleAssert(t, queryInfo.ColDefExpressions_[0].ColLength_ == 4)
+	testingpkg.SimpleAssert(t, queryInfo.ColDefExpressions_[0].IsFixedChar_)
+	testingpkg.SimpleAssert(t, queryInfo.ColDefExpressions_[1].ColLength_ == 1)
+	testingpkg.SimpleAssert(t, queryInfo.ColDefExpressions_[1].IsFixedChar_)
+	testingpkg.SimpleAssert(t, *queryInfo.ColDefExpressions_[2].ColType_ == types.Varchar)
+	testingpkg.SimpleAssert(t, queryInfo.ColDefExpressions_[2].ColLength_ == 0)
 }
 
 func TestCreateTableWithIndexDefQuery(t *testing.T) {
@@ -444,3 +456,15 @@ func TestSimpleUpdateQuery(t *testing.T) {
 	testingpkg.SimpleAssert(t, *queryInfo.WhereExpression_.Left_.(*string) == "gender")
 	testingpkg.SimpleAssert(t, queryInfo.WhereExpression_.Right_.(*types.Value).ToVarchar() == "M")
 }
+
+func TestVacuumQuery(t *testing.T) {
+	sqlStr := "VACUUM employees;"
+	queryInfo := ProcessSQLStr(&sqlStr)
+	testingpkg.SimpleAssert(t, *queryInfo.QueryType_ == VACUUM)
+	testingpkg.SimpleAssert(t, *queryInfo.JoinTables_[0] == "employees")
+
+	sqlStr = "vacuum;"
+	queryInfo = ProcessSQLStr(&sqlStr)
+	testingpkg.SimpleAssert(t, *queryInfo.QueryType_ == VACUUM)
+	testingpkg.SimpleAssert(t, len(queryInfo.JoinTables_) == 0)
+}
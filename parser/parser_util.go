@@ -16,10 +16,14 @@ const (
 	INSERT
 	DELETE
 	UPDATE
+	VACUUM
 )
 
 func ValueExprToValue(expr *driver.ValueExpr) *types.Value {
 	switch expr.Datum.Kind() {
+	case ptypes.KindNull:
+		ret := types.NewNull(types.Null)
+		return &ret
 	case ptypes.KindInt64, ptypes.KindUint64:
 		val_str := expr.String()
 		istr := strings.Split(val_str, " ")[1]
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/charset"
 	"github.com/pingcap/parser/mysql"
 	driver "github.com/pingcap/tidb/types/parser_driver"
 	"github.com/ryogrid/SamehadaDB/types"
@@ -90,7 +91,21 @@ func (v *RootSQLVisitor) Enter(in ast.Node) (ast.Node, bool) {
 			case mysql.TypeFloat, mysql.TypeLonglong:
 				ctype := types.Float
 				cdef.ColType_ = &ctype
+			case mysql.TypeVarchar, mysql.TypeVarString:
+				ctype := types.Varchar
+				cdef.ColType_ = &ctype
+				cdef.ColLength_ = uint32(node.Tp.Flen)
+			case mysql.TypeString:
+				// CHAR without length is CHAR(1). BINARY(n) is not padded
+				ctype := types.Varchar
+				cdef.ColType_ = &ctype
+				cdef.ColLength_ = 1
+				if node.Tp.Flen > 0 {
+					cdef.ColLength_ = uint32(node.Tp.Flen)
+				}
+				cdef.IsFixedChar_ = node.Tp.Charset != charset.CharsetBin
 			default:
+				// TEXT, BLOB and so on
 				ctype := types.Varchar
 				cdef.ColType_ = &ctype
 			}
@@ -128,6 +143,12 @@ func (v *RootSQLVisitor) Enter(in ast.Node) (ast.Node, bool) {
 		v.QueryInfo_.WhereExpression_.LogicalOperationType_ = logicType
 		v.QueryInfo_.WhereExpression_.ComparisonOperationType_ = compType
 
+		return in, true
+	case *ast.IsNullExpr:
+		// WHERE clause which has IS (NOT) NULL only
+		new_visitor := &BinaryOpVisitor{v.QueryInfo_, new(BinaryOpExpression)}
+		node.Accept(new_visitor)
+		v.QueryInfo_.WhereExpression_ = new_visitor.BinaryOpExpression_
 		return in, true
 	case *driver.ValueExpr:
 		// when INSERT
@@ -43,6 +43,8 @@ func (pner *SimplePlanner) MakePlan(qi *parser.QueryInfo, txn *access.Transactio
 		return pner.MakeDeletePlan()
 	case parser.UPDATE:
 		return pner.MakeUpdatePlan()
+	case parser.VACUUM:
+		return pner.MakeVacuumPlan()
 	default:
 		panic("unknown query type")
 	}
@@ -284,7 +286,10 @@ func (pner *SimplePlanner) MakeCreateTablePlan() (error, plans.Plan) {
 
 	columns := make([]*column.Column, 0)
 	for _, cdefExp := range pner.qi.ColDefExpressions_ {
-		columns = append(columns, column.NewColumn(*cdefExp.ColName_, *cdefExp.ColType_, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil))
+		column_ := column.NewColumn(*cdefExp.ColName_, *cdefExp.ColType_, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+		column_.SetVariableLength(cdefExp.ColLength_)
+		column_.SetIsFixedChar(cdefExp.IsFixedChar_)
+		columns = append(columns, column_)
 	}
 	schema_ := schema.NewSchema(columns)
 
@@ -316,7 +321,11 @@ func (pner *SimplePlanner) MakeInsertPlan() (error, plans.Plan) {
 			return PrintAndCreateError("specified column name " + *colName + " does not exist on table " + *pner.qi.JoinTables_[0] + ".")
 		}
 		valType := schema_.GetColumn(schema_.GetColIndex(*colName)).GetType()
-		if val.ValueType() != valType {
+		if val.IsNull() {
+			// NULL literal has no type. it gets type of the column
+			typedNull := types.NewNull(valType)
+			val = &typedNull
+		} else if val.ValueType() != valType {
 			return PrintAndCreateError("data type of " + *colName + " is wrong.")
 		}
 		row = append(row, *val)
@@ -347,6 +356,24 @@ func (pner *SimplePlanner) MakeDeletePlan() (error, plans.Plan) {
 	return nil, deletePlan
 }
 
+func (pner *SimplePlanner) MakeVacuumPlan() (error, plans.Plan) {
+	oids := make([]uint32, 0)
+	if len(pner.qi.JoinTables_) == 0 {
+		// all tables
+		for _, tableMetadata := range pner.catalog_.GetAllTables() {
+			oids = append(oids, tableMetadata.OID())
+		}
+	} else {
+		tableMetadata := pner.catalog_.GetTableByName(*pner.qi.JoinTables_[0])
+		if tableMetadata == nil {
+			return PrintAndCreateError("table " + *pner.qi.JoinTables_[0] + " not found.")
+		}
+		oids = append(oids, tableMetadata.OID())
+	}
+
+	return nil, plans.NewVacuumPlanNode(oids)
+}
+
 func (pner *SimplePlanner) MakeUpdatePlan() (error, plans.Plan) {
 	tableMetadata := pner.catalog_.GetTableByName(*pner.qi.JoinTables_[0])
 	if tableMetadata == nil {
@@ -369,12 +396,15 @@ func (pner *SimplePlanner) MakeUpdatePlan() (error, plans.Plan) {
 	// second, construc values list includes dummy value (not update target)
 	updateVals := make([]types.Value, tgtTblSchema.GetColumnCount())
 	// fill all elems with dummy
-	for idx, _ := range tgtTblSchema.GetColumns() {
-		updateVals[idx] = types.NewNull()
+	for idx, column_ := range tgtTblSchema.GetColumns() {
+		updateVals[idx] = types.NewNull(column_.GetType())
 	}
 	// overwrite elem which is update target
 	for idx, colIdx := range updateColIdxs {
 		updateVals[colIdx] = *pner.qi.SetExpressions_[idx].UpdateValue_
+		if updateVals[colIdx].IsNull() {
+			updateVals[colIdx] = types.NewNull(tgtTblSchema.GetColumn(uint32(colIdx)).GetType())
+		}
 	}
 
 	var predicate expression.Expression = nil
@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"encoding/binary"
 	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/errors"
 	"github.com/ryogrid/SamehadaDB/storage/disk"
 	"github.com/ryogrid/SamehadaDB/storage/tuple"
 	"github.com/ryogrid/SamehadaDB/types"
@@ -15,6 +18,8 @@ import (
 /**
  * LogManager maintains a separate thread that is awakened whenever the log buffer is full or whenever a timeout
  * happens. When the thread is awakened, the log buffer's content is written into the disk log file.
+ * committing transactions wait at FlushUntil for the thread, so commit records of transactions which commit
+ * concurrently are made durable by one write (group commit)
  */
 type LogManager struct {
 	// TODO: (SDB) must ensure atomicity if current locking becomes not enough
@@ -31,10 +36,44 @@ type LogManager struct {
 	flush_buffer   []byte
 	latch          common.ReaderWriterLatch
 	wlog_mutex     *sync.Mutex
-	//flush_thread   *thread //__attribute__((__unused__));
-	//cv           condition_variable
-	disk_manager    *disk.DiskManager //__attribute__((__unused__));
-	isEnableLogging bool
+	// signaled when persistent_lsn is updated. isFlushThreadActive is also protected by its lock
+	persistent_cond *sync.Cond
+	// flush thread is awakened by sending to these channels
+	// (flush_force is used when log buffer has enough data and flush should not be delayed)
+	flush_request       chan bool
+	flush_force         chan bool
+	flush_thread_stop   chan bool
+	flush_thread_done   chan bool
+	isFlushThreadActive bool
+	disk_manager        *disk.DiskManager //__attribute__((__unused__));
+	isEnableLogging     bool
+	/** Offset in log file where content of log_buffer is written at next flush. */
+	log_file_offset uint32
+	/** LSN of the first log record in log_buffer. */
+	buffer_first_lsn types.LSN
+	/** First LSN and log file offset of each flushed chunk of log buffer. used for finding log records by LSN. */
+	lsn_offset_index []lsnOffsetEntry
+	stats            LogStats
+}
+
+// LogStats is counters of LogManager (values are totals since the manager was created)
+type LogStats struct {
+	// writes of log buffer to log file
+	Flushes uint64
+	// total size of written log data
+	FlushedBytes uint64
+}
+
+type lsnOffsetEntry struct {
+	first_lsn types.LSN
+	offset    uint32
+}
+
+// LogBufferSizeOf returns size of log buffer for db whose page size is pageSize.
+// log records have tuples of the page size at most. so the buffer is sized from page size of the db
+// (it is common.LogBufferSize when page size is common.PageSize)
+func LogBufferSizeOf(pageSize int) int {
+	return (common.LogBufferSizeBase + 1) * pageSize
 }
 
 func NewLogManager(disk_manager *disk.DiskManager) *LogManager {
@@ -42,36 +81,58 @@ func NewLogManager(disk_manager *disk.DiskManager) *LogManager {
 	ret.next_lsn = 0
 	ret.persistent_lsn = common.InvalidLSN
 	ret.disk_manager = disk_manager
-	ret.log_buffer = make([]byte, common.LogBufferSize)
-	ret.flush_buffer = make([]byte, common.LogBufferSize)
+	logBufferSize := LogBufferSizeOf((*disk_manager).GetPageSize())
+	ret.log_buffer = make([]byte, logBufferSize)
+	ret.flush_buffer = make([]byte, logBufferSize)
 	ret.latch = common.NewRWLatch()
 	ret.wlog_mutex = new(sync.Mutex)
+	ret.persistent_cond = sync.NewCond(new(sync.Mutex))
+	ret.flush_request = make(chan bool, 1)
+	ret.flush_force = make(chan bool, 1)
+	ret.isFlushThreadActive = false
 	ret.offset = 0
 	ret.isEnableLogging = false
+	ret.log_file_offset = uint32((*disk_manager).GetLogFileSize())
+	ret.buffer_first_lsn = common.InvalidLSN
+	ret.lsn_offset_index = make([]lsnOffsetEntry, 0)
 	return ret
 }
 
+// GetStats returns a snapshot of counters
+func (log_manager *LogManager) GetStats() LogStats {
+	return LogStats{atomic.LoadUint64(&log_manager.stats.Flushes), atomic.LoadUint64(&log_manager.stats.FlushedBytes)}
+}
+
 func (log_manager *LogManager) GetNextLSN() types.LSN       { return log_manager.next_lsn }
 func (log_manager *LogManager) SetNextLSN(lsnVal types.LSN) { log_manager.next_lsn = lsnVal }
-func (log_manager *LogManager) GetPersistentLSN() types.LSN { return log_manager.persistent_lsn }
 
 //func (log_manager *LogManager) SetPersistentLSN(lsn types.LSN) { log_manager.persistent_lsn = lsn }
 //func (log_manager *LogManager) GetLogBuffer() []byte           { return log_manager.log_buffer }
 
-func (log_manager *LogManager) Flush() {
-	// TODO: (SDB) need fix to occur buffer swap when already running flushing?
-
-	// For I/O efficiency, ideally flush thread should be used like below
-	// https://github.com/astronaut0131/bustub/blob/master/src/recovery/log_manager.cpp#L39
-	// maybe, blocking can be eliminated because txn must wait for log persistence at commit
-	// https://github.com/astronaut0131/bustub/blob/master/src/concurrency/transaction_manager.cpp#L64
+func (log_manager *LogManager) GetPersistentLSN() types.LSN {
+	log_manager.persistent_cond.L.Lock()
+	defer log_manager.persistent_cond.L.Unlock()
+	return log_manager.persistent_lsn
+}
 
+/*
+* write all log records in log buffer to log file synchronously.
+* when flush thread is running, FlushUntil should be used for waiting persistence of a log record
+ */
+func (log_manager *LogManager) Flush() {
 	log_manager.wlog_mutex.Lock()
 	log_manager.latch.WLock()
 
 	lsn := log_manager.log_buffer_lsn
+	first_lsn := log_manager.buffer_first_lsn
+	// all log records appended until now become durable with this flush
+	flushed_lsn := log_manager.next_lsn - 1
 	offset := log_manager.offset
 	log_manager.offset = 0
+	if offset > 0 {
+		log_manager.lsn_offset_index = append(log_manager.lsn_offset_index, lsnOffsetEntry{log_manager.buffer_first_lsn, log_manager.log_file_offset})
+		log_manager.log_file_offset += offset
+	}
 
 	// swap address of two buffers
 	//swap(log_manager.log_buffer, log_manager.flush_buffer)
@@ -82,10 +143,114 @@ func (log_manager *LogManager) Flush() {
 	log_manager.latch.WUnlock()
 
 	// fmt.Printf("offset at Flush:%d\n", offset)
-	(*log_manager.disk_manager).WriteLog(log_manager.flush_buffer[:offset])
+	(*log_manager.disk_manager).WriteLog(log_manager.flush_buffer[:offset], first_lsn, lsn)
+	if offset > 0 {
+		atomic.AddUint64(&log_manager.stats.Flushes, 1)
+		atomic.AddUint64(&log_manager.stats.FlushedBytes, uint64(offset))
+	}
+
+	log_manager.persistent_cond.L.Lock()
+	if flushed_lsn > log_manager.persistent_lsn {
+		log_manager.persistent_lsn = flushed_lsn
+	}
+	log_manager.persistent_cond.Broadcast()
+	log_manager.persistent_cond.L.Unlock()
 	log_manager.wlog_mutex.Unlock()
+}
 
-	log_manager.persistent_lsn = lsn
+/*
+* returns when log records until lsn (including it) have been written to log file.
+* lsn greater than LSN of the last appended log record is treated as the last one.
+* when flush thread is running, flush is requested to it and caller waits for the flush.
+* log records appended by other threads while a flush is running are written together at next flush,
+* so many transactions which commit concurrently share one write of log file
+ */
+func (log_manager *LogManager) FlushUntil(lsn types.LSN) {
+	log_manager.latch.RLock()
+	if lsn >= log_manager.next_lsn {
+		// (ex: LSN of a page which was written by former run)
+		lsn = log_manager.next_lsn - 1
+	}
+	log_manager.latch.RUnlock()
+
+	log_manager.persistent_cond.L.Lock()
+	for log_manager.persistent_lsn < lsn {
+		if !log_manager.isFlushThreadActive {
+			log_manager.persistent_cond.L.Unlock()
+			log_manager.Flush()
+			return
+		}
+		log_manager.requestFlush(log_manager.flush_request)
+		log_manager.persistent_cond.Wait()
+	}
+	log_manager.persistent_cond.L.Unlock()
+}
+
+// wakes up flush thread. request is not queued when a request is already pending
+func (log_manager *LogManager) requestFlush(ch chan bool) {
+	select {
+	case ch <- true:
+	default:
+	}
+}
+
+/*
+* start a thread which flushes log buffer when flush is requested by FlushUntil, when buffered log data
+* reaches common.LogFlushSize and at every common.LogTimeout.
+* flush requested by FlushUntil is delayed until common.LogFlushInterval passes from the last flush
+* for collecting commit records of other transactions
+ */
+func (log_manager *LogManager) RunFlushThread() {
+	log_manager.persistent_cond.L.Lock()
+	defer log_manager.persistent_cond.L.Unlock()
+	if log_manager.isFlushThreadActive {
+		return
+	}
+	log_manager.isFlushThreadActive = true
+	log_manager.flush_thread_stop = make(chan bool)
+	log_manager.flush_thread_done = make(chan bool)
+
+	go func(stop chan bool, done chan bool) {
+		ticker := time.NewTicker(common.LogTimeout)
+		defer ticker.Stop()
+		lastFlushTime := time.Now()
+		for {
+			select {
+			case <-stop:
+				// log records appended until stop are made durable
+				log_manager.Flush()
+				done <- true
+				return
+			case <-log_manager.flush_request:
+				if wait := common.LogFlushInterval - time.Since(lastFlushTime); wait > 0 {
+					timer := time.NewTimer(wait)
+					select {
+					case <-timer.C:
+					case <-log_manager.flush_force:
+					}
+					timer.Stop()
+				}
+			case <-log_manager.flush_force:
+			case <-ticker.C:
+			}
+			log_manager.Flush()
+			lastFlushTime = time.Now()
+		}
+	}(log_manager.flush_thread_stop, log_manager.flush_thread_done)
+}
+
+// stop the flush thread and wait for its finish. after this, FlushUntil flushes synchronously
+func (log_manager *LogManager) StopFlushThread() {
+	log_manager.persistent_cond.L.Lock()
+	if !log_manager.isFlushThreadActive {
+		log_manager.persistent_cond.L.Unlock()
+		return
+	}
+	log_manager.isFlushThreadActive = false
+	log_manager.persistent_cond.L.Unlock()
+
+	log_manager.flush_thread_stop <- true
+	<-log_manager.flush_thread_done
 }
 
 /*
@@ -104,10 +269,19 @@ func (log_manager *LogManager) DeactivateLogging() { log_manager.isEnableLogging
 
 func (log_manager *LogManager) IsEnabledLogging() bool { return log_manager.isEnableLogging }
 
+// ErrLogRecordTooLarge is returned by AppendLogRecord when the log record is larger than log buffer
+const ErrLogRecordTooLarge = errors.Error("log record is larger than log buffer")
+
+// GetMaxLogRecordSize returns the size of the largest log record which can be appended (size of log buffer)
+func (log_manager *LogManager) GetMaxLogRecordSize() uint32 {
+	return uint32(len(log_manager.log_buffer))
+}
+
 /*
 * append a log record into log buffer
 * you MUST set the log record's lsn within this method
-* @return: lsn that is assigned to this log record
+* @return: lsn that is assigned to this log record. ErrLogRecordTooLarge is returned when
+*          the record can't be placed on log buffer even if it is empty (no lsn is assigned)
 *
 *
 * example below
@@ -124,30 +298,44 @@ func (log_manager *LogManager) IsEnabledLogging() bool { return log_manager.isEn
 *  }
 *
  */
-func (log_manager *LogManager) AppendLogRecord(log_record *LogRecord) types.LSN {
-	// First, serialize the must have fields(20 bytes in total)
-
-	if common.LogBufferSize-log_manager.offset < HEADER_SIZE {
+func (log_manager *LogManager) AppendLogRecord(log_record *LogRecord) (types.LSN, error) {
+	if log_record.Size > log_manager.GetMaxLogRecordSize() {
+		return common.InvalidLSN, ErrLogRecordTooLarge
+	}
+	log_manager.latch.WLock()
+	// LSN is assigned after space is reserved, so all log records which have LSN are in log buffer or log file
+	for uint32(len(log_manager.log_buffer))-log_manager.offset < log_record.Size {
+		log_manager.latch.WUnlock()
 		log_manager.Flush()
+		log_manager.latch.WLock()
 	}
 
-	log_manager.latch.WLock()
+	// First, serialize the must have fields(24 bytes in total)
 	log_record.Lsn = log_manager.next_lsn
 	log_manager.next_lsn += 1
 	headerInBytes := log_record.GetLogHeaderData()
 	copy(log_manager.log_buffer[log_manager.offset:], headerInBytes)
 
-	if common.LogBufferSize-log_manager.offset < log_record.Size {
-		log_manager.latch.WUnlock()
-		log_manager.Flush()
-		log_manager.latch.WLock()
-		copy(log_manager.log_buffer[log_manager.offset:], log_record.GetLogHeaderData())
-	}
 	log_manager.log_buffer_lsn = log_record.Lsn
+	if log_manager.offset == 0 {
+		log_manager.buffer_first_lsn = log_record.Lsn
+	}
+	start := log_manager.offset
 	pos := log_manager.offset + HEADER_SIZE
 	log_manager.offset += log_record.Size
 
-	if log_record.Log_record_type == INSERT {
+	body_type := log_record.Log_record_type
+	if body_type == CLR {
+		buf := new(bytes.Buffer)
+		binary.Write(buf, binary.LittleEndian, log_record.Undo_next_lsn)
+		binary.Write(buf, binary.LittleEndian, log_record.Clr_redo_type)
+		copy(log_manager.log_buffer[pos:], buf.Bytes())
+		pos += uint32(buf.Len())
+		// rest is serialized in same format as the compensating operation
+		body_type = log_record.Clr_redo_type
+	}
+
+	if body_type == INSERT {
 		buf := new(bytes.Buffer)
 		binary.Write(buf, binary.LittleEndian, log_record.Insert_rid)
 		ridInBytes := buf.Bytes()
@@ -155,9 +343,9 @@ func (log_manager *LogManager) AppendLogRecord(log_record *LogRecord) types.LSN
 		pos += uint32(unsafe.Sizeof(log_record.Insert_rid))
 		// we have provided serialize function for tuple class
 		log_record.Insert_tuple.SerializeTo(log_manager.log_buffer[pos:])
-	} else if log_record.Log_record_type == APPLYDELETE ||
-		log_record.Log_record_type == MARKDELETE ||
-		log_record.Log_record_type == ROLLBACKDELETE {
+	} else if body_type == APPLYDELETE ||
+		body_type == MARKDELETE ||
+		body_type == ROLLBACKDELETE {
 		buf := new(bytes.Buffer)
 		binary.Write(buf, binary.LittleEndian, log_record.Delete_rid)
 		ridInBytes := buf.Bytes()
@@ -165,7 +353,7 @@ func (log_manager *LogManager) AppendLogRecord(log_record *LogRecord) types.LSN
 		pos += uint32(unsafe.Sizeof(log_record.Delete_rid))
 		// we have provided serialize function for tuple class
 		log_record.Delete_tuple.SerializeTo(log_manager.log_buffer[pos:])
-	} else if log_record.Log_record_type == UPDATE {
+	} else if body_type == UPDATE {
 		buf := new(bytes.Buffer)
 		binary.Write(buf, binary.LittleEndian, log_record.Update_rid)
 		ridInBytes := buf.Bytes()
@@ -175,13 +363,182 @@ func (log_manager *LogManager) AppendLogRecord(log_record *LogRecord) types.LSN
 		log_record.Old_tuple.SerializeTo(log_manager.log_buffer[pos:])
 		pos += log_record.Old_tuple.Size() + uint32(tuple.TupleSizeOffsetInLogrecord)
 		log_record.New_tuple.SerializeTo(log_manager.log_buffer[pos:])
-	} else if log_record.Log_record_type == NEWPAGE {
+	} else if body_type == COMMIT {
+		buf := new(bytes.Buffer)
+		binary.Write(buf, binary.LittleEndian, log_record.Commit_time)
+		copy(log_manager.log_buffer[pos:], buf.Bytes())
+	} else if body_type == NEWPAGE {
 		buf := new(bytes.Buffer)
 		binary.Write(buf, binary.LittleEndian, log_record.Prev_page_id)
 		pageIdInBytes := buf.Bytes()
 		copy(log_manager.log_buffer[pos:], pageIdInBytes)
+	} else if body_type == HASH_TABLE_INSERT ||
+		body_type == HASH_TABLE_REMOVE {
+		buf := new(bytes.Buffer)
+		binary.Write(buf, binary.LittleEndian, log_record.Hash_header_page_id)
+		binary.Write(buf, binary.LittleEndian, log_record.Hash_block_page_id)
+		binary.Write(buf, binary.LittleEndian, log_record.Hash_offset)
+		binary.Write(buf, binary.LittleEndian, log_record.Hash_key)
+		binary.Write(buf, binary.LittleEndian, log_record.Hash_value)
+		binary.Write(buf, binary.LittleEndian, log_record.Hash_overflow_page_id)
+		binary.Write(buf, binary.LittleEndian, log_record.Hash_overflow_offset)
+		binary.Write(buf, binary.LittleEndian, uint32(len(log_record.Hash_key_data)))
+		buf.Write(log_record.Hash_key_data)
+		copy(log_manager.log_buffer[pos:], buf.Bytes())
+	} else if body_type == END_CHECKPOINT ||
+		body_type == CHECKPOINT_TABLES {
+		buf := new(bytes.Buffer)
+		binary.Write(buf, binary.LittleEndian, log_record.Recovery_start_offset)
+		binary.Write(buf, binary.LittleEndian, uint32(len(log_record.Active_txn_table)))
+		for txn_id, last_lsn := range log_record.Active_txn_table {
+			binary.Write(buf, binary.LittleEndian, txn_id)
+			binary.Write(buf, binary.LittleEndian, last_lsn)
+		}
+		binary.Write(buf, binary.LittleEndian, uint32(len(log_record.Dirty_page_table)))
+		for page_id, rec_lsn := range log_record.Dirty_page_table {
+			binary.Write(buf, binary.LittleEndian, page_id)
+			binary.Write(buf, binary.LittleEndian, rec_lsn)
+		}
+		binary.Write(buf, binary.LittleEndian, uint32(len(log_record.Free_page_ids)))
+		for _, page_id := range log_record.Free_page_ids {
+			binary.Write(buf, binary.LittleEndian, page_id)
+		}
+		copy(log_manager.log_buffer[pos:], buf.Bytes())
+	} else if body_type == DEALLOCATEPAGE ||
+		body_type == REUSEPAGE {
+		buf := new(bytes.Buffer)
+		binary.Write(buf, binary.LittleEndian, log_record.Page_id)
+		copy(log_manager.log_buffer[pos:], buf.Bytes())
+	} else if body_type == TUPLE_OVERFLOW {
+		buf := new(bytes.Buffer)
+		binary.Write(buf, binary.LittleEndian, log_record.Page_id)
+		binary.Write(buf, binary.LittleEndian, log_record.Overflow_next_page_id)
+		binary.Write(buf, binary.LittleEndian, uint32(len(log_record.Overflow_data)))
+		copy(log_manager.log_buffer[pos:], buf.Bytes())
+		pos += uint32(buf.Len())
+		copy(log_manager.log_buffer[pos:], log_record.Overflow_data)
+	} else if body_type == RELEASEPAGES {
+		buf := new(bytes.Buffer)
+		binary.Write(buf, binary.LittleEndian, uint32(len(log_record.Release_page_ids)))
+		for _, page_id := range log_record.Release_page_ids {
+			binary.Write(buf, binary.LittleEndian, page_id)
+		}
+		binary.Write(buf, binary.LittleEndian, uint32(len(log_record.Release_chain_page_ids)))
+		for _, page_id := range log_record.Release_chain_page_ids {
+			binary.Write(buf, binary.LittleEndian, page_id)
+		}
+		copy(log_manager.log_buffer[pos:], buf.Bytes())
 	}
 
+	recordData := log_manager.log_buffer[start : start+log_record.Size]
+	binary.LittleEndian.PutUint32(recordData[OffsetLogRecordChecksum:], common.CalcChecksum(recordData, OffsetLogRecordChecksum))
+
+	isFlushNeeded := log_manager.offset >= common.LogFlushSize
 	log_manager.latch.WUnlock()
-	return log_record.Lsn
+
+	if isFlushNeeded {
+		log_manager.requestFlush(log_manager.flush_force)
+	}
+	return log_record.Lsn, nil
+}
+
+/*
+* returns offset in log file of the log buffer chunk which contains the log record of lsn.
+* log records which are read from returned offset sequentially reach the record.
+* lsn must not be older than the one passed to DiscardLSNOffsetsBefore
+ */
+func (log_manager *LogManager) GetLogFileOffsetOfLSN(lsn types.LSN) uint32 {
+	log_manager.latch.RLock()
+	defer log_manager.latch.RUnlock()
+
+	if log_manager.offset > 0 && lsn >= log_manager.buffer_first_lsn {
+		// not flushed yet
+		return log_manager.log_file_offset
+	}
+	// log records which are not in index are already made durable by former run
+	ret := log_manager.log_file_offset
+	if len(log_manager.lsn_offset_index) > 0 {
+		ret = log_manager.lsn_offset_index[0].offset
+	}
+	for _, entry := range log_manager.lsn_offset_index {
+		if entry.first_lsn > lsn {
+			break
+		}
+		ret = entry.offset
+	}
+	return ret
+}
+
+/*
+* forget offsets of log records older than lsn.
+* (log records older than the lsn are not needed at recovery)
+ */
+func (log_manager *LogManager) DiscardLSNOffsetsBefore(lsn types.LSN) {
+	log_manager.latch.WLock()
+	defer log_manager.latch.WUnlock()
+
+	idx := 0
+	for idx+1 < len(log_manager.lsn_offset_index) && log_manager.lsn_offset_index[idx+1].first_lsn <= lsn {
+		idx++
+	}
+	log_manager.lsn_offset_index = log_manager.lsn_offset_index[idx:]
+}
+
+/*
+* persist location of the last complete checkpoint.
+* recovery starts from the checkpoint which begins with BEGIN_CHECKPOINT record of begin_lsn
+* all log records until the END_CHECKPOINT record must be flushed before calling this
+ */
+func (log_manager *LogManager) WriteCheckpointLocation(begin_lsn types.LSN) {
+	(*log_manager.disk_manager).WriteLastCheckpointOffset(int32(log_manager.GetLogFileOffsetOfLSN(begin_lsn)))
+}
+
+/*
+* discard log data at offset and after it (used at point-in-time recovery).
+* log buffer must be empty when this is called
+ */
+func (log_manager *LogManager) DiscardLogAfter(offset uint32) {
+	log_manager.wlog_mutex.Lock()
+	defer log_manager.wlog_mutex.Unlock()
+	log_manager.latch.WLock()
+	defer log_manager.latch.WUnlock()
+
+	(*log_manager.disk_manager).DiscardLogAfter(offset)
+	log_manager.log_file_offset = offset
+	idx := len(log_manager.lsn_offset_index)
+	for idx > 0 && log_manager.lsn_offset_index[idx-1].offset >= offset {
+		idx--
+	}
+	log_manager.lsn_offset_index = log_manager.lsn_offset_index[:idx]
+}
+
+/*
+* delete (or move to archive directory) log segments which are not needed for recovery from lsn.
+* the segment which contains GetLogFileOffsetOfLSN(lsn) is kept
+ */
+func (log_manager *LogManager) TruncateLogBefore(lsn types.LSN) {
+	// head of the chunk which contains lsn is the start point of recovery
+	(*log_manager.disk_manager).TruncateLogBefore(log_manager.GetFirstLSNOfChunk(lsn))
+}
+
+// returns LSN of the log record at GetLogFileOffsetOfLSN(lsn) (head of flushed chunk which contains lsn)
+func (log_manager *LogManager) GetFirstLSNOfChunk(lsn types.LSN) types.LSN {
+	log_manager.latch.RLock()
+	defer log_manager.latch.RUnlock()
+
+	if log_manager.offset > 0 && lsn >= log_manager.buffer_first_lsn {
+		// not flushed yet
+		return log_manager.buffer_first_lsn
+	}
+	for idx := len(log_manager.lsn_offset_index) - 1; idx >= 0; idx-- {
+		if log_manager.lsn_offset_index[idx].first_lsn <= lsn {
+			return log_manager.lsn_offset_index[idx].first_lsn
+		}
+	}
+	return lsn
+}
+
+// returns total size of log files in byte
+func (log_manager *LogManager) GetLogDiskUsage() int64 {
+	return (*log_manager.disk_manager).GetLogDiskUsage()
 }
@@ -5,12 +5,16 @@ import (
 	"encoding/binary"
 	"unsafe"
 
+	"github.com/ryogrid/SamehadaDB/common"
 	"github.com/ryogrid/SamehadaDB/storage/page"
 	"github.com/ryogrid/SamehadaDB/storage/tuple"
 	"github.com/ryogrid/SamehadaDB/types"
 )
 
-const HEADER_SIZE uint32 = 20
+const HEADER_SIZE uint32 = 24
+
+// offset of checksum in header of log record
+const OffsetLogRecordChecksum uint32 = 20
 
 type LogRecordType int32
 
@@ -27,15 +31,38 @@ const (
 	ABORT
 	/** Creating a new page in the table heap. */
 	NEWPAGE
+	/** Inserting/removing a key/value pair to/from a block page of hash index. */
+	HASH_TABLE_INSERT
+	HASH_TABLE_REMOVE
+	/** Start and end of fuzzy checkpoint. END_CHECKPOINT has active transaction table and dirty page table. */
+	BEGIN_CHECKPOINT
+	END_CHECKPOINT
+	/** Compensation log record (CLR). it is written when an operation is undone and is never undone itself. */
+	CLR
+	/** Adding a page to free page list and reusing a page in it. these are not related to transactions. */
+	DEALLOCATEPAGE
+	REUSEPAGE
+	/** Writing a part of data of a large tuple to an overflow page. */
+	TUPLE_OVERFLOW
+	/** A part of tables of a checkpoint which is written between BEGIN_CHECKPOINT and END_CHECKPOINT. */
+	CHECKPOINT_TABLES
+	/**
+	 * Pages which should be released (ex: overflow pages of a deleted large tuple).
+	 * when it has transaction id, the pages are released only if the transaction commits.
+	 * pages which are not released yet are released at recovery
+	 */
+	RELEASEPAGES
 )
 
 /**
  * For every write operation on the table page, you should write ahead a corresponding log record.
  *
- * For EACH log record, HEADER is like (5 fields in common, 20 bytes in total).
- *---------------------------------------------
- * | size | LSN | transID | prevLSN | LogType |
- *---------------------------------------------
+ * For EACH log record, HEADER is like (6 fields in common, 24 bytes in total).
+ *--------------------------------------------------------
+ * | size | LSN | transID | prevLSN | LogType | checksum |
+ *--------------------------------------------------------
+ * checksum is CRC32C of whole log record (calculated with checksum field as 0).
+ * it is used for detecting torn write at tail of log
  * For insert type log record
  *---------------------------------------------------------------
  * | HEADER | tuple_rid | tuple_size | tuple_data(char[] array) |
@@ -48,10 +75,58 @@ const (
  *-----------------------------------------------------------------------------------
  * | HEADER | tuple_rid | tuple_size | old_tuple_data | tuple_size | new_tuple_data |
  *-----------------------------------------------------------------------------------
+ * For commit type log record
+ *-------------------------
+ * | HEADER | commit_time |
+ *-------------------------
+ * commit_time is unix time in nanoseconds. it is used for point-in-time recovery
  * For new page type log record
  *--------------------------
  * | HEADER | prev_page_id |
  *--------------------------
+ * For hash table type log record (including hash_table_insert, hash_table_remove)
+ *-------------------------------------------------------------------------------------------
+ * | HEADER | header_page_id | block_page_id | offset_in_block | hashed_key | value |
+ *   overflow_page_id | offset_in_overflow | key_size | key_data(char[] array) |
+ *-------------------------------------------------------------------------------------------
+ * overflow_page_id is InvalidPageID when key_data is stored in the slot of block page
+ * For begin checkpoint type log record
+ *----------
+ * | HEADER |
+ *----------
+ * For end checkpoint type log record (prevLSN of HEADER is LSN of corresponding begin checkpoint record)
+ *-----------------------------------------------------------------------------------------------
+ * | HEADER | recovery_start_offset | txn_num | (txn_id, last_lsn) ... | page_num | (page_id, rec_lsn) ... |
+ *   free_page_num | free_page_id ... |
+ *-----------------------------------------------------------------------------------------------
+ * recovery_start_offset is offset in log file where recovery should start reading log records
+ * free_page_id ... is content of free page list when the checkpoint was taken
+ * For checkpoint tables type log record (prevLSN of HEADER is LSN of corresponding begin checkpoint record)
+ *   same as end checkpoint type. recovery_start_offset is not used.
+ *   tables of a checkpoint are split to these records because they can be larger than log buffer.
+ *   tables of the checkpoint are union of the ones on these records and the end checkpoint record
+ * For compensation log record (CLR)
+ *-----------------------------------------------------------------------
+ * | HEADER | undo_next_lsn | redo_type | same as log record of redo_type |
+ *-----------------------------------------------------------------------
+ * redo_type is type of the operation which compensates for the undone one (ex: APPLYDELETE for INSERT)
+ * undo_next_lsn is LSN of the log record which should be undone next (prevLSN of the undone record)
+ * For page deallocation type log record (including deallocatepage, reusepage)
+ *---------------------
+ * | HEADER | page_id |
+ *---------------------
+ * (CLR of undone tuple_overflow has this body with redo_type deallocatepage)
+ * For tuple overflow type log record
+ *---------------------------------------------------------------
+ * | HEADER | page_id | next_page_id | data_size | data(char[] array) |
+ *---------------------------------------------------------------
+ * data is the part of tuple data stored on the overflow page
+ * For release pages type log record
+ *-------------------------------------------------------------------------
+ * | HEADER | page_num | page_id ... | chain_num | chain_first_page_id ... |
+ *-------------------------------------------------------------------------
+ * chain_first_page_id is first page of a page chain whose pages could not be read.
+ * the page and pages which follow it on the chain should be released
  */
 
 type LogRecord struct {
@@ -78,6 +153,44 @@ type LogRecord struct {
 
 	// case4: for new page opeartion
 	Prev_page_id types.PageID //INVALID_PAGE_ID
+
+	// case5: for hash index operation
+	Hash_header_page_id types.PageID
+	Hash_block_page_id  types.PageID
+	Hash_offset         uint32
+	Hash_key            uint32
+	Hash_value          uint64
+	// original key data and location on overflow page where it is stored (if needed)
+	Hash_overflow_page_id types.PageID
+	Hash_overflow_offset  uint32
+	Hash_key_data         []byte
+
+	// case6: for end checkpoint
+	Recovery_start_offset uint32
+	// txn id -> LSN of the last log record of the transaction
+	Active_txn_table map[types.TxnID]types.LSN
+	// page id -> LSN of the oldest log record which may be not reflected to the page on disk (recLSN)
+	Dirty_page_table map[types.PageID]types.LSN
+
+	// case7: for CLR (fields of redo type are used for the compensating operation)
+	Undo_next_lsn types.LSN
+	Clr_redo_type LogRecordType
+
+	// case8: for commit (unix time in nanoseconds)
+	Commit_time int64
+
+	// case9: for page deallocation and reuse
+	Page_id types.PageID
+	// for end checkpoint. content of free page list
+	Free_page_ids []types.PageID
+
+	// case10: for tuple overflow (Page_id is the overflow page)
+	Overflow_next_page_id types.PageID
+	Overflow_data         []byte
+
+	// case11: for release pages
+	Release_page_ids       []types.PageID
+	Release_chain_page_ids []types.PageID
 }
 
 // friend class LogManager;
@@ -85,7 +198,7 @@ type LogRecord struct {
 
 //func NewLogRecord() *LogRecord {}
 
-// constructor for Transaction type(BEGIN/COMMIT/ABORT)
+// constructor for Transaction type(BEGIN/ABORT)
 func NewLogRecordTxn(txn_id types.TxnID, prev_lsn types.LSN, log_record_type LogRecordType) *LogRecord {
 	ret := new(LogRecord)
 	ret.Size = HEADER_SIZE
@@ -95,6 +208,18 @@ func NewLogRecordTxn(txn_id types.TxnID, prev_lsn types.LSN, log_record_type Log
 	return ret
 }
 
+// constructor for COMMIT type
+func NewLogRecordCommit(txn_id types.TxnID, prev_lsn types.LSN, commit_time int64) *LogRecord {
+	ret := new(LogRecord)
+	ret.Txn_id = txn_id
+	ret.Prev_lsn = prev_lsn
+	ret.Log_record_type = COMMIT
+	ret.Commit_time = commit_time
+	// calculate log record size
+	ret.Size = HEADER_SIZE + uint32(unsafe.Sizeof(commit_time))
+	return ret
+}
+
 // constructor for INSERT/DELETE type
 func NewLogRecordInsertDelete(txn_id types.TxnID, prev_lsn types.LSN, log_record_type LogRecordType, rid page.RID, tuple *tuple.Tuple) *LogRecord {
 	ret := new(LogRecord)
@@ -143,6 +268,178 @@ func NewLogRecordNewPage(txn_id types.TxnID, prev_lsn types.LSN, log_record_type
 	return ret
 }
 
+// constructor for HASH_TABLE_INSERT/HASH_TABLE_REMOVE type
+func NewLogRecordHashTable(txn_id types.TxnID, prev_lsn types.LSN, log_record_type LogRecordType, header_page_id types.PageID,
+	block_page_id types.PageID, offset uint32, key uint32, value uint64, overflow_page_id types.PageID, overflow_offset uint32,
+	key_data []byte) *LogRecord {
+	ret := new(LogRecord)
+	ret.Txn_id = txn_id
+	ret.Prev_lsn = prev_lsn
+	ret.Log_record_type = log_record_type
+	ret.Hash_header_page_id = header_page_id
+	ret.Hash_block_page_id = block_page_id
+	ret.Hash_offset = offset
+	ret.Hash_key = key
+	ret.Hash_value = value
+	ret.Hash_overflow_page_id = overflow_page_id
+	ret.Hash_overflow_offset = overflow_offset
+	ret.Hash_key_data = key_data
+	// calculate log record size
+	ret.Size = HEADER_SIZE + 3*uint32(unsafe.Sizeof(header_page_id)) + 4*uint32(unsafe.Sizeof(offset)) + uint32(unsafe.Sizeof(value)) +
+		uint32(len(key_data))
+	return ret
+}
+
+// constructor for BEGIN_CHECKPOINT type
+func NewLogRecordBeginCheckpoint() *LogRecord {
+	ret := new(LogRecord)
+	ret.Size = HEADER_SIZE
+	ret.Txn_id = common.InvalidTxnID
+	ret.Prev_lsn = common.InvalidLSN
+	ret.Log_record_type = BEGIN_CHECKPOINT
+	return ret
+}
+
+// constructor for END_CHECKPOINT type.
+// tables of the checkpoint are written on CHECKPOINT_TABLES records beforehand (see NewLogRecordsCheckpointTables)
+func NewLogRecordEndCheckpoint(begin_lsn types.LSN, recovery_start_offset uint32) *LogRecord {
+	ret := newLogRecordCheckpointTables(begin_lsn)
+	ret.Log_record_type = END_CHECKPOINT
+	ret.Recovery_start_offset = recovery_start_offset
+	return ret
+}
+
+// size of each entry of tables of checkpoint records
+const (
+	sizeActiveTxnEntry = uint32(unsafe.Sizeof(types.TxnID(0)) + unsafe.Sizeof(types.LSN(0)))
+	sizeDirtyPageEntry = uint32(unsafe.Sizeof(types.PageID(0)) + unsafe.Sizeof(types.LSN(0)))
+	sizeFreePageEntry  = uint32(unsafe.Sizeof(types.PageID(0)))
+)
+
+func newLogRecordCheckpointTables(begin_lsn types.LSN) *LogRecord {
+	ret := new(LogRecord)
+	ret.Txn_id = common.InvalidTxnID
+	ret.Prev_lsn = begin_lsn
+	ret.Log_record_type = CHECKPOINT_TABLES
+	ret.Active_txn_table = make(map[types.TxnID]types.LSN)
+	ret.Dirty_page_table = make(map[types.PageID]types.LSN)
+	ret.Free_page_ids = make([]types.PageID, 0)
+	// recovery_start_offset and numbers of entries of the three tables
+	ret.Size = HEADER_SIZE + 4*uint32(unsafe.Sizeof(uint32(0)))
+	return ret
+}
+
+// constructor for CHECKPOINT_TABLES type. the tables are split to records whose size is max_size at most
+// (max_size is size of log buffer. see LogManager::GetMaxLogRecordSize)
+func NewLogRecordsCheckpointTables(begin_lsn types.LSN, active_txn_table map[types.TxnID]types.LSN,
+	dirty_page_table map[types.PageID]types.LSN, free_page_ids []types.PageID, max_size uint32) []*LogRecord {
+	ret := make([]*LogRecord, 0)
+	current := newLogRecordCheckpointTables(begin_lsn)
+	// returns the record which has space for an entry of entrySize
+	recordFor := func(entrySize uint32) *LogRecord {
+		if current.Size+entrySize > max_size {
+			ret = append(ret, current)
+			current = newLogRecordCheckpointTables(begin_lsn)
+		}
+		current.Size += entrySize
+		return current
+	}
+	for txn_id, last_lsn := range active_txn_table {
+		recordFor(sizeActiveTxnEntry).Active_txn_table[txn_id] = last_lsn
+	}
+	for page_id, rec_lsn := range dirty_page_table {
+		recordFor(sizeDirtyPageEntry).Dirty_page_table[page_id] = rec_lsn
+	}
+	for _, page_id := range free_page_ids {
+		record := recordFor(sizeFreePageEntry)
+		record.Free_page_ids = append(record.Free_page_ids, page_id)
+	}
+	return append(ret, current)
+}
+
+// constructor for DEALLOCATEPAGE/REUSEPAGE type
+func NewLogRecordPageDeallocation(log_record_type LogRecordType, page_id types.PageID) *LogRecord {
+	ret := new(LogRecord)
+	ret.Txn_id = common.InvalidTxnID
+	ret.Prev_lsn = common.InvalidLSN
+	ret.Log_record_type = log_record_type
+	ret.Page_id = page_id
+	// calculate log record size
+	ret.Size = HEADER_SIZE + uint32(unsafe.Sizeof(page_id))
+	return ret
+}
+
+// constructor for TUPLE_OVERFLOW type
+func NewLogRecordTupleOverflow(txn_id types.TxnID, prev_lsn types.LSN, page_id types.PageID, next_page_id types.PageID, data []byte) *LogRecord {
+	ret := new(LogRecord)
+	ret.Txn_id = txn_id
+	ret.Prev_lsn = prev_lsn
+	ret.Log_record_type = TUPLE_OVERFLOW
+	ret.Page_id = page_id
+	ret.Overflow_next_page_id = next_page_id
+	ret.Overflow_data = data
+	// calculate log record size
+	ret.Size = HEADER_SIZE + uint32(unsafe.Sizeof(page_id)) + uint32(unsafe.Sizeof(next_page_id)) + uint32(unsafe.Sizeof(uint32(0))) + uint32(len(data))
+	return ret
+}
+
+// constructor for RELEASEPAGES type. the lists are split to records whose size is max_size at most.
+// Prev_lsn of each record must be set by the caller when they are written by a transaction
+func NewLogRecordsReleasePages(txn_id types.TxnID, page_ids []types.PageID, chain_page_ids []types.PageID, max_size uint32) []*LogRecord {
+	newRecord := func() *LogRecord {
+		ret := new(LogRecord)
+		ret.Txn_id = txn_id
+		ret.Prev_lsn = common.InvalidLSN
+		ret.Log_record_type = RELEASEPAGES
+		ret.Release_page_ids = make([]types.PageID, 0)
+		ret.Release_chain_page_ids = make([]types.PageID, 0)
+		// numbers of entries of the two lists
+		ret.Size = HEADER_SIZE + 2*uint32(unsafe.Sizeof(uint32(0)))
+		return ret
+	}
+	ret := make([]*LogRecord, 0)
+	current := newRecord()
+	recordFor := func() *LogRecord {
+		if current.Size+sizeFreePageEntry > max_size {
+			ret = append(ret, current)
+			current = newRecord()
+		}
+		current.Size += sizeFreePageEntry
+		return current
+	}
+	for _, page_id := range page_ids {
+		record := recordFor()
+		record.Release_page_ids = append(record.Release_page_ids, page_id)
+	}
+	for _, page_id := range chain_page_ids {
+		record := recordFor()
+		record.Release_chain_page_ids = append(record.Release_chain_page_ids, page_id)
+	}
+	return append(ret, current)
+}
+
+// constructor for CLR type
+// log_record is a record of the compensating operation which is made with the constructors above
+func NewLogRecordCLR(log_record *LogRecord, undo_next_lsn types.LSN) *LogRecord {
+	ret := new(LogRecord)
+	*ret = *log_record
+	ret.Log_record_type = CLR
+	ret.Clr_redo_type = log_record.Log_record_type
+	ret.Undo_next_lsn = undo_next_lsn
+	// calculate log record size
+	ret.Size = log_record.Size + uint32(unsafe.Sizeof(undo_next_lsn)) + uint32(unsafe.Sizeof(log_record.Log_record_type))
+	return ret
+}
+
+// returns type of the operation which should be redone with this record.
+// it is the type of the compensating operation when this is a CLR
+func (log_record *LogRecord) GetRedoType() LogRecordType {
+	if log_record.Log_record_type == CLR {
+		return log_record.Clr_redo_type
+	}
+	return log_record.Log_record_type
+}
+
 func (log_record *LogRecord) GetDeleteRID() page.RID          { return log_record.Delete_rid }
 func (log_record *LogRecord) GetInserteTuple() tuple.Tuple    { return log_record.Insert_tuple }
 func (log_record *LogRecord) GetInsertRID() page.RID          { return log_record.Insert_rid }
@@ -160,6 +457,8 @@ func (log_record *LogRecord) GetLogHeaderData() []byte {
 	binary.Write(buf, binary.LittleEndian, log_record.Txn_id)
 	binary.Write(buf, binary.LittleEndian, log_record.Prev_lsn)
 	binary.Write(buf, binary.LittleEndian, log_record.Log_record_type)
+	// checksum is set after body is serialized
+	binary.Write(buf, binary.LittleEndian, uint32(0))
 
 	// fmt.Printf("GetLogHeaderData: %d, %d, %d, %d, %d, %d\n",
 	// 	log_record.Size,
@@ -3,13 +3,16 @@ package log_recovery
 import (
 	"bytes"
 	"encoding/binary"
+	"math"
 	"unsafe"
 
 	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/container/hash"
 	"github.com/ryogrid/SamehadaDB/recovery"
 	"github.com/ryogrid/SamehadaDB/storage/access"
 	"github.com/ryogrid/SamehadaDB/storage/buffer"
 	"github.com/ryogrid/SamehadaDB/storage/disk"
+	"github.com/ryogrid/SamehadaDB/storage/page"
 	"github.com/ryogrid/SamehadaDB/storage/tuple"
 	"github.com/ryogrid/SamehadaDB/types"
 )
@@ -29,10 +32,47 @@ type LogRecovery struct {
 
 	offset     int32 //__attribute__((__unused__))
 	log_buffer []byte
+
+	/** Maintain pages which may be not reflected changes by log records and LSN of the oldest one (recLSN). */
+	dirty_page_table map[types.PageID]types.LSN
+
+	/** Target of point-in-time recovery. log records after it are discarded (InvalidLSN and 0 mean no target). */
+	target_lsn  types.LSN
+	target_time int64
+
+	/** Free page list which is rebuilt with the checkpoint and page deallocation log records. */
+	free_page_ids []types.PageID
+	/** LSN of the last deallocation of each page. records older than it are of the previous user of the page. */
+	dealloc_lsns map[types.PageID]types.LSN
+	/** Pages to be released which are logged with RELEASEPAGES records (value is true for first page of a page chain). */
+	pending_releases map[types.PageID]bool
+	/** RELEASEPAGES records of each transaction. they are effective only when the transaction commits. */
+	txn_releases map[types.TxnID][]*recovery.LogRecord
 }
 
 func NewLogRecovery(disk_manager disk.DiskManager, buffer_pool_manager *buffer.BufferPoolManager, log_manager *recovery.LogManager) *LogRecovery {
-	return &LogRecovery{disk_manager, buffer_pool_manager, log_manager, make(map[types.TxnID]types.LSN), make(map[types.LSN]int), 0, make([]byte, common.LogBufferSize)}
+	return &LogRecovery{disk_manager, buffer_pool_manager, log_manager, make(map[types.TxnID]types.LSN), make(map[types.LSN]int), 0, make([]byte, recovery.LogBufferSizeOf(disk_manager.GetPageSize())),
+		make(map[types.PageID]types.LSN), common.InvalidLSN, 0, make([]types.PageID, 0), make(map[types.PageID]types.LSN),
+		make(map[types.PageID]bool), make(map[types.TxnID][]*recovery.LogRecord)}
+}
+
+/*
+* set target of point-in-time recovery. this must be called before Redo.
+* log records whose LSN is greater than target_lsn are discarded (InvalidLSN means no limit)
+* and COMMIT record whose commit time is after target_time (unix time in nanoseconds. 0 means no limit)
+* and log records after it are discarded. transactions which are not committed at the point are undone
+ */
+func (log_recovery *LogRecovery) SetRecoveryTarget(target_lsn types.LSN, target_time int64) {
+	log_recovery.target_lsn = target_lsn
+	log_recovery.target_time = target_time
+}
+
+func (log_recovery *LogRecovery) isBeyondRecoveryTarget(log_record *recovery.LogRecord) bool {
+	if log_recovery.target_lsn != common.InvalidLSN && log_record.Lsn > log_recovery.target_lsn {
+		return true
+	}
+	return log_recovery.target_time != 0 && log_record.Log_record_type == recovery.COMMIT &&
+		log_record.Commit_time > log_recovery.target_time
 }
 
 /*
@@ -47,7 +87,7 @@ func (log_recovery *LogRecovery) DeserializeLogRecord(data []byte, log_record *r
 		// fmt.Println("return false point 1")
 		return false
 	}
-	// First, unserialize the must have fields(20 bytes in total)
+	// First, unserialize the must have fields(24 bytes in total)
 	record_construct_buf := new(bytes.Buffer)
 	record_construct_buf.Write(data[:recovery.HEADER_SIZE])
 	binary.Read(record_construct_buf, binary.LittleEndian, &(log_record.Size))
@@ -56,37 +96,124 @@ func (log_recovery *LogRecovery) DeserializeLogRecord(data []byte, log_record *r
 	binary.Read(record_construct_buf, binary.LittleEndian, &(log_record.Prev_lsn))
 	binary.Read(record_construct_buf, binary.LittleEndian, &(log_record.Log_record_type))
 
-	if log_record.Size <= 0 {
+	if log_record.Size < recovery.HEADER_SIZE {
 		// fmt.Println(log_record)
 		// fmt.Println("return false point 2")
 		return false
 	}
-	// if common.LogBufferSize-len(data) < int(log_record.Size) {
-	// 	return false
-	// }
+	if len(data) < int(log_record.Size) {
+		// log record is not fully contained in data
+		return false
+	}
+	if binary.LittleEndian.Uint32(data[recovery.OffsetLogRecordChecksum:]) !=
+		common.CalcChecksum(data[:log_record.Size], recovery.OffsetLogRecordChecksum) {
+		// log record is broken (ex: torn write at tail of log)
+		return false
+	}
 
 	pos := recovery.HEADER_SIZE
-	if log_record.Log_record_type == recovery.INSERT {
+	body_type := log_record.Log_record_type
+	if body_type == recovery.CLR {
+		buf := bytes.NewBuffer(data[pos:])
+		binary.Read(buf, binary.LittleEndian, &log_record.Undo_next_lsn)
+		binary.Read(buf, binary.LittleEndian, &log_record.Clr_redo_type)
+		pos += uint32(unsafe.Sizeof(log_record.Undo_next_lsn)) + uint32(unsafe.Sizeof(log_record.Clr_redo_type))
+		// rest is deserialized in same format as the compensating operation
+		body_type = log_record.Clr_redo_type
+	}
+
+	if body_type == recovery.INSERT {
 		binary.Read(bytes.NewBuffer(data[pos:]), binary.LittleEndian, &log_record.Insert_rid)
 		pos += uint32(unsafe.Sizeof(log_record.Insert_rid))
 		// we have provided serialize function for tuple class
 		log_record.Insert_tuple.DeserializeFrom(data[pos:])
-	} else if log_record.Log_record_type == recovery.APPLYDELETE ||
-		log_record.Log_record_type == recovery.MARKDELETE ||
-		log_record.Log_record_type == recovery.ROLLBACKDELETE {
+	} else if body_type == recovery.APPLYDELETE ||
+		body_type == recovery.MARKDELETE ||
+		body_type == recovery.ROLLBACKDELETE {
 		binary.Read(bytes.NewBuffer(data[pos:]), binary.LittleEndian, &log_record.Delete_rid)
 		pos += uint32(unsafe.Sizeof(log_record.Delete_rid))
 		// we have provided serialize function for tuple class
 		log_record.Delete_tuple.DeserializeFrom(data[pos:])
-	} else if log_record.Log_record_type == recovery.UPDATE {
+	} else if body_type == recovery.UPDATE {
 		binary.Read(bytes.NewBuffer(data[pos:]), binary.LittleEndian, &log_record.Update_rid)
 		pos += uint32(unsafe.Sizeof(log_record.Update_rid))
 		// we have provided serialize function for tuple class
 		log_record.Old_tuple.DeserializeFrom(data[pos:])
 		pos += log_record.Old_tuple.Size() + uint32(tuple.TupleSizeOffsetInLogrecord)
 		log_record.New_tuple.DeserializeFrom(data[pos:])
-	} else if log_record.Log_record_type == recovery.NEWPAGE {
+	} else if body_type == recovery.COMMIT {
+		binary.Read(bytes.NewBuffer(data[pos:]), binary.LittleEndian, &log_record.Commit_time)
+	} else if body_type == recovery.NEWPAGE {
 		binary.Read(bytes.NewBuffer(data[pos:]), binary.LittleEndian, &log_record.Prev_page_id)
+	} else if body_type == recovery.HASH_TABLE_INSERT ||
+		body_type == recovery.HASH_TABLE_REMOVE {
+		buf := bytes.NewBuffer(data[pos:])
+		binary.Read(buf, binary.LittleEndian, &log_record.Hash_header_page_id)
+		binary.Read(buf, binary.LittleEndian, &log_record.Hash_block_page_id)
+		binary.Read(buf, binary.LittleEndian, &log_record.Hash_offset)
+		binary.Read(buf, binary.LittleEndian, &log_record.Hash_key)
+		binary.Read(buf, binary.LittleEndian, &log_record.Hash_value)
+		binary.Read(buf, binary.LittleEndian, &log_record.Hash_overflow_page_id)
+		binary.Read(buf, binary.LittleEndian, &log_record.Hash_overflow_offset)
+		var keySize uint32
+		binary.Read(buf, binary.LittleEndian, &keySize)
+		log_record.Hash_key_data = make([]byte, keySize)
+		buf.Read(log_record.Hash_key_data)
+	} else if body_type == recovery.END_CHECKPOINT ||
+		body_type == recovery.CHECKPOINT_TABLES {
+		buf := bytes.NewBuffer(data[pos:])
+		binary.Read(buf, binary.LittleEndian, &log_record.Recovery_start_offset)
+		var txnNum uint32
+		binary.Read(buf, binary.LittleEndian, &txnNum)
+		log_record.Active_txn_table = make(map[types.TxnID]types.LSN)
+		for ii := uint32(0); ii < txnNum; ii++ {
+			var txn_id types.TxnID
+			var last_lsn types.LSN
+			binary.Read(buf, binary.LittleEndian, &txn_id)
+			binary.Read(buf, binary.LittleEndian, &last_lsn)
+			log_record.Active_txn_table[txn_id] = last_lsn
+		}
+		var pageNum uint32
+		binary.Read(buf, binary.LittleEndian, &pageNum)
+		log_record.Dirty_page_table = make(map[types.PageID]types.LSN)
+		for ii := uint32(0); ii < pageNum; ii++ {
+			var page_id types.PageID
+			var rec_lsn types.LSN
+			binary.Read(buf, binary.LittleEndian, &page_id)
+			binary.Read(buf, binary.LittleEndian, &rec_lsn)
+			log_record.Dirty_page_table[page_id] = rec_lsn
+		}
+		var freePageNum uint32
+		binary.Read(buf, binary.LittleEndian, &freePageNum)
+		log_record.Free_page_ids = make([]types.PageID, freePageNum)
+		for ii := uint32(0); ii < freePageNum; ii++ {
+			binary.Read(buf, binary.LittleEndian, &log_record.Free_page_ids[ii])
+		}
+	} else if body_type == recovery.DEALLOCATEPAGE ||
+		body_type == recovery.REUSEPAGE {
+		binary.Read(bytes.NewBuffer(data[pos:]), binary.LittleEndian, &log_record.Page_id)
+	} else if body_type == recovery.TUPLE_OVERFLOW {
+		buf := bytes.NewBuffer(data[pos:])
+		binary.Read(buf, binary.LittleEndian, &log_record.Page_id)
+		binary.Read(buf, binary.LittleEndian, &log_record.Overflow_next_page_id)
+		var dataSize uint32
+		binary.Read(buf, binary.LittleEndian, &dataSize)
+		log_record.Overflow_data = make([]byte, dataSize)
+		buf.Read(log_record.Overflow_data)
+	} else if body_type == recovery.RELEASEPAGES {
+		buf := bytes.NewBuffer(data[pos:])
+		var pageNum uint32
+		binary.Read(buf, binary.LittleEndian, &pageNum)
+		log_record.Release_page_ids = make([]types.PageID, pageNum)
+		for ii := uint32(0); ii < pageNum; ii++ {
+			binary.Read(buf, binary.LittleEndian, &log_record.Release_page_ids[ii])
+		}
+		var chainNum uint32
+		binary.Read(buf, binary.LittleEndian, &chainNum)
+		log_record.Release_chain_page_ids = make([]types.PageID, chainNum)
+		for ii := uint32(0); ii < chainNum; ii++ {
+			binary.Read(buf, binary.LittleEndian, &log_record.Release_chain_page_ids[ii])
+		}
 	}
 
 	//fmt.Println(log_record)
@@ -94,49 +221,280 @@ func (log_recovery *LogRecovery) DeserializeLogRecord(data []byte, log_record *r
 	return true
 }
 
+/*
+* read the last complete checkpoint and set up active transaction table and dirty page table with it
+* return value: offset in log file where analysis should start
+ */
+func (log_recovery *LogRecovery) readLastCheckpoint() uint32 {
+	ckptOffset := log_recovery.disk_manager.ReadLastCheckpointOffset()
+	if ckptOffset < 0 {
+		// checkpoint has not been done. recovery starts from head of log
+		return 0
+	}
+
+	var file_offset = uint32(ckptOffset)
+	var readBytes uint32
+	beginLSN := types.LSN(common.InvalidLSN)
+	// tables of the checkpoint are split to CHECKPOINT_TABLES records and END_CHECKPOINT record.
+	// they are used only when END_CHECKPOINT is found
+	activeTxnTable := make(map[types.TxnID]types.LSN)
+	dirtyPageTable := make(map[types.PageID]types.LSN)
+	freePageIds := make([]types.PageID, 0)
+	for log_recovery.disk_manager.ReadLog(log_recovery.log_buffer, int32(file_offset), &readBytes) {
+		var buffer_offset uint32 = 0
+		var log_record recovery.LogRecord
+		for log_recovery.DeserializeLogRecord(log_recovery.log_buffer[buffer_offset:readBytes], &log_record) {
+			if log_record.Log_record_type == recovery.BEGIN_CHECKPOINT {
+				beginLSN = log_record.Lsn
+			} else if (log_record.Log_record_type == recovery.CHECKPOINT_TABLES || log_record.Log_record_type == recovery.END_CHECKPOINT) &&
+				log_record.Prev_lsn == beginLSN {
+				for txn_id, last_lsn := range log_record.Active_txn_table {
+					activeTxnTable[txn_id] = last_lsn
+				}
+				for page_id, rec_lsn := range log_record.Dirty_page_table {
+					dirtyPageTable[page_id] = rec_lsn
+				}
+				freePageIds = append(freePageIds, log_record.Free_page_ids...)
+				if log_record.Log_record_type == recovery.END_CHECKPOINT {
+					log_recovery.dirty_page_table = dirtyPageTable
+					log_recovery.free_page_ids = freePageIds
+					for txn_id, last_lsn := range activeTxnTable {
+						log_recovery.active_txn[txn_id] = last_lsn
+					}
+					return log_record.Recovery_start_offset
+				}
+			}
+			buffer_offset += log_record.Size
+		}
+		if buffer_offset == 0 {
+			break
+		}
+		file_offset += buffer_offset
+	}
+
+	// END_CHECKPOINT record was not found (checkpoint is incomplete)
+	return 0
+}
+
+// returns ids of pages which are modified by the operation of log_record
+func getModifiedPageIds(log_record *recovery.LogRecord) []types.PageID {
+	switch log_record.GetRedoType() {
+	case recovery.INSERT:
+		return []types.PageID{log_record.Insert_rid.GetPageId()}
+	case recovery.APPLYDELETE, recovery.MARKDELETE, recovery.ROLLBACKDELETE:
+		return []types.PageID{log_record.Delete_rid.GetPageId()}
+	case recovery.UPDATE:
+		return []types.PageID{log_record.Update_rid.GetPageId()}
+	case recovery.HASH_TABLE_INSERT, recovery.HASH_TABLE_REMOVE:
+		if log_record.Hash_overflow_page_id != types.InvalidPageID {
+			return []types.PageID{log_record.Hash_block_page_id, log_record.Hash_overflow_page_id}
+		}
+		return []types.PageID{log_record.Hash_block_page_id}
+	case recovery.TUPLE_OVERFLOW:
+		return []types.PageID{log_record.Page_id}
+	default:
+		return nil
+	}
+}
+
+func appendPageIdIfNotExist(pageIds []types.PageID, pageId types.PageID) []types.PageID {
+	for _, id := range pageIds {
+		if id == pageId {
+			return pageIds
+		}
+	}
+	return append(pageIds, pageId)
+}
+
+func containsPageId(pageIds []types.PageID, pageId types.PageID) bool {
+	for _, id := range pageIds {
+		if id == pageId {
+			return true
+		}
+	}
+	return false
+}
+
+func removePageId(pageIds []types.PageID, pageId types.PageID) []types.PageID {
+	for ii, id := range pageIds {
+		if id == pageId {
+			return append(pageIds[:ii], pageIds[ii+1:]...)
+		}
+	}
+	return pageIds
+}
+
+/*
+*analysis phase
+*read log records from the last complete checkpoint (or head of log) to the end and build
+*active_txn table (loser transactions), dirty page table and lsn_mapping table.
+*free page list of DiskManager is also rebuilt here and pages which were to be released but not released
+*are registered to BufferPoolManager
+*when target of point-in-time recovery is set, log data after the target is discarded here.
+*log data from a broken log record (checksum mismatch) to the end is also discarded
+* first return value: greatest LSN of log entries
+* second return value: offset in log file where redo phase should start
+ */
+func (log_recovery *LogRecovery) analyze() (types.LSN, uint32) {
+	greatestLSN := types.LSN(0)
+	var file_offset uint32 = log_recovery.readLastCheckpoint()
+	var readBytes uint32
+	isTargetReached := false
+	for !isTargetReached && log_recovery.disk_manager.ReadLog(log_recovery.log_buffer, int32(file_offset), &readBytes) {
+		var buffer_offset uint32 = 0
+		var log_record recovery.LogRecord
+		for log_recovery.DeserializeLogRecord(log_recovery.log_buffer[buffer_offset:readBytes], &log_record) {
+			if log_recovery.isBeyondRecoveryTarget(&log_record) {
+				isTargetReached = true
+				break
+			}
+			if log_record.Lsn > greatestLSN {
+				greatestLSN = log_record.Lsn
+			}
+			if log_record.Txn_id != common.InvalidTxnID {
+				if log_record.Log_record_type == recovery.COMMIT || log_record.Log_record_type == recovery.ABORT {
+					// (ABORT record is written after rollback of the transaction finished)
+					delete(log_recovery.active_txn, log_record.Txn_id)
+				} else {
+					log_recovery.active_txn[log_record.Txn_id] = log_record.Lsn
+				}
+			}
+			if log_record.Log_record_type == recovery.RELEASEPAGES {
+				if log_record.Txn_id == common.InvalidTxnID {
+					log_recovery.addPendingReleases(&log_record)
+				} else {
+					record := log_record
+					log_recovery.txn_releases[log_record.Txn_id] = append(log_recovery.txn_releases[log_record.Txn_id], &record)
+				}
+			} else if log_record.Log_record_type == recovery.COMMIT {
+				for _, record := range log_recovery.txn_releases[log_record.Txn_id] {
+					log_recovery.addPendingReleases(record)
+				}
+				delete(log_recovery.txn_releases, log_record.Txn_id)
+			}
+			// CLR of undone tuple_overflow record is also a deallocation
+			if log_record.GetRedoType() == recovery.DEALLOCATEPAGE {
+				log_recovery.free_page_ids = appendPageIdIfNotExist(log_recovery.free_page_ids, log_record.Page_id)
+				log_recovery.dealloc_lsns[log_record.Page_id] = log_record.Lsn
+				delete(log_recovery.pending_releases, log_record.Page_id)
+			} else if log_record.Log_record_type == recovery.REUSEPAGE {
+				log_recovery.free_page_ids = removePageId(log_recovery.free_page_ids, log_record.Page_id)
+				delete(log_recovery.pending_releases, log_record.Page_id)
+			}
+			log_recovery.lsn_mapping[log_record.Lsn] = int(file_offset + buffer_offset)
+			for _, pageId := range getModifiedPageIds(&log_record) {
+				if _, ok := log_recovery.dirty_page_table[pageId]; !ok {
+					log_recovery.dirty_page_table[pageId] = log_record.Lsn
+				}
+			}
+			buffer_offset += log_record.Size
+		}
+		if buffer_offset == 0 {
+			// incomplete log record
+			break
+		}
+		file_offset += buffer_offset
+	}
+	if isTargetReached {
+		// log records after the target must not be redone at this and later recoveries
+		log_recovery.log_manager.DiscardLogAfter(file_offset)
+	} else if file_offset < uint32(log_recovery.disk_manager.GetLogFileSize()) {
+		// log record at file_offset is broken (torn write at tail of log).
+		// it and following data are discarded so that log records appended later can be read
+		log_recovery.log_manager.DiscardLogAfter(file_offset)
+	}
+	// records before the checkpoint may be read again here. but the result is same
+	// because state of each page in the list is decided by the last record of the page
+	log_recovery.disk_manager.SetFreePageIds(log_recovery.free_page_ids)
+	// pages which are not released yet are released after recovery (see access.ReleasePendingOverflowPages)
+	pendingPageIds := make([]types.PageID, 0)
+	pendingChainPageIds := make([]types.PageID, 0)
+	for pageId, isChain := range log_recovery.pending_releases {
+		if isChain {
+			pendingChainPageIds = append(pendingChainPageIds, pageId)
+		} else {
+			pendingPageIds = append(pendingPageIds, pageId)
+		}
+	}
+	log_recovery.buffer_pool_manager.AddPendingReleases(pendingPageIds, pendingChainPageIds)
+
+	// redo starts from the oldest log record which may be not reflected to page on disk
+	redoStartOffset := file_offset
+	if len(log_recovery.dirty_page_table) > 0 {
+		minRecLSN := types.LSN(math.MaxInt32)
+		for _, recLSN := range log_recovery.dirty_page_table {
+			if recLSN < minRecLSN {
+				minRecLSN = recLSN
+			}
+		}
+		for lsn, offset := range log_recovery.lsn_mapping {
+			if lsn >= minRecLSN && uint32(offset) < redoStartOffset {
+				redoStartOffset = uint32(offset)
+			}
+		}
+	}
+	return greatestLSN, redoStartOffset
+}
+
+// registers pages on a RELEASEPAGES record as pages to be released
+func (log_recovery *LogRecovery) addPendingReleases(log_record *recovery.LogRecord) {
+	for _, pageId := range log_record.Release_page_ids {
+		log_recovery.pending_releases[pageId] = false
+	}
+	for _, pageId := range log_record.Release_chain_page_ids {
+		log_recovery.pending_releases[pageId] = true
+	}
+}
+
+/*
+* when the page was not dirty at the time or the record is older than recLSN of the page,
+* changes by the record are already reflected to page on disk.
+* records written before deallocation of the page are not redone because the page may be reused
+* (page data on disk may be one of the new user)
+ */
+func (log_recovery *LogRecovery) isRedoNeeded(log_record *recovery.LogRecord) bool {
+	pageIds := getModifiedPageIds(log_record)
+	if len(pageIds) == 0 {
+		return true
+	}
+	for _, pageId := range pageIds {
+		if deallocLSN, ok := log_recovery.dealloc_lsns[pageId]; ok && log_record.Lsn < deallocLSN {
+			continue
+		}
+		if recLSN, ok := log_recovery.dirty_page_table[pageId]; ok && recLSN <= log_record.Lsn {
+			return true
+		}
+	}
+	return false
+}
+
 /*
 *redo phase on TABLE PAGE level(table/table_page.h)
-*read log file from the beginning to end (you must prefetch log records into
-*log buffer to reduce unnecessary I/O operations), remember to compare page's
-*LSN with log_record's sequence number, and also build active_txn table &
-*lsn_mapping table
+*analysis phase is done first. then log records are read from the oldest recLSN of dirty page table
+*to the end (you must prefetch log records into log buffer to reduce unnecessary I/O operations)
+*and all of them including CLRs are repeated. remember to compare page's LSN with log_record's sequence number
 * first return value: greatest LSN of log entries
 * seconde return value: when redo operation occured, value is true
  */
 func (log_recovery *LogRecovery) Redo() (types.LSN, bool) {
-	// readLogLoopCnt := 0
-	// deserializeLoopCnt := 0
-	greatestLSN := 0
-	log_recovery.log_buffer = make([]byte, common.LogBufferSize)
-	var file_offset uint32 = 0
+	log_recovery.log_buffer = make([]byte, recovery.LogBufferSizeOf(log_recovery.disk_manager.GetPageSize()))
+	greatestLSN, file_offset := log_recovery.analyze()
+	// log records written at undo phase (CLRs) must have greater LSN than existing ones
+	if log_recovery.log_manager.GetNextLSN() <= greatestLSN {
+		log_recovery.log_manager.SetNextLSN(greatestLSN + 1)
+	}
+
 	var readBytes uint32
 	isRedoOccured := false
 	for log_recovery.disk_manager.ReadLog(log_recovery.log_buffer, int32(file_offset), &readBytes) {
 		var buffer_offset uint32 = 0
 		var log_record recovery.LogRecord
-		// fmt.Printf("outer file_offset %d\n", file_offset)
-		// readLogLoopCnt++
-		// if readLogLoopCnt > 100 {
-		// 	//fmt.Printf("file_offset %d\n", file_offset)
-		// 	panic("readLogLoopCnt is illegal")
-		// }
 		for log_recovery.DeserializeLogRecord(log_recovery.log_buffer[buffer_offset:readBytes], &log_record) {
-			// fmt.Printf("inner file_offset %d\n", file_offset)
-			// fmt.Printf("inner buffer_offset %d\n", buffer_offset)
-			// fmt.Println(log_record)
-			// deserializeLoopCnt++
-			// if deserializeLoopCnt > 100 {
-			// 	fmt.Printf("file_offset %d\n", file_offset)
-			// 	fmt.Printf("buffer_offset %d\n", buffer_offset)
-			// 	fmt.Println(log_record)
-			// 	panic("deserializeLoopCnt is illegal")
-			// }
-			if int(log_record.Lsn) > greatestLSN {
-				greatestLSN = int(log_record.Lsn)
-			}
-			log_recovery.active_txn[log_record.Txn_id] = log_record.Lsn
-			log_recovery.lsn_mapping[log_record.Lsn] = int(file_offset + buffer_offset)
-			if log_record.Log_record_type == recovery.INSERT {
+			// CLR is redone as the compensating operation
+			redo_type := log_record.GetRedoType()
+			if !log_recovery.isRedoNeeded(&log_record) {
+				// do nothing
+			} else if redo_type == recovery.INSERT {
 				page_ :=
 					access.CastPageAsTablePage(log_recovery.buffer_pool_manager.FetchPage(log_record.Insert_rid.GetPageId()))
 				if page_.GetLSN() < log_record.GetLSN() {
@@ -146,16 +504,16 @@ func (log_recovery *LogRecovery) Redo() (types.LSN, bool) {
 					isRedoOccured = true
 				}
 				log_recovery.buffer_pool_manager.UnpinPage(log_record.Insert_rid.GetPageId(), true)
-			} else if log_record.Log_record_type == recovery.APPLYDELETE {
+			} else if redo_type == recovery.APPLYDELETE {
 				page_ :=
 					access.CastPageAsTablePage(log_recovery.buffer_pool_manager.FetchPage(log_record.Delete_rid.GetPageId()))
 				if page_.GetLSN() < log_record.GetLSN() {
-					page_.ApplyDelete(&log_record.Delete_rid, nil, nil)
+					page_.ApplyDelete(&log_record.Delete_rid, nil, log_recovery.log_manager)
 					page_.SetLSN(log_record.GetLSN())
 					isRedoOccured = true
 				}
 				log_recovery.buffer_pool_manager.UnpinPage(log_record.Delete_rid.GetPageId(), true)
-			} else if log_record.Log_record_type == recovery.MARKDELETE {
+			} else if redo_type == recovery.MARKDELETE {
 				page_ :=
 					access.CastPageAsTablePage(log_recovery.buffer_pool_manager.FetchPage(log_record.Delete_rid.GetPageId()))
 				if page_.GetLSN() < log_record.GetLSN() {
@@ -164,7 +522,7 @@ func (log_recovery *LogRecovery) Redo() (types.LSN, bool) {
 					isRedoOccured = true
 				}
 				log_recovery.buffer_pool_manager.UnpinPage(log_record.Delete_rid.GetPageId(), true)
-			} else if log_record.Log_record_type == recovery.ROLLBACKDELETE {
+			} else if redo_type == recovery.ROLLBACKDELETE {
 				page_ :=
 					access.CastPageAsTablePage(log_recovery.buffer_pool_manager.FetchPage(log_record.Delete_rid.GetPageId()))
 				if page_.GetLSN() < log_record.GetLSN() {
@@ -173,7 +531,7 @@ func (log_recovery *LogRecovery) Redo() (types.LSN, bool) {
 					isRedoOccured = true
 				}
 				log_recovery.buffer_pool_manager.UnpinPage(log_record.Delete_rid.GetPageId(), true)
-			} else if log_record.Log_record_type == recovery.UPDATE {
+			} else if redo_type == recovery.UPDATE {
 				page_ :=
 					access.CastPageAsTablePage(log_recovery.buffer_pool_manager.FetchPage(log_record.Update_rid.GetPageId()))
 				if page_.GetLSN() < log_record.GetLSN() {
@@ -184,13 +542,7 @@ func (log_recovery *LogRecovery) Redo() (types.LSN, bool) {
 					isRedoOccured = true
 				}
 				log_recovery.buffer_pool_manager.UnpinPage(log_record.Update_rid.GetPageId(), true)
-			} else if log_record.Log_record_type == recovery.BEGIN {
-				// fmt.Println("found BEGIN log record")
-				log_recovery.active_txn[log_record.Txn_id] = log_record.Lsn
-			} else if log_record.Log_record_type == recovery.COMMIT {
-				// fmt.Println("found COMMIT log record")
-				delete(log_recovery.active_txn, log_record.Txn_id)
-			} else if log_record.Log_record_type == recovery.NEWPAGE {
+			} else if redo_type == recovery.NEWPAGE {
 				var page_id types.PageID
 				//new_page := access.CastPageAsTablePage(log_recovery.buffer_pool_manager.NewPage(&page_id, nil))
 				new_page := access.CastPageAsTablePage(log_recovery.buffer_pool_manager.NewPage())
@@ -199,73 +551,201 @@ func (log_recovery *LogRecovery) Redo() (types.LSN, bool) {
 				new_page.Init(page_id, log_record.Prev_page_id, log_recovery.log_manager, nil, nil)
 				//log_recovery.buffer_pool_manager.FlushPage(page_id)
 				log_recovery.buffer_pool_manager.UnpinPage(page_id, true)
+			} else if redo_type == recovery.TUPLE_OVERFLOW {
+				overflowPage := access.CastPageAsTupleOverflowPage(log_recovery.buffer_pool_manager.FetchPage(log_record.Page_id))
+				if overflowPage.GetLSN() < log_record.GetLSN() {
+					overflowPage.Init(log_record.Page_id, log_record.Overflow_next_page_id, log_record.Overflow_data)
+					overflowPage.SetLSN(log_record.GetLSN())
+					isRedoOccured = true
+				}
+				log_recovery.buffer_pool_manager.UnpinPage(log_record.Page_id, true)
+			} else if redo_type == recovery.HASH_TABLE_INSERT ||
+				redo_type == recovery.HASH_TABLE_REMOVE {
+				if redo_type == recovery.HASH_TABLE_INSERT && log_record.Hash_overflow_page_id != types.InvalidPageID {
+					// long key is written to overflow page
+					overflowPage := (*page.HashTableOverflowPage)(unsafe.Pointer(
+						&log_recovery.buffer_pool_manager.FetchPage(log_record.Hash_overflow_page_id).Data()[0]))
+					if overflowPage.GetLSN() < log_record.GetLSN() {
+						overflowPage.WriteKey(log_record.Hash_overflow_offset, log_record.Hash_key_data)
+						overflowPage.SetLSN(log_record.GetLSN())
+						isRedoOccured = true
+					}
+					log_recovery.buffer_pool_manager.UnpinPage(log_record.Hash_overflow_page_id, true)
+				}
+				blockPage := (*page.HashTableBlockPage)(unsafe.Pointer(
+					&log_recovery.buffer_pool_manager.FetchPage(log_record.Hash_block_page_id).Data()[0]))
+				if blockPage.GetLSN() < log_record.GetLSN() {
+					if redo_type == recovery.HASH_TABLE_INSERT {
+						blockPage.Insert(log_record.Hash_offset, page.NewHashTablePair(log_record.Hash_key, log_record.Hash_value,
+							log_record.Hash_key_data, log_record.Hash_overflow_page_id, log_record.Hash_overflow_offset))
+					} else {
+						blockPage.Remove(log_record.Hash_offset)
+					}
+					blockPage.SetLSN(log_record.GetLSN())
+					isRedoOccured = true
+				}
+				log_recovery.buffer_pool_manager.UnpinPage(log_record.Hash_block_page_id, true)
 			}
 			buffer_offset += log_record.Size
 		}
-		// incomplete log record
-		// fmt.Printf("buffer_offset %d\n", buffer_offset)
+		if buffer_offset == 0 {
+			// incomplete log record
+			break
+		}
 		file_offset += buffer_offset
 	}
-	return types.LSN(greatestLSN), isRedoOccured
+	return greatestLSN, isRedoOccured
+}
+
+// writes CLR of the compensating operation recorded on log_record and returns LSN of the CLR
+func (log_recovery *LogRecovery) writeCLR(log_record *recovery.LogRecord, undo_next_lsn types.LSN) types.LSN {
+	lsn, err := log_recovery.log_manager.AppendLogRecord(recovery.NewLogRecordCLR(log_record, undo_next_lsn))
+	common.SH_Assert(err == nil, "CLR can't be appended")
+	log_recovery.active_txn[log_record.Txn_id] = lsn
+	return lsn
+}
+
+// undo an operation recorded on log_record and write CLR of it.
+// page operations are done without logging, so logging must be deactivated
+func (log_recovery *LogRecovery) undoRecord(log_record *recovery.LogRecord) {
+	txn_id := log_record.Txn_id
+	prev_lsn := log_recovery.active_txn[txn_id]
+	undo_next_lsn := log_record.Prev_lsn
+	if log_record.Log_record_type == recovery.INSERT {
+		page_ :=
+			access.CastPageAsTablePage(log_recovery.buffer_pool_manager.FetchPage(log_record.Insert_rid.GetPageId()))
+		page_.ApplyDelete(&log_record.Insert_rid, nil, log_recovery.log_manager)
+		page_.SetLSN(log_recovery.writeCLR(recovery.NewLogRecordInsertDelete(txn_id, prev_lsn, recovery.APPLYDELETE,
+			log_record.Insert_rid, &log_record.Insert_tuple), undo_next_lsn))
+		log_recovery.buffer_pool_manager.UnpinPage(log_record.Insert_rid.GetPageId(), true)
+	} else if log_record.Log_record_type == recovery.APPLYDELETE {
+		page_ :=
+			access.CastPageAsTablePage(log_recovery.buffer_pool_manager.FetchPage(log_record.Delete_rid.GetPageId()))
+		log_record.Delete_tuple.SetRID(&log_record.Delete_rid)
+		rid, err := page_.InsertTuple(&log_record.Delete_tuple, log_recovery.log_manager, nil, nil)
+		if err == nil {
+			page_.SetLSN(log_recovery.writeCLR(recovery.NewLogRecordInsertDelete(txn_id, prev_lsn, recovery.INSERT,
+				*rid, &log_record.Delete_tuple), undo_next_lsn))
+		}
+		log_recovery.buffer_pool_manager.UnpinPage(log_record.Delete_rid.GetPageId(), true)
+	} else if log_record.Log_record_type == recovery.MARKDELETE {
+		page_ :=
+			access.CastPageAsTablePage(log_recovery.buffer_pool_manager.FetchPage(log_record.Delete_rid.GetPageId()))
+		page_.RollbackDelete(&log_record.Delete_rid, nil, log_recovery.log_manager)
+		page_.SetLSN(log_recovery.writeCLR(recovery.NewLogRecordInsertDelete(txn_id, prev_lsn, recovery.ROLLBACKDELETE,
+			log_record.Delete_rid, new(tuple.Tuple)), undo_next_lsn))
+		log_recovery.buffer_pool_manager.UnpinPage(log_record.Delete_rid.GetPageId(), true)
+	} else if log_record.Log_record_type == recovery.ROLLBACKDELETE {
+		page_ :=
+			access.CastPageAsTablePage(log_recovery.buffer_pool_manager.FetchPage(log_record.Delete_rid.GetPageId()))
+		page_.MarkDelete(&log_record.Delete_rid, nil, nil, log_recovery.log_manager)
+		page_.SetLSN(log_recovery.writeCLR(recovery.NewLogRecordInsertDelete(txn_id, prev_lsn, recovery.MARKDELETE,
+			log_record.Delete_rid, new(tuple.Tuple)), undo_next_lsn))
+		log_recovery.buffer_pool_manager.UnpinPage(log_record.Delete_rid.GetPageId(), true)
+	} else if log_record.Log_record_type == recovery.UPDATE {
+		page_ :=
+			access.CastPageAsTablePage(log_recovery.buffer_pool_manager.FetchPage(log_record.Update_rid.GetPageId()))
+		// UpdateTuple overwrites New_tuple argument with current data of the tuple
+		page_.UpdateTuple(&log_record.Old_tuple, nil, nil, &log_record.New_tuple, &log_record.Update_rid, nil, nil, log_recovery.log_manager)
+		page_.SetLSN(log_recovery.writeCLR(recovery.NewLogRecordUpdate(txn_id, prev_lsn, recovery.UPDATE,
+			log_record.Update_rid, log_record.New_tuple, log_record.Old_tuple), undo_next_lsn))
+		log_recovery.buffer_pool_manager.UnpinPage(log_record.Update_rid.GetPageId(), true)
+	} else if log_record.Log_record_type == recovery.TUPLE_OVERFLOW {
+		// the overflow page is released. CLR of it has body of deallocatepage record
+		clr_body := recovery.NewLogRecordPageDeallocation(recovery.DEALLOCATEPAGE, log_record.Page_id)
+		clr_body.Txn_id = txn_id
+		clr_body.Prev_lsn = prev_lsn
+		log_recovery.writeCLR(clr_body, undo_next_lsn)
+		if !containsPageId(log_recovery.buffer_pool_manager.GetFreePageIds(), log_record.Page_id) {
+			log_recovery.buffer_pool_manager.DeletePage(log_record.Page_id)
+		}
+	} else if log_record.Log_record_type == recovery.HASH_TABLE_INSERT ||
+		log_record.Log_record_type == recovery.HASH_TABLE_REMOVE {
+		// CLR is written by hash table because location of the entry may differ from the one on log_record
+		txn := access.NewTransaction(txn_id)
+		txn.SetPrevLSN(prev_lsn)
+		txn.SetUndoNextLSN(undo_next_lsn)
+		ht := hash.NewLinearProbeHashTable(log_recovery.buffer_pool_manager, log_recovery.log_manager, 0, log_record.Hash_header_page_id)
+		var err error
+		if log_record.Log_record_type == recovery.HASH_TABLE_INSERT {
+			err = ht.UndoInsert(log_record.Hash_block_page_id, log_record.Hash_offset, log_record.Hash_key_data, log_record.Hash_value, txn)
+		} else {
+			err = ht.UndoRemove(log_record.Hash_block_page_id, log_record.Hash_offset, log_record.Hash_key_data, log_record.Hash_value, txn)
+		}
+		if err != nil {
+			// undo of the operation can not be skipped
+			panic("undo of hash index operation failed: " + err.Error())
+		}
+		log_recovery.active_txn[txn_id] = txn.GetPrevLSN()
+	}
 }
 
 /*
 *undo phase on TABLE PAGE level(table/table_page.h)
-*iterate through active txn map and undo each operation
+*undo operations of transactions in active txn map in descending order of LSN.
+*each undone operation is logged as a CLR which points the record to be undone next (undoNextLSN)
+*and CLRs are never undone, so operations are not undone twice even if system crashes
+*during undo phase or rollback of a transaction. ABORT record is written when all operations of
+*a transaction are undone. logging must be deactivated (records are written directly)
 * when undo operation occured, return value becomes true
  */
 func (log_recovery *LogRecovery) Undo() bool {
-	var file_offset int
+	return log_recovery.undo(-1)
+}
+
+// for testing of crash during undo phase. Undo stops after undoing undoCnt log records
+func (log_recovery *LogRecovery) UndoPartiallyForTesting(undoCnt int) bool {
+	return log_recovery.undo(undoCnt)
+}
+
+func (log_recovery *LogRecovery) undo(limit int) bool {
 	var log_record recovery.LogRecord
 	isUndoOccured := false
-	// fmt.Println(log_recovery.active_txn)
-	// fmt.Println(log_recovery.lsn_mapping)
-	for _, lsn := range log_recovery.active_txn {
-		//lsn = it.second
-		for lsn != common.InvalidLSN {
-			//fmt.Printf("lsn at Undo loop top: %d\n", lsn)
-			file_offset = log_recovery.lsn_mapping[lsn]
-			// fmt.Printf("file_offset: %d\n", file_offset)
-			var readBytes uint32
-			log_recovery.disk_manager.ReadLog(log_recovery.log_buffer, int32(file_offset), &readBytes)
-			log_recovery.DeserializeLogRecord(log_recovery.log_buffer[:readBytes], &log_record)
-			if log_record.Log_record_type == recovery.INSERT {
-				page_ :=
-					access.CastPageAsTablePage(log_recovery.buffer_pool_manager.FetchPage(log_record.Insert_rid.GetPageId()))
-				// fmt.Printf("insert log type, page lsn:%d, log lsn:%d", page.GetLSN(), log_record.GetLSN())
-				page_.ApplyDelete(&log_record.Insert_rid, nil, log_recovery.log_manager)
-				log_recovery.buffer_pool_manager.UnpinPage(log_record.Insert_rid.GetPageId(), true)
-				isUndoOccured = true
-			} else if log_record.Log_record_type == recovery.APPLYDELETE {
-				page_ :=
-					access.CastPageAsTablePage(log_recovery.buffer_pool_manager.FetchPage(log_record.Delete_rid.GetPageId()))
-				log_record.Delete_tuple.SetRID(&log_record.Delete_rid)
-				page_.InsertTuple(&log_record.Delete_tuple, log_recovery.log_manager, nil, nil)
-				log_recovery.buffer_pool_manager.UnpinPage(log_record.Delete_rid.GetPageId(), true)
-				isUndoOccured = true
-			} else if log_record.Log_record_type == recovery.MARKDELETE {
-				page_ :=
-					access.CastPageAsTablePage(log_recovery.buffer_pool_manager.FetchPage(log_record.Delete_rid.GetPageId()))
-				page_.RollbackDelete(&log_record.Delete_rid, nil, log_recovery.log_manager)
-				log_recovery.buffer_pool_manager.UnpinPage(log_record.Delete_rid.GetPageId(), true)
-				isUndoOccured = true
-			} else if log_record.Log_record_type == recovery.ROLLBACKDELETE {
-				page_ :=
-					access.CastPageAsTablePage(log_recovery.buffer_pool_manager.FetchPage(log_record.Delete_rid.GetPageId()))
-				page_.MarkDelete(&log_record.Delete_rid, nil, nil, log_recovery.log_manager)
-				log_recovery.buffer_pool_manager.UnpinPage(log_record.Delete_rid.GetPageId(), true)
-				isUndoOccured = true
-			} else if log_record.Log_record_type == recovery.UPDATE {
-				page_ :=
-					access.CastPageAsTablePage(log_recovery.buffer_pool_manager.FetchPage(log_record.Update_rid.GetPageId()))
-				page_.UpdateTuple(&log_record.Old_tuple, nil, nil, &log_record.New_tuple, &log_record.Update_rid, nil, nil, log_recovery.log_manager)
-				log_recovery.buffer_pool_manager.UnpinPage(log_record.Update_rid.GetPageId(), true)
-				isUndoOccured = true
+	// LSN of the record to be undone next of each transaction
+	undo_next := make(map[types.TxnID]types.LSN)
+	for txn_id, lsn := range log_recovery.active_txn {
+		undo_next[txn_id] = lsn
+	}
+	undoCnt := 0
+	for len(undo_next) > 0 && (limit < 0 || undoCnt < limit) {
+		// the newest record is undone first
+		txn_id := types.TxnID(common.InvalidTxnID)
+		lsn := types.LSN(common.InvalidLSN)
+		for id, next_lsn := range undo_next {
+			if next_lsn > lsn {
+				txn_id = id
+				lsn = next_lsn
 			}
-			lsn = log_record.Prev_lsn
-			// fmt.Printf("lsn at Undo loop bottom: %d\n", lsn)
+		}
+
+		file_offset, ok := log_recovery.lsn_mapping[lsn]
+		common.SH_Assert(ok, "log record to undo is not found!")
+		var readBytes uint32
+		log_recovery.disk_manager.ReadLog(log_recovery.log_buffer, int32(file_offset), &readBytes)
+		log_recovery.DeserializeLogRecord(log_recovery.log_buffer[:readBytes], &log_record)
+
+		next_lsn := log_record.Prev_lsn
+		switch log_record.Log_record_type {
+		case recovery.CLR:
+			// operations after undo_next_lsn are already undone
+			next_lsn = log_record.Undo_next_lsn
+		case recovery.INSERT, recovery.APPLYDELETE, recovery.MARKDELETE, recovery.ROLLBACKDELETE, recovery.UPDATE,
+			recovery.HASH_TABLE_INSERT, recovery.HASH_TABLE_REMOVE, recovery.TUPLE_OVERFLOW:
+			log_recovery.undoRecord(&log_record)
+			isUndoOccured = true
+			undoCnt++
+		}
+
+		if next_lsn == common.InvalidLSN {
+			// all operations of the transaction are undone
+			_, err := log_recovery.log_manager.AppendLogRecord(
+				recovery.NewLogRecordTxn(txn_id, log_recovery.active_txn[txn_id], recovery.ABORT))
+			common.SH_Assert(err == nil, "log record of abort can't be appended")
+			delete(log_recovery.active_txn, txn_id)
+			delete(undo_next, txn_id)
+		} else {
+			undo_next[txn_id] = next_lsn
 		}
 	}
 	return isUndoOccured
-	//log_recovery.buffer_pool_manager.FlushAllPages()
 }
@@ -0,0 +1,104 @@
+package log_recovery
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/samehada"
+	testingpkg "github.com/ryogrid/SamehadaDB/testing"
+)
+
+func TestGroupCommit(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+	os.Remove(t.Name() + ".db")
+	os.Remove(t.Name() + ".log")
+
+	samehada_instance := samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	log_manager := samehada_instance.GetLogManager()
+	txn_mgr := samehada_instance.GetTransactionManager()
+	log_manager.RunFlushThread()
+
+	const threadNum = 16
+	const txnNumPerThread = 50
+	isDurable := true
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	flushNumAtStart := samehada_instance.GetDiskManager().GetNumFlushes()
+	for ii := 0; ii < threadNum; ii++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for jj := 0; jj < txnNumPerThread; jj++ {
+				txn := txn_mgr.Begin(nil)
+				txn_mgr.Commit(txn)
+				// commit record must be durable when Commit returns
+				if log_manager.GetPersistentLSN() < txn.GetPrevLSN() {
+					mutex.Lock()
+					isDurable = false
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	flushNum := samehada_instance.GetDiskManager().GetNumFlushes() - flushNumAtStart
+	fmt.Printf("commits: %d, flushes: %d\n", threadNum*txnNumPerThread, flushNum)
+	testingpkg.Assert(t, isDurable, "commit returned before its commit record was flushed")
+	testingpkg.Assert(t, flushNum <= threadNum*txnNumPerThread, "")
+
+	// log records appended after stop are flushed synchronously
+	log_manager.StopFlushThread()
+	txn := txn_mgr.Begin(nil)
+	txn_mgr.Commit(txn)
+	testingpkg.Assert(t, log_manager.GetPersistentLSN() >= txn.GetPrevLSN(), "")
+
+	common.TempSuppressOnMemStorage = false
+	samehada_instance.Shutdown(true)
+	common.TempSuppressOnMemStorageMutex.Unlock()
+}
+
+// commits of empty transactions from parallel goroutines. reports commits per second
+func benchmarkCommit(b *testing.B, isGroupCommit bool) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+	dbName := "BenchmarkCommit"
+	os.Remove(dbName + ".db")
+	os.Remove(dbName + ".log")
+
+	samehada_instance := samehada.NewSamehadaInstance(dbName, common.BufferPoolMaxFrameNumForTest)
+	if isGroupCommit {
+		samehada_instance.GetLogManager().RunFlushThread()
+	}
+	txn_mgr := samehada_instance.GetTransactionManager()
+	flushNumAtStart := samehada_instance.GetDiskManager().GetNumFlushes()
+
+	b.SetParallelism(64)
+	b.ResetTimer()
+	start := time.Now()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			txn_mgr.Commit(txn_mgr.Begin(nil))
+		}
+	})
+	elapsed := time.Since(start)
+	b.StopTimer()
+	b.ReportMetric(float64(b.N)/elapsed.Seconds(), "commits/s")
+	b.ReportMetric(float64(samehada_instance.GetDiskManager().GetNumFlushes()-flushNumAtStart)/float64(b.N), "flushes/commit")
+
+	common.TempSuppressOnMemStorage = false
+	samehada_instance.Shutdown(true)
+	common.TempSuppressOnMemStorageMutex.Unlock()
+}
+
+func BenchmarkCommitWithSyncFlush(b *testing.B) {
+	benchmarkCommit(b, false)
+}
+
+func BenchmarkCommitWithGroupCommit(b *testing.B) {
+	benchmarkCommit(b, true)
+}
@@ -8,10 +8,14 @@ import (
 	"math"
 	"math/rand"
 	"os"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/container/hash"
+	"github.com/ryogrid/SamehadaDB/recovery"
 	"github.com/ryogrid/SamehadaDB/recovery/log_recovery"
 	"github.com/ryogrid/SamehadaDB/storage/access"
 	"github.com/ryogrid/SamehadaDB/storage/page"
@@ -57,7 +61,8 @@ func TestLogSererializeAndDeserialize(t *testing.T) {
 		tuple_ := tuple.NewTuple(rid, 100, dummyData)
 		log_rec := recovery.NewLogRecordInsertDelete(txn.GetTransactionId(), txn.GetPrevLSN(),
 			recovery.INSERT, *rid, tuple_)
-		lsn := lm.AppendLogRecord(log_rec)
+		lsn, err := lm.AppendLogRecord(log_rec)
+		testingpkg.Ok(t, err)
 		txn.SetPrevLSN(lsn)
 		cntup_num++
 		////////////////////////
@@ -73,7 +78,8 @@ func TestLogSererializeAndDeserialize(t *testing.T) {
 		tuple_new := tuple.NewTuple(rid, 100, dummyData2)
 		log_rec = recovery.NewLogRecordUpdate(txn.GetTransactionId(), txn.GetPrevLSN(),
 			recovery.UPDATE, *rid, *tuple_old, *tuple_new)
-		lsn = lm.AppendLogRecord(log_rec)
+		lsn, err = lm.AppendLogRecord(log_rec)
+		testingpkg.Ok(t, err)
 		txn.SetPrevLSN(lsn)
 		cntup_num++
 		////////////////////////
@@ -86,7 +92,8 @@ func TestLogSererializeAndDeserialize(t *testing.T) {
 		// copy(dummyData, dummyTupleData1)
 		log_rec = recovery.NewLogRecordNewPage(txn.GetTransactionId(), txn.GetPrevLSN(),
 			recovery.NEWPAGE, types.PageID(cntup_num))
-		lsn = lm.AppendLogRecord(log_rec)
+		lsn, err = lm.AppendLogRecord(log_rec)
+		testingpkg.Ok(t, err)
 		txn.SetPrevLSN(lsn)
 		cntup_num++
 
@@ -263,6 +270,199 @@ func TestRedo(t *testing.T) {
 	common.TempSuppressOnMemStorageMutex.Unlock()
 }
 
+func TestTornLogRecord(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+	os.Remove(t.Name() + ".db")
+	os.Remove(t.Name() + ".log")
+
+	samehada_instance := samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	samehada_instance.GetLogManager().ActivateLogging()
+
+	col1 := column.NewColumn("a", types.Varchar, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	col2 := column.NewColumn("b", types.Integer, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	schema_ := schema.NewSchema([]*column.Column{col1, col2})
+
+	txn := samehada_instance.GetTransactionManager().Begin(nil)
+	test_table := access.NewTableHeap(samehada_instance.GetBufferPoolManager(), samehada_instance.GetLogManager(),
+		samehada_instance.GetLockManager(), txn)
+	first_page_id := test_table.GetFirstPageId()
+	rid1, _ := test_table.InsertTuple(ConstructTuple(schema_), txn)
+	samehada_instance.GetTransactionManager().Commit(txn)
+
+	txn = samehada_instance.GetTransactionManager().Begin(nil)
+	rid2, _ := test_table.InsertTuple(ConstructTuple(schema_), txn)
+	samehada_instance.GetTransactionManager().Commit(txn)
+
+	fmt.Println("System crash")
+	samehada_instance.CloseFilesForTesting()
+
+	// break the last byte of the log (COMMIT record of second txn) as torn write
+	f, err := os.OpenFile(t.Name()+".log", os.O_RDWR, 0666)
+	testingpkg.Ok(t, err)
+	fileInfo, _ := f.Stat()
+	lastByte := make([]byte, 1)
+	f.ReadAt(lastByte, fileInfo.Size()-1)
+	lastByte[0] ^= 0xff
+	f.WriteAt(lastByte, fileInfo.Size()-1)
+	f.Close()
+
+	fmt.Println("System restart...")
+	samehada_instance = samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	samehada_instance.GetLogManager().DeactivateLogging()
+	log_recovery_ := log_recovery.NewLogRecovery(
+		samehada_instance.GetDiskManager(),
+		samehada_instance.GetBufferPoolManager(),
+		samehada_instance.GetLogManager())
+	log_recovery_.Redo()
+	log_recovery_.Undo()
+	samehada_instance.GetLogManager().ActivateLogging()
+
+	// second txn is treated as uncommitted because its COMMIT record is broken
+	txn = samehada_instance.GetTransactionManager().Begin(nil)
+	test_table = access.InitTableHeap(samehada_instance.GetBufferPoolManager(), first_page_id,
+		samehada_instance.GetLogManager(), samehada_instance.GetLockManager())
+	testingpkg.Assert(t, test_table.GetTuple(rid1, txn) != nil, "committed tuple is lost")
+	testingpkg.Assert(t, test_table.GetTuple(rid2, txn) == nil, "tuple of txn whose COMMIT record is broken exists")
+	samehada_instance.GetTransactionManager().Commit(txn)
+
+	// log records appended after the broken one was discarded are read at next recovery
+	txn = samehada_instance.GetTransactionManager().Begin(nil)
+	test_table = access.InitTableHeap(samehada_instance.GetBufferPoolManager(), first_page_id,
+		samehada_instance.GetLogManager(), samehada_instance.GetLockManager())
+	rid3, _ := test_table.InsertTuple(ConstructTuple(schema_), txn)
+	samehada_instance.GetTransactionManager().Commit(txn)
+
+	fmt.Println("System crash")
+	samehada_instance.CloseFilesForTesting()
+
+	fmt.Println("System restart...")
+	samehada_instance = samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	samehada_instance.GetLogManager().DeactivateLogging()
+	log_recovery_ = log_recovery.NewLogRecovery(
+		samehada_instance.GetDiskManager(),
+		samehada_instance.GetBufferPoolManager(),
+		samehada_instance.GetLogManager())
+	log_recovery_.Redo()
+	log_recovery_.Undo()
+
+	txn = samehada_instance.GetTransactionManager().Begin(nil)
+	test_table = access.InitTableHeap(samehada_instance.GetBufferPoolManager(), first_page_id,
+		samehada_instance.GetLogManager(), samehada_instance.GetLockManager())
+	testingpkg.Assert(t, test_table.GetTuple(rid1, txn) != nil, "")
+	testingpkg.Assert(t, test_table.GetTuple(rid3, txn) != nil, "tuple inserted after recovery is lost")
+
+	common.TempSuppressOnMemStorage = false
+	samehada_instance.Shutdown(true)
+	common.TempSuppressOnMemStorageMutex.Unlock()
+}
+
+func TestFreePageListRecovery(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+	os.Remove(t.Name() + ".db")
+	os.Remove(t.Name() + ".log")
+
+	samehada_instance := samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	samehada_instance.GetLogManager().ActivateLogging()
+	bpm := samehada_instance.GetBufferPoolManager()
+
+	pageIds := make([]types.PageID, 0)
+	for ii := 0; ii < 6; ii++ {
+		pg := bpm.NewPage()
+		pageIds = append(pageIds, pg.GetPageId())
+		bpm.UnpinPage(pg.GetPageId(), true)
+	}
+	bpm.FlushAllPages()
+
+	bpm.DeletePage(pageIds[0])
+	bpm.DeletePage(pageIds[1])
+	bpm.DeletePage(pageIds[2])
+	// free page list is stored to records of the checkpoint
+	samehada_instance.GetCheckpointManager().BeginCheckpoint()
+	samehada_instance.GetCheckpointManager().EndCheckpoint()
+
+	bpm.DeletePage(pageIds[3])
+	pg := bpm.NewPage()
+	testingpkg.Equals(t, pageIds[3], pg.GetPageId())
+	bpm.UnpinPage(pg.GetPageId(), true)
+	bpm.DeletePage(pageIds[4])
+	samehada_instance.GetLogManager().Flush()
+
+	fmt.Println("System crash")
+	samehada_instance.CloseFilesForTesting()
+
+	fmt.Println("System restart...")
+	samehada_instance = samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	samehada_instance.GetLogManager().DeactivateLogging()
+	log_recovery_ := log_recovery.NewLogRecovery(
+		samehada_instance.GetDiskManager(),
+		samehada_instance.GetBufferPoolManager(),
+		samehada_instance.GetLogManager())
+	log_recovery_.Redo()
+	log_recovery_.Undo()
+
+	// free page list is rebuilt with the checkpoint and log records after it
+	freePageIds := samehada_instance.GetDiskManager().GetFreePageIds()
+	sort.Slice(freePageIds, func(i, j int) bool { return freePageIds[i] < freePageIds[j] })
+	testingpkg.Equals(t, []types.PageID{pageIds[0], pageIds[1], pageIds[2], pageIds[4]}, freePageIds)
+
+	common.TempSuppressOnMemStorage = false
+	samehada_instance.Shutdown(true)
+	common.TempSuppressOnMemStorageMutex.Unlock()
+}
+
+func TestCheckpointOfLargeFreePageList(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+	os.Remove(t.Name() + ".db")
+	os.Remove(t.Name() + ".log")
+
+	samehada_instance := samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	lm := samehada_instance.GetLogManager()
+	lm.ActivateLogging()
+
+	// free page list which is larger than log buffer (ex: after VACUUM of a large table)
+	pageNum := int(lm.GetMaxLogRecordSize()/4) + 1000
+	largeFreePageIds := make([]types.PageID, pageNum)
+	for ii := 0; ii < pageNum; ii++ {
+		largeFreePageIds[ii] = types.PageID(ii)
+	}
+	samehada_instance.GetDiskManager().SetFreePageIds(largeFreePageIds)
+
+	// Scenario: a record larger than log buffer is rejected instead of waiting for space forever
+	records := recovery.NewLogRecordsCheckpointTables(0, map[types.TxnID]types.LSN{}, map[types.PageID]types.LSN{},
+		largeFreePageIds, math.MaxUint32)
+	testingpkg.Equals(t, 1, len(records))
+	_, err := lm.AppendLogRecord(records[0])
+	testingpkg.Equals(t, recovery.ErrLogRecordTooLarge, err)
+
+	// Scenario: tables of checkpoint are split to records which fit in log buffer
+	oldestLSN := samehada_instance.GetCheckpointManager().Checkpoint()
+	testingpkg.Assert(t, oldestLSN != common.InvalidLSN, "checkpoint is not complete")
+
+	fmt.Println("System crash")
+	samehada_instance.CloseFilesForTesting()
+
+	fmt.Println("System restart...")
+	samehada_instance = samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	samehada_instance.GetLogManager().DeactivateLogging()
+	log_recovery_ := log_recovery.NewLogRecovery(
+		samehada_instance.GetDiskManager(),
+		samehada_instance.GetBufferPoolManager(),
+		samehada_instance.GetLogManager())
+	log_recovery_.Redo()
+	log_recovery_.Undo()
+
+	freePageIds := samehada_instance.GetDiskManager().GetFreePageIds()
+	sort.Slice(freePageIds, func(i, j int) bool { return freePageIds[i] < freePageIds[j] })
+	testingpkg.Equals(t, largeFreePageIds, freePageIds)
+
+	common.TempSuppressOnMemStorage = false
+	samehada_instance.Shutdown(true)
+	common.TempSuppressOnMemStorageMutex.Unlock()
+}
+
 func TestUndo(t *testing.T) {
 	common.TempSuppressOnMemStorageMutex.Lock()
 	common.TempSuppressOnMemStorage = true
@@ -415,6 +615,150 @@ func TestUndo(t *testing.T) {
 	common.TempSuppressOnMemStorageMutex.Unlock()
 }
 
+func TestRedoAndUndoOfLargeTuple(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+	os.Remove(t.Name() + ".db")
+	os.Remove(t.Name() + ".log")
+
+	samehada_instance := samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	samehada_instance.GetLogManager().ActivateLogging()
+
+	col1 := column.NewColumn("a", types.Integer, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	col2 := column.NewColumn("b", types.Varchar, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	schema_ := schema.NewSchema([]*column.Column{col1, col2})
+	largeStr1 := strings.Repeat("a", common.PageSize*3)
+	largeStr2 := strings.Repeat("b", common.PageSize*2)
+
+	txn := samehada_instance.GetTransactionManager().Begin(nil)
+	test_table := access.NewTableHeap(
+		samehada_instance.GetBufferPoolManager(),
+		samehada_instance.GetLogManager(),
+		samehada_instance.GetLockManager(),
+		txn)
+	first_page_id := test_table.GetFirstPageId()
+	rid1, err := test_table.InsertTuple(tuple.NewTupleFromSchema([]types.Value{types.NewInteger(1), types.NewVarchar(largeStr1)}, schema_), txn)
+	testingpkg.Ok(t, err)
+	samehada_instance.GetTransactionManager().Commit(txn)
+
+	// overflow pages of the tuple inserted by this txn are released at recovery
+	txn = samehada_instance.GetTransactionManager().Begin(nil)
+	rid2, err := test_table.InsertTuple(tuple.NewTupleFromSchema([]types.Value{types.NewInteger(2), types.NewVarchar(largeStr2)}, schema_), txn)
+	testingpkg.Ok(t, err)
+	samehada_instance.GetLogManager().Flush()
+
+	fmt.Println("System crash before commit")
+	samehada_instance.CloseFilesForTesting()
+
+	fmt.Println("System restart...")
+	samehada_instance = samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	samehada_instance.GetLogManager().DeactivateLogging()
+	log_recovery_ := log_recovery.NewLogRecovery(
+		samehada_instance.GetDiskManager(),
+		samehada_instance.GetBufferPoolManager(),
+		samehada_instance.GetLogManager())
+	log_recovery_.Redo()
+	log_recovery_.Undo()
+	testingpkg.Assert(t, len(samehada_instance.GetDiskManager().GetFreePageIds()) > 0, "overflow pages of aborted txn are not released")
+	samehada_instance.GetLogManager().ActivateLogging()
+
+	test_table = access.InitTableHeap(
+		samehada_instance.GetBufferPoolManager(),
+		first_page_id,
+		samehada_instance.GetLogManager(),
+		samehada_instance.GetLockManager())
+	txn = samehada_instance.GetTransactionManager().Begin(nil)
+	tuple1 := test_table.GetTuple(rid1, txn)
+	testingpkg.Assert(t, tuple1 != nil, "committed large tuple is lost")
+	testingpkg.Equals(t, largeStr1, tuple1.GetValue(schema_, 1).ToVarchar())
+	testingpkg.Assert(t, test_table.GetTuple(rid2, txn) == nil, "large tuple of aborted txn exists")
+	samehada_instance.GetTransactionManager().Commit(txn)
+
+	common.TempSuppressOnMemStorage = false
+	samehada_instance.Shutdown(true)
+	common.TempSuppressOnMemStorageMutex.Unlock()
+}
+
+func TestOverflowPagesPendingAtCrash(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+	os.Remove(t.Name() + ".db")
+	os.Remove(t.Name() + ".log")
+
+	samehada_instance := samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	samehada_instance.GetLogManager().ActivateLogging()
+
+	col1 := column.NewColumn("a", types.Integer, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	col2 := column.NewColumn("b", types.Varchar, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	schema_ := schema.NewSchema([]*column.Column{col1, col2})
+	largeStr := strings.Repeat("a", common.PageSize*3)
+
+	txn := samehada_instance.GetTransactionManager().Begin(nil)
+	test_table := access.NewTableHeap(
+		samehada_instance.GetBufferPoolManager(),
+		samehada_instance.GetLogManager(),
+		samehada_instance.GetLockManager(),
+		txn)
+	first_page_id := test_table.GetFirstPageId()
+	sizeBefore := samehada_instance.GetDiskManager().Size()
+	rid, err := test_table.InsertTuple(tuple.NewTupleFromSchema([]types.Value{types.NewInteger(1), types.NewVarchar(largeStr)}, schema_), txn)
+	testingpkg.Ok(t, err)
+	samehada_instance.GetTransactionManager().Commit(txn)
+	// overflow pages are allocated just after the table page
+	overflowPageCnt := int((samehada_instance.GetDiskManager().Size() - sizeBefore) / int64(common.PageSize))
+	testingpkg.Assert(t, overflowPageCnt > 1, "tuple is not stored on overflow pages")
+
+	// overflow pages are pinned at commit. so they can't be released
+	for ii := 1; ii <= overflowPageCnt; ii++ {
+		testingpkg.Assert(t, samehada_instance.GetBufferPoolManager().FetchPage(first_page_id+types.PageID(ii)) != nil, "")
+	}
+	freeCnt := len(samehada_instance.GetBufferPoolManager().GetFreePageIds())
+	txn = samehada_instance.GetTransactionManager().Begin(nil)
+	testingpkg.Assert(t, test_table.MarkDelete(rid, txn), "MarkDelete failed")
+	samehada_instance.GetTransactionManager().Commit(txn)
+	testingpkg.Assert(t, txn.GetFinishError() != nil, "failure of release is not recorded")
+	testingpkg.Equals(t, freeCnt, len(samehada_instance.GetBufferPoolManager().GetFreePageIds()))
+	for ii := 1; ii <= overflowPageCnt; ii++ {
+		samehada_instance.GetBufferPoolManager().UnpinPage(first_page_id+types.PageID(ii), false)
+	}
+
+	// log records of the deletion are not read at recovery after this checkpoint
+	samehada_instance.GetCheckpointManager().BeginCheckpoint()
+	samehada_instance.GetCheckpointManager().EndCheckpoint()
+
+	fmt.Println("System crash before the pages are released")
+	samehada_instance.CloseFilesForTesting()
+
+	fmt.Println("System restart...")
+	samehada_instance = samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	samehada_instance.GetLogManager().DeactivateLogging()
+	log_recovery_ := log_recovery.NewLogRecovery(
+		samehada_instance.GetDiskManager(),
+		samehada_instance.GetBufferPoolManager(),
+		samehada_instance.GetLogManager())
+	log_recovery_.Redo()
+	log_recovery_.Undo()
+	testingpkg.Ok(t, access.ReleasePendingOverflowPages(samehada_instance.GetBufferPoolManager()))
+	freePageIds := samehada_instance.GetBufferPoolManager().GetFreePageIds()
+	for ii := 1; ii <= overflowPageCnt; ii++ {
+		testingpkg.Assert(t, containsPageId(freePageIds, first_page_id+types.PageID(ii)), "overflow page is leaked")
+	}
+	samehada_instance.GetLogManager().ActivateLogging()
+
+	common.TempSuppressOnMemStorage = false
+	samehada_instance.Shutdown(true)
+	common.TempSuppressOnMemStorageMutex.Unlock()
+}
+
+func containsPageId(pageIds []types.PageID, pageId types.PageID) bool {
+	for _, id := range pageIds {
+		if id == pageId {
+			return true
+		}
+	}
+	return false
+}
+
 func TestCheckpoint(t *testing.T) {
 	common.TempSuppressOnMemStorageMutex.Lock()
 	common.TempSuppressOnMemStorage = true
@@ -535,6 +879,515 @@ func TestCheckpoint(t *testing.T) {
 	common.TempSuppressOnMemStorageMutex.Unlock()
 }
 
+func TestFuzzyCheckpoint(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+	if !common.EnableOnMemStorage || common.TempSuppressOnMemStorage {
+		os.Remove(t.Name() + ".db")
+		os.Remove(t.Name() + ".log")
+	}
+
+	samehada_instance := samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	testingpkg.Assert(t, samehada_instance.GetLogManager().IsEnabledLogging(), "")
+	txn_mgr := samehada_instance.GetTransactionManager()
+
+	col1 := column.NewColumn("a", types.Varchar, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	col2 := column.NewColumn("b", types.Integer, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	schema_ := schema.NewSchema([]*column.Column{col1, col2})
+
+	fmt.Println("insert tuples and commit")
+	txn := txn_mgr.Begin(nil)
+	test_table := access.NewTableHeap(samehada_instance.GetBufferPoolManager(), samehada_instance.GetLogManager(),
+		samehada_instance.GetLockManager(), txn)
+	firstPageId := test_table.GetFirstPageId()
+	committedRIDs := make([]page.RID, 0)
+	committedTuples := make([]*tuple.Tuple, 0)
+	for ii := 0; ii < 100; ii++ {
+		tuple_ := ConstructTuple(schema_)
+		rid, err := test_table.InsertTuple(tuple_, txn)
+		testingpkg.Ok(t, err)
+		committedRIDs = append(committedRIDs, *rid)
+		committedTuples = append(committedTuples, tuple_)
+	}
+	txn_mgr.Commit(txn)
+
+	fmt.Println("begin a transaction which is running during checkpoint")
+	runningTxn := txn_mgr.Begin(nil)
+	uncommittedRIDs := make([]page.RID, 0)
+	for ii := 0; ii < 10; ii++ {
+		rid, err := test_table.InsertTuple(ConstructTuple(schema_), runningTxn)
+		testingpkg.Ok(t, err)
+		uncommittedRIDs = append(uncommittedRIDs, *rid)
+	}
+
+	// running transaction must not block checkpointing
+	done := make(chan bool)
+	go func() {
+		samehada_instance.GetCheckpointManager().BeginCheckpoint()
+		samehada_instance.GetCheckpointManager().EndCheckpoint()
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("checkpointing is blocked by running transaction")
+	}
+
+	fmt.Println("check checkpoint records")
+	ckptOffset := samehada_instance.GetDiskManager().ReadLastCheckpointOffset()
+	testingpkg.Assert(t, ckptOffset > 0, "location of checkpoint should be recorded")
+	log_recovery_ := log_recovery.NewLogRecovery(
+		samehada_instance.GetDiskManager(),
+		samehada_instance.GetBufferPoolManager(),
+		samehada_instance.GetLogManager())
+	log_buffer := make([]byte, common.LogBufferSize)
+	var readBytes uint32
+	testingpkg.Assert(t, samehada_instance.GetDiskManager().ReadLog(log_buffer, ckptOffset, &readBytes), "")
+	var buffer_offset uint32 = 0
+	var log_record recovery.LogRecord
+	var endRecord *recovery.LogRecord = nil
+	beginLSN := types.LSN(common.InvalidLSN)
+	// tables are written on CHECKPOINT_TABLES records before END_CHECKPOINT record
+	activeTxnTable := make(map[types.TxnID]types.LSN)
+	for log_recovery_.DeserializeLogRecord(log_buffer[buffer_offset:readBytes], &log_record) {
+		if log_record.Log_record_type == recovery.BEGIN_CHECKPOINT {
+			beginLSN = log_record.Lsn
+		} else if log_record.Log_record_type == recovery.CHECKPOINT_TABLES {
+			testingpkg.Equals(t, beginLSN, log_record.Prev_lsn)
+			for txn_id, last_lsn := range log_record.Active_txn_table {
+				activeTxnTable[txn_id] = last_lsn
+			}
+		} else if log_record.Log_record_type == recovery.END_CHECKPOINT {
+			copied := log_record
+			endRecord = &copied
+		}
+		buffer_offset += log_record.Size
+	}
+	testingpkg.Assert(t, endRecord != nil, "END_CHECKPOINT record should be written")
+	testingpkg.Equals(t, beginLSN, endRecord.Prev_lsn)
+	lastLSN, ok := activeTxnTable[runningTxn.GetTransactionId()]
+	testingpkg.Assert(t, ok, "running transaction should be in active transaction table")
+	testingpkg.Equals(t, runningTxn.GetPrevLSN(), lastLSN)
+	_, ok = activeTxnTable[txn.GetTransactionId()]
+	testingpkg.Assert(t, !ok, "committed transaction should not be in active transaction table")
+	// records of committed transaction before the running one are not needed at recovery
+	testingpkg.Assert(t, endRecord.Recovery_start_offset > 0, "")
+	testingpkg.Assert(t, endRecord.Recovery_start_offset <= uint32(ckptOffset), "")
+
+	fmt.Println("operations after checkpoint")
+	txn = txn_mgr.Begin(nil)
+	for ii := 0; ii < 100; ii++ {
+		tuple_ := ConstructTuple(schema_)
+		rid, err := test_table.InsertTuple(tuple_, txn)
+		testingpkg.Ok(t, err)
+		committedRIDs = append(committedRIDs, *rid)
+		committedTuples = append(committedTuples, tuple_)
+	}
+	txn_mgr.Commit(txn)
+	for ii := 0; ii < 10; ii++ {
+		rid, err := test_table.InsertTuple(ConstructTuple(schema_), runningTxn)
+		testingpkg.Ok(t, err)
+		uncommittedRIDs = append(uncommittedRIDs, *rid)
+	}
+	samehada_instance.GetLogManager().Flush()
+
+	fmt.Println("System crash before commit")
+	samehada_instance.CloseFilesForTesting()
+
+	fmt.Println("System restarted..")
+	samehada_instance = samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	samehada_instance.GetLogManager().DeactivateLogging()
+	log_recovery_ = log_recovery.NewLogRecovery(
+		samehada_instance.GetDiskManager(),
+		samehada_instance.GetBufferPoolManager(),
+		samehada_instance.GetLogManager())
+	_, isRedoOccured := log_recovery_.Redo()
+	testingpkg.Assert(t, isRedoOccured, "")
+	isUndoOccured := log_recovery_.Undo()
+	testingpkg.Assert(t, isUndoOccured, "")
+
+	fmt.Println("Check if recovery success")
+	txn = samehada_instance.GetTransactionManager().Begin(nil)
+	test_table = access.InitTableHeap(samehada_instance.GetBufferPoolManager(), firstPageId,
+		samehada_instance.GetLogManager(), samehada_instance.GetLockManager())
+	for ii, rid := range committedRIDs {
+		tuple_ := test_table.GetTuple(&rid, txn)
+		testingpkg.Assert(t, tuple_ != nil, "committed tuple should exist")
+		testingpkg.Assert(t, tuple_.GetValue(schema_, 0).CompareEquals(committedTuples[ii].GetValue(schema_, 0)), "")
+		testingpkg.Assert(t, tuple_.GetValue(schema_, 1).CompareEquals(committedTuples[ii].GetValue(schema_, 1)), "")
+	}
+	for _, rid := range uncommittedRIDs {
+		testingpkg.Assert(t, test_table.GetTuple(&rid, txn) == nil, "uncommitted tuple should be removed")
+	}
+	samehada_instance.GetTransactionManager().Commit(txn)
+
+	common.TempSuppressOnMemStorage = false
+	samehada_instance.Shutdown(true)
+	common.TempSuppressOnMemStorageMutex.Unlock()
+}
+
+func TestRedoAndUndoOfHashIndex(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+	if !common.EnableOnMemStorage || common.TempSuppressOnMemStorage {
+		os.Remove(t.Name() + ".db")
+		os.Remove(t.Name() + ".log")
+	}
+
+	samehada_instance := samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	testingpkg.Assert(t, samehada_instance.GetLogManager().IsEnabledLogging(), "")
+
+	// hash table starts with one bucket and buckets are split during inserts
+	ht := hash.NewLinearProbeHashTable(samehada_instance.GetBufferPoolManager(), samehada_instance.GetLogManager(), 1, types.InvalidPageID)
+	headerPageId := ht.GetHeaderPageId()
+
+	// keys of odd values are long enough to be stored on overflow pages
+	intToBytes := func(val int) []byte {
+		if val%2 == 0 {
+			return types.NewInteger(int32(val)).Serialize()
+		}
+		return types.NewVarchar(fmt.Sprintf("key stored on overflow page %d", val)).Serialize()
+	}
+
+	fmt.Println("insert entries and commit")
+	txn := samehada_instance.GetTransactionManager().Begin(nil)
+	for ii := 0; ii < 2000; ii++ {
+		testingpkg.Ok(t, ht.Insert(intToBytes(ii), uint64(ii), txn))
+	}
+	// values of a key are stored on chained block pages
+	dupKey := intToBytes(-1)
+	for ii := 0; ii < 500; ii++ {
+		testingpkg.Ok(t, ht.Insert(dupKey, uint64(ii), txn))
+	}
+	samehada_instance.GetTransactionManager().Commit(txn)
+
+	fmt.Println("insert and remove entries without commit")
+	txn = samehada_instance.GetTransactionManager().Begin(nil)
+	for ii := 0; ii < 1000; ii++ {
+		ht.Remove(intToBytes(ii), uint64(ii), txn)
+	}
+	for ii := 2000; ii < 3000; ii++ {
+		testingpkg.Ok(t, ht.Insert(intToBytes(ii), uint64(ii), txn))
+	}
+	for ii := 0; ii < 250; ii++ {
+		ht.Remove(dupKey, uint64(ii), txn)
+	}
+	for ii := 500; ii < 1000; ii++ {
+		testingpkg.Ok(t, ht.Insert(dupKey, uint64(ii), txn))
+	}
+	samehada_instance.GetLogManager().Flush()
+
+	fmt.Println("half of dirty pages are written to disk before crash")
+	dirtyPageIds := make([]types.PageID, 0)
+	for pageId, _ := range samehada_instance.GetBufferPoolManager().GetDirtyPageTable() {
+		dirtyPageIds = append(dirtyPageIds, pageId)
+	}
+	sort.Slice(dirtyPageIds, func(i, j int) bool { return dirtyPageIds[i] < dirtyPageIds[j] })
+	for ii := 0; ii < len(dirtyPageIds); ii += 2 {
+		samehada_instance.GetBufferPoolManager().FlushPage(dirtyPageIds[ii])
+	}
+
+	fmt.Println("System crash before commit")
+	samehada_instance.CloseFilesForTesting()
+
+	fmt.Println("System restarted..")
+	samehada_instance = samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	samehada_instance.GetLogManager().DeactivateLogging()
+
+	log_recovery := log_recovery.NewLogRecovery(
+		samehada_instance.GetDiskManager(),
+		samehada_instance.GetBufferPoolManager(),
+		samehada_instance.GetLogManager())
+	_, isRedoOccured := log_recovery.Redo()
+	testingpkg.Assert(t, isRedoOccured, "")
+	isUndoOccured := log_recovery.Undo()
+	testingpkg.Assert(t, isUndoOccured, "")
+
+	fmt.Println("Check if hash index is recovered")
+	ht = hash.NewLinearProbeHashTable(samehada_instance.GetBufferPoolManager(), samehada_instance.GetLogManager(), 0, headerPageId)
+	for ii := 0; ii < 2000; ii++ {
+		res := ht.GetValue(intToBytes(ii))
+		testingpkg.Equals(t, 1, len(res))
+		testingpkg.Equals(t, uint64(ii), res[0])
+	}
+	for ii := 2000; ii < 3000; ii++ {
+		res := ht.GetValue(intToBytes(ii))
+		testingpkg.Equals(t, 0, len(res))
+	}
+	res := ht.GetValue(dupKey)
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	testingpkg.Equals(t, 500, len(res))
+	for ii, val := range res {
+		testingpkg.Equals(t, uint64(ii), val)
+	}
+
+	common.TempSuppressOnMemStorage = false
+	samehada_instance.Shutdown(true)
+	common.TempSuppressOnMemStorageMutex.Unlock()
+}
+
+// returns number of log records of each type which are written by the transaction
+func countLogRecordsOfTxn(samehada_instance *samehada.SamehadaInstance, txn_id types.TxnID) map[recovery.LogRecordType]int {
+	ret := make(map[recovery.LogRecordType]int)
+	log_recovery_ := log_recovery.NewLogRecovery(
+		samehada_instance.GetDiskManager(),
+		samehada_instance.GetBufferPoolManager(),
+		samehada_instance.GetLogManager())
+	log_buffer := make([]byte, common.LogBufferSize)
+	var file_offset uint32 = 0
+	var readBytes uint32
+	for samehada_instance.GetDiskManager().ReadLog(log_buffer, int32(file_offset), &readBytes) {
+		var buffer_offset uint32 = 0
+		var log_record recovery.LogRecord
+		for log_recovery_.DeserializeLogRecord(log_buffer[buffer_offset:readBytes], &log_record) {
+			if log_record.Txn_id == txn_id {
+				ret[log_record.Log_record_type]++
+			}
+			buffer_offset += log_record.Size
+		}
+		if buffer_offset == 0 {
+			break
+		}
+		file_offset += buffer_offset
+	}
+	return ret
+}
+
+func TestRepeatedCrashDuringUndo(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+	if !common.EnableOnMemStorage || common.TempSuppressOnMemStorage {
+		os.Remove(t.Name() + ".db")
+		os.Remove(t.Name() + ".log")
+	}
+
+	samehada_instance := samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	testingpkg.Assert(t, samehada_instance.GetLogManager().IsEnabledLogging(), "")
+	txn_mgr := samehada_instance.GetTransactionManager()
+
+	col1 := column.NewColumn("a", types.Varchar, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	col2 := column.NewColumn("b", types.Integer, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	schema_ := schema.NewSchema([]*column.Column{col1, col2})
+	key := func(val int) []byte { return types.NewInteger(int32(val)).Serialize() }
+
+	fmt.Println("insert tuples and index entries and commit")
+	txn := txn_mgr.Begin(nil)
+	test_table := access.NewTableHeap(samehada_instance.GetBufferPoolManager(), samehada_instance.GetLogManager(),
+		samehada_instance.GetLockManager(), txn)
+	firstPageId := test_table.GetFirstPageId()
+	ht := hash.NewLinearProbeHashTable(samehada_instance.GetBufferPoolManager(), samehada_instance.GetLogManager(), 1, types.InvalidPageID)
+	headerPageId := ht.GetHeaderPageId()
+	rids := make([]page.RID, 0)
+	tuples := make([]*tuple.Tuple, 0)
+	for ii := 0; ii < 3; ii++ {
+		tuple_ := ConstructTuple(schema_)
+		rid, err := test_table.InsertTuple(tuple_, txn)
+		testingpkg.Ok(t, err)
+		rids = append(rids, *rid)
+		tuples = append(tuples, tuple_)
+		testingpkg.Ok(t, ht.Insert(key(ii), uint64(ii), txn))
+	}
+	txn_mgr.Commit(txn)
+
+	fmt.Println("operations of a transaction which is not committed")
+	loserTxn := txn_mgr.Begin(nil)
+	testingpkg.Assert(t, test_table.MarkDelete(&rids[0], loserTxn), "")
+	ht.Remove(key(0), 0, loserTxn)
+	row := []types.Value{types.NewVarchar("updated"), types.NewInteger(256)}
+	is_updated, _ := test_table.UpdateTuple(tuple.NewTupleFromSchema(row, schema_), nil, nil, rids[1], loserTxn)
+	testingpkg.Assert(t, is_updated, "")
+	loserRID, err := test_table.InsertTuple(ConstructTuple(schema_), loserTxn)
+	testingpkg.Ok(t, err)
+	testingpkg.Ok(t, ht.Insert(key(3), 3, loserTxn))
+	loserOpNum := 5
+
+	// changes by the transaction reach disk
+	samehada_instance.GetLogManager().Flush()
+	samehada_instance.GetBufferPoolManager().FlushAllPages()
+
+	fmt.Println("System crash before commit")
+	samehada_instance.CloseFilesForTesting()
+
+	fmt.Println("System restarted..")
+	samehada_instance = samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	samehada_instance.GetLogManager().DeactivateLogging()
+	log_recovery_ := log_recovery.NewLogRecovery(
+		samehada_instance.GetDiskManager(),
+		samehada_instance.GetBufferPoolManager(),
+		samehada_instance.GetLogManager())
+	log_recovery_.Redo()
+	testingpkg.Assert(t, log_recovery_.UndoPartiallyForTesting(2), "")
+
+	fmt.Println("System crash during undo phase (undone pages and CLRs are persisted)")
+	samehada_instance.GetLogManager().Flush()
+	samehada_instance.GetBufferPoolManager().FlushAllPages()
+	samehada_instance.CloseFilesForTesting()
+
+	fmt.Println("System restarted..")
+	samehada_instance = samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	samehada_instance.GetLogManager().DeactivateLogging()
+	log_recovery_ = log_recovery.NewLogRecovery(
+		samehada_instance.GetDiskManager(),
+		samehada_instance.GetBufferPoolManager(),
+		samehada_instance.GetLogManager())
+	log_recovery_.Redo()
+	testingpkg.Assert(t, log_recovery_.Undo(), "")
+
+	fmt.Println("System crash after undo phase (only log is persisted)")
+	samehada_instance.GetLogManager().Flush()
+	samehada_instance.CloseFilesForTesting()
+
+	fmt.Println("System restarted..")
+	samehada_instance = samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	samehada_instance.GetLogManager().DeactivateLogging()
+	log_recovery_ = log_recovery.NewLogRecovery(
+		samehada_instance.GetDiskManager(),
+		samehada_instance.GetBufferPoolManager(),
+		samehada_instance.GetLogManager())
+	_, isRedoOccured := log_recovery_.Redo()
+	testingpkg.Assert(t, isRedoOccured, "")
+	testingpkg.Assert(t, !log_recovery_.Undo(), "rolled back transaction should not be undone again")
+
+	fmt.Println("Check if recovery success")
+	txn = samehada_instance.GetTransactionManager().Begin(nil)
+	test_table = access.InitTableHeap(samehada_instance.GetBufferPoolManager(), firstPageId,
+		samehada_instance.GetLogManager(), samehada_instance.GetLockManager())
+	for ii, rid := range rids {
+		tuple_ := test_table.GetTuple(&rid, txn)
+		testingpkg.Assert(t, tuple_ != nil, "committed tuple should exist")
+		testingpkg.Assert(t, tuple_.GetValue(schema_, 0).CompareEquals(tuples[ii].GetValue(schema_, 0)), "")
+		testingpkg.Assert(t, tuple_.GetValue(schema_, 1).CompareEquals(tuples[ii].GetValue(schema_, 1)), "")
+	}
+	testingpkg.Assert(t, test_table.GetTuple(loserRID, txn) == nil, "uncommitted tuple should be removed")
+	samehada_instance.GetTransactionManager().Commit(txn)
+
+	ht = hash.NewLinearProbeHashTable(samehada_instance.GetBufferPoolManager(), samehada_instance.GetLogManager(), 0, headerPageId)
+	for ii := 0; ii < 3; ii++ {
+		res := ht.GetValue(key(ii))
+		testingpkg.Equals(t, 1, len(res))
+		testingpkg.Equals(t, uint64(ii), res[0])
+	}
+	testingpkg.Equals(t, 0, len(ht.GetValue(key(3))))
+
+	// each operation is compensated only once over repeated crashes
+	counts := countLogRecordsOfTxn(samehada_instance, loserTxn.GetTransactionId())
+	testingpkg.Equals(t, loserOpNum, counts[recovery.CLR])
+	testingpkg.Equals(t, 1, counts[recovery.ABORT])
+
+	common.TempSuppressOnMemStorage = false
+	samehada_instance.Shutdown(true)
+	common.TempSuppressOnMemStorageMutex.Unlock()
+}
+
+func TestCrashDuringAbort(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+	if !common.EnableOnMemStorage || common.TempSuppressOnMemStorage {
+		os.Remove(t.Name() + ".db")
+		os.Remove(t.Name() + ".log")
+	}
+
+	samehada_instance := samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	testingpkg.Assert(t, samehada_instance.GetLogManager().IsEnabledLogging(), "")
+	txn_mgr := samehada_instance.GetTransactionManager()
+
+	col1 := column.NewColumn("a", types.Varchar, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	col2 := column.NewColumn("b", types.Integer, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	schema_ := schema.NewSchema([]*column.Column{col1, col2})
+
+	fmt.Println("insert tuples and commit")
+	txn := txn_mgr.Begin(nil)
+	test_table := access.NewTableHeap(samehada_instance.GetBufferPoolManager(), samehada_instance.GetLogManager(),
+		samehada_instance.GetLockManager(), txn)
+	firstPageId := test_table.GetFirstPageId()
+	rids := make([]page.RID, 0)
+	tuples := make([]*tuple.Tuple, 0)
+	for ii := 0; ii < 4; ii++ {
+		tuple_ := ConstructTuple(schema_)
+		rid, err := test_table.InsertTuple(tuple_, txn)
+		testingpkg.Ok(t, err)
+		rids = append(rids, *rid)
+		tuples = append(tuples, tuple_)
+	}
+	txn_mgr.Commit(txn)
+
+	row := []types.Value{types.NewVarchar("updated"), types.NewInteger(256)}
+
+	fmt.Println("operations of a transaction which is aborted")
+	abortedTxn := txn_mgr.Begin(nil)
+	testingpkg.Assert(t, test_table.MarkDelete(&rids[0], abortedTxn), "")
+	is_updated, _ := test_table.UpdateTuple(tuple.NewTupleFromSchema(row, schema_), nil, nil, rids[1], abortedTxn)
+	testingpkg.Assert(t, is_updated, "")
+	abortedRID, err := test_table.InsertTuple(ConstructTuple(schema_), abortedTxn)
+	testingpkg.Ok(t, err)
+
+	fmt.Println("operations of a transaction whose rollback is interrupted by crash")
+	partialTxn := txn_mgr.Begin(nil)
+	testingpkg.Assert(t, test_table.MarkDelete(&rids[2], partialTxn), "")
+	lsnBeforeUpdate := partialTxn.GetPrevLSN()
+	is_updated, _ = test_table.UpdateTuple(tuple.NewTupleFromSchema(row, schema_), nil, nil, rids[3], partialTxn)
+	testingpkg.Assert(t, is_updated, "")
+	lsnBeforeInsert := partialTxn.GetPrevLSN()
+	partialRID, err := test_table.InsertTuple(ConstructTuple(schema_), partialTxn)
+	testingpkg.Ok(t, err)
+
+	// changes by the transactions reach disk
+	samehada_instance.GetLogManager().Flush()
+	samehada_instance.GetBufferPoolManager().FlushAllPages()
+
+	txn_mgr.Abort(abortedTxn)
+
+	// same as TransactionManager.Abort does, but rollback stops after two write records are undone
+	partialTxn.SetState(access.ABORTED)
+	partialTxn.SetUndoNextLSN(lsnBeforeInsert)
+	_, err = test_table.ApplyDelete(partialRID, partialTxn)
+	testingpkg.Ok(t, err)
+	partialTxn.SetUndoNextLSN(lsnBeforeUpdate)
+	test_table.UpdateTuple(tuples[3], nil, nil, rids[3], partialTxn)
+
+	fmt.Println("System crash during rollback (only log is persisted)")
+	samehada_instance.GetLogManager().Flush()
+	samehada_instance.CloseFilesForTesting()
+
+	fmt.Println("System restarted..")
+	samehada_instance = samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	samehada_instance.GetLogManager().DeactivateLogging()
+	log_recovery_ := log_recovery.NewLogRecovery(
+		samehada_instance.GetDiskManager(),
+		samehada_instance.GetBufferPoolManager(),
+		samehada_instance.GetLogManager())
+	_, isRedoOccured := log_recovery_.Redo()
+	testingpkg.Assert(t, isRedoOccured, "")
+	testingpkg.Assert(t, log_recovery_.Undo(), "")
+	samehada_instance.GetLogManager().Flush()
+
+	fmt.Println("Check if recovery success")
+	txn = samehada_instance.GetTransactionManager().Begin(nil)
+	test_table = access.InitTableHeap(samehada_instance.GetBufferPoolManager(), firstPageId,
+		samehada_instance.GetLogManager(), samehada_instance.GetLockManager())
+	for ii, rid := range rids {
+		tuple_ := test_table.GetTuple(&rid, txn)
+		testingpkg.Assert(t, tuple_ != nil, "committed tuple should exist")
+		testingpkg.Assert(t, tuple_.GetValue(schema_, 0).CompareEquals(tuples[ii].GetValue(schema_, 0)), "")
+		testingpkg.Assert(t, tuple_.GetValue(schema_, 1).CompareEquals(tuples[ii].GetValue(schema_, 1)), "")
+	}
+	testingpkg.Assert(t, test_table.GetTuple(abortedRID, txn) == nil, "inserted tuple of aborted transaction should be removed")
+	testingpkg.Assert(t, test_table.GetTuple(partialRID, txn) == nil, "inserted tuple of aborted transaction should be removed")
+	samehada_instance.GetTransactionManager().Commit(txn)
+
+	// operations undone at runtime are not undone again at recovery
+	counts := countLogRecordsOfTxn(samehada_instance, abortedTxn.GetTransactionId())
+	testingpkg.Equals(t, 3, counts[recovery.CLR])
+	testingpkg.Equals(t, 1, counts[recovery.ABORT])
+	counts = countLogRecordsOfTxn(samehada_instance, partialTxn.GetTransactionId())
+	testingpkg.Equals(t, 3, counts[recovery.CLR])
+	testingpkg.Equals(t, 1, counts[recovery.ABORT])
+
+	common.TempSuppressOnMemStorage = false
+	samehada_instance.Shutdown(true)
+	common.TempSuppressOnMemStorageMutex.Unlock()
+}
+
 // use a fixed schema to construct a random tuple
 func ConstructTuple(schema_ *schema.Schema) *tuple.Tuple {
 	var values []types.Value
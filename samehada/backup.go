@@ -0,0 +1,149 @@
+package samehada
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/storage/disk"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+const (
+	// 2: backup.db has header of db file
+	backupFormatVersion    = 2
+	backupManifestFileName = "MANIFEST"
+	backupDBFileName       = "backup.db"
+	backupLogFileName      = "backup.log"
+)
+
+// BackupManifest describes a backup made by SamehadaDB::Backup. it is written to backup directory as JSON
+type BackupManifest struct {
+	Version  int
+	PageSize int
+	// number of pages in backup.db
+	PageNum int64
+	// LSN of the first log record in backup.log
+	StartLSN types.LSN
+	// range of backup.log in log of the source db
+	LogStartOffset uint32
+	LogEndOffset   uint32
+	CreatedAt      time.Time
+}
+
+/**
+ * online backup to dir. transactions can run while backup is running.
+ * pages are copied through BufferPoolManager::ReadPageFromDisk which blocks write back of pages
+ * during each read (a page is never copied while it is written) and log from the start point of recovery of a checkpoint
+ * taken at beginning to the end of page copy is copied with them. so the copied pages are made consistent
+ * with redo/undo at RestoreDBFromBackup.
+ * manifest is written last, so backup directory without it is an incomplete backup
+ */
+func (sdb *SamehadaDB) Backup(dir string) error {
+	dm := sdb.shi_.GetDiskManager()
+	lm := sdb.shi_.GetLogManager()
+	bpm := sdb.shi_.GetBufferPoolManager()
+
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	os.Remove(filepath.Join(dir, backupManifestFileName))
+
+	// log needed for making pages consistent must not be truncated during backup
+	sdb.chkpntMgr.BlockCheckpointing()
+	defer sdb.chkpntMgr.ResumeCheckpointing()
+	sdb.chkpntMgr.BeginCheckpoint()
+	oldestLSN := sdb.chkpntMgr.EndCheckpoint()
+	if oldestLSN == common.InvalidLSN {
+		return errors.New("backup needs logging and a complete checkpoint")
+	}
+	logStartOffset := lm.GetLogFileOffsetOfLSN(oldestLSN)
+	startLSN := lm.GetFirstLSNOfChunk(oldestLSN)
+
+	dbFile, err := os.OpenFile(filepath.Join(dir, backupDBFileName), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer dbFile.Close()
+
+	// header (format version, creation time and catalog roots) is same as the source db
+	header := dm.GetDBHeader()
+	pageSize := header.PageSize
+	if err = disk.WriteDBHeader(dbFile, &header); err != nil {
+		return err
+	}
+	data := make([]byte, pageSize)
+	copiedNum := int64(0)
+	var logEndOffset uint32
+	for {
+		pageNum := dm.Size() / int64(pageSize)
+		for ; copiedNum < pageNum; copiedNum++ {
+			// corrupted page is detected here (PageCorruptionError)
+			if err = bpm.ReadPageFromDisk(types.PageID(copiedNum), data); err != nil {
+				return err
+			}
+			// checksum field is cleared by ReadPage
+			disk.SetPageChecksum(data)
+			if _, err = dbFile.WriteAt(data, disk.PageOffset(types.PageID(copiedNum), pageSize)); err != nil {
+				return err
+			}
+		}
+		// changes on copied pages are included in the backup log
+		lm.Flush()
+		logEndOffset = uint32(dm.GetLogFileSize())
+
+		// pages allocated during the copy are written to db file and copied at next round
+		bpm.FlushAllDirtyPagesConcurrently()
+		if dm.Size()/int64(pageSize) == pageNum {
+			break
+		}
+	}
+	if err = dbFile.Sync(); err != nil {
+		return err
+	}
+
+	if err = disk.CopyLogToFile(dm, filepath.Join(dir, backupLogFileName), logStartOffset, logEndOffset, startLSN); err != nil {
+		return err
+	}
+
+	manifest := &BackupManifest{backupFormatVersion, pageSize, copiedNum, startLSN, logStartOffset, logEndOffset, time.Now()}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpFileName := filepath.Join(dir, backupManifestFileName+".tmp")
+	if err = os.WriteFile(tmpFileName, manifestData, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmpFileName, filepath.Join(dir, backupManifestFileName))
+}
+
+// reads manifest of backup in dir
+func ReadBackupManifest(dir string) (*BackupManifest, error) {
+	manifestData, err := os.ReadFile(filepath.Join(dir, backupManifestFileName))
+	if err != nil {
+		return nil, err
+	}
+	manifest := new(BackupManifest)
+	if err = json.Unmarshal(manifestData, manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Version != backupFormatVersion {
+		return nil, errors.New("unsupported backup format version")
+	}
+	if !disk.IsValidPageSize(manifest.PageSize) {
+		return nil, errors.New("page size of backup is invalid")
+	}
+	return manifest, nil
+}
+
+// makes DB of dbName from backup in dir which is made by SamehadaDB::Backup
+func RestoreDBFromBackup(dbName string, memKBytes int, dir string) (*SamehadaDB, error) {
+	if _, err := ReadBackupManifest(dir); err != nil {
+		return nil, err
+	}
+	return restoreDB(dbName, memKBytes, filepath.Join(dir, backupDBFileName), dir, common.InvalidLSN, 0)
+}
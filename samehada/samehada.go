@@ -1,6 +1,7 @@
 package samehada
 
 import (
+	"errors"
 	"fmt"
 	"github.com/ryogrid/SamehadaDB/catalog"
 	"github.com/ryogrid/SamehadaDB/common"
@@ -12,14 +13,15 @@ import (
 	"github.com/ryogrid/SamehadaDB/recovery/log_recovery"
 	"github.com/ryogrid/SamehadaDB/samehada/samehada_util"
 	"github.com/ryogrid/SamehadaDB/storage/access"
+	"github.com/ryogrid/SamehadaDB/storage/buffer"
 	"github.com/ryogrid/SamehadaDB/storage/disk"
+	"github.com/ryogrid/SamehadaDB/storage/index"
 	"github.com/ryogrid/SamehadaDB/storage/index/index_constants"
-	"github.com/ryogrid/SamehadaDB/storage/page"
 	"github.com/ryogrid/SamehadaDB/storage/table/schema"
 	"github.com/ryogrid/SamehadaDB/storage/tuple"
 	"github.com/ryogrid/SamehadaDB/types"
 	"math"
-	"unsafe"
+	"time"
 )
 
 type SamehadaDB struct {
@@ -28,48 +30,33 @@ type SamehadaDB struct {
 	exec_engine_ *executors.ExecutionEngine
 	chkpntMgr    *concurrency.CheckpointManager
 	planner_     planner.Planner
+	startTime    time.Time
 }
 
 func reconstructIndexDataOfATbl(t *catalog.TableMetadata, c *catalog.Catalog, dman disk.DiskManager, txn *access.Transaction) {
 	executionEngine := &executors.ExecutionEngine{}
 	executorContext := executors.NewExecutorContext(c, t.Table().GetBufferPoolManager(), txn)
 
-	zeroClearedBuf := make([]byte, common.PageSize)
-	bpm := t.Table().GetBufferPoolManager()
+	var allTuples []*tuple.Tuple = nil
 
+	// insert index entries correspond to each tuple and column to each index objects
 	for colIdx, index_ := range t.Indexes() {
 		if index_ != nil {
 			column_ := t.Schema().GetColumn(uint32(colIdx))
 			switch column_.IndexKind() {
 			case index_constants.INDEX_KIND_HASH:
-				// clear pages for HashTableBlockPage for avoiding conflict with reconstruction
-				// due to there may be pages (on disk) which has old index entries data in current design...
-				// note: when this method is called, the pages are not fetched yet (= are not in memory)
-
-				indexHeaderPageId := column_.IndexHeaderPageId()
-
-				hPageData := bpm.FetchPage(indexHeaderPageId).Data()
-				headerPage := (*page.HashTableHeaderPage)(unsafe.Pointer(hPageData))
-				for ii := uint32(0); ii < headerPage.NumBlocks(); ii++ {
-					blockPageId := headerPage.GetBlockPageId(ii)
-					// zero clear specifed space of db file
-					dman.WritePage(blockPageId, zeroClearedBuf)
+				// operations to hash index are logged and recovered at redo/undo phase
+				// so reconstruction is needed only when old format index was reset at open
+				if !index_.(*index.LinearProbeHashTableIndex).IsFormatMigrated() {
+					continue
 				}
 			case index_constants.INDEX_KIND_SKIP_LIST:
-				// do nothing here
-				// (Since SkipList index can't reuse past allocated pages, data clear of allocated pages
-				//  are not needed...)
+				// SkipList index is not logged. so entries are inserted to the index which was made empty at open
+				// (pages of old entries were freed then if db was shut down cleanly)
 			default:
 				panic("invalid index kind!")
 			}
-		}
-	}
 
-	var allTuples []*tuple.Tuple = nil
-
-	// insert index entries correspond to each tuple and column to each index objects
-	for _, index_ := range t.Indexes() {
-		if index_ != nil {
 			if allTuples == nil {
 				// get all tuples once
 				outSchema := t.Schema()
@@ -79,6 +66,9 @@ func reconstructIndexDataOfATbl(t *catalog.TableMetadata, c *catalog.Catalog, dm
 			for _, tuple_ := range allTuples {
 				rid := tuple_.GetRID()
 				index_.InsertEntry(tuple_, *rid, txn)
+				if txn.GetState() == access.ABORTED {
+					panic("reconstruction of index data failed: " + fmt.Sprint(txn.GetAbortReason()))
+				}
 			}
 		}
 	}
@@ -91,40 +81,118 @@ func ReconstructAllIndexData(c *catalog.Catalog, dman disk.DiskManager, txn *acc
 	}
 }
 
-func NewSamehadaDB(dbName string, memKBytes int) *SamehadaDB {
+// error is returned when db file can't be opened or its header is invalid
+// (ex: disk.ErrNotSamehadaDBFile, disk.DBFormatVersionError)
+func NewSamehadaDB(dbName string, memKBytes int) (*SamehadaDB, error) {
+	return newSamehadaDB(dbName, memKBytes, common.PageSize, common.InvalidLSN, 0)
+}
+
+// same as NewSamehadaDB but db is created with pageSize when it does not exist.
+// pageSize must be power of 2 from common.PageSize to common.MaxPageSize.
+// hash index can be used only when pageSize is common.PageSize (see Catalog::CreateTable).
+// header of existing db file is validated and disk.PageSizeMismatchError is returned
+// when its page size differs from pageSize
+func NewSamehadaDBWithPageSize(dbName string, memKBytes int, pageSize int) (*SamehadaDB, error) {
+	if !disk.IsValidPageSize(pageSize) {
+		return nil, fmt.Errorf("invalid page size: %d", pageSize)
+	}
+	if (!common.EnableOnMemStorage || common.TempSuppressOnMemStorage) && samehada_util.FileExists(dbName+".db") {
+		header, err := disk.ReadDBHeader(dbName + ".db")
+		if err != nil {
+			return nil, err
+		}
+		if header.PageSize != pageSize {
+			return nil, &disk.PageSizeMismatchError{FilePageSize: header.PageSize, RequestedPageSize: pageSize}
+		}
+	}
+	return newSamehadaDB(dbName, memKBytes, pageSize, common.InvalidLSN, 0)
+}
+
+/**
+ * point-in-time recovery.
+ * DB of dbName is made from snapshotFile (a copy of .db file) and log segment files in archiveDir
+ * and log records are replayed until targetLSN. transactions which are not committed at the point are rolled back.
+ * archiveDir must have all log data written after snapshotFile was copied (archived segments
+ * and a copy of the active segment) and snapshotFile must not have changes after the target.
+ */
+func RestoreDBToLSN(dbName string, memKBytes int, snapshotFile string, archiveDir string, targetLSN types.LSN) (*SamehadaDB, error) {
+	return restoreDB(dbName, memKBytes, snapshotFile, archiveDir, targetLSN, 0)
+}
+
+// same as RestoreDBToLSN but log is replayed until the last commit at or before targetTime
+func RestoreDBToTime(dbName string, memKBytes int, snapshotFile string, archiveDir string, targetTime time.Time) (*SamehadaDB, error) {
+	return restoreDB(dbName, memKBytes, snapshotFile, archiveDir, common.InvalidLSN, targetTime.UnixNano())
+}
+
+func restoreDB(dbName string, memKBytes int, snapshotFile string, archiveDir string, targetLSN types.LSN, targetTime int64) (*SamehadaDB, error) {
+	if common.EnableOnMemStorage && !common.TempSuppressOnMemStorage {
+		return nil, errors.New("point-in-time recovery is not supported on virtual storage")
+	}
+	if _, err := disk.ReadDBHeader(snapshotFile); err != nil {
+		return nil, fmt.Errorf("snapshot file is invalid: %w", err)
+	}
+	if err := disk.PrepareFilesForRestore(dbName+".db", snapshotFile, archiveDir); err != nil {
+		return nil, err
+	}
+	// page size is recorded in restored db file
+	return newSamehadaDB(dbName, memKBytes, common.PageSize, targetLSN, targetTime)
+}
+
+// targetLSN and targetTime are target of point-in-time recovery (see LogRecovery::SetRecoveryTarget)
+func newSamehadaDB(dbName string, memKBytes int, pageSize int, targetLSN types.LSN, targetTime int64) (*SamehadaDB, error) {
 	isExistingDB := false
 
 	if !common.EnableOnMemStorage || common.TempSuppressOnMemStorage {
 		isExistingDB = samehada_util.FileExists(dbName + ".db")
 	}
 
-	bpoolSize := math.Floor(float64(memKBytes*1024) / float64(common.PageSize))
-	shi := NewSamehadaInstance(dbName, int(bpoolSize))
-	txn := shi.GetTransactionManager().Begin(nil)
-
+	disk_manager, err := newDiskManager(dbName, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	bpoolSize := math.Floor(float64(memKBytes*1024) / float64(disk_manager.GetPageSize()))
+	shi := newSamehadaInstance(disk_manager, int(bpoolSize))
 	shi.GetLogManager().DeactivateLogging()
 
+	txn := shi.GetTransactionManager().Begin(nil)
+
 	var c *catalog.Catalog
 	if isExistingDB {
 		log_recovery := log_recovery.NewLogRecovery(
 			shi.GetDiskManager(),
 			shi.GetBufferPoolManager(),
 			shi.GetLogManager())
-		greatestLSN, isRedoOccured := log_recovery.Redo()
-		isUndoOccured := log_recovery.Undo()
-
-		dman := shi.GetDiskManager()
-		dman.GCLogFile()
-		shi.GetLogManager().SetNextLSN(greatestLSN + 1)
+		log_recovery.SetRecoveryTarget(targetLSN, targetTime)
+		log_recovery.Redo()
+		log_recovery.Undo()
+		// CLRs and ABORT records written at undo phase must be persisted before pages
+		shi.GetLogManager().Flush()
+		// overflow pages which were not released before crash are released here.
+		// ones which can not be released are kept and retried at VACUUM
+		access.ReleasePendingOverflowPages(shi.GetBufferPoolManager())
 
 		c = catalog.RecoveryCatalogFromCatalogPage(shi.GetBufferPoolManager(), shi.GetLogManager(), shi.GetLockManager(), txn)
-
-		if isRedoOccured || isUndoOccured {
-			// index date reloading/recovery is not implemented yet
-			// so when db did not exit graceful, all index data should be recounstruct
-			// (hash index uses already allocated pages but skip list index deserts these...)
-			ReconstructAllIndexData(c, shi.GetDiskManager(), txn)
+		if c.HasLegacyFormatTuples(txn) {
+			// db was written with older tuple format (each value had null flag).
+			// migration is logged and committed as a transaction. when system crashes during it,
+			// it is rolled back at recovery and done again at next launch
+			shi.GetLogManager().ActivateLogging()
+			c.MigrateTupleFormat(txn)
+			shi.GetTransactionManager().Commit(txn)
+			shi.GetLogManager().DeactivateLogging()
+			txn = shi.GetTransactionManager().Begin(nil)
 		}
+		c.RecordIndexHeaderPageIds(txn)
+
+		// hash index data is recovered with log records at redo/undo phase
+		// but reloading of skip list index is not implemented yet
+		// so skip list index data is always reconstructed on newly allocated pages
+		// (pages of old data are freed when catalog is loaded if db was shut down cleanly.
+		// after crash, they are not freed because pages on disk may be inconsistent)
+		// this also works as format migration of skip list index because entries
+		// are always written in current format (value was widened from 4 to 8 bytes)
+		// and pages written in older format are never read
+		ReconstructAllIndexData(c, shi.GetDiskManager(), txn)
 	} else {
 		c = catalog.BootstrapCatalog(shi.GetBufferPoolManager(), shi.GetLogManager(), shi.GetLockManager(), txn)
 	}
@@ -133,14 +201,21 @@ func NewSamehadaDB(dbName string, memKBytes int) *SamehadaDB {
 	shi.transaction_manager.Commit(txn)
 
 	shi.GetLogManager().ActivateLogging()
+	// commit records are made durable by flush thread (group commit)
+	shi.GetLogManager().RunFlushThread()
 
 	exec_engine := &executors.ExecutionEngine{}
 	pnner := planner.NewSimplePlanner(c, shi.GetBufferPoolManager())
 
 	chkpntMgr := concurrency.NewCheckpointManager(shi.GetTransactionManager(), shi.GetLogManager(), shi.GetBufferPoolManager())
+	if isExistingDB {
+		// recovered state becomes start point of next recovery
+		// and log segments which are not needed anymore are truncated
+		chkpntMgr.Checkpoint()
+	}
 	chkpntMgr.StartCheckpointTh()
 
-	return &SamehadaDB{shi, c, exec_engine, chkpntMgr, pnner}
+	return &SamehadaDB{shi, c, exec_engine, chkpntMgr, pnner, time.Now()}, nil
 }
 
 func (sdb *SamehadaDB) ExecuteSQL(sqlStr string) (error, [][]interface{}) {
@@ -158,6 +233,8 @@ func (sdb *SamehadaDB) ExecuteSQLRetValues(sqlStr string) (error, [][]*types.Val
 		sdb.shi_.GetTransactionManager().Commit(txn)
 		return nil, nil
 	} else if err != nil {
+		// txn must be finished because it blocks checkpointing and VACUUM
+		sdb.shi_.GetTransactionManager().Abort(txn)
 		return err, nil
 	}
 
@@ -167,8 +244,25 @@ func (sdb *SamehadaDB) ExecuteSQLRetValues(sqlStr string) (error, [][]*types.Val
 	if txn.GetState() == access.ABORTED {
 		sdb.shi_.GetTransactionManager().Abort(txn)
 		// TODO: (SDB) when concurrent execution of transaction is activated, appropriate handling of aborted transactions is needed
+		if reason := txn.GetAbortReason(); reason != nil {
+			// ex: buffer.ErrBufferPoolExhausted
+			return reason, nil
+		}
+		if err := txn.GetFinishError(); err != nil {
+			return err, nil
+		}
 	} else {
 		sdb.shi_.GetTransactionManager().Commit(txn)
+		if plan.GetType() == plans.Vacuum {
+			// compaction is committed already. failure of releasing pages is reported but VACUUM is not undone
+			if err := sdb.releaseEmptyPages(plan.(*plans.VacuumPlanNode).GetTableOIDs()); err != nil {
+				return err, nil
+			}
+		}
+		// the statement is committed but a part of work at commit failed (ex: overflow pages are not released yet)
+		if err := txn.GetFinishError(); err != nil {
+			return err, nil
+		}
 	}
 
 	outSchema := plan.OutputSchema()
@@ -182,6 +276,54 @@ func (sdb *SamehadaDB) ExecuteSQLRetValues(sqlStr string) (error, [][]*types.Val
 	return nil, retVals
 }
 
+// pages emptied by VACUUM are released when no transaction is running
+// because other transactions may be accessing them. the first error is returned
+// after pages of all tables are tried to release
+func (sdb *SamehadaDB) releaseEmptyPages(oids []uint32) error {
+	sdb.shi_.GetTransactionManager().BlockAllTransactions()
+	defer sdb.shi_.GetTransactionManager().ResumeTransactions()
+	var firstErr error = nil
+	for _, oid := range oids {
+		if _, err := sdb.catalog_.GetTableByOID(oid).Table().ReleaseEmptyPages(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// returns total size of log files in byte
+func (sdb *SamehadaDB) GetLogDiskUsage() int64 {
+	return sdb.shi_.GetLogManager().GetLogDiskUsage()
+}
+
+// log segments which are not needed for recovery are moved to dir instead of deletion.
+// they can be used for point-in-time recovery (RestoreDBToLSN, RestoreDBToTime)
+func (sdb *SamehadaDB) SetLogArchiveDir(dir string) {
+	sdb.shi_.GetDiskManager().SetLogArchiveDir(dir)
+}
+
+// statements wait for a frame of buffer pool up to timeout when all frames are pinned.
+// when no frame gets available, they fail with buffer.ErrBufferPoolExhausted
+func (sdb *SamehadaDB) SetFrameWaitTimeout(timeout time.Duration) {
+	sdb.shi_.GetBufferPoolManager().SetFrameWaitTimeout(timeout)
+}
+
+// debug mode which records stack traces of the last pinners of pages.
+// pages which remain pinned can be checked with GetPinLeaks
+func (sdb *SamehadaDB) SetPinTracking(isEnable bool) {
+	sdb.shi_.GetBufferPoolManager().SetPinTracking(isEnable)
+}
+
+// returns pages which are pinned now. no page should be pinned when no statement is running
+func (sdb *SamehadaDB) GetPinLeaks() []*buffer.PinLeak {
+	return sdb.shi_.GetBufferPoolManager().GetPinLeaks()
+}
+
+// returns LSN of the last log record. it can be used as target of point-in-time recovery
+func (sdb *SamehadaDB) GetLastLSN() types.LSN {
+	return sdb.shi_.GetLogManager().GetNextLSN() - 1
+}
+
 func (sdb *SamehadaDB) Shutdown() {
 	// set a flag which is check by checkpointing thread
 	sdb.chkpntMgr.StopCheckpointTh()
@@ -27,14 +27,25 @@ func NewSamehadaInstanceForTesting() *SamehadaInstance {
 // reset program state except for variables on testcase function
 // and db/log file
 // bpoolSize: usable buffer size in frame(=page) num
+// (panics when db file can't be opened. use NewSamehadaDB to get the error)
 func NewSamehadaInstance(dbName string, bpoolSize int) *SamehadaInstance {
-	var disk_manager disk.DiskManager
+	disk_manager, err := newDiskManager(dbName, common.PageSize)
+	if err != nil {
+		panic(err)
+	}
+	return newSamehadaInstance(disk_manager, bpoolSize)
+}
+
+// pageSize is used when db is newly created. existing db file is opened with its page size
+func newDiskManager(dbName string, pageSize int) (disk.DiskManager, error) {
 	if !common.EnableOnMemStorage || common.TempSuppressOnMemStorage {
-		disk_manager = disk.NewDiskManagerImpl(dbName + ".db")
+		return disk.NewDiskManagerImplWithPageSize(dbName+".db", pageSize)
 	} else {
-		disk_manager = disk.NewVirtualDiskManagerImpl(dbName + ".db")
+		return disk.NewVirtualDiskManagerImplWithPageSize(dbName+".db", pageSize), nil
 	}
+}
 
+func newSamehadaInstance(disk_manager disk.DiskManager, bpoolSize int) *SamehadaInstance {
 	log_manager := recovery.NewLogManager(&disk_manager)
 	log_manager.ActivateLogging()
 	bpm := buffer.NewBufferPoolManager(uint32(bpoolSize), disk_manager, log_manager)
@@ -71,6 +82,9 @@ func (si *SamehadaInstance) GetCheckpointManager() *concurrency.CheckpointManage
 
 // functionality is Flushing dirty pages, shutdown of DiskManager and action around DB/Log files
 func (si *SamehadaInstance) Shutdown(IsRemoveFiles bool) {
+	// log records in log buffer are flushed at stop
+	si.log_manager.StopFlushThread()
+	si.bpm.WaitForPrefetches()
 	if IsRemoveFiles {
 		//close
 		si.disk_manager.ShutDown()
@@ -80,6 +94,8 @@ func (si *SamehadaInstance) Shutdown(IsRemoveFiles bool) {
 	} else {
 		// TODO: (SDB) flush only dirty pages
 		si.bpm.FlushAllPages()
+		// pages which are not logged (ex: pages of skip list index) are used at next launch only when this is recorded
+		si.disk_manager.MarkShutDownCleanly()
 		// close only
 		si.disk_manager.ShutDown()
 	}
@@ -87,5 +103,6 @@ func (si *SamehadaInstance) Shutdown(IsRemoveFiles bool) {
 
 // for testing. this method does file closing only in contrast to Shutdown method
 func (si *SamehadaInstance) CloseFilesForTesting() {
+	si.bpm.WaitForPrefetches()
 	si.disk_manager.ShutDown()
 }
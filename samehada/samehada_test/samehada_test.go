@@ -1,12 +1,21 @@
 package samehada_test
 
 import (
+	"errors"
 	"fmt"
 	"github.com/ryogrid/SamehadaDB/common"
 	"github.com/ryogrid/SamehadaDB/samehada"
+	"github.com/ryogrid/SamehadaDB/storage/disk"
+	"github.com/ryogrid/SamehadaDB/storage/table/column"
 	testingpkg "github.com/ryogrid/SamehadaDB/testing"
+	"io"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // TODO: (SDB) need to check query result (TestInsertAndMultiItemPredicateSelect)
@@ -20,7 +29,8 @@ func TestInsertAndMultiItemPredicateSelect(t *testing.T) {
 		os.Remove("example.log")
 	}
 
-	db := samehada.NewSamehadaDB("example", 200)
+	db, err := samehada.NewSamehadaDB("example", 200)
+	testingpkg.Ok(t, err)
 	db.ExecuteSQLRetValues("CREATE TABLE name_age_list(name VARCHAR(256), age INT);")
 	db.ExecuteSQLRetValues("INSERT INTO name_age_list(name, age) VALUES ('鈴木', 20);")
 	db.ExecuteSQLRetValues("INSERT INTO name_age_list(name, age) VALUES ('青木', 22);")
@@ -51,7 +61,8 @@ func TestHasJoinSelect(t *testing.T) {
 		os.Remove("example.log")
 	}
 
-	db := samehada.NewSamehadaDB("example", 200)
+	db, err := samehada.NewSamehadaDB("example", 200)
+	testingpkg.Ok(t, err)
 	db.ExecuteSQLRetValues("CREATE TABLE id_name_list(id INT, name VARCHAR(256));")
 	db.ExecuteSQLRetValues("INSERT INTO id_name_list(id, name) VALUES (1, '鈴木');")
 	db.ExecuteSQLRetValues("INSERT INTO id_name_list(id, name) VALUES (2, '青木');")
@@ -85,7 +96,8 @@ func TestSimpleDelete(t *testing.T) {
 		os.Remove("example.log")
 	}
 
-	db := samehada.NewSamehadaDB("example", 200)
+	db, err := samehada.NewSamehadaDB("example", 200)
+	testingpkg.Ok(t, err)
 	db.ExecuteSQLRetValues("CREATE TABLE name_age_list(name VARCHAR(256), age INT);")
 	db.ExecuteSQLRetValues("INSERT INTO name_age_list(name, age) VALUES ('鈴木', 20);")
 	db.ExecuteSQLRetValues("INSERT INTO name_age_list(name, age) VALUES ('青木', 22);")
@@ -111,7 +123,8 @@ func TestSimpleUpdate(t *testing.T) {
 		os.Remove("example.log")
 	}
 
-	db := samehada.NewSamehadaDB("example", 200)
+	db, err := samehada.NewSamehadaDB("example", 200)
+	testingpkg.Ok(t, err)
 	db.ExecuteSQLRetValues("CREATE TABLE name_age_list(name VARCHAR(256), age INT);")
 	db.ExecuteSQLRetValues("INSERT INTO name_age_list(name, age) VALUES ('鈴木', 20);")
 	db.ExecuteSQLRetValues("INSERT INTO name_age_list(name, age) VALUES ('青木', 22);")
@@ -139,7 +152,8 @@ func TestRebootWithLoadAndRecovery(t *testing.T) {
 		os.Remove(t.Name() + ".log")
 	}
 
-	db := samehada.NewSamehadaDB("TestRebootWithLoadAndRecovery", 200)
+	db, err := samehada.NewSamehadaDB("TestRebootWithLoadAndRecovery", 200)
+	testingpkg.Ok(t, err)
 	db.ExecuteSQLRetValues("CREATE TABLE name_age_list(name VARCHAR(256), age INT);")
 	db.ExecuteSQLRetValues("INSERT INTO name_age_list(name, age) VALUES ('鈴木', 20);")
 	db.ExecuteSQLRetValues("INSERT INTO name_age_list(name, age) VALUES ('青木', 22);")
@@ -158,7 +172,8 @@ func TestRebootWithLoadAndRecovery(t *testing.T) {
 	// relaunch using TestRebootWithLoadAndRecovery.log files
 	// load of db file and redo/undo process runs
 	// and remove needless log data
-	db2 := samehada.NewSamehadaDB(t.Name(), 200)
+	db2, err := samehada.NewSamehadaDB(t.Name(), 200)
+	testingpkg.Ok(t, err)
 	db2.ExecuteSQLRetValues("INSERT INTO name_age_list(name, age) VALUES ('鮫肌', 18);")
 	_, results2 := db2.ExecuteSQLRetValues("SELECT * FROM name_age_list WHERE name = '鮫肌';")
 	samehada.PrintExecuteResults(results2)
@@ -170,7 +185,8 @@ func TestRebootWithLoadAndRecovery(t *testing.T) {
 	// relaunch using TestRebootWithLoadAndRecovery.db and TestRebootWithLoadAndRecovery.log files
 	// load of db file and redo/undo process runs
 	// and remove needless log data
-	db3 := samehada.NewSamehadaDB(t.Name(), 200)
+	db3, err := samehada.NewSamehadaDB(t.Name(), 200)
+	testingpkg.Ok(t, err)
 	db3.ExecuteSQLRetValues("INSERT INTO name_age_list(name, age) VALUES ('鮫肌', 15);")
 	_, results3 := db3.ExecuteSQLRetValues("SELECT * FROM name_age_list WHERE name = '鮫肌';")
 	samehada.PrintExecuteResults(results3)
@@ -192,7 +208,8 @@ func TestRebootAndReturnIFValues(t *testing.T) {
 		os.Remove(t.Name() + ".log")
 	}
 
-	db := samehada.NewSamehadaDB(t.Name(), 200)
+	db, err := samehada.NewSamehadaDB(t.Name(), 200)
+	testingpkg.Ok(t, err)
 	db.ExecuteSQL("CREATE TABLE name_age_list(name VARCHAR(256), age INT);")
 	db.ExecuteSQL("INSERT INTO name_age_list(name, age) VALUES ('鈴木', 20);")
 	db.ExecuteSQL("INSERT INTO name_age_list(name, age) VALUES ('青木', 22);")
@@ -214,7 +231,8 @@ func TestRebootAndReturnIFValues(t *testing.T) {
 	// relaunch using /tmp/todo.db and /tmp/todo.log files
 	// load of db file and redo/undo process runs
 	// and remove needless log data
-	db2 := samehada.NewSamehadaDB(t.Name(), 200)
+	db2, err := samehada.NewSamehadaDB(t.Name(), 200)
+	testingpkg.Ok(t, err)
 	db2.ExecuteSQL("INSERT INTO name_age_list(name, age) VALUES ('鮫肌', 18);")
 	_, results2 := db2.ExecuteSQL("SELECT * FROM name_age_list WHERE name = '鮫肌';")
 	fmt.Println("---")
@@ -229,7 +247,8 @@ func TestRebootAndReturnIFValues(t *testing.T) {
 	// relaunch using /tmp/todo.db and /tmp/todo.log files
 	// load of db file and redo/undo process runs
 	// and remove needless log data
-	db3 := samehada.NewSamehadaDB(t.Name(), 200)
+	db3, err := samehada.NewSamehadaDB(t.Name(), 200)
+	testingpkg.Ok(t, err)
 	db3.ExecuteSQL("INSERT INTO name_age_list(name, age) VALUES ('鮫肌', 15);")
 	_, results3 := db3.ExecuteSQL("SELECT * FROM name_age_list WHERE name = '鮫肌';")
 	fmt.Println("---")
@@ -242,3 +261,447 @@ func TestRebootAndReturnIFValues(t *testing.T) {
 	db3.Shutdown()
 	common.TempSuppressOnMemStorageMutex.Unlock()
 }
+
+func removeDBFilesForTesting(dbName string) {
+	os.Remove(dbName + ".db")
+	os.Remove(dbName + ".log")
+	os.Remove(dbName + ".ckpt")
+}
+
+func TestPointInTimeRecovery(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+
+	restoredName := t.Name() + "_restored"
+	snapshotFile := t.Name() + "_snapshot.db"
+	archiveDir := t.Name() + "_archive"
+	removeDBFilesForTesting(t.Name())
+	removeDBFilesForTesting(restoredName)
+	os.Remove(snapshotFile)
+	os.RemoveAll(archiveDir)
+	os.MkdirAll(archiveDir, 0777)
+
+	db, err := samehada.NewSamehadaDB(t.Name(), 200)
+	testingpkg.Ok(t, err)
+	db.SetLogArchiveDir(archiveDir)
+	db.ExecuteSQL("CREATE TABLE name_age_list(name VARCHAR(256), age INT);")
+	db.ExecuteSQL("INSERT INTO name_age_list(name, age) VALUES ('鈴木', 20);")
+	db.ExecuteSQL("INSERT INTO name_age_list(name, age) VALUES ('青木', 22);")
+	db.Shutdown()
+
+	// base backup
+	data, err := os.ReadFile(t.Name() + ".db")
+	testingpkg.Ok(t, err)
+	testingpkg.Ok(t, os.WriteFile(snapshotFile, data, 0666))
+
+	db, err = samehada.NewSamehadaDB(t.Name(), 200)
+	testingpkg.Ok(t, err)
+	db.SetLogArchiveDir(archiveDir)
+	db.ExecuteSQL("INSERT INTO name_age_list(name, age) VALUES ('山田', 25);")
+	targetLSN := db.GetLastLSN()
+	time.Sleep(time.Millisecond)
+	targetTime := time.Now()
+	time.Sleep(time.Millisecond)
+	// bad operations
+	db.ExecuteSQL("INSERT INTO name_age_list(name, age) VALUES ('加藤', 18);")
+	db.ExecuteSQL("DELETE FROM name_age_list WHERE age >= 20;")
+	_, results := db.ExecuteSQL("SELECT * FROM name_age_list;")
+	testingpkg.SimpleAssert(t, len(results) == 1)
+	db.Shutdown()
+
+	// active segment is archived too
+	data, err = os.ReadFile(t.Name() + ".log")
+	testingpkg.Ok(t, err)
+	testingpkg.Ok(t, os.WriteFile(filepath.Join(archiveDir, t.Name()+".log"), data, 0666))
+
+	restored, err := samehada.RestoreDBToTime(restoredName, 200, snapshotFile, archiveDir, targetTime)
+	testingpkg.Ok(t, err)
+	_, results = restored.ExecuteSQL("SELECT * FROM name_age_list;")
+	testingpkg.SimpleAssert(t, len(results) == 3)
+	_, results = restored.ExecuteSQL("SELECT * FROM name_age_list WHERE age = 18;")
+	testingpkg.SimpleAssert(t, len(results) == 0)
+	restored.Shutdown()
+
+	restored, err = samehada.RestoreDBToLSN(restoredName, 200, snapshotFile, archiveDir, targetLSN)
+	testingpkg.Ok(t, err)
+	_, results = restored.ExecuteSQL("SELECT * FROM name_age_list;")
+	testingpkg.SimpleAssert(t, len(results) == 3)
+	restored.Shutdown()
+
+	// log records after the target are not replayed at reopen
+	restored, err = samehada.NewSamehadaDB(restoredName, 200)
+	testingpkg.Ok(t, err)
+	_, results = restored.ExecuteSQL("SELECT * FROM name_age_list;")
+	testingpkg.SimpleAssert(t, len(results) == 3)
+	restored.ExecuteSQL("INSERT INTO name_age_list(name, age) VALUES ('木村', 18);")
+	_, results = restored.ExecuteSQL("SELECT * FROM name_age_list;")
+	testingpkg.SimpleAssert(t, len(results) == 4)
+
+	common.TempSuppressOnMemStorage = false
+	restored.Shutdown()
+	common.TempSuppressOnMemStorageMutex.Unlock()
+
+	removeDBFilesForTesting(t.Name())
+	removeDBFilesForTesting(restoredName)
+	os.Remove(snapshotFile)
+	os.RemoveAll(archiveDir)
+}
+
+func TestOnlineBackupAndRestore(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+
+	restoredName := t.Name() + "_restored"
+	backupDir := t.Name() + "_backup"
+	removeDBFilesForTesting(t.Name())
+	removeDBFilesForTesting(restoredName)
+	os.RemoveAll(backupDir)
+
+	db, err := samehada.NewSamehadaDB(t.Name(), 200)
+	testingpkg.Ok(t, err)
+	db.ExecuteSQL("CREATE TABLE name_age_list(name VARCHAR(256), age INT);")
+	for ii := 0; ii < 100; ii++ {
+		db.ExecuteSQL(fmt.Sprintf("INSERT INTO name_age_list(name, age) VALUES ('before', %d);", ii))
+	}
+
+	// rows are inserted while backup is running
+	var insertedNum int32
+	isStopped := make(chan bool)
+	isFinished := make(chan bool)
+	go func() {
+		for ii := 0; ; ii++ {
+			select {
+			case <-isStopped:
+				isFinished <- true
+				return
+			default:
+			}
+			err, _ := db.ExecuteSQL(fmt.Sprintf("INSERT INTO name_age_list(name, age) VALUES ('during', %d);", ii))
+			if err == nil {
+				atomic.AddInt32(&insertedNum, 1)
+			}
+		}
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	insertedNumAtStart := atomic.LoadInt32(&insertedNum)
+	testingpkg.Ok(t, db.Backup(backupDir))
+	insertedNumAtEnd := atomic.LoadInt32(&insertedNum)
+	isStopped <- true
+	<-isFinished
+	db.Shutdown()
+
+	manifest, err := samehada.ReadBackupManifest(backupDir)
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, common.PageSize, manifest.PageSize)
+
+	restored, err := samehada.RestoreDBFromBackup(restoredName, 200, backupDir)
+	testingpkg.Ok(t, err)
+	_, results := restored.ExecuteSQL("SELECT * FROM name_age_list WHERE name = 'before';")
+	testingpkg.SimpleAssert(t, len(results) == 100)
+	_, results = restored.ExecuteSQL("SELECT * FROM name_age_list WHERE name = 'during';")
+	fmt.Printf("inserted rows: at backup start %d, at backup end %d, in backup %d\n", insertedNumAtStart, insertedNumAtEnd, len(results))
+	testingpkg.SimpleAssert(t, int32(len(results)) >= insertedNumAtStart && int32(len(results)) <= insertedNumAtEnd+1)
+	// inserted rows are continuous
+	ages := make(map[int32]bool)
+	for _, row := range results {
+		ages[row[1].(int32)] = true
+	}
+	for ii := int32(0); ii < int32(len(results)); ii++ {
+		testingpkg.SimpleAssert(t, ages[ii])
+	}
+
+	common.TempSuppressOnMemStorage = false
+	restored.Shutdown()
+	common.TempSuppressOnMemStorageMutex.Unlock()
+
+	removeDBFilesForTesting(t.Name())
+	removeDBFilesForTesting(restoredName)
+	os.RemoveAll(backupDir)
+}
+
+func TestLargeTextValue(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+	os.Remove(t.Name() + ".db")
+	os.Remove(t.Name() + ".log")
+
+	// values larger than a page are stored on overflow pages
+	body1 := strings.Repeat("samehada", 3000)
+	body2 := strings.Repeat("SAMEHADA", 1000)
+
+	db, err := samehada.NewSamehadaDB(t.Name(), 200)
+	testingpkg.Ok(t, err)
+	db.ExecuteSQL("CREATE TABLE docs(id INT, body TEXT);")
+	db.ExecuteSQL("INSERT INTO docs(id, body) VALUES (1, '" + body1 + "');")
+	db.ExecuteSQL("INSERT INTO docs(id, body) VALUES (2, 'short');")
+	_, results1 := db.ExecuteSQL("SELECT body FROM docs WHERE id = 1;")
+	testingpkg.SimpleAssert(t, len(results1) == 1)
+	testingpkg.SimpleAssert(t, results1[0][0].(string) == body1)
+
+	db.ExecuteSQL("UPDATE docs SET body = '" + body2 + "' WHERE id = 1;")
+	db.Shutdown()
+
+	db2, err := samehada.NewSamehadaDB(t.Name(), 200)
+	testingpkg.Ok(t, err)
+	_, results2 := db2.ExecuteSQL("SELECT id, body FROM docs;")
+	testingpkg.SimpleAssert(t, len(results2) == 2)
+	for _, resultRow := range results2 {
+		if resultRow[0].(int32) == 1 {
+			testingpkg.SimpleAssert(t, resultRow[1].(string) == body2)
+		} else {
+			testingpkg.SimpleAssert(t, resultRow[1].(string) == "short")
+		}
+	}
+	db2.ExecuteSQL("DELETE FROM docs WHERE id = 1;")
+	_, results3 := db2.ExecuteSQL("SELECT id FROM docs;")
+	testingpkg.SimpleAssert(t, len(results3) == 1)
+
+	common.TempSuppressOnMemStorage = false
+	db2.Shutdown()
+	common.TempSuppressOnMemStorageMutex.Unlock()
+}
+
+func TestDeclaredStringLength(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+	os.Remove(t.Name() + ".db")
+	os.Remove(t.Name() + ".log")
+
+	db, err := samehada.NewSamehadaDB(t.Name(), 200)
+	testingpkg.Ok(t, err)
+	db.ExecuteSQL("CREATE TABLE codes(name VARCHAR(5), code CHAR(4), id INT);")
+	err, _ = db.ExecuteSQL("INSERT INTO codes(name, code, id) VALUES ('鮫肌鮫肌鮫', 'ab', 1);")
+	testingpkg.Ok(t, err)
+	err, _ = db.ExecuteSQL("INSERT INTO codes(name, code, id) VALUES ('samehada', 'cd', 2);")
+	var tooLongErr *column.ValueTooLongError
+	testingpkg.SimpleAssert(t, errors.As(err, &tooLongErr))
+	testingpkg.SimpleAssert(t, tooLongErr.ColumnName == "name" && tooLongErr.MaxLength == 5 && tooLongErr.Length == 8)
+	err, _ = db.ExecuteSQL("UPDATE codes SET code = 'abcde' WHERE id = 1;")
+	testingpkg.SimpleAssert(t, errors.As(err, &tooLongErr))
+
+	// value of CHAR(n) is stored with padding and returned without trailing spaces
+	_, results1 := db.ExecuteSQL("SELECT code FROM codes WHERE code = 'ab';")
+	testingpkg.SimpleAssert(t, len(results1) == 1)
+	testingpkg.SimpleAssert(t, results1[0][0].(string) == "ab")
+	db.Shutdown()
+
+	// declared lengths are kept in catalog
+	db2, err := samehada.NewSamehadaDB(t.Name(), 200)
+	testingpkg.Ok(t, err)
+	err, _ = db2.ExecuteSQL("INSERT INTO codes(name, code, id) VALUES ('abc', 'abcde', 3);")
+	testingpkg.SimpleAssert(t, errors.As(err, &tooLongErr))
+	_, results2 := db2.ExecuteSQL("SELECT id FROM codes;")
+	testingpkg.SimpleAssert(t, len(results2) == 1)
+
+	common.TempSuppressOnMemStorage = false
+	db2.Shutdown()
+	common.TempSuppressOnMemStorageMutex.Unlock()
+}
+
+func TestNullValues(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+	removeDBFilesForTesting(t.Name())
+
+	db, err := samehada.NewSamehadaDB(t.Name(), 200)
+	testingpkg.Ok(t, err)
+	db.ExecuteSQL("CREATE TABLE t(a INT, b VARCHAR(10), c INT);")
+	err, _ = db.ExecuteSQL("INSERT INTO t(a, b, c) VALUES (1, 'x', NULL);")
+	testingpkg.Ok(t, err)
+	err, _ = db.ExecuteSQL("INSERT INTO t(a, b, c) VALUES (2, NULL, 20);")
+	testingpkg.Ok(t, err)
+	err, _ = db.ExecuteSQL("INSERT INTO t(a, b, c) VALUES (NULL, 'z', 30);")
+	testingpkg.Ok(t, err)
+	db.Shutdown()
+
+	// null bitmap of tuples is persisted
+	db2, err := samehada.NewSamehadaDB(t.Name(), 200)
+	testingpkg.Ok(t, err)
+	_, results1 := db2.ExecuteSQL("SELECT a FROM t WHERE c IS NULL;")
+	testingpkg.SimpleAssert(t, len(results1) == 1)
+	testingpkg.SimpleAssert(t, results1[0][0].(int32) == 1)
+	_, results2 := db2.ExecuteSQL("SELECT a, b, c FROM t WHERE b IS NOT NULL;")
+	testingpkg.SimpleAssert(t, len(results2) == 2)
+	_, results3 := db2.ExecuteSQL("SELECT a, b, c FROM t WHERE a = 2;")
+	testingpkg.SimpleAssert(t, len(results3) == 1)
+	testingpkg.SimpleAssert(t, results3[0][1] == nil)
+	testingpkg.SimpleAssert(t, results3[0][2].(int32) == 20)
+
+	// comparison with NULL is not satisfied
+	_, results4 := db2.ExecuteSQL("SELECT a FROM t WHERE c = NULL;")
+	testingpkg.SimpleAssert(t, len(results4) == 0)
+	_, results5 := db2.ExecuteSQL("SELECT a FROM t WHERE c > 10;")
+	testingpkg.SimpleAssert(t, len(results5) == 2)
+	_, results6 := db2.ExecuteSQL("SELECT c FROM t WHERE a < 5;")
+	testingpkg.SimpleAssert(t, len(results6) == 2)
+
+	common.TempSuppressOnMemStorage = false
+	db2.Shutdown()
+	common.TempSuppressOnMemStorageMutex.Unlock()
+}
+
+func TestVacuum(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+
+	removeDBFilesForTesting(t.Name())
+
+	db, err := samehada.NewSamehadaDB(t.Name(), 200)
+	testingpkg.Ok(t, err)
+	db.ExecuteSQLRetValues("CREATE TABLE name_age_list(name VARCHAR(256), age INT);")
+	for ii := 0; ii < 200; ii++ {
+		db.ExecuteSQLRetValues(fmt.Sprintf("INSERT INTO name_age_list(name, age) VALUES ('%0200d', %d);", ii, ii))
+	}
+	db.ExecuteSQLRetValues("DELETE FROM name_age_list WHERE age < 190;")
+
+	err, _ = db.ExecuteSQLRetValues("VACUUM name_age_list;")
+	testingpkg.SimpleAssert(t, err == nil)
+	err, _ = db.ExecuteSQLRetValues("VACUUM not_exist_table;")
+	testingpkg.SimpleAssert(t, err != nil)
+
+	_, results1 := db.ExecuteSQLRetValues("SELECT * FROM name_age_list;")
+	testingpkg.SimpleAssert(t, len(results1) == 10)
+
+	db.Shutdown()
+
+	// moved rows are persisted and released pages are reused by new rows
+	db2, err := samehada.NewSamehadaDB(t.Name(), 200)
+	testingpkg.Ok(t, err)
+	_, results2 := db2.ExecuteSQLRetValues("SELECT * FROM name_age_list WHERE age >= 190;")
+	testingpkg.SimpleAssert(t, len(results2) == 10)
+	for ii := 200; ii < 250; ii++ {
+		db2.ExecuteSQLRetValues(fmt.Sprintf("INSERT INTO name_age_list(name, age) VALUES ('%0200d', %d);", ii, ii))
+	}
+	err, _ = db2.ExecuteSQLRetValues("VACUUM;")
+	testingpkg.SimpleAssert(t, err == nil)
+	_, results3 := db2.ExecuteSQLRetValues("SELECT * FROM name_age_list;")
+	testingpkg.SimpleAssert(t, len(results3) == 60)
+
+	common.TempSuppressOnMemStorage = false
+	db2.Shutdown()
+	common.TempSuppressOnMemStorageMutex.Unlock()
+	removeDBFilesForTesting(t.Name())
+}
+
+func TestStats(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+
+	removeDBFilesForTesting(t.Name())
+
+	db, err := samehada.NewSamehadaDB(t.Name(), 200)
+	testingpkg.Ok(t, err)
+	db.ExecuteSQLRetValues("CREATE TABLE name_age_list(name VARCHAR(256), age INT);")
+	db.ExecuteSQLRetValues("INSERT INTO name_age_list(name, age) VALUES ('鈴木', 20);")
+	db.ExecuteSQLRetValues("INSERT INTO name_age_list(name, age) VALUES ('青木', 22);")
+	_, results := db.ExecuteSQLRetValues("SELECT * FROM name_age_list WHERE age >= 20;")
+	testingpkg.SimpleAssert(t, len(results) == 2)
+
+	stats := db.Stats()
+	testingpkg.SimpleAssert(t, stats.BufferPool.Hits > 0)
+	testingpkg.SimpleAssert(t, stats.TablePageAccesses["name_age_list"] > 0)
+	testingpkg.SimpleAssert(t, stats.Log.Flushes > 0 && stats.Log.FlushedBytes > 0)
+	testingpkg.SimpleAssert(t, stats.Lock.Requests > 0)
+	// 4 statements and one transaction at launch
+	testingpkg.SimpleAssert(t, stats.Txn.Commits == 5)
+	testingpkg.SimpleAssert(t, stats.Txn.Aborts == 0)
+	testingpkg.SimpleAssert(t, stats.TxnCommitRate > 0)
+
+	rec := httptest.NewRecorder()
+	db.StatsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Result().Body)
+	testingpkg.SimpleAssert(t, strings.Contains(string(body), "# TYPE samehada_buffer_pool_hits_total counter"))
+	testingpkg.SimpleAssert(t, strings.Contains(string(body), "samehada_txn_commits_total 5\n"))
+	testingpkg.SimpleAssert(t, strings.Contains(string(body), "samehada_table_page_accesses_total{table=\"name_age_list\"} "))
+
+	common.TempSuppressOnMemStorage = false
+	db.Shutdown()
+	common.TempSuppressOnMemStorageMutex.Unlock()
+	removeDBFilesForTesting(t.Name())
+}
+
+func TestPageSizePerDB(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+
+	removeDBFilesForTesting(t.Name())
+
+	_, err := samehada.NewSamehadaDBWithPageSize(t.Name(), 200, 3*common.PageSize)
+	testingpkg.SimpleAssert(t, err != nil)
+
+	pageSize := 4 * common.PageSize
+	db, err := samehada.NewSamehadaDBWithPageSize(t.Name(), 800, pageSize)
+	testingpkg.SimpleAssert(t, err == nil)
+	db.ExecuteSQLRetValues("CREATE TABLE name_age_list(name VARCHAR(256), age INT);")
+	for ii := 0; ii < 300; ii++ {
+		db.ExecuteSQLRetValues(fmt.Sprintf("INSERT INTO name_age_list(name, age) VALUES ('%0200d', %d);", ii, ii))
+	}
+	_, results1 := db.ExecuteSQLRetValues("SELECT * FROM name_age_list WHERE age >= 100;")
+	testingpkg.SimpleAssert(t, len(results1) == 200)
+	db.Shutdown()
+
+	fileInfo, err := os.Stat(t.Name() + ".db")
+	testingpkg.SimpleAssert(t, err == nil && fileInfo.Size()%int64(pageSize) == 0)
+
+	// reopen with different page size is rejected
+	_, err = samehada.NewSamehadaDBWithPageSize(t.Name(), 800, common.PageSize)
+	var mismatchErr *disk.PageSizeMismatchError
+	testingpkg.SimpleAssert(t, errors.As(err, &mismatchErr) && mismatchErr.FilePageSize == pageSize)
+
+	// page size recorded in db file is used at reopen
+	db2, err := samehada.NewSamehadaDB(t.Name(), 800)
+	testingpkg.Ok(t, err)
+	_, results2 := db2.ExecuteSQLRetValues("SELECT * FROM name_age_list WHERE age >= 100;")
+	testingpkg.SimpleAssert(t, len(results2) == 200)
+	db2.ExecuteSQLRetValues("UPDATE name_age_list SET age = 1000 WHERE age < 100;")
+	_, results3 := db2.ExecuteSQLRetValues("SELECT * FROM name_age_list WHERE age = 1000;")
+	testingpkg.SimpleAssert(t, len(results3) == 100)
+
+	common.TempSuppressOnMemStorage = false
+	db2.Shutdown()
+	common.TempSuppressOnMemStorageMutex.Unlock()
+	removeDBFilesForTesting(t.Name())
+}
+
+func TestOpenHeaderlessAndInvalidDBFile(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+
+	removeDBFilesForTesting(t.Name())
+
+	db, err := samehada.NewSamehadaDB(t.Name(), 200)
+	testingpkg.Ok(t, err)
+	db.ExecuteSQLRetValues("CREATE TABLE name_age_list(name VARCHAR(256), age INT);")
+	for ii := 0; ii < 100; ii++ {
+		db.ExecuteSQLRetValues(fmt.Sprintf("INSERT INTO name_age_list(name, age) VALUES ('name%d', %d);", ii, ii))
+	}
+	db.Shutdown()
+
+	// Scenario: db file written before header was added (pages are placed from the head of file) is migrated at open
+	data, err := os.ReadFile(t.Name() + ".db")
+	testingpkg.Ok(t, err)
+	testingpkg.Ok(t, os.WriteFile(t.Name()+".db", data[common.PageSize:], 0666))
+	header, err := disk.ReadDBHeader(t.Name() + ".db")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, uint32(0), header.FormatVersion)
+
+	db2, err := samehada.NewSamehadaDB(t.Name(), 200)
+	testingpkg.Ok(t, err)
+	_, results := db2.ExecuteSQLRetValues("SELECT * FROM name_age_list WHERE age >= 50;")
+	testingpkg.SimpleAssert(t, len(results) == 50)
+	db2.Shutdown()
+	header, err = disk.ReadDBHeader(t.Name() + ".db")
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, uint32(disk.DBFormatVersion), header.FormatVersion)
+
+	// Scenario: file which is not db file of SamehadaDB is rejected with error
+	removeDBFilesForTesting(t.Name())
+	testingpkg.Ok(t, os.WriteFile(t.Name()+".db", []byte(strings.Repeat("this is not a db file. ", 1000)), 0666))
+	db3, err := samehada.NewSamehadaDB(t.Name(), 200)
+	testingpkg.SimpleAssert(t, db3 == nil && err == disk.ErrNotSamehadaDBFile)
+
+	common.TempSuppressOnMemStorage = false
+	common.TempSuppressOnMemStorageMutex.Unlock()
+	removeDBFilesForTesting(t.Name())
+}
@@ -0,0 +1,83 @@
+package samehada
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/ryogrid/SamehadaDB/recovery"
+	"github.com/ryogrid/SamehadaDB/storage/access"
+	"github.com/ryogrid/SamehadaDB/storage/buffer"
+)
+
+// Stats is a snapshot of counters of a SamehadaDB instance. counters are totals since the instance was launched
+type Stats struct {
+	Uptime     time.Duration
+	BufferPool buffer.BufferPoolStats
+	// table name -> number of page fetches for accessing the table
+	TablePageAccesses map[string]uint64
+	Log               recovery.LogStats
+	Lock              access.LockStats
+	Txn               access.TxnStats
+	// average number of committed/aborted transactions per second since launch
+	TxnCommitRate float64
+	TxnAbortRate  float64
+}
+
+func (sdb *SamehadaDB) Stats() *Stats {
+	ret := new(Stats)
+	ret.Uptime = time.Since(sdb.startTime)
+	ret.BufferPool = sdb.shi_.GetBufferPoolManager().GetStats()
+	ret.TablePageAccesses = make(map[string]uint64)
+	for _, tableMetadata := range sdb.catalog_.GetAllTables() {
+		ret.TablePageAccesses[tableMetadata.Name()] = tableMetadata.Table().GetPageAccessCount()
+	}
+	ret.Log = sdb.shi_.GetLogManager().GetStats()
+	ret.Lock = sdb.shi_.GetLockManager().GetStats()
+	ret.Txn = sdb.shi_.GetTransactionManager().GetStats()
+	if secs := ret.Uptime.Seconds(); secs > 0 {
+		ret.TxnCommitRate = float64(ret.Txn.Commits) / secs
+		ret.TxnAbortRate = float64(ret.Txn.Aborts) / secs
+	}
+	return ret
+}
+
+func writeMetric(w http.ResponseWriter, name string, metricType string, help string, value interface{}) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+	fmt.Fprintf(w, "%s %v\n", name, value)
+}
+
+// StatsHandler returns a http.Handler which serves Stats in Prometheus text exposition format.
+// ex: http.Handle("/metrics", db.StatsHandler())
+func (sdb *SamehadaDB) StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats := sdb.Stats()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		writeMetric(w, "samehada_uptime_seconds", "gauge", "Time since the instance was launched.", stats.Uptime.Seconds())
+		writeMetric(w, "samehada_buffer_pool_hits_total", "counter", "Page fetches served from the buffer pool.", stats.BufferPool.Hits)
+		writeMetric(w, "samehada_buffer_pool_misses_total", "counter", "Page fetches which read the page from disk.", stats.BufferPool.Misses)
+		writeMetric(w, "samehada_buffer_pool_evictions_total", "counter", "Pages cached out of the buffer pool.", stats.BufferPool.Evictions)
+		writeMetric(w, "samehada_buffer_pool_dirty_flushes_total", "counter", "Writes of dirty pages to disk.", stats.BufferPool.DirtyFlushes)
+
+		fmt.Fprintf(w, "# HELP samehada_table_page_accesses_total Page fetches for accessing each table.\n")
+		fmt.Fprintf(w, "# TYPE samehada_table_page_accesses_total counter\n")
+		tableNames := make([]string, 0, len(stats.TablePageAccesses))
+		for tableName := range stats.TablePageAccesses {
+			tableNames = append(tableNames, tableName)
+		}
+		sort.Strings(tableNames)
+		for _, tableName := range tableNames {
+			fmt.Fprintf(w, "samehada_table_page_accesses_total{table=%q} %d\n", tableName, stats.TablePageAccesses[tableName])
+		}
+
+		writeMetric(w, "samehada_log_flushes_total", "counter", "Writes of log buffer to log file.", stats.Log.Flushes)
+		writeMetric(w, "samehada_log_flushed_bytes_total", "counter", "Bytes of log data written to log file.", stats.Log.FlushedBytes)
+		writeMetric(w, "samehada_lock_requests_total", "counter", "Tuple lock requests.", stats.Lock.Requests)
+		writeMetric(w, "samehada_lock_conflicts_total", "counter", "Tuple lock requests which failed by conflict (requester is aborted).", stats.Lock.Conflicts)
+		writeMetric(w, "samehada_txn_commits_total", "counter", "Committed transactions.", stats.Txn.Commits)
+		writeMetric(w, "samehada_txn_aborts_total", "counter", "Aborted transactions.", stats.Txn.Aborts)
+	})
+}
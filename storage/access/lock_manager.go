@@ -72,6 +72,16 @@ type LockManager struct {
 
 	shared_lock_table    map[page.RID][]types.TxnID
 	exclusive_lock_table map[page.RID]types.TxnID
+
+	stats LockStats
+}
+
+// LockStats is counters of LockManager (values are totals since the manager was created)
+// lock requests don't wait. a request which conflicts with a lock held by other txn fails
+// and the requesting txn is aborted
+type LockStats struct {
+	Requests  uint64
+	Conflicts uint64
 }
 
 /**
@@ -156,11 +166,13 @@ func (lock_manager *LockManager) LockShared(txn *Transaction, rid *page.RID) boo
 	//fmt.Printf("called LockShared, %v\n", rid)
 	lock_manager.mutex.Lock()
 	defer lock_manager.mutex.Unlock()
+	lock_manager.stats.Requests++
 	slock_set := txn.GetSharedLockSet()
 	if txnID, ok := lock_manager.exclusive_lock_table[*rid]; ok {
 		if txnID == txn.GetTransactionId() {
 			return true
 		} else {
+			lock_manager.stats.Conflicts++
 			return false
 		}
 	} else {
@@ -196,16 +208,19 @@ func (lock_manager *LockManager) LockExclusive(txn *Transaction, rid *page.RID)
 	//fmt.Printf("called LockExclusive, %v\n", rid)
 	lock_manager.mutex.Lock()
 	defer lock_manager.mutex.Unlock()
+	lock_manager.stats.Requests++
 	exlock_set := txn.GetExclusiveLockSet()
 	if txnID, ok := lock_manager.exclusive_lock_table[*rid]; ok {
 		if txnID == txn.GetTransactionId() {
 			return true
 		} else {
+			lock_manager.stats.Conflicts++
 			return false
 		}
 	} else {
 		if arr, ok := lock_manager.shared_lock_table[*rid]; ok {
 			if len(arr) != 0 {
+				lock_manager.stats.Conflicts++
 				return false
 			}
 		}
@@ -227,6 +242,7 @@ func (lock_manager *LockManager) LockUpgrade(txn *Transaction, rid *page.RID) bo
 	//fmt.Printf("called LockUpgrade %v\n", rid)
 	lock_manager.mutex.Lock()
 	defer lock_manager.mutex.Unlock()
+	lock_manager.stats.Requests++
 	slock_set := txn.GetSharedLockSet()
 	elock_set := txn.GetExclusiveLockSet()
 	if txn.IsSharedLocked(rid) {
@@ -234,6 +250,7 @@ func (lock_manager *LockManager) LockUpgrade(txn *Transaction, rid *page.RID) bo
 			if txnID == txn.GetTransactionId() {
 				return true
 			} else {
+				lock_manager.stats.Conflicts++
 				return false
 			}
 		} else {
@@ -285,6 +302,13 @@ func (lock_manager *LockManager) Unlock(txn *Transaction, rid_list []page.RID) b
 	return true
 }
 
+// GetStats returns a snapshot of counters
+func (lock_manager *LockManager) GetStats() LockStats {
+	lock_manager.mutex.Lock()
+	defer lock_manager.mutex.Unlock()
+	return lock_manager.stats
+}
+
 func (lock_manager *LockManager) PrintLockTables() {
 	fmt.Printf("len of shared_lock_table at WUnlock %d\n", len(lock_manager.shared_lock_table))
 	fmt.Printf("len of exclusive_lock_table at WUnlock %d\n", len(lock_manager.exclusive_lock_table))
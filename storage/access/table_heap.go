@@ -12,6 +12,7 @@ import (
 	"github.com/ryogrid/SamehadaDB/storage/table/schema"
 	"github.com/ryogrid/SamehadaDB/storage/tuple"
 	"github.com/ryogrid/SamehadaDB/types"
+	"sync/atomic"
 )
 
 // TableHeap represents a physical table on disk.
@@ -21,6 +22,8 @@ type TableHeap struct {
 	firstPageId  types.PageID
 	log_manager  *recovery.LogManager
 	lock_manager *LockManager
+	// number of page fetches for accessing this table
+	page_access_cnt uint64
 }
 
 // NewTableHeap creates a table heap without a  (open table)
@@ -34,12 +37,33 @@ func NewTableHeap(bpm *buffer.BufferPoolManager, log_manager *recovery.LogManage
 	// flush page for recovery process works...
 	bpm.FlushPage(p.ID())
 	bpm.UnpinPage(p.ID(), true)
-	return &TableHeap{bpm, p.ID(), log_manager, lock_manager}
+	return &TableHeap{bpm, p.ID(), log_manager, lock_manager, 0}
 }
 
 // InitTableHeap ...
 func InitTableHeap(bpm *buffer.BufferPoolManager, pageId types.PageID, log_manager *recovery.LogManager, lock_manager *LockManager) *TableHeap {
-	return &TableHeap{bpm, pageId, log_manager, lock_manager}
+	return &TableHeap{bpm, pageId, log_manager, lock_manager, 0}
+}
+
+// aborts txn because a page could not be pinned or read (ex: buffer.ErrBufferPoolExhausted, *disk.PageCorruptionError).
+// the error is also recorded to txn for reporting it to the client
+func abortByPageError(txn *Transaction, err error) error {
+	if txn != nil {
+		txn.SetState(ABORTED)
+		txn.SetAbortReason(err)
+	}
+	return err
+}
+
+// fetches a page of this table with counting the access
+func (t *TableHeap) fetchPage(pageId types.PageID) (*page.Page, error) {
+	atomic.AddUint64(&t.page_access_cnt, 1)
+	return t.bpm.FetchPageWithErr(pageId)
+}
+
+// GetPageAccessCount returns number of page fetches for accessing this table
+func (t *TableHeap) GetPageAccessCount() uint64 {
+	return atomic.LoadUint64(&t.page_access_cnt)
 }
 
 // GetFirstPageId returns firstPageId
@@ -55,7 +79,25 @@ func (t *TableHeap) GetFirstPageId() types.PageID {
 // 1. It tries to insert in the next page
 // 2. If there is no next page, it creates a new page and insert in it
 func (t *TableHeap) InsertTuple(tuple_ *tuple.Tuple, txn *Transaction) (rid *page.RID, err error) {
-	currentPage := CastPageAsTablePage(t.bpm.FetchPage(t.firstPageId))
+	stored_tuple, err := t.prepareTupleForPage(tuple_, txn)
+	if err != nil {
+		return nil, err
+	}
+	rid, err = t.insertStoredTuple(stored_tuple, txn)
+	if err == nil {
+		tuple_.SetRID(rid)
+	}
+	return rid, err
+}
+
+// inserts data which is stored on a table page (a stub when data of the tuple is on overflow pages)
+func (t *TableHeap) insertStoredTuple(tuple_ *tuple.Tuple, txn *Transaction) (rid *page.RID, err error) {
+	prevLSN := txn.GetPrevLSN()
+	pg, err := t.fetchPage(t.firstPageId)
+	if err != nil {
+		return nil, abortByPageError(txn, err)
+	}
+	currentPage := CastPageAsTablePage(pg)
 
 	// Insert into the first page with enough space. If no such page exists, create a new page and insert into that.
 	// INVARIANT: currentPage is WLatched if you leave the loop normally.
@@ -76,10 +118,19 @@ func (t *TableHeap) InsertTuple(tuple_ *tuple.Tuple, txn *Transaction) (rid *pag
 		if nextPageId.IsValid() {
 			t.bpm.UnpinPage(currentPage.GetTablePageId(), false)
 			currentPage.WUnlatch()
-			currentPage = CastPageAsTablePage(t.bpm.FetchPage(nextPageId))
+			pg, err = t.fetchPage(nextPageId)
+			if err != nil {
+				return nil, abortByPageError(txn, err)
+			}
+			currentPage = CastPageAsTablePage(pg)
 			//currentPage.WLatch()
 		} else {
 			p := t.bpm.NewPage()
+			if p == nil {
+				currentPage.WUnlatch()
+				t.bpm.UnpinPage(currentPage.GetTablePageId(), false)
+				return nil, abortByPageError(txn, buffer.ErrBufferPoolExhausted)
+			}
 			currentPage.SetNextPageId(p.ID())
 			currentPage.WUnlatch()
 			newPage := CastPageAsTablePage(p)
@@ -97,26 +148,41 @@ func (t *TableHeap) InsertTuple(tuple_ *tuple.Tuple, txn *Transaction) (rid *pag
 
 	t.bpm.UnpinPage(currentPage.GetTablePageId(), true)
 	// Update the transaction's write set.
-	txn.AddIntoWriteSet(NewWriteRecord(*rid, INSERT, new(tuple.Tuple), t))
+	txn.AddIntoWriteSet(NewWriteRecord(*rid, INSERT, new(tuple.Tuple), t, prevLSN))
 	return rid, nil
 }
 
 // if specified nil to update_col_idxs and schema_, all data of existed tuple is replaced one of new_tuple
 // if specified not nil, new_tuple also should have all columns defined in schema. but not update target value can be dummy value
 func (t *TableHeap) UpdateTuple(tuple_ *tuple.Tuple, update_col_idxs []int, schema_ *schema.Schema, rid page.RID, txn *Transaction) (bool, *page.RID) {
+	if update_col_idxs != nil && schema_ != nil {
+		// values of not updated columns are read here because data of the tuple may be on overflow pages
+		old_tuple := t.GetTuple(&rid, txn)
+		if old_tuple == nil {
+			return false, nil
+		}
+		tuple_ = mergeUpdatedValues(tuple_, old_tuple, update_col_idxs, schema_)
+	}
+	stored_tuple, err := t.prepareTupleForPage(tuple_, txn)
+	if err != nil {
+		return false, nil
+	}
+
+	prevLSN := txn.GetPrevLSN()
 	// Find the page which contains the tuple.
-	page_ := CastPageAsTablePage(t.bpm.FetchPage(rid.GetPageId()))
+	pg, err := t.fetchPage(rid.GetPageId())
 	// If the page could not be found, then abort the transaction.
-	if page_ == nil {
-		txn.SetState(ABORTED)
+	if err != nil {
+		abortByPageError(txn, err)
 		return false, nil
 	}
+	page_ := CastPageAsTablePage(pg)
 	// Update the tuple; but first save the old value for rollbacks.
 	old_tuple := new(tuple.Tuple)
 	old_tuple.SetRID(new(page.RID))
 
 	page_.WLatch()
-	is_updated, err, need_follow_tuple := page_.UpdateTuple(tuple_, update_col_idxs, schema_, old_tuple, &rid, txn, t.lock_manager, t.log_manager)
+	is_updated, err, need_follow_tuple := page_.UpdateTuple(stored_tuple, nil, nil, old_tuple, &rid, txn, t.lock_manager, t.log_manager)
 	page_.WUnlatch()
 	t.bpm.UnpinPage(page_.GetTablePageId(), is_updated)
 
@@ -133,7 +199,7 @@ func (t *TableHeap) UpdateTuple(tuple_ *tuple.Tuple, update_col_idxs []int, sche
 		}
 
 		var err error = nil
-		new_rid, err = t.InsertTuple(need_follow_tuple, txn)
+		new_rid, err = t.insertStoredTuple(need_follow_tuple, txn)
 		if err != nil {
 			fmt.Println("TableHeap::UpdateTuple(): InsertTuple failed")
 			txn.SetState(ABORTED)
@@ -147,19 +213,26 @@ func (t *TableHeap) UpdateTuple(tuple_ *tuple.Tuple, update_col_idxs []int, sche
 
 	// Update the transaction's write set.
 	if is_updated && txn.GetState() != ABORTED {
-		txn.AddIntoWriteSet(NewWriteRecord(rid, UPDATE, old_tuple, t))
+		txn.AddIntoWriteSet(NewWriteRecord(rid, UPDATE, old_tuple, t, prevLSN))
 	}
 	return is_updated, new_rid
 }
 
 func (t *TableHeap) MarkDelete(rid *page.RID, txn *Transaction) bool {
+	return t.markDelete(rid, txn, false)
+}
+
+// isMoved should be true when the tuple is inserted to other location by txn (overflow pages of it are not released at commit)
+func (t *TableHeap) markDelete(rid *page.RID, txn *Transaction, isMoved bool) bool {
+	prevLSN := txn.GetPrevLSN()
 	// Find the page which contains the tuple.
-	page_ := CastPageAsTablePage(t.bpm.FetchPage(rid.GetPageId()))
+	pg, err := t.fetchPage(rid.GetPageId())
 	// If the page could not be found, then abort the transaction.
-	if page_ == nil {
-		txn.SetState(ABORTED)
+	if err != nil {
+		abortByPageError(txn, err)
 		return false
 	}
+	page_ := CastPageAsTablePage(pg)
 	// Otherwise, mark the tuple as deleted.
 	page_.WLatch()
 	is_marked := page_.MarkDelete(rid, txn, t.lock_manager, t.log_manager)
@@ -167,42 +240,68 @@ func (t *TableHeap) MarkDelete(rid *page.RID, txn *Transaction) bool {
 	t.bpm.UnpinPage(page_.GetTablePageId(), true)
 	if is_marked {
 		// Update the transaction's write set.
-		txn.AddIntoWriteSet(NewWriteRecord(*rid, DELETE, new(tuple.Tuple), t))
+		write_record := NewWriteRecord(*rid, DELETE, new(tuple.Tuple), t, prevLSN)
+		write_record.isMoved = isMoved
+		txn.AddIntoWriteSet(write_record)
 	}
 
 	return is_marked
 }
 
-func (t *TableHeap) ApplyDelete(rid *page.RID, txn *Transaction) {
+// returns data of the deleted tuple (it is a stub when data of the tuple is on overflow pages).
+// txn is not aborted on error because this is called at commit or abort of it
+func (t *TableHeap) ApplyDelete(rid *page.RID, txn *Transaction) (*tuple.Tuple, error) {
 	// Find the page which contains the tuple.
-	page_ := CastPageAsTablePage(t.bpm.FetchPage(rid.GetPageId()))
-	common.SH_Assert(page_ != nil, "Couldn't find a page containing that RID.")
+	pg, err := t.fetchPage(rid.GetPageId())
+	if err != nil {
+		return nil, fmt.Errorf("delete of tuple (%d, %d) can't be applied: %w", rid.GetPageId(), rid.GetSlotNum(), err)
+	}
+	page_ := CastPageAsTablePage(pg)
 	// Delete the tuple from the page.
 	page_.WLatch()
-	page_.ApplyDelete(rid, txn, t.log_manager)
+	deleted_tuple := page_.ApplyDelete(rid, txn, t.log_manager)
 	//t.lock_manager.WUnlock(txn, []page.RID{*rid})
 	page_.WUnlatch()
 	t.bpm.UnpinPage(page_.GetTablePageId(), true)
+	return deleted_tuple, nil
 }
 
-func (t *TableHeap) RollbackDelete(rid *page.RID, txn *Transaction) {
+func (t *TableHeap) RollbackDelete(rid *page.RID, txn *Transaction) error {
 	// Find the page which contains the tuple.
-	page_ := CastPageAsTablePage(t.bpm.FetchPage(rid.GetPageId()))
-	common.SH_Assert(page_ != nil, "Couldn't find a page containing that RID.")
+	pg, err := t.fetchPage(rid.GetPageId())
+	if err != nil {
+		return fmt.Errorf("delete of tuple (%d, %d) can't be rolled back: %w", rid.GetPageId(), rid.GetSlotNum(), err)
+	}
+	page_ := CastPageAsTablePage(pg)
 	// Rollback the delete.
 	page_.WLatch()
 	page_.RollbackDelete(rid, txn, t.log_manager)
 	page_.WUnlatch()
 	t.bpm.UnpinPage(page_.GetTablePageId(), true)
+	return nil
 }
 
-// GetTuple reads a tuple from the table
+// GetTuple reads a tuple from the table. data on overflow pages is also read
 func (t *TableHeap) GetTuple(rid *page.RID, txn *Transaction) *tuple.Tuple {
+	stored_tuple := t.getStoredTuple(rid, txn)
+	if stored_tuple == nil {
+		return nil
+	}
+	return t.loadOverflowTuple(stored_tuple, txn)
+}
+
+// reads data of the tuple on the table page (a stub when data of the tuple is on overflow pages)
+func (t *TableHeap) getStoredTuple(rid *page.RID, txn *Transaction) *tuple.Tuple {
 	if !txn.IsSharedLocked(rid) && !txn.IsExclusiveLocked(rid) && !t.lock_manager.LockShared(txn, rid) {
 		txn.SetState(ABORTED)
 		return nil
 	}
-	page := CastPageAsTablePage(t.bpm.FetchPage(rid.GetPageId()))
+	pg, err := t.fetchPage(rid.GetPageId())
+	if err != nil {
+		abortByPageError(txn, err)
+		return nil
+	}
+	page := CastPageAsTablePage(pg)
 	defer t.bpm.UnpinPage(page.ID(), false)
 	page.RLatch()
 	ret := page.GetTuple(rid, t.log_manager, t.lock_manager, txn)
@@ -215,7 +314,12 @@ func (t *TableHeap) GetFirstTuple(txn *Transaction) *tuple.Tuple {
 	var rid *page.RID = nil
 	pageId := t.firstPageId
 	for pageId.IsValid() {
-		page := CastPageAsTablePage(t.bpm.FetchPage(pageId))
+		pg, err := t.fetchPage(pageId)
+		if err != nil {
+			abortByPageError(txn, err)
+			return nil
+		}
+		page := CastPageAsTablePage(pg)
 		page.RLatch()
 		rid = page.GetTupleFirstRID()
 		t.bpm.UnpinPage(pageId, false)
@@ -232,6 +336,379 @@ func (t *TableHeap) GetFirstTuple(txn *Transaction) *tuple.Tuple {
 	return t.GetTuple(rid, txn)
 }
 
+// TupleMove is a tuple relocated by Compact and its old and new location
+type TupleMove struct {
+	Tuple  *tuple.Tuple
+	OldRID page.RID
+	NewRID page.RID
+}
+
+// returns ids of all pages of the table in order of the page chain
+func (t *TableHeap) getPageIds() ([]types.PageID, error) {
+	pageIds := make([]types.PageID, 0)
+	pageId := t.firstPageId
+	for pageId.IsValid() {
+		pageIds = append(pageIds, pageId)
+		pg, err := t.fetchPage(pageId)
+		if err != nil {
+			return nil, err
+		}
+		page_ := CastPageAsTablePage(pg)
+		page_.RLatch()
+		nextPageId := page_.GetNextPageId()
+		page_.RUnlatch()
+		t.bpm.UnpinPage(pageId, false)
+		pageId = nextPageId
+	}
+	return pageIds, nil
+}
+
+// inserts a tuple into the specified page. ErrNotEnoughSpace or ErrNoFreeSlot is returned when the page is full
+func (t *TableHeap) insertTupleIntoPage(pageId types.PageID, tuple_ *tuple.Tuple, txn *Transaction) (*page.RID, error) {
+	prevLSN := txn.GetPrevLSN()
+	pg, err := t.fetchPage(pageId)
+	if err != nil {
+		return nil, abortByPageError(txn, err)
+	}
+	page_ := CastPageAsTablePage(pg)
+	page_.WLatch()
+	rid, err := page_.InsertTuple(tuple_, t.log_manager, t.lock_manager, txn)
+	page_.WUnlatch()
+	t.bpm.UnpinPage(pageId, err == nil)
+	if err != nil {
+		return nil, err
+	}
+	txn.AddIntoWriteSet(NewWriteRecord(*rid, INSERT, new(tuple.Tuple), t, prevLSN))
+	return rid, nil
+}
+
+// Compact moves tuples on pages at the tail of the table to free space of pages at the head.
+// each move is a insertion of the tuple and MarkDelete of the old one by txn.
+// so moves are logged and they are applied at commit (or rolled back at abort) as usual operations.
+// pages which become empty can be released with ReleaseEmptyPages after txn is committed.
+// PAY ATTENTION: index entries are not updated. caller should update them with returned moves
+// (when txn is aborted, nil is returned)
+func (t *TableHeap) Compact(txn *Transaction) []*TupleMove {
+	moves := make([]*TupleMove, 0)
+	pageIds, err := t.getPageIds()
+	if err != nil {
+		abortByPageError(txn, err)
+		return nil
+	}
+
+	dstIdx := 0
+	for srcIdx := len(pageIds) - 1; srcIdx > dstIdx; srcIdx-- {
+		pg, err := t.fetchPage(pageIds[srcIdx])
+		if err != nil {
+			abortByPageError(txn, err)
+			return nil
+		}
+		srcPage := CastPageAsTablePage(pg)
+		srcPage.RLatch()
+		tupleCount := srcPage.GetTupleCount()
+		srcPage.RUnlatch()
+
+		for slot := uint32(0); slot < tupleCount; slot++ {
+			srcPage.RLatch()
+			tupleSize := srcPage.GetTupleSize(slot)
+			srcPage.RUnlatch()
+			if IsDeleted(tupleSize) {
+				// empty slot or tuple which is being deleted by other txn
+				continue
+			}
+
+			oldRID := page.RID{}
+			oldRID.Set(pageIds[srcIdx], slot)
+			// a stub is moved as is. overflow pages are shared by old and new location until txn is committed
+			stored_tuple := t.getStoredTuple(&oldRID, txn)
+			var tuple_ *tuple.Tuple = nil
+			if stored_tuple != nil {
+				tuple_ = t.loadOverflowTuple(stored_tuple, txn)
+			}
+			if tuple_ == nil {
+				t.bpm.UnpinPage(pageIds[srcIdx], false)
+				txn.SetState(ABORTED)
+				return nil
+			}
+
+			var newRID *page.RID = nil
+			for dstIdx < srcIdx {
+				var err error
+				newRID, err = t.insertTupleIntoPage(pageIds[dstIdx], stored_tuple, txn)
+				if err == nil {
+					break
+				}
+				if err != ErrNotEnoughSpace && err != ErrNoFreeSlot {
+					t.bpm.UnpinPage(pageIds[srcIdx], false)
+					txn.SetState(ABORTED)
+					return nil
+				}
+				dstIdx++
+			}
+			if newRID == nil {
+				// pages before srcIdx have no free space anymore
+				t.bpm.UnpinPage(pageIds[srcIdx], false)
+				return moves
+			}
+
+			if !t.markDelete(&oldRID, txn, true) {
+				t.bpm.UnpinPage(pageIds[srcIdx], false)
+				txn.SetState(ABORTED)
+				return nil
+			}
+			tuple_.SetRID(newRID)
+			moves = append(moves, &TupleMove{tuple_, oldRID, *newRID})
+		}
+		t.bpm.UnpinPage(pageIds[srcIdx], false)
+	}
+
+	return moves
+}
+
+// ReleaseEmptyPages removes empty pages at the tail of the page chain and returns them to free page list.
+// returns number of released pages. when a page can not be read, the chain is not changed and the error is returned.
+// when some pages can not be deallocated, the others are released and the first error is returned
+// (such pages are not reachable from the table anymore but they can't be reused).
+// overflow pages which could not be released at commit or abort are also released (they are not counted).
+// PAY ATTENTION: this must be called when no transaction is running (see TransactionManager::BlockAllTransactions)
+func (t *TableHeap) ReleaseEmptyPages() (int, error) {
+	// overflow pages whose release failed at commit or abort are retried here
+	pendingErr := ReleasePendingOverflowPages(t.bpm)
+
+	pageIds, err := t.getPageIds()
+	if err != nil {
+		return 0, err
+	}
+
+	// the first page is never released because the catalog refers it
+	lastIdx := 0
+	for ii := len(pageIds) - 1; ii > 0; ii-- {
+		pg, err := t.fetchPage(pageIds[ii])
+		if err != nil {
+			return 0, err
+		}
+		page_ := CastPageAsTablePage(pg)
+		page_.RLatch()
+		isEmpty := page_.GetTupleFirstRID() == nil
+		page_.RUnlatch()
+		t.bpm.UnpinPage(pageIds[ii], false)
+		if !isEmpty {
+			lastIdx = ii
+			break
+		}
+	}
+	if lastIdx == len(pageIds)-1 {
+		return 0, pendingErr
+	}
+
+	// change of the page chain is not logged. so it is written to disk before
+	// the pages are deallocated (same as InsertTuple does for a new page)
+	pg, err := t.fetchPage(pageIds[lastIdx])
+	if err != nil {
+		return 0, err
+	}
+	lastPage := CastPageAsTablePage(pg)
+	lastPage.WLatch()
+	lastPage.SetNextPageId(types.InvalidPageID)
+	lastPage.WUnlatch()
+	t.bpm.UnpinPage(pageIds[lastIdx], true)
+	t.bpm.FlushPage(pageIds[lastIdx])
+
+	releasedCnt := 0
+	firstErr := pendingErr
+	for _, pageId := range pageIds[lastIdx+1:] {
+		if err = t.bpm.DeletePage(pageId); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("release of page %d failed: %w", pageId, err)
+			}
+			continue
+		}
+		releasedCnt++
+	}
+	return releasedCnt, firstErr
+}
+
+// writes data of tuple_ to overflow pages when it can't be stored in a table page and returns a stub of it.
+// otherwise tuple_ is returned as is. pages are written from the tail of the chain and each of them is
+// logged and registered to write set of txn, so they are released when txn is aborted
+func (t *TableHeap) prepareTupleForPage(tuple_ *tuple.Tuple, txn *Transaction) (*tuple.Tuple, error) {
+	pageSize := t.bpm.GetPageSize()
+	if tuple_.Size() <= maxInlineTupleSize(pageSize) {
+		return tuple_, nil
+	}
+
+	data := tuple_.Data()[:tuple_.Size()]
+	chunkSize := overflowDataSizePerPage(pageSize)
+	pageCnt := (tuple_.Size() + chunkSize - 1) / chunkSize
+	nextPageId := types.InvalidPageID
+	for ii := int(pageCnt) - 1; ii >= 0; ii-- {
+		chunk := data[uint32(ii)*chunkSize:]
+		if uint32(len(chunk)) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+
+		prevLSN := txn.GetPrevLSN()
+		p := t.bpm.NewPage()
+		if p == nil {
+			return nil, abortByPageError(txn, buffer.ErrBufferPoolExhausted)
+		}
+		overflowPage := CastPageAsTupleOverflowPage(p)
+		overflowPage.WLatch()
+		overflowPage.Init(p.ID(), nextPageId, chunk)
+		if t.log_manager.IsEnabledLogging() {
+			log_record := recovery.NewLogRecordTupleOverflow(txn.GetTransactionId(), prevLSN, p.ID(), nextPageId, chunk)
+			lsn := appendLogRecord(t.log_manager, txn, log_record)
+			overflowPage.SetLSN(lsn)
+			txn.SetPrevLSN(lsn)
+		}
+		overflowPage.WUnlatch()
+		// flush page for recovery process works (same as a new table page)
+		t.bpm.FlushPage(p.ID())
+		t.bpm.UnpinPage(p.ID(), true)
+
+		rid := page.RID{}
+		rid.Set(p.ID(), 0)
+		txn.AddIntoWriteSet(NewWriteRecord(rid, OVERFLOW, new(tuple.Tuple), t, prevLSN))
+		nextPageId = p.ID()
+	}
+	return newOverflowStub(nextPageId, tuple_.Size()), nil
+}
+
+// returns tuple which has data read from overflow pages when stored_tuple is a stub.
+// otherwise stored_tuple is returned as is
+func (t *TableHeap) loadOverflowTuple(stored_tuple *tuple.Tuple, txn *Transaction) *tuple.Tuple {
+	pageId, tupleSize, ok := parseOverflowStub(stored_tuple)
+	if !ok {
+		return stored_tuple
+	}
+
+	data := make([]byte, 0, tupleSize)
+	for pageId.IsValid() {
+		p, err := t.fetchPage(pageId)
+		if err != nil {
+			abortByPageError(txn, err)
+			return nil
+		}
+		overflowPage := CastPageAsTupleOverflowPage(p)
+		overflowPage.RLatch()
+		data = append(data, overflowPage.GetTupleData()...)
+		nextPageId := overflowPage.GetNextPageId()
+		overflowPage.RUnlatch()
+		t.bpm.UnpinPage(pageId, false)
+		pageId = nextPageId
+	}
+	common.SH_Assert(uint32(len(data)) == tupleSize, "data size on overflow pages differs from the stub.")
+	return tuple.NewTuple(stored_tuple.GetRID(), tupleSize, data)
+}
+
+// returns pages on the overflow page chain which begins with firstPageId.
+// when a page can't be read, pages from it are unknown and it is returned as unreadPageId with the error
+func getOverflowPageIds(bpm *buffer.BufferPoolManager, firstPageId types.PageID) (pageIds []types.PageID, unreadPageId types.PageID, err error) {
+	pageIds = make([]types.PageID, 0)
+	pageId := firstPageId
+	for pageId.IsValid() {
+		p, err := bpm.FetchPageWithErr(pageId)
+		if err != nil {
+			return pageIds, pageId, fmt.Errorf("release of overflow page %d failed: %w", pageId, err)
+		}
+		overflowPage := CastPageAsTupleOverflowPage(p)
+		overflowPage.RLatch()
+		nextPageId := overflowPage.GetNextPageId()
+		overflowPage.RUnlatch()
+		bpm.UnpinPage(pageId, false)
+		pageIds = append(pageIds, pageId)
+		pageId = nextPageId
+	}
+	return pageIds, types.InvalidPageID, nil
+}
+
+// logs overflow pages of tuples which are deleted or updated by txn. they are released when txn commits.
+// PAY ATTENTION: this must be called before the commit record is appended.
+// when system crashes after the commit record becomes durable, recovery process releases them
+// (see also BufferPoolManager::AddPendingReleases)
+func (t *TableHeap) logOverflowRelease(pageIds []types.PageID, chainPageIds []types.PageID, txn *Transaction) {
+	if !t.log_manager.IsEnabledLogging() {
+		return
+	}
+	for _, log_record := range recovery.NewLogRecordsReleasePages(txn.GetTransactionId(), pageIds, chainPageIds, t.log_manager.GetMaxLogRecordSize()) {
+		log_record.Prev_lsn = txn.GetPrevLSN()
+		lsn := appendLogRecord(t.log_manager, txn, log_record)
+		txn.SetPrevLSN(lsn)
+	}
+}
+
+// releases overflow pages of tuples which are deleted or updated by a committed transaction.
+// pages of chainPageIds are read from the chains. they are logged by logOverflowRelease beforehand.
+// PAY ATTENTION: this must be called after the commit record becomes durable.
+// pages which can not be released are kept for releasing them later (see ReleasePendingOverflowPages)
+// and the first error is returned
+func (t *TableHeap) releaseOverflowPages(pageIds []types.PageID, chainPageIds []types.PageID) error {
+	t.bpm.AddPendingReleases(pageIds, chainPageIds)
+	firstErr := releasePages(t.bpm, pageIds)
+	for _, chainPageId := range chainPageIds {
+		if err := releaseOverflowChain(t.bpm, chainPageId); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// ReleasePendingOverflowPages releases overflow pages whose release failed before
+// (including ones which are not released before crash. see BufferPoolManager::AddPendingReleases).
+// pages which can not be released yet are kept and the first error is returned
+func ReleasePendingOverflowPages(bpm *buffer.BufferPoolManager) error {
+	pageIds, chainPageIds := bpm.GetPendingReleases()
+	firstErr := releasePages(bpm, pageIds)
+	for _, chainPageId := range chainPageIds {
+		if err := releaseOverflowChain(bpm, chainPageId); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// releases pages which are registered as pending releases. ones which can not be released are kept
+func releasePages(bpm *buffer.BufferPoolManager, pageIds []types.PageID) error {
+	var firstErr error = nil
+	for _, pageId := range pageIds {
+		if err := bpm.DeletePage(pageId); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("release of overflow page %d failed: %w", pageId, err)
+		}
+	}
+	return firstErr
+}
+
+// releases pages of an overflow page chain which is registered as a pending release.
+// the pages are registered (and logged) in place of the chain before they are released
+func releaseOverflowChain(bpm *buffer.BufferPoolManager, chainPageId types.PageID) error {
+	pageIds, unreadPageId, readErr := getOverflowPageIds(bpm, chainPageId)
+	if len(pageIds) == 0 {
+		return readErr
+	}
+	if err := bpm.ResolvePendingChain(chainPageId, pageIds, unreadPageId); err != nil {
+		return err
+	}
+	if err := releasePages(bpm, pageIds); err != nil && readErr == nil {
+		return err
+	}
+	return readErr
+}
+
+// releases an overflow page written by txn which is being aborted.
+// a deallocation record is logged as a CLR, so the page is not released twice by recovery process
+func (t *TableHeap) rollbackOverflowPage(pageId types.PageID, txn *Transaction) {
+	if t.log_manager.IsEnabledLogging() {
+		log_record := recovery.NewLogRecordPageDeallocation(recovery.DEALLOCATEPAGE, pageId)
+		log_record.Txn_id = txn.GetTransactionId()
+		log_record.Prev_lsn = txn.GetPrevLSN()
+		lsn := appendLogRecord(t.log_manager, txn, log_record)
+		txn.SetPrevLSN(lsn)
+	}
+	// the page is released later when it can't be released now (see ReleasePendingOverflowPages)
+	t.bpm.AddPendingReleases([]types.PageID{pageId}, nil)
+	txn.recordFinishError(releasePages(t.bpm, []types.PageID{pageId}))
+}
+
 // Iterator returns a iterator for this table heap
 func (t *TableHeap) Iterator(txn *Transaction) *TableHeapIterator {
 	return NewTableHeapIterator(t, t.lock_manager, txn)
@@ -240,3 +717,7 @@ func (t *TableHeap) Iterator(txn *Transaction) *TableHeapIterator {
 func (t *TableHeap) GetBufferPoolManager() *buffer.BufferPoolManager {
 	return t.bpm
 }
+
+func (t *TableHeap) GetLogManager() *recovery.LogManager {
+	return t.log_manager
+}
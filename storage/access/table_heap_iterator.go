@@ -4,7 +4,11 @@
 package access
 
 import (
+	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/storage/buffer"
+	"github.com/ryogrid/SamehadaDB/storage/page"
 	"github.com/ryogrid/SamehadaDB/storage/tuple"
+	"github.com/ryogrid/SamehadaDB/types"
 )
 
 // TableHeapIterator is the access method for table heaps
@@ -16,12 +20,19 @@ type TableHeapIterator struct {
 	tuple        *tuple.Tuple
 	lock_manager *LockManager
 	txn          *Transaction
+	// read-ahead of pages which follow the current page (see readAhead)
+	isReadAheadStarted bool
+	readAheadCh        <-chan buffer.PrefetchResult
+	// the first page which is not read ahead yet (InvalidPageID when read-ahead stopped)
+	readAheadNextId types.PageID
+	// the number of pages read ahead which the iterator has not reached yet
+	readAheadRemain int
 }
 
 // NewTableHeapIterator creates a new table heap operator for the given table heap
 // It points to the first tuple of the table heap
 func NewTableHeapIterator(tableHeap *TableHeap, lock_manager *LockManager, txn *Transaction) *TableHeapIterator {
-	return &TableHeapIterator{tableHeap, tableHeap.GetFirstTuple(txn), lock_manager, txn}
+	return &TableHeapIterator{tableHeap, tableHeap.GetFirstTuple(txn), lock_manager, txn, false, nil, types.InvalidPageID, 0}
 }
 
 // Current points to the current tuple
@@ -39,18 +50,37 @@ func (it *TableHeapIterator) End() bool {
 // or it can be in the next page
 func (it *TableHeapIterator) Next() *tuple.Tuple {
 	bpm := it.tableHeap.bpm
-	currentPage := CastPageAsTablePage(bpm.FetchPage(it.tuple.GetRID().GetPageId()))
+	pg, err := it.tableHeap.fetchPage(it.tuple.GetRID().GetPageId())
+	if err != nil {
+		// iteration ends and txn is aborted (caller can check it with GetAbortReason of txn)
+		abortByPageError(it.txn, err)
+		it.tuple = nil
+		return nil
+	}
+	currentPage := CastPageAsTablePage(pg)
 	currentPage.RLatch()
+	if !it.isReadAheadStarted {
+		it.isReadAheadStarted = true
+		it.readAhead(currentPage.GetNextPageId(), false)
+	}
 
 	nextTupleRID := currentPage.GetNextTupleRID(it.tuple.GetRID(), false)
 	if nextTupleRID == nil {
 		// VARIANT: currentPage is always RLatched after loop
 		for currentPage.GetNextPageId().IsValid() {
-			nextPage := CastPageAsTablePage(bpm.FetchPage(currentPage.GetNextPageId()))
+			pg, err = it.tableHeap.fetchPage(currentPage.GetNextPageId())
+			if err != nil {
+				currentPage.RUnlatch()
+				bpm.UnpinPage(currentPage.GetTablePageId(), false)
+				abortByPageError(it.txn, err)
+				it.tuple = nil
+				return nil
+			}
 			currentPage.RUnlatch()
 			bpm.UnpinPage(currentPage.GetTablePageId(), false)
-			currentPage = nextPage
+			currentPage = CastPageAsTablePage(pg)
 			currentPage.RLatch()
+			it.readAhead(currentPage.GetNextPageId(), true)
 			nextTupleRID = currentPage.GetNextTupleRID(it.tuple.GetRID(), true)
 			//nextTupleRID = currentPage.GetNextTupleRID(it.tuple.GetRID(), false)
 
@@ -70,3 +100,38 @@ func (it *TableHeapIterator) Next() *tuple.Tuple {
 	bpm.UnpinPage(currentPage.GetTablePageId(), false)
 	return it.tuple
 }
+
+// readAhead requests read-ahead of pages which follow the current page when the iterator
+// has consumed half of pages read ahead. nextPageId is the next page of the current page
+// and isMoved is true when the iterator has moved to the current page from previous one
+func (it *TableHeapIterator) readAhead(nextPageId types.PageID, isMoved bool) {
+	if isMoved && it.readAheadRemain > 0 {
+		it.readAheadRemain--
+	}
+	if it.readAheadCh != nil {
+		select {
+		case ret := <-it.readAheadCh:
+			it.readAheadCh = nil
+			it.readAheadRemain += ret.ReadNum
+			it.readAheadNextId = ret.NextPageId
+		default:
+			// previous read-ahead is running
+			return
+		}
+	}
+	if common.ReadAheadPageNum <= 0 || it.readAheadRemain > common.ReadAheadPageNum/2 {
+		return
+	}
+
+	startPageId := it.readAheadNextId
+	if it.readAheadRemain == 0 {
+		// the iterator caught up with read-ahead
+		startPageId = nextPageId
+	}
+	if !startPageId.IsValid() {
+		return
+	}
+	it.readAheadCh = it.tableHeap.bpm.PrefetchPages(startPageId, common.ReadAheadPageNum, func(pg *page.Page) types.PageID {
+		return CastPageAsTablePage(pg).GetNextPageId()
+	})
+}
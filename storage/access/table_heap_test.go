@@ -4,9 +4,11 @@
 package access
 
 import (
+	"errors"
 	"fmt"
 	"github.com/ryogrid/SamehadaDB/common"
 	"github.com/ryogrid/SamehadaDB/storage/index/index_constants"
+	"os"
 	"testing"
 
 	"github.com/ryogrid/SamehadaDB/recovery"
@@ -63,9 +65,12 @@ func TestTableHeap(t *testing.T) {
 		rid := &page.RID{}
 		//// (4096 - 24) / (8 + (4 * 2)) => 254.5
 		//rid.Set(types.PageID(i/254), uint32(i%254))
-		// (4096 - 24) / (8 + (5 * 2)) => 226.222...
+		//// (4096 - 24) / (8 + (5 * 2)) => 226.222...
+		//rid.Set(types.PageID(i/226), uint32(i%226))
+		// tuple has header (2 bytes) and null bitmap (1 byte)
+		// (4096 - 24) / (8 + (2 + 1 + 4 * 2)) => 214.315...
 
-		rid.Set(types.PageID(i/226), uint32(i%226))
+		rid.Set(types.PageID(i/214), uint32(i%214))
 		tuple := th.GetTuple(rid, txn)
 		testingpkg.Equals(t, int32(i*2), tuple.GetValue(schema_, 0).ToInteger())
 		testingpkg.Equals(t, int32((i+1)*2), tuple.GetValue(schema_, 1).ToInteger())
@@ -108,9 +113,10 @@ func TestTableHeapFourCol(t *testing.T) {
 
 	th := NewTableHeap(bpm, log_manager, lock_manager, txn)
 
-	// this schema creates a tuple of size (4 + 1) * 4 => 20 bytes (when includes metadata at header the value is 28)
-	// it means that a page can only contains 145 tuples of this schema
-	// (4096 - 24) / 28 => 145.4285...
+	// this schema creates a tuple of size 2 + 1 + 4 * 4 => 19 bytes (header and null bitmap of tuple are included.
+	// when includes metadata at header the value is 27)
+	// it means that a page can only contains 150 tuples of this schema
+	// (4096 - 24) / 27 => 150.814...
 	columnA := column.NewColumn("a", types.Integer, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
 	columnB := column.NewColumn("b", types.Integer, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
 	columnC := column.NewColumn("c", types.Integer, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
@@ -119,7 +125,7 @@ func TestTableHeapFourCol(t *testing.T) {
 	schema_ := schema.NewSchema([]*column.Column{columnA, columnB, columnC, columnD})
 
 	// inserting 1000 tuples, means that we need at least 7 pages to insert all tuples
-	// 1000 / 145 => 6.896...
+	// 1000 / 150 => 6.666...
 	for i := 0; i < 1000; i++ {
 		row := make([]types.Value, 0)
 		row = append(row, types.NewInteger(int32(i*2)))
@@ -142,7 +148,7 @@ func TestTableHeapFourCol(t *testing.T) {
 
 	for i := 0; i < 1000; i++ {
 		rid := &page.RID{}
-		rid.Set(types.PageID(i/145), uint32(i%145))
+		rid.Set(types.PageID(i/150), uint32(i%150))
 		tuple_ := th.GetTuple(rid, txn)
 		testingpkg.Equals(t, int32(i*2), tuple_.GetValue(schema_, 0).ToInteger())
 		testingpkg.Equals(t, int32((i+1)*2), tuple_.GetValue(schema_, 1).ToInteger())
@@ -170,3 +176,241 @@ func TestTableHeapFourCol(t *testing.T) {
 
 	txn_mgr.Commit(txn)
 }
+
+// sequential scan of a table larger than the buffer pool with and without read-ahead.
+// db file is accessed with O_DIRECT (when it is supported) so that page cache of OS does not hide I/O
+func BenchmarkSeqScanReadAhead(b *testing.B) {
+	const poolSize = 32
+	const tupleNum = 20000
+
+	dbFileName := "BenchmarkSeqScanReadAhead.db"
+	os.Remove(dbFileName)
+	os.Remove("BenchmarkSeqScanReadAhead.log")
+	dm, err := disk.NewDiskManagerImplWithDirectIO(dbFileName)
+	testingpkg.Ok(b, err)
+	defer func() {
+		dm.ShutDown()
+		dm.RemoveDBFile()
+		dm.RemoveLogFile()
+	}()
+	log_manager := recovery.NewLogManager(&dm)
+	bpm := buffer.NewBufferPoolManager(poolSize, dm, log_manager)
+	lock_manager := NewLockManager(REGULAR, SS2PL_MODE)
+	txn_mgr := NewTransactionManager(lock_manager, log_manager)
+
+	txn := txn_mgr.Begin(nil)
+	th := NewTableHeap(bpm, log_manager, lock_manager, txn)
+	columnA := column.NewColumn("a", types.Integer, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	columnB := column.NewColumn("b", types.Integer, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	schema_ := schema.NewSchema([]*column.Column{columnA, columnB})
+	for i := 0; i < tupleNum; i++ {
+		row := []types.Value{types.NewInteger(int32(i)), types.NewInteger(int32(i * 2))}
+		th.InsertTuple(tuple.NewTupleFromSchema(row, schema_), txn)
+	}
+	txn_mgr.Commit(txn)
+	bpm.FlushAllPages()
+	pageNum := dm.Size() / common.PageSize
+
+	orgReadAheadPageNum := common.ReadAheadPageNum
+	defer func() { common.ReadAheadPageNum = orgReadAheadPageNum }()
+	for _, readAheadPageNum := range []int{0, 8, 32} {
+		b.Run(fmt.Sprintf("read-ahead=%d", readAheadPageNum), func(b *testing.B) {
+			common.ReadAheadPageNum = readAheadPageNum
+			b.SetBytes(pageNum * common.PageSize)
+			for n := 0; n < b.N; n++ {
+				txn := txn_mgr.Begin(nil)
+				cnt := 0
+				for it := th.Iterator(txn); !it.End(); it.Next() {
+					cnt++
+				}
+				txn_mgr.Commit(txn)
+				if cnt != tupleNum {
+					b.Fatalf("scan returned %d tuples", cnt)
+				}
+			}
+		})
+	}
+}
+
+func TestTableHeapLargeTuple(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+
+	dm := disk.NewDiskManagerTest()
+	defer dm.ShutDown()
+	log_manager := recovery.NewLogManager(&dm)
+	log_manager.ActivateLogging()
+	bpm := buffer.NewBufferPoolManager(10, dm, log_manager)
+	lock_manager := NewLockManager(STRICT, SS2PL_MODE)
+	txn_mgr := NewTransactionManager(lock_manager, log_manager)
+
+	txn := txn_mgr.Begin(nil)
+	th := NewTableHeap(bpm, log_manager, lock_manager, txn)
+	txn_mgr.Commit(txn)
+
+	columnA := column.NewColumn("a", types.Integer, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	columnB := column.NewColumn("b", types.Varchar, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	schema_ := schema.NewSchema([]*column.Column{columnA, columnB})
+
+	makeString := func(c byte, length int) string {
+		buf := make([]byte, length)
+		for ii := range buf {
+			buf[ii] = c + byte(ii%26)
+		}
+		return string(buf)
+	}
+	// longer than 65535 bytes. length of it is stored in long format
+	largeStr := makeString('a', 100000)
+	largeStr2 := makeString('A', 30000)
+	overflowPageCnt := func(str string) int {
+		size := int(tuple.NewTupleFromSchema([]types.Value{types.NewInteger(0), types.NewVarchar(str)}, schema_).Size())
+		perPage := int(overflowDataSizePerPage(bpm.GetPageSize()))
+		return (size + perPage - 1) / perPage
+	}
+
+	// insert a small tuple and a large tuple
+	txn = txn_mgr.Begin(nil)
+	smallRID, err := th.InsertTuple(tuple.NewTupleFromSchema([]types.Value{types.NewInteger(1), types.NewVarchar("small")}, schema_), txn)
+	testingpkg.Ok(t, err)
+	largeRID, err := th.InsertTuple(tuple.NewTupleFromSchema([]types.Value{types.NewInteger(2), types.NewVarchar(largeStr)}, schema_), txn)
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, smallRID.GetPageId(), largeRID.GetPageId())
+	txn_mgr.Commit(txn)
+
+	txn = txn_mgr.Begin(nil)
+	largeTuple := th.GetTuple(largeRID, txn)
+	testingpkg.Equals(t, int32(2), largeTuple.GetValue(schema_, 0).ToInteger())
+	testingpkg.Equals(t, largeStr, largeTuple.GetValue(schema_, 1).ToVarchar())
+	testingpkg.Equals(t, *largeRID, *largeTuple.GetRID())
+	stored := th.getStoredTuple(largeRID, txn)
+	testingpkg.Equals(t, sizeOverflowStub, stored.Size())
+
+	// iterator also returns data on overflow pages
+	tupleCnt := 0
+	it := th.Iterator(txn)
+	for tuple_ := it.Current(); !it.End(); tuple_ = it.Next() {
+		if tuple_.GetValue(schema_, 0).ToInteger() == 2 {
+			testingpkg.Equals(t, largeStr, tuple_.GetValue(schema_, 1).ToVarchar())
+		}
+		tupleCnt++
+	}
+	testingpkg.Equals(t, 2, tupleCnt)
+	txn_mgr.Commit(txn)
+
+	// overflow pages written by aborted txn are released
+	txn = txn_mgr.Begin(nil)
+	freeCnt := len(bpm.GetFreePageIds())
+	_, err = th.InsertTuple(tuple.NewTupleFromSchema([]types.Value{types.NewInteger(3), types.NewVarchar(largeStr2)}, schema_), txn)
+	testingpkg.Ok(t, err)
+	txn_mgr.Abort(txn)
+	testingpkg.Equals(t, freeCnt+overflowPageCnt(largeStr2), len(bpm.GetFreePageIds()))
+
+	// update of a column. old overflow pages are released at commit and released pages are reused
+	dbSize := dm.Size()
+	txn = txn_mgr.Begin(nil)
+	freeCnt = len(bpm.GetFreePageIds())
+	isUpdated, _ := th.UpdateTuple(tuple.NewTupleFromSchema([]types.Value{types.NewInteger(0), types.NewVarchar(largeStr2)}, schema_), []int{1}, schema_, *largeRID, txn)
+	testingpkg.Assert(t, isUpdated, "UpdateTuple failed")
+	txn_mgr.Commit(txn)
+	testingpkg.Equals(t, freeCnt-overflowPageCnt(largeStr2)+overflowPageCnt(largeStr), len(bpm.GetFreePageIds()))
+	testingpkg.Equals(t, dbSize, dm.Size())
+
+	txn = txn_mgr.Begin(nil)
+	largeTuple = th.GetTuple(largeRID, txn)
+	testingpkg.Equals(t, int32(2), largeTuple.GetValue(schema_, 0).ToInteger())
+	testingpkg.Equals(t, largeStr2, largeTuple.GetValue(schema_, 1).ToVarchar())
+	txn_mgr.Commit(txn)
+
+	// deletion
+	txn = txn_mgr.Begin(nil)
+	freeCnt = len(bpm.GetFreePageIds())
+	testingpkg.Assert(t, th.MarkDelete(largeRID, txn), "MarkDelete failed")
+	txn_mgr.Commit(txn)
+	testingpkg.Equals(t, freeCnt+overflowPageCnt(largeStr2), len(bpm.GetFreePageIds()))
+
+	txn = txn_mgr.Begin(nil)
+	testingpkg.Assert(t, th.GetTuple(largeRID, txn) == nil, "deleted tuple is returned")
+	smallTuple := th.GetTuple(smallRID, txn)
+	testingpkg.Equals(t, "small", smallTuple.GetValue(schema_, 1).ToVarchar())
+	txn_mgr.Commit(txn)
+
+	// overflow page which is pinned at commit is not leaked. it is released by ReleaseEmptyPages
+	txn = txn_mgr.Begin(nil)
+	largeRID, err = th.InsertTuple(tuple.NewTupleFromSchema([]types.Value{types.NewInteger(4), types.NewVarchar(largeStr2)}, schema_), txn)
+	testingpkg.Ok(t, err)
+	firstOverflowPageId, _, _ := parseOverflowStub(th.getStoredTuple(largeRID, txn))
+	txn_mgr.Commit(txn)
+	txn = txn_mgr.Begin(nil)
+	freeCnt = len(bpm.GetFreePageIds())
+	testingpkg.Assert(t, bpm.FetchPage(firstOverflowPageId) != nil, "")
+	testingpkg.Assert(t, th.MarkDelete(largeRID, txn), "MarkDelete failed")
+	txn_mgr.Commit(txn)
+	testingpkg.Assert(t, txn.GetFinishError() != nil, "failure of release is not recorded")
+	testingpkg.Equals(t, freeCnt+overflowPageCnt(largeStr2)-1, len(bpm.GetFreePageIds()))
+	bpm.UnpinPage(firstOverflowPageId, false)
+	txn_mgr.BlockAllTransactions()
+	_, err = th.ReleaseEmptyPages()
+	txn_mgr.ResumeTransactions()
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, freeCnt+overflowPageCnt(largeStr2), len(bpm.GetFreePageIds()))
+
+	common.TempSuppressOnMemStorage = false
+	common.TempSuppressOnMemStorageMutex.Unlock()
+}
+
+func TestCommitAndAbortWithUnfetchablePage(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+
+	poolSize := uint32(4)
+	dm := disk.NewDiskManagerTest()
+	defer dm.ShutDown()
+	log_manager := recovery.NewLogManager(&dm)
+	bpm := buffer.NewBufferPoolManager(poolSize, dm, log_manager)
+	lock_manager := NewLockManager(REGULAR, SS2PL_MODE)
+	txn_mgr := NewTransactionManager(lock_manager, log_manager)
+
+	txn := txn_mgr.Begin(nil)
+	th := NewTableHeap(bpm, log_manager, lock_manager, txn)
+	columnA := column.NewColumn("a", types.Integer, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	schema_ := schema.NewSchema([]*column.Column{columnA})
+	rid, err := th.InsertTuple(tuple.NewTupleFromSchema([]types.Value{types.NewInteger(1)}, schema_), txn)
+	testingpkg.Ok(t, err)
+	txn_mgr.Commit(txn)
+
+	// pins all frames so the table page is evicted and it can't be fetched again
+	pinAllFrames := func() []types.PageID {
+		pageIds := make([]types.PageID, 0)
+		for ii := uint32(0); ii < poolSize; ii++ {
+			pg := bpm.NewPage()
+			testingpkg.Assert(t, pg != nil, "NewPage failed")
+			pageIds = append(pageIds, pg.GetPageId())
+		}
+		return pageIds
+	}
+	unpinAll := func(pageIds []types.PageID) {
+		for _, pageId := range pageIds {
+			bpm.UnpinPage(pageId, false)
+		}
+	}
+
+	// Scenario: commit reports the error instead of panic and the tuple remains marked as deleted
+	txn = txn_mgr.Begin(nil)
+	testingpkg.Assert(t, th.MarkDelete(rid, txn), "MarkDelete failed")
+	pinned := pinAllFrames()
+	txn_mgr.Commit(txn)
+	testingpkg.Assert(t, errors.Is(txn.GetFinishError(), buffer.ErrBufferPoolExhausted), "failure of commit is not recorded")
+	unpinAll(pinned)
+
+	// Scenario: abort reports the error instead of panic
+	txn = txn_mgr.Begin(nil)
+	_, err = th.InsertTuple(tuple.NewTupleFromSchema([]types.Value{types.NewInteger(2)}, schema_), txn)
+	testingpkg.Ok(t, err)
+	pinned = pinAllFrames()
+	txn_mgr.Abort(txn)
+	testingpkg.Assert(t, errors.Is(txn.GetFinishError(), buffer.ErrBufferPoolExhausted), "failure of abort is not recorded")
+	unpinAll(pinned)
+
+	common.TempSuppressOnMemStorage = false
+	common.TempSuppressOnMemStorageMutex.Unlock()
+}
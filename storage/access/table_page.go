@@ -21,14 +21,14 @@ import (
 // static constexpr uint64_t DELETE_MASK = (1U << (8 * sizeof(uint32_t) - 1));
 const deleteMask = uint32(1 << ((8 * 4) - 1))
 
-const sizeTablePageHeader = uint32(24)
+const sizeTablePageHeader = uint32(page.SizePageHeader + 16)
 const sizeTuple = uint32(8)
-const offSetPrevPageId = uint32(8)
-const offSetNextPageId = uint32(12)
-const offsetFreeSpace = uint32(16)
-const offSetTupleCount = uint32(20)
-const offsetTupleOffset = uint32(24)
-const offsetTupleSize = uint32(28)
+const offSetPrevPageId = uint32(page.SizePageHeader)
+const offSetNextPageId = uint32(page.SizePageHeader + 4)
+const offsetFreeSpace = uint32(page.SizePageHeader + 8)
+const offSetTupleCount = uint32(page.SizePageHeader + 12)
+const offsetTupleOffset = uint32(page.SizePageHeader + 16)
+const offsetTupleSize = uint32(page.SizePageHeader + 20)
 
 const ErrEmptyTuple = errors.Error("tuple cannot be empty")
 const ErrNotEnoughSpace = errors.Error("there is not enough space")
@@ -42,9 +42,9 @@ const ErrNoFreeSlot = errors.Error("could not find a free slot")
 //	                              ^
 //	                              free space pointer
 //	Header format (size in bytes):
-//	----------------------------------------------------------------------------
-//	| PageId (4)| LSN (4)| PrevPageId (4)| NextPageId (4)| FreeSpacePointer(4) |
-//	----------------------------------------------------------------------------
+//	---------------------------------------------------------------------------------------------
+//	| PageId (4)| LSN (4)| Checksum (4)| PrevPageId (4)| NextPageId (4)| FreeSpacePointer(4) |
+//	---------------------------------------------------------------------------------------------
 //	----------------------------------------------------------------
 //	| TupleCount (4) | Tuple_1 offset (4) | Tuple_1 size (4) | ... |
 //	----------------------------------------------------------------
@@ -62,6 +62,19 @@ func CastPageAsTablePage(page *page.Page) *TablePage {
 	return (*TablePage)(unsafe.Pointer(page))
 }
 
+// appends log record of an operation by txn.
+// while txn is rolled back, the record is written as a CLR for not being undone again at recovery
+func appendLogRecord(log_manager *recovery.LogManager, txn *Transaction, log_record *recovery.LogRecord) types.LSN {
+	if txn.GetUndoNextLSN() != common.InvalidLSN {
+		log_record = recovery.NewLogRecordCLR(log_record, txn.GetUndoNextLSN())
+	}
+	// tuple data on log records is smaller than a page (larger one is stored on overflow pages)
+	// so the record always fits in log buffer
+	lsn, err := log_manager.AppendLogRecord(log_record)
+	common.SH_Assert(err == nil, "log record of txn can't be appended")
+	return lsn
+}
+
 // Inserts a tuple into the table
 func (tp *TablePage) InsertTuple(tuple *tuple.Tuple, log_manager *recovery.LogManager, lock_manager *LockManager, txn *Transaction) (*page.RID, error) {
 	if tuple.Size() == 0 {
@@ -115,7 +128,7 @@ func (tp *TablePage) InsertTuple(tuple *tuple.Tuple, log_manager *recovery.LogMa
 		//common.SH_Assert(!txn.IsSharedLocked(rid) && !txn.IsExclusiveLocked(rid), "A new tuple should not be locked.")
 		//common.SH_Assert(locked, "Locking a new tuple should always work.")
 		log_record := recovery.NewLogRecordInsertDelete(txn.GetTransactionId(), txn.GetPrevLSN(), recovery.INSERT, *rid, tuple)
-		lsn := log_manager.AppendLogRecord(log_record)
+		lsn := appendLogRecord(log_manager, txn, log_record)
 		tp.Page.SetLSN(lsn)
 		txn.SetPrevLSN(lsn)
 	}
@@ -160,18 +173,7 @@ func (tp *TablePage) UpdateTuple(new_tuple *tuple.Tuple, update_col_idxs []int,
 		update_tuple = new_tuple
 	} else {
 		// update specifed columns only case
-
-		var update_tuple_values []types.Value = make([]types.Value, 0)
-		matched_cnt := int(0)
-		for idx, _ := range schema_.GetColumns() {
-			if matched_cnt < len(update_col_idxs) && idx == update_col_idxs[matched_cnt] {
-				update_tuple_values = append(update_tuple_values, new_tuple.GetValue(schema_, uint32(idx)))
-				matched_cnt++
-			} else {
-				update_tuple_values = append(update_tuple_values, old_tuple.GetValue(schema_, uint32(idx)))
-			}
-		}
-		update_tuple = tuple.NewTupleFromSchema(update_tuple_values, schema_)
+		update_tuple = mergeUpdatedValues(new_tuple, old_tuple, update_col_idxs, schema_)
 	}
 
 	if tp.getFreeSpaceRemaining()+tuple_size < update_tuple.Size() {
@@ -194,7 +196,7 @@ func (tp *TablePage) UpdateTuple(new_tuple *tuple.Tuple, update_col_idxs []int,
 			return false, nil, nil
 		}
 		log_record := recovery.NewLogRecordUpdate(txn.GetTransactionId(), txn.GetPrevLSN(), recovery.UPDATE, *rid, *old_tuple, *update_tuple)
-		lsn := log_manager.AppendLogRecord(log_record)
+		lsn := appendLogRecord(log_manager, txn, log_record)
 		tp.SetLSN(lsn)
 		txn.SetPrevLSN(lsn)
 	}
@@ -219,6 +221,21 @@ func (tp *TablePage) UpdateTuple(new_tuple *tuple.Tuple, update_col_idxs []int,
 	return true, nil, nil
 }
 
+// returns tuple which has values of update_col_idxs columns of new_tuple and values of other columns of old_tuple
+func mergeUpdatedValues(new_tuple *tuple.Tuple, old_tuple *tuple.Tuple, update_col_idxs []int, schema_ *schema.Schema) *tuple.Tuple {
+	var update_tuple_values []types.Value = make([]types.Value, 0)
+	matched_cnt := int(0)
+	for idx, _ := range schema_.GetColumns() {
+		if matched_cnt < len(update_col_idxs) && idx == update_col_idxs[matched_cnt] {
+			update_tuple_values = append(update_tuple_values, new_tuple.GetValue(schema_, uint32(idx)))
+			matched_cnt++
+		} else {
+			update_tuple_values = append(update_tuple_values, old_tuple.GetValue(schema_, uint32(idx)))
+		}
+	}
+	return tuple.NewTupleFromSchema(update_tuple_values, schema_)
+}
+
 func (tp *TablePage) MarkDelete(rid *page.RID, txn *Transaction, lock_manager *LockManager, log_manager *recovery.LogManager) bool {
 	slot_num := rid.GetSlotNum()
 	// If the slot number is invalid, abort the transaction.
@@ -251,7 +268,7 @@ func (tp *TablePage) MarkDelete(rid *page.RID, txn *Transaction, lock_manager *L
 		}
 		dummy_tuple := new(tuple.Tuple)
 		log_record := recovery.NewLogRecordInsertDelete(txn.GetTransactionId(), txn.GetPrevLSN(), recovery.MARKDELETE, *rid, dummy_tuple)
-		lsn := log_manager.AppendLogRecord(log_record)
+		lsn := appendLogRecord(log_manager, txn, log_record)
 		tp.SetLSN(lsn)
 		txn.SetPrevLSN(lsn)
 	}
@@ -263,7 +280,8 @@ func (tp *TablePage) MarkDelete(rid *page.RID, txn *Transaction, lock_manager *L
 	return true
 }
 
-func (table_page *TablePage) ApplyDelete(rid *page.RID, txn *Transaction, log_manager *recovery.LogManager) {
+// returns data of the deleted tuple (it is a stub when data of the tuple is on overflow pages)
+func (table_page *TablePage) ApplyDelete(rid *page.RID, txn *Transaction, log_manager *recovery.LogManager) *tuple.Tuple {
 	slot_num := rid.GetSlotNum()
 	common.SH_Assert(slot_num < table_page.GetTupleCount(), "Cannot have more slots than tuples.")
 
@@ -287,7 +305,7 @@ func (table_page *TablePage) ApplyDelete(rid *page.RID, txn *Transaction, log_ma
 	if log_manager.IsEnabledLogging() {
 		common.SH_Assert(txn.IsExclusiveLocked(rid), "We must own the exclusive lock!")
 		log_record := recovery.NewLogRecordInsertDelete(txn.GetTransactionId(), txn.GetPrevLSN(), recovery.APPLYDELETE, *rid, delete_tuple)
-		lsn := log_manager.AppendLogRecord(log_record)
+		lsn := appendLogRecord(log_manager, txn, log_record)
 		table_page.SetLSN(lsn)
 		txn.SetPrevLSN(lsn)
 	}
@@ -311,6 +329,7 @@ func (table_page *TablePage) ApplyDelete(rid *page.RID, txn *Transaction, log_ma
 			table_page.SetTupleOffsetAtSlot(uint32(ii), tuple_offset_ii+tuple_size)
 		}
 	}
+	return delete_tuple
 }
 
 func (tp *TablePage) RollbackDelete(rid *page.RID, txn *Transaction, log_manager *recovery.LogManager) {
@@ -319,7 +338,7 @@ func (tp *TablePage) RollbackDelete(rid *page.RID, txn *Transaction, log_manager
 		common.SH_Assert(txn.IsExclusiveLocked(rid), "We must own an exclusive lock on the RID.")
 		dummy_tuple := new(tuple.Tuple)
 		log_record := recovery.NewLogRecordInsertDelete(txn.GetTransactionId(), txn.GetPrevLSN(), recovery.ROLLBACKDELETE, *rid, dummy_tuple)
-		lsn := log_manager.AppendLogRecord(log_record)
+		lsn := appendLogRecord(log_manager, txn, log_record)
 		tp.SetLSN(lsn)
 		txn.SetPrevLSN(lsn)
 	}
@@ -340,7 +359,7 @@ func (tp *TablePage) Init(pageId types.PageID, prevPageId types.PageID, log_mana
 	if log_manager.IsEnabledLogging() {
 		//txn_ := (*Transaction)(unsafe.Pointer(&txn))
 		log_record := recovery.NewLogRecordNewPage(txn.GetTransactionId(), txn.GetPrevLSN(), recovery.NEWPAGE, prevPageId)
-		lsn := log_manager.AppendLogRecord(log_record)
+		lsn := appendLogRecord(log_manager, txn, log_record)
 		tp.Page.SetLSN(lsn)
 		txn.SetPrevLSN(lsn)
 	}
@@ -348,7 +367,7 @@ func (tp *TablePage) Init(pageId types.PageID, prevPageId types.PageID, log_mana
 	tp.SetPrevPageId(prevPageId)
 	tp.SetNextPageId(types.InvalidPageID)
 	tp.SetTupleCount(0)
-	tp.SetFreeSpacePointer(common.PageSize) // point to the end of the page
+	tp.SetFreeSpacePointer(uint32(len(tp.Data()))) // point to the end of the page
 }
 
 func (tp *TablePage) SetPageId(pageId types.PageID) {
@@ -37,6 +37,8 @@ const (
 	INSERT WType = iota
 	DELETE
 	UPDATE
+	/** Writing an overflow page of a large tuple. rid has id of the page */
+	OVERFLOW
 )
 
 /**
@@ -49,14 +51,19 @@ type WriteRecord struct {
 	tuple *tuple.Tuple
 	/** The table heap specifies which table this write record is for. */
 	table *TableHeap
+	/** The LSN of the last record written by the transaction before the write. it is used as undoNextLSN of CLR */
+	prev_lsn types.LSN
+	/** The deleted tuple was moved to other location (see TableHeap::Compact). overflow pages of it are kept at commit */
+	isMoved bool
 }
 
-func NewWriteRecord(rid page.RID, wtype WType, tuple *tuple.Tuple, table *TableHeap) *WriteRecord {
+func NewWriteRecord(rid page.RID, wtype WType, tuple *tuple.Tuple, table *TableHeap, prev_lsn types.LSN) *WriteRecord {
 	ret := new(WriteRecord)
 	ret.rid = rid
 	ret.wtype = wtype
 	ret.tuple = tuple
 	ret.table = table
+	ret.prev_lsn = prev_lsn
 	return ret
 }
 
@@ -79,6 +86,13 @@ type Transaction struct {
 	/** The LSN of the last record written by the access. */
 	prev_lsn types.LSN
 
+	/** The LSN of the first record written by the access. */
+	first_lsn types.LSN
+
+	/** The LSN of the record to be undone next. this is valid only while the transaction is rolled back
+	 *  and log records written in the meantime are CLRs. */
+	undo_next_lsn types.LSN
+
 	// /** Concurrent index: the pages that were latched during index operation. */
 	// page_set deque<*Page>
 	// /** Concurrent index: the page IDs that were deleted during index operation.*/
@@ -88,6 +102,13 @@ type Transaction struct {
 	shared_lock_set []page.RID
 	// /** LockManager: the set of exclusive-locked tuples held by this access. */
 	exclusive_lock_set []page.RID
+
+	// error which caused abort of the transaction (ex: buffer.ErrBufferPoolExhausted).
+	// it is reported to the client
+	abort_reason error
+	// error which occured while the write set is applied at commit or undone at abort
+	// (ex: a page can't be fetched, overflow pages can't be released). it is reported to the client
+	finish_err error
 }
 
 func NewTransaction(txn_id types.TxnID) *Transaction {
@@ -97,10 +118,14 @@ func NewTransaction(txn_id types.TxnID) *Transaction {
 		txn_id,
 		make([]*WriteRecord, 0),
 		common.InvalidLSN,
+		common.InvalidLSN,
+		common.InvalidLSN,
 		// deque<*Page>,
 		// unordered_set<PageID>
 		make([]page.RID, 0),
 		make([]page.RID, 0),
+		nil,
+		nil,
 	}
 }
 
@@ -166,6 +191,22 @@ func (txn *Transaction) GetState() TransactionState { return txn.state }
  */
 func (txn *Transaction) SetState(state TransactionState) { txn.state = state }
 
+/** @return the error which caused abort of this transaction (nil when it is not known) */
+func (txn *Transaction) GetAbortReason() error { return txn.abort_reason }
+
+/** @param err the error which caused abort of this transaction */
+func (txn *Transaction) SetAbortReason(err error) { txn.abort_reason = err }
+
+// returns the first error which occured at commit or abort (nil when the write set is applied or undone completely).
+// commit or abort itself is not canceled by it
+func (txn *Transaction) GetFinishError() error { return txn.finish_err }
+
+func (txn *Transaction) recordFinishError(err error) {
+	if err != nil && txn.finish_err == nil {
+		txn.finish_err = err
+	}
+}
+
 /** @return the previous LSN */
 func (txn *Transaction) GetPrevLSN() types.LSN { return txn.prev_lsn }
 
@@ -173,4 +214,21 @@ func (txn *Transaction) GetPrevLSN() types.LSN { return txn.prev_lsn }
 * Set the previous LSN.
 * @param prev_lsn new previous lsn
  */
-func (txn *Transaction) SetPrevLSN(prev_lsn types.LSN) { txn.prev_lsn = prev_lsn }
+func (txn *Transaction) SetPrevLSN(prev_lsn types.LSN) {
+	if txn.first_lsn == common.InvalidLSN {
+		txn.first_lsn = prev_lsn
+	}
+	txn.prev_lsn = prev_lsn
+}
+
+/** @return the LSN of the first record written by the transaction */
+func (txn *Transaction) GetFirstLSN() types.LSN { return txn.first_lsn }
+
+/** @return the LSN of the record to be undone next (InvalidLSN when the transaction is not rolled back) */
+func (txn *Transaction) GetUndoNextLSN() types.LSN { return txn.undo_next_lsn }
+
+/**
+* Set the undoNextLSN. log records of the transaction are written as CLRs while valid LSN is set.
+* @param undo_next_lsn LSN of the record to be undone next
+ */
+func (txn *Transaction) SetUndoNextLSN(undo_next_lsn types.LSN) { txn.undo_next_lsn = undo_next_lsn }
@@ -1,7 +1,9 @@
 package access
 
 import (
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/ryogrid/SamehadaDB/common"
 	"github.com/ryogrid/SamehadaDB/recovery"
@@ -19,12 +21,19 @@ type TransactionManager struct {
 	/** The global transaction latch is used for checkpointing. */
 	global_txn_latch common.ReaderWriterLatch
 	mutex            *sync.Mutex
+	/** Transactions which are not finished. */
+	txn_map map[types.TxnID]*Transaction
+	stats   TxnStats
 }
 
-var txn_map map[types.TxnID]*Transaction = make(map[types.TxnID]*Transaction)
+// TxnStats is counters of TransactionManager (values are totals since the manager was created)
+type TxnStats struct {
+	Commits uint64
+	Aborts  uint64
+}
 
 func NewTransactionManager(lock_manager *LockManager, log_manager *recovery.LogManager) *TransactionManager {
-	return &TransactionManager{0, lock_manager, log_manager, common.NewRWLatch(), new(sync.Mutex)}
+	return &TransactionManager{0, lock_manager, log_manager, common.NewRWLatch(), new(sync.Mutex), make(map[types.TxnID]*Transaction), TxnStats{}}
 }
 
 func (transaction_manager *TransactionManager) Begin(txn *Transaction) *Transaction {
@@ -43,12 +52,12 @@ func (transaction_manager *TransactionManager) Begin(txn *Transaction) *Transact
 
 	if transaction_manager.log_manager.IsEnabledLogging() {
 		log_record := recovery.NewLogRecordTxn(txn_ret.GetTransactionId(), txn_ret.GetPrevLSN(), recovery.BEGIN)
-		lsn := transaction_manager.log_manager.AppendLogRecord(log_record)
+		lsn := appendLogRecord(transaction_manager.log_manager, txn_ret, log_record)
 		txn_ret.SetPrevLSN(lsn)
 	}
 
 	transaction_manager.mutex.Lock()
-	txn_map[txn_ret.GetTransactionId()] = txn_ret
+	transaction_manager.txn_map[txn_ret.GetTransactionId()] = txn_ret
 	transaction_manager.mutex.Unlock()
 	return txn_ret
 }
@@ -57,6 +66,9 @@ func (transaction_manager *TransactionManager) Commit(txn *Transaction) {
 	txn.SetState(COMMITTED)
 
 	// Perform all deletes before we commit.
+	// overflow pages of deleted tuples and old data of updated tuples are released after commit
+	// (key is the first overflow page. same pages can be referred from multiple items)
+	overflow_pages := make(map[types.PageID]*TableHeap)
 	write_set := txn.GetWriteSet()
 	for len(write_set) != 0 {
 		item := write_set[len(write_set)-1]
@@ -64,26 +76,57 @@ func (transaction_manager *TransactionManager) Commit(txn *Transaction) {
 		rid := item.rid
 		if item.wtype == DELETE {
 			// Note that this also releases the lock when holding the page latch.
-			pageID := rid.GetPageId()
-			tpage := CastPageAsTablePage(table.bpm.FetchPage(pageID))
-			tpage.WLatch()
-			tpage.ApplyDelete(&item.rid, txn, transaction_manager.log_manager)
-			tpage.WUnlatch()
+			// when the page can't be fetched, the tuple remains marked as deleted and it is reported
+			deleted_tuple, err := table.ApplyDelete(&rid, txn)
+			txn.recordFinishError(err)
+			if firstPageId, _, ok := parseOverflowStub(deleted_tuple); ok && !item.isMoved {
+				overflow_pages[firstPageId] = table
+			}
+		} else if item.wtype == UPDATE {
+			if firstPageId, _, ok := parseOverflowStub(item.tuple); ok {
+				overflow_pages[firstPageId] = table
+			}
 		}
 		write_set = write_set[:len(write_set)-1]
 	}
 	txn.SetWriteSet(write_set)
 
+	// pages on the overflow page chains are logged before the commit record, so they are released
+	// by recovery process when system crashes before they are released
+	var release_table *TableHeap = nil
+	release_page_ids := make([]types.PageID, 0)
+	release_chain_page_ids := make([]types.PageID, 0)
+	for firstPageId, table := range overflow_pages {
+		pageIds, unreadPageId, err := getOverflowPageIds(table.bpm, firstPageId)
+		// when a page can't be read, the rest of the chain is read again at the release
+		txn.recordFinishError(err)
+		release_page_ids = append(release_page_ids, pageIds...)
+		if unreadPageId.IsValid() {
+			release_chain_page_ids = append(release_chain_page_ids, unreadPageId)
+		}
+		release_table = table
+	}
+	if release_table != nil {
+		release_table.logOverflowRelease(release_page_ids, release_chain_page_ids, txn)
+	}
+
 	if transaction_manager.log_manager.IsEnabledLogging() {
-		log_record := recovery.NewLogRecordTxn(txn.GetTransactionId(), txn.GetPrevLSN(), recovery.COMMIT)
-		lsn := transaction_manager.log_manager.AppendLogRecord(log_record)
+		log_record := recovery.NewLogRecordCommit(txn.GetTransactionId(), txn.GetPrevLSN(), time.Now().UnixNano())
+		lsn := appendLogRecord(transaction_manager.log_manager, txn, log_record)
 		txn.SetPrevLSN(lsn)
-		transaction_manager.log_manager.Flush()
+		// wait until the commit record becomes durable (it may be written with ones of other transactions)
+		transaction_manager.log_manager.FlushUntil(lsn)
+	}
+
+	if release_table != nil {
+		txn.recordFinishError(release_table.releaseOverflowPages(release_page_ids, release_chain_page_ids))
 	}
 
 	// Release all the locks.
 	transaction_manager.mutex.Lock()
 	transaction_manager.releaseLocks(txn)
+	delete(transaction_manager.txn_map, txn.GetTransactionId())
+	transaction_manager.stats.Commits++
 	transaction_manager.mutex.Unlock()
 	// Release the global transaction latch.
 	transaction_manager.global_txn_latch.RUnlock()
@@ -93,41 +136,69 @@ func (transaction_manager *TransactionManager) Abort(txn *Transaction) {
 	txn.SetState(ABORTED)
 
 	// Rollback before releasing the access.
+	// operations for rollback are logged as CLRs which point the record to be undone next,
+	// so they are not undone again when system crashes before the rollback finishes
 	write_set := txn.GetWriteSet()
 	for len(write_set) != 0 {
 		item := write_set[len(write_set)-1]
 		table := item.table
+		if transaction_manager.log_manager.IsEnabledLogging() {
+			txn.SetUndoNextLSN(item.prev_lsn)
+		}
+		// when a page can't be fetched, rollback of the item is skipped and it is reported
 		if item.wtype == DELETE {
-			table.RollbackDelete(&item.rid, txn)
+			txn.recordFinishError(table.RollbackDelete(&item.rid, txn))
 		} else if item.wtype == INSERT {
-			rid := item.rid
 			// Note that this also releases the lock when holding the page latch.
-			pageID := rid.GetPageId()
-			tpage := CastPageAsTablePage(table.bpm.FetchPage(pageID))
-			tpage.WLatch()
-			tpage.ApplyDelete(&item.rid, txn, transaction_manager.log_manager)
-			tpage.WUnlatch()
+			_, err := table.ApplyDelete(&item.rid, txn)
+			txn.recordFinishError(err)
 		} else if item.wtype == UPDATE {
-			table.UpdateTuple(item.tuple, nil, nil, item.rid, txn)
+			if is_updated, _ := table.UpdateTuple(item.tuple, nil, nil, item.rid, txn); !is_updated {
+				txn.recordFinishError(fmt.Errorf("update of tuple (%d, %d) can't be rolled back", item.rid.GetPageId(), item.rid.GetSlotNum()))
+			}
+		} else if item.wtype == OVERFLOW {
+			table.rollbackOverflowPage(item.rid.GetPageId(), txn)
 		}
 		write_set = write_set[:len(write_set)-1]
 	}
 	txn.SetWriteSet(write_set)
+	txn.SetUndoNextLSN(common.InvalidLSN)
 
 	if transaction_manager.log_manager.IsEnabledLogging() {
 		log_record := recovery.NewLogRecordTxn(txn.GetTransactionId(), txn.GetPrevLSN(), recovery.ABORT)
-		lsn := transaction_manager.log_manager.AppendLogRecord(log_record)
+		lsn := appendLogRecord(transaction_manager.log_manager, txn, log_record)
 		txn.SetPrevLSN(lsn)
 	}
 
 	// Release all the locks.
 	transaction_manager.mutex.Lock()
 	transaction_manager.releaseLocks(txn)
+	delete(transaction_manager.txn_map, txn.GetTransactionId())
+	transaction_manager.stats.Aborts++
 	transaction_manager.mutex.Unlock()
 	// Release the global transaction latch.
 	transaction_manager.global_txn_latch.RUnlock()
 }
 
+// GetStats returns a snapshot of counters
+func (transaction_manager *TransactionManager) GetStats() TxnStats {
+	transaction_manager.mutex.Lock()
+	defer transaction_manager.mutex.Unlock()
+	return transaction_manager.stats
+}
+
+// returns transactions which are running now (used for checkpointing)
+func (transaction_manager *TransactionManager) GetActiveTransactions() []*Transaction {
+	transaction_manager.mutex.Lock()
+	defer transaction_manager.mutex.Unlock()
+
+	ret := make([]*Transaction, 0, len(transaction_manager.txn_map))
+	for _, txn := range transaction_manager.txn_map {
+		ret = append(ret, txn)
+	}
+	return ret
+}
+
 func (transaction_manager *TransactionManager) BlockAllTransactions() {
 	transaction_manager.global_txn_latch.WLock()
 }
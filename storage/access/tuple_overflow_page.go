@@ -0,0 +1,93 @@
+package access
+
+import (
+	"encoding/binary"
+	"unsafe"
+
+	"github.com/ryogrid/SamehadaDB/storage/page"
+	"github.com/ryogrid/SamehadaDB/storage/tuple"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+const offsetOverflowNextPageId = uint32(page.SizePageHeader)
+const offsetOverflowDataSize = uint32(page.SizePageHeader + 4)
+const sizeTupleOverflowPageHeader = uint32(page.SizePageHeader + 8)
+
+// stub tuple starts with this value. data of tuples made from schema never starts with it
+// (tuple starts with the header magic 0xFFFE. legacy tuple starts with a null flag byte or an offset
+// of varchar payload which is less than page size)
+const overflowStubMarker = uint32(0xFFFFFFFF)
+const sizeOverflowStub = uint32(12)
+
+/**
+ * TupleOverflowPage stores a part of data of a tuple which is too large to be stored in a table page.
+ * data of such a tuple is split into chained overflow pages and the table page has a stub tuple in place of it.
+ *
+ * Overflow page format (size in byte):
+ * ------------------------------------------------------------------------------------
+ * | PageId (4) | LSN (4) | Checksum (4) | NextPageId (4) | DataSize (4) | Data ... |
+ * ------------------------------------------------------------------------------------
+ *
+ * Stub tuple format (size in byte):
+ * ---------------------------------------------------------------
+ * | Marker (4) (0xFFFFFFFF) | FirstPageId (4) | TupleSize (4) |
+ * ---------------------------------------------------------------
+ */
+type TupleOverflowPage struct {
+	page.Page
+}
+
+// CastPageAsTupleOverflowPage casts the abstract Page struct into TupleOverflowPage
+func CastPageAsTupleOverflowPage(page *page.Page) *TupleOverflowPage {
+	if page == nil {
+		return nil
+	}
+
+	return (*TupleOverflowPage)(unsafe.Pointer(page))
+}
+
+// Init sets up the page with a part of tuple data. data must fit in the page (see overflowDataSizePerPage)
+func (op *TupleOverflowPage) Init(pageId types.PageID, nextPageId types.PageID, data []byte) {
+	op.Copy(0, pageId.Serialize())
+	op.Copy(offsetOverflowNextPageId, nextPageId.Serialize())
+	op.Copy(offsetOverflowDataSize, types.UInt32(len(data)).Serialize())
+	op.Copy(sizeTupleOverflowPageHeader, data)
+}
+
+func (op *TupleOverflowPage) GetNextPageId() types.PageID {
+	return types.NewPageIDFromBytes(op.Data()[offsetOverflowNextPageId:])
+}
+
+// GetTupleData returns a copy of the part of tuple data on the page
+func (op *TupleOverflowPage) GetTupleData() []byte {
+	size := uint32(types.NewUInt32FromBytes(op.Data()[offsetOverflowDataSize:]))
+	ret := make([]byte, size)
+	copy(ret, op.Data()[sizeTupleOverflowPageHeader:sizeTupleOverflowPageHeader+size])
+	return ret
+}
+
+// size of tuple data which a overflow page of the page size can have
+func overflowDataSizePerPage(pageSize int) uint32 {
+	return uint32(pageSize) - sizeTupleOverflowPageHeader
+}
+
+// tuple larger than this can't be stored in an empty table page. data of it is stored on overflow pages
+func maxInlineTupleSize(pageSize int) uint32 {
+	return uint32(pageSize) - sizeTablePageHeader - sizeTuple
+}
+
+func newOverflowStub(firstPageId types.PageID, tupleSize uint32) *tuple.Tuple {
+	data := make([]byte, sizeOverflowStub)
+	binary.LittleEndian.PutUint32(data, overflowStubMarker)
+	binary.LittleEndian.PutUint32(data[4:], uint32(firstPageId))
+	binary.LittleEndian.PutUint32(data[8:], tupleSize)
+	return tuple.NewTuple(nil, sizeOverflowStub, data)
+}
+
+// returns location of data of the tuple when tuple_ is a stub. ok is false when it is a usual tuple
+func parseOverflowStub(tuple_ *tuple.Tuple) (firstPageId types.PageID, tupleSize uint32, ok bool) {
+	if tuple_ == nil || tuple_.Size() != sizeOverflowStub || binary.LittleEndian.Uint32(tuple_.Data()) != overflowStubMarker {
+		return types.InvalidPageID, 0, false
+	}
+	return types.PageID(binary.LittleEndian.Uint32(tuple_.Data()[4:])), binary.LittleEndian.Uint32(tuple_.Data()[8:]), true
+}
@@ -4,105 +4,284 @@
 package buffer
 
 import (
-	"errors"
 	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/errors"
 	"github.com/ryogrid/SamehadaDB/recovery"
 	"github.com/ryogrid/SamehadaDB/storage/disk"
 	"github.com/ryogrid/SamehadaDB/storage/page"
 	"github.com/ryogrid/SamehadaDB/types"
 )
 
+// FetchPage and NewPage return nil when all frames which can be used for the page are pinned.
+// callers report it with this error
+const ErrBufferPoolExhausted = errors.Error("buffer pool is exhausted (all frames are pinned)")
+
+// a pool is partitioned only when each shard can have this number of frames at least.
+// small pool is not partitioned because pages pinned at same time may be concentrated on one shard
+const MinFramesPerShard = 64
+
+// upper limit of the number of shards of the default configuration
+const MaxNumShards = 16
+
 // BufferPoolManager represents the buffer pool manager
 type BufferPoolManager struct {
 	diskManager disk.DiskManager
-	pages       []*page.Page // index is FrameID
-	replacer    *ClockReplacer
-	freeList    []FrameID
-	pageTable   map[types.PageID]FrameID
+	// page is always cached on the shard decided by its PageID (see shardOf)
+	shards      []*bufferPoolShard
 	log_manager *recovery.LogManager
-	mutex       *sync.Mutex //*sync.RWMutex
+	// serializes allocation and deallocation of pages (it is acquired before latch of a shard)
+	mutex *sync.Mutex
+	// FetchPage and NewPage wait for a frame to be unpinned until this time passes (0 means no wait)
+	frameWaitTimeout time.Duration
+	// debug mode: stack trace of the last pinner of each page is recorded for reporting pin leaks
+	isPinTracking bool
+	// page size of the db (see DiskManager::GetPageSize)
+	pageSize int
+	// read-aheads which are running (see WaitForPrefetches)
+	prefetchWG *sync.WaitGroup
+	// held in shared mode during structure modifications whose pages are written in
+	// specific order (see BeginStructureModification) and in exclusive mode by FlushAllDirtyPagesConcurrently
+	smoLatch *sync.RWMutex
+	// held in shared mode while a page is written to disk and in exclusive mode by ReadPageFromDisk
+	diskWriteLatch *sync.RWMutex
+	// pages whose release is logged but which are not released yet (see AddPendingReleases).
+	// value is true when the page is first page of a page chain whose pages are unknown. guarded by mutex
+	pendingReleases map[types.PageID]bool
+}
+
+// PoolExhaustedError is returned by FetchPageWithErr instead of ErrBufferPoolExhausted when pin tracking
+// is enabled (see SetPinTracking). it has pages which were pinned when the pool was exhausted.
+// errors.Is(err, ErrBufferPoolExhausted) is true for it
+type PoolExhaustedError struct {
+	PinnedPages []*PinLeak
+}
+
+func (e *PoolExhaustedError) Error() string {
+	pageIds := make([]string, 0, len(e.PinnedPages))
+	for _, leak := range e.PinnedPages {
+		pageIds = append(pageIds, fmt.Sprintf("%d(%d)", leak.PageID, leak.PinCount))
+	}
+	return fmt.Sprintf("%s. pinned pages (pin count): %s", ErrBufferPoolExhausted.Error(), strings.Join(pageIds, ", "))
+}
+
+func (e *PoolExhaustedError) Is(target error) bool {
+	return target == ErrBufferPoolExhausted
+}
+
+// PinLeak is a page which is still pinned and the stack trace of the goroutine which pinned it last
+type PinLeak struct {
+	PageID          types.PageID
+	PinCount        int32
+	LastPinnerStack string
+}
+
+// bufferPoolShard is a partition of the buffer pool which has its own latch, page table and replacer.
+// disk I/O is not done with the latch held
+type bufferPoolShard struct {
+	pages     []*page.Page // index is FrameID (local to the shard)
+	replacer  Replacer
+	freeList  []FrameID
+	pageTable map[types.PageID]FrameID
+	// pages which are being read from disk or written back to disk at eviction.
+	// the channel is closed when the I/O finishes
+	inflight map[types.PageID]chan struct{}
+	// evicted dirty pages whose write back is not finished yet (they are in dirty page table)
+	evicting map[types.PageID]*page.Page
+	mutex    *sync.Mutex
+	stats    BufferPoolStats
+	// closed and replaced when a frame gets available while there are waiters (see waitFrame)
+	frameFreed chan struct{}
+	waiterNum  int
+	// stack traces of the last pinners (used only when pin tracking is enabled)
+	lastPinners map[types.PageID]string
+}
+
+// BufferPoolStats is counters of BufferPoolManager (values are totals since the pool was created)
+type BufferPoolStats struct {
+	// FetchPage calls which found the page on the pool
+	Hits uint64
+	// FetchPage calls which read the page from disk
+	Misses uint64
+	// pages cached out to reuse their frames
+	Evictions uint64
+	// writes of dirty pages to disk (at eviction and flush)
+	DirtyFlushes uint64
+}
+
+func (b *BufferPoolManager) shardOf(pageID types.PageID) *bufferPoolShard {
+	return b.shards[uint32(pageID)%uint32(len(b.shards))]
 }
 
 // FetchPage fetches the requested page from the buffer pool.
+// nil is returned when all frames are pinned (see ErrBufferPoolExhausted and SetFrameWaitTimeout)
+// or the page could not be read from disk. use FetchPageWithErr for knowing the reason
 func (b *BufferPoolManager) FetchPage(pageID types.PageID) *page.Page {
-	// if it is on buffer pool return it
-	//b.mutex.WLock()
-	b.mutex.Lock()
-	if frameID, ok := b.pageTable[pageID]; ok {
-		pg := b.pages[frameID]
-		pg.IncPinCount()
-		(*b.replacer).Pin(frameID)
-		b.mutex.Unlock()
-		if common.EnableDebug {
-			common.ShPrintf(common.DEBUG_INFO, "FetchPage: PageId=%d PinCount=%d\n", pg.GetPageId(), pg.PinCount())
-		}
-		return pg
-	}
+	pg, _ := b.FetchPageWithErr(pageID)
+	return pg
+}
 
-	//b.mutex.WUnlock()
-	// get the id from free list or from replacer
-	frameID, isFromFreeList := b.getFrameID()
-	//b.mutex.WLock()
-	if frameID == nil {
-		b.mutex.Unlock()
-		return nil
-	}
+// FetchPageWithErr is same as FetchPage but returns the reason of failure.
+// it is ErrBufferPoolExhausted (*PoolExhaustedError when pin tracking is enabled)
+// or the error returned by DiskManager::ReadPage (ex: *disk.PageCorruptionError)
+func (b *BufferPoolManager) FetchPageWithErr(pageID types.PageID) (*page.Page, error) {
+	shard := b.shardOf(pageID)
+	deadline := time.Now().Add(b.frameWaitTimeout)
+	shard.mutex.Lock()
+	var frameID *FrameID
+	var victim *page.Page
+	done := make(chan struct{})
+	for {
+		shard.waitInflight(pageID)
 
-	if !isFromFreeList {
-		// remove page from current frame
-		//b.mutex.WLock()
-		currentPage := b.pages[*frameID]
-		//b.mutex.WUnlock()
-		if currentPage != nil {
-			if currentPage.IsDirty() {
-				b.log_manager.Flush()
-				currentPage.WLatch()
-				data := *currentPage.Data()
-				b.diskManager.WritePage(currentPage.ID(), data[:])
-				currentPage.WUnlatch()
-			}
-			//b.mutex.WLock()
+		// if it is on buffer pool return it
+		if frameID, ok := shard.pageTable[pageID]; ok {
+			atomic.AddUint64(&shard.stats.Hits, 1)
+			pg := shard.pages[frameID]
+			pg.IncPinCount()
+			shard.replacer.Pin(frameID)
+			b.setRecLSNIfClean(pg)
+			b.recordPinner(shard, pageID)
+			shard.mutex.Unlock()
 			if common.EnableDebug {
-				common.ShPrintf(common.DEBUG_INFO, "FetchPage: page=%d is removed from pageTable.\n", currentPage.ID())
+				common.ShPrintf(common.DEBUG_INFO, "FetchPage: PageId=%d PinCount=%d\n", pg.GetPageId(), pg.PinCount())
 			}
-			delete(b.pageTable, currentPage.ID())
-			//b.mutex.WUnlock()
+			return pg, nil
 		}
-		//b.mutex.WUnlock()
-	}
-
-	//b.mutex.WLock()
-	data := make([]byte, common.PageSize)
-	err := b.diskManager.ReadPage(pageID, data)
-	if err != nil {
-		fmt.Println(err)
-		panic("ReadPage returned error!")
-		//return nil
-	}
-	var pageData [common.PageSize]byte
-	copy(pageData[:], data)
-	pg := page.New(pageID, false, &pageData)
-	b.pageTable[pageID] = *frameID
-	b.pages[*frameID] = pg
-	b.mutex.Unlock()
+
+		frameID, victim = shard.reserveFrame(pageID, done)
+		if frameID != nil {
+			break
+		}
+		// page may be cached by other thread during waiting. so page table is checked again
+		if !shard.waitFrame(deadline) {
+			shard.mutex.Unlock()
+			return nil, b.exhaustionError()
+		}
+	}
+	atomic.AddUint64(&shard.stats.Misses, 1)
+	shard.mutex.Unlock()
+
+	b.writeBackVictim(shard, victim)
+	data := make([]byte, b.pageSize)
+	if err := b.diskManager.ReadPage(pageID, data); err != nil {
+		shard.mutex.Lock()
+		shard.releaseReservedFrame(*frameID, pageID, victim)
+		shard.mutex.Unlock()
+		close(done)
+		return nil, err
+	}
+	pg := page.New(pageID, false, data)
+
+	shard.mutex.Lock()
+	b.setRecLSNIfClean(pg)
+	shard.installPage(*frameID, pg, victim)
+	b.recordPinner(shard, pageID)
+	shard.mutex.Unlock()
+	close(done)
 
 	if common.EnableDebug {
 		common.ShPrintf(common.DEBUG_INFO, "FetchPage: PageId=%d PinCount=%d\n", pg.GetPageId(), pg.PinCount())
 	}
-	return pg
+	return pg, nil
+}
+
+// PrefetchResult is sent when read-ahead requested with PrefetchPages finishes
+type PrefetchResult struct {
+	// the number of pages read from disk
+	ReadNum int
+	// the page which follows the last page read. InvalidPageID when the chain ended or read-ahead
+	// stopped at a page which is on the pool already or because no frame is available
+	NextPageId types.PageID
+}
+
+// PrefetchPages reads up to num pages along a page chain from startPageID asynchronously.
+// getNextPageId returns id of the next page of the chain from page data.
+// pages are not pinned and loading them is not counted as accesses by replacer (and Hits/Misses of stats).
+// the returned channel receives the result when read-ahead finishes
+func (b *BufferPoolManager) PrefetchPages(startPageID types.PageID, num int, getNextPageId func(*page.Page) types.PageID) <-chan PrefetchResult {
+	ret := make(chan PrefetchResult, 1)
+	b.prefetchWG.Add(1)
+	go func() {
+		defer b.prefetchWG.Done()
+		readNum := 0
+		pageID := startPageID
+		for ; readNum < num && pageID.IsValid(); readNum++ {
+			nextPageID, ok := b.prefetchPage(pageID, getNextPageId)
+			if !ok {
+				pageID = types.InvalidPageID
+				break
+			}
+			pageID = nextPageID
+		}
+		ret <- PrefetchResult{readNum, pageID}
+	}()
+	return ret
+}
+
+// WaitForPrefetches waits until all running read-aheads finish.
+// this must be called before DiskManager is shut down because read-ahead may outlive the scan which requested it
+func (b *BufferPoolManager) WaitForPrefetches() {
+	b.prefetchWG.Wait()
+}
+
+// prefetchPage reads a page to the pool without pinning it and returns id of the next page of the chain.
+// false is returned when the page is on the pool (or being read by other thread), no frame is available
+// or the page could not be read
+func (b *BufferPoolManager) prefetchPage(pageID types.PageID, getNextPageId func(*page.Page) types.PageID) (types.PageID, bool) {
+	shard := b.shardOf(pageID)
+	shard.mutex.Lock()
+	if _, ok := shard.pageTable[pageID]; ok {
+		shard.mutex.Unlock()
+		return types.InvalidPageID, false
+	}
+	if _, ok := shard.inflight[pageID]; ok {
+		shard.mutex.Unlock()
+		return types.InvalidPageID, false
+	}
+	done := make(chan struct{})
+	// read-ahead does not wait for frames
+	frameID, victim := shard.reserveFrame(pageID, done)
+	shard.mutex.Unlock()
+	if frameID == nil {
+		return types.InvalidPageID, false
+	}
+
+	b.writeBackVictim(shard, victim)
+	data := make([]byte, b.pageSize)
+	if err := b.diskManager.ReadPage(pageID, data); err != nil {
+		// read-ahead stops here. the error is reported when the page is fetched
+		shard.mutex.Lock()
+		shard.releaseReservedFrame(*frameID, pageID, victim)
+		shard.mutex.Unlock()
+		close(done)
+		return types.InvalidPageID, false
+	}
+	pg := page.New(pageID, false, data)
+	// the page is read before other threads can access it
+	nextPageID := getNextPageId(pg)
+
+	shard.mutex.Lock()
+	b.setRecLSNIfClean(pg)
+	shard.installPrefetchedPage(*frameID, pg, victim)
+	shard.mutex.Unlock()
+	close(done)
+	return nextPageID, true
 }
 
 // UnpinPage unpins the target page from the buffer pool.
 func (b *BufferPoolManager) UnpinPage(pageID types.PageID, isDirty bool) error {
-
-	b.mutex.Lock()
-	//b.mutex.RLock()
-	if frameID, ok := b.pageTable[pageID]; ok {
-		pg := b.pages[frameID]
-		//b.mutex.RUnlock()
+	shard := b.shardOf(pageID)
+	shard.mutex.Lock()
+	if frameID, ok := shard.pageTable[pageID]; ok {
+		pg := shard.pages[frameID]
 		pg.DecPinCount()
 
 		if pg.PinCount() < 0 {
@@ -110,105 +289,151 @@ func (b *BufferPoolManager) UnpinPage(pageID types.PageID, isDirty bool) error {
 		}
 
 		if pg.PinCount() <= 0 {
-			(*b.replacer).Unpin(frameID)
+			shard.replacer.Unpin(frameID)
+			shard.notifyFrameFreed()
 		}
 
 		if pg.IsDirty() || isDirty {
 			pg.SetIsDirty(true)
 		} else {
 			pg.SetIsDirty(false)
+			if pg.PinCount() <= 0 {
+				pg.SetRecLSN(common.InvalidLSN)
+			}
 		}
-		b.mutex.Unlock()
+		shard.mutex.Unlock()
 
 		if common.EnableDebug {
 			common.ShPrintf(common.DEBUG_INFO, "UnpinPage: PageId=%d PinCount=%d\n", pg.GetPageId(), pg.PinCount())
 		}
 		return nil
 	}
-	b.mutex.Unlock()
-	//b.mutex.RUnlock()
+	shard.mutex.Unlock()
 
 	if common.EnableDebug {
 		common.ShPrintf(common.DEBUG_INFO, "UnpinPage: could not find page! PageId=%d\n", pageID)
 		panic("could not find page")
 	}
-	return errors.New("could not find page")
+	return errors.Error("could not find page")
 
 }
 
 // Decrement pincount of passed page (this can be used only when a thread has pin of page more than 1
-// this get lock of BufferPoolManager
+// this get lock of the shard which has the page
 func (b *BufferPoolManager) IncPinOfPage(page_ page.PageIF) {
-	b.mutex.Lock()
+	shard := b.shardOf(page_.GetPageId())
+	shard.mutex.Lock()
 	page_.IncPinCount()
-	b.mutex.Unlock()
+	b.recordPinner(shard, page_.GetPageId())
+	shard.mutex.Unlock()
 }
 
 // Decrement pin count of passed page (this can be used only when a thread has pin of page more than 1
-// this get lock of BufferPoolManager but overhead is smaller than UnpinPage
+// this get lock of the shard which has the page but overhead is smaller than UnpinPage
 func (b *BufferPoolManager) DecPinOfPage(page_ page.PageIF) {
-	b.mutex.Lock()
+	shard := b.shardOf(page_.GetPageId())
+	shard.mutex.Lock()
 	page_.DecPinCount()
-	b.mutex.Unlock()
+	shard.mutex.Unlock()
 }
 
 // FlushPage Flushes the target page to disk.
 func (b *BufferPoolManager) FlushPage(pageID types.PageID) bool {
-	b.mutex.Lock()
-	if frameID, ok := b.pageTable[pageID]; ok {
-		pg := b.pages[frameID]
-		b.mutex.Unlock()
+	shard := b.shardOf(pageID)
+	shard.mutex.Lock()
+	if frameID, ok := shard.pageTable[pageID]; ok {
+		pg := shard.pages[frameID]
+		shard.mutex.Unlock()
 		pg.WLatch()
 		pg.DecPinCount()
 
 		data := pg.Data()
+		if pg.IsDirty() {
+			atomic.AddUint64(&shard.stats.DirtyFlushes, 1)
+		}
 		pg.SetIsDirty(false)
 
-		//b.mutex.WLock()
-		b.diskManager.WritePage(pageID, data[:])
+		b.flushLogForPage(pg)
+		b.writePage(pageID, pg.GetLSN(), data[:])
+		// caller may modify the page after this without fetching it again (and pin count may be 0 here).
+		// so recLSN is not cleared but set to the LSN from which the page can be dirty again
+		if b.log_manager != nil {
+			pg.SetRecLSN(b.log_manager.GetNextLSN())
+		} else {
+			pg.SetRecLSN(common.InvalidLSN)
+		}
 		pg.WUnlatch()
-		//b.mutex.WUnlock()
 		return true
 	}
-	b.mutex.Unlock()
+	shard.mutex.Unlock()
 	return false
 }
 
 // NewPage allocates a new page in the buffer pool with the disk manager help
+// nil is returned when all frames are pinned (see ErrBufferPoolExhausted and SetFrameWaitTimeout)
 func (b *BufferPoolManager) NewPage() *page.Page {
+	deadline := time.Now().Add(b.frameWaitTimeout)
+	var pageID types.PageID
+	var shard *bufferPoolShard
+	var frameID *FrameID
+	var victim *page.Page
+	var isReuse bool
+	done := make(chan struct{})
+	for {
+		b.mutex.Lock()
+		// allocates new page
+		isReuse = b.diskManager.GetNumFreePages() > 0
+		pageID = b.diskManager.AllocatePage()
 
-	b.mutex.Lock()
-	frameID, isFromFreeList := b.getFrameID()
-	if frameID == nil {
+		shard = b.shardOf(pageID)
+		shard.mutex.Lock()
+		// reused page may be being written back yet (it was evicted before deallocation)
+		shard.waitInflight(pageID)
+		frameID, victim = shard.reserveFrame(pageID, done)
+		if frameID != nil {
+			shard.mutex.Unlock()
+			break
+		}
+		// the shard is full, it can't find a frame
+		b.diskManager.CancelAllocatePage(pageID, isReuse)
 		b.mutex.Unlock()
-		return nil // the buffer is full, it can't find a frame
+		// page id to be allocated next may belong to other shard but the same one is waited.
+		// it is rare because page ids are distributed over shards evenly
+		isFreed := shard.waitFrame(deadline)
+		shard.mutex.Unlock()
+		if !isFreed {
+			b.reportExhaustion()
+			return nil
+		}
 	}
 
-	if !isFromFreeList {
-		// remove page from current frame
-		currentPage := b.pages[*frameID]
-		if currentPage != nil {
-			if currentPage.IsDirty() {
-				b.log_manager.Flush()
-				data := currentPage.Data()
-				b.diskManager.WritePage(currentPage.ID(), data[:])
-			}
-
-			if common.EnableDebug {
-				common.ShPrintf(common.DEBUG_INFO, "NewPage: page=%d is removed from pageTable.\n", currentPage.ID())
-			}
-			delete(b.pageTable, currentPage.ID())
-		}
+	reuseLSN := types.LSN(common.InvalidLSN)
+	if isReuse && b.log_manager != nil && b.log_manager.IsEnabledLogging() {
+		var err error
+		reuseLSN, err = b.log_manager.AppendLogRecord(recovery.NewLogRecordPageDeallocation(recovery.REUSEPAGE, pageID))
+		common.SH_Assert(err == nil, "log record of page reuse can't be appended")
 	}
+	b.mutex.Unlock()
 
-	// allocates new page
-	pageID := b.diskManager.AllocatePage()
-	pg := page.NewEmpty(pageID)
+	b.writeBackVictim(shard, victim)
+	pg := page.NewEmptyWithSize(pageID, b.pageSize)
+	if isReuse {
+		// old data of reused page on disk must not be read even if the page is not modified
+		pg.SetIsDirty(true)
+	}
 
-	b.pageTable[pageID] = *frameID
-	b.pages[*frameID] = pg
+	shard.mutex.Lock()
+	b.setRecLSNIfClean(pg)
+	shard.installPage(*frameID, pg, victim)
+	b.recordPinner(shard, pageID)
+	shard.mutex.Unlock()
+	close(done)
 
-	b.mutex.Unlock()
+	if reuseLSN != common.InvalidLSN {
+		// if the page is written to disk before the REUSEPAGE record is durable,
+		// it is treated as free page after crash and data on it is overwritten
+		b.log_manager.FlushUntil(reuseLSN)
+	}
 
 	if common.EnableDebug {
 		common.ShPrintf(common.DEBUG_INFO, "NewPage: returned pageID: %d\n", pageID)
@@ -217,62 +442,165 @@ func (b *BufferPoolManager) NewPage() *page.Page {
 	return pg
 }
 
-// DeletePage make disk space of db file which is idenfied by pageID
+// DeletePage make disk space of db file which is idenfied by pageID reusable
+// 1.   Search the page table for the requested page (P).
+// 2.   If P exists, but has a non-zero pin-count, return error. Someone is using the page.
+// 3.   Otherwise, P can be deleted. Remove P from the page table and return its frame to the free list.
+// 4.   Add P to free page list of DiskManager. deallocation is logged and P is reused by NewPage
 func (b *BufferPoolManager) DeletePage(pageID types.PageID) error {
-	// 0.   Make sure you call DiskManager::DeallocatePage!
-	// 1.   Search the page table for the requested page (P).
-	// 1.   If P does not exist, return true.
-	// 2.   If P exists, but has a non-zero pin-count, return false. Someone is using the page.
-	// 3.   Otherwise, P can be deleted. Remove P from the page table, reset its metadata and return it to the free list.
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
 
-	//// operations even if the page is not on memory ////
+	shard := b.shardOf(pageID)
+	shard.mutex.Lock()
+	if frameID, ok := shard.pageTable[pageID]; ok {
+		page := shard.pages[frameID]
+		page.WLatch()
+		if page.PinCount() > 0 {
+			page.WUnlatch()
+			shard.mutex.Unlock()
+			return errors.Error("Pin count greater than 0")
+		}
+		// data of the page is not needed anymore. so it is not written even if it is dirty
+		delete(shard.pageTable, pageID)
+		shard.replacer.Remove(frameID)
+		shard.freeList = append(shard.freeList, frameID)
+		delete(shard.lastPinners, pageID)
+		shard.notifyFrameFreed()
+		page.WUnlatch()
+	}
+	shard.mutex.Unlock()
 
-	// do something if needed
+	// log record is appended with b.mutex held for keeping order of log records and
+	// changes to free page list same (see GetFreePageIds)
+	if b.log_manager != nil && b.log_manager.IsEnabledLogging() {
+		_, err := b.log_manager.AppendLogRecord(recovery.NewLogRecordPageDeallocation(recovery.DEALLOCATEPAGE, pageID))
+		common.SH_Assert(err == nil, "log record of page deallocation can't be appended")
+	}
 	b.diskManager.DeallocatePage(pageID)
-	// TODO: (SDB) implement reusable page list and add pageId to it (BufferPoolManager::DeletePage)
+	delete(b.pendingReleases, pageID)
 
-	////////////////////////////////////////////////////////
+	return nil
+}
 
-	var frameID FrameID
-	var ok bool
+// AddPendingReleases registers pages which should be released and first pages of page chains whose pages
+// should be released. the caller must log them beforehand (see recovery.NewLogRecordsReleasePages).
+// they are released with DeletePage later and ones which are not released yet are logged again
+// at checkpointing (see LogPendingReleases), so they are released by recovery process after crash
+func (b *BufferPoolManager) AddPendingReleases(pageIds []types.PageID, chainPageIds []types.PageID) {
 	b.mutex.Lock()
-	if frameID, ok = b.pageTable[pageID]; !ok {
-		b.mutex.Unlock()
-		//panic("delete target page not found on pageTable")
-		return nil
+	defer b.mutex.Unlock()
+	for _, pageId := range pageIds {
+		b.pendingReleases[pageId] = false
 	}
-
-	page := b.pages[frameID]
-	page.WLatch()
-	if page.PinCount() > 0 {
-		page.WUnlatch()
-		b.mutex.Unlock()
-		return nil
-		//panic("Pin count greater than 0")
-		//return errors.New("Pin count greater than 0")
+	for _, pageId := range chainPageIds {
+		b.pendingReleases[pageId] = true
 	}
+}
+
+// GetPendingReleases returns pages and page chains which are registered with AddPendingReleases and not released yet
+func (b *BufferPoolManager) GetPendingReleases() (pageIds []types.PageID, chainPageIds []types.PageID) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.getPendingReleases()
+}
 
-	// when the page is on memory
-	if page.GetPageId() == pageID {
-		delete(b.pageTable, pageID)
-		(*b.replacer).Pin(frameID)
-		b.freeList = append(b.freeList, frameID)
+// b.mutex must be held
+func (b *BufferPoolManager) getPendingReleases() (pageIds []types.PageID, chainPageIds []types.PageID) {
+	pageIds = make([]types.PageID, 0)
+	chainPageIds = make([]types.PageID, 0)
+	for pageId, isChain := range b.pendingReleases {
+		if isChain {
+			chainPageIds = append(chainPageIds, pageId)
+		} else {
+			pageIds = append(pageIds, pageId)
+		}
 	}
+	return pageIds, chainPageIds
+}
 
-	page.WUnlatch()
-	b.mutex.Unlock()
+// ResolvePendingChain replaces a registered page chain with pages on it. pageIds are pages which were read
+// from the chain and unreadPageId is the page where reading stopped (InvalidPageID when all pages were read).
+// the rest of the chain from unreadPageId is registered as a page chain. the replacement is logged
+func (b *BufferPoolManager) ResolvePendingChain(chainPageId types.PageID, pageIds []types.PageID, unreadPageId types.PageID) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	chainPageIds := make([]types.PageID, 0)
+	if unreadPageId.IsValid() {
+		chainPageIds = append(chainPageIds, unreadPageId)
+	}
+	// log records are appended with b.mutex held for keeping order of them and the ones of LogPendingReleases
+	if b.log_manager != nil && b.log_manager.IsEnabledLogging() {
+		for _, log_record := range recovery.NewLogRecordsReleasePages(common.InvalidTxnID, pageIds, chainPageIds, b.log_manager.GetMaxLogRecordSize()) {
+			if _, err := b.log_manager.AppendLogRecord(log_record); err != nil {
+				return err
+			}
+		}
+	}
+	delete(b.pendingReleases, chainPageId)
+	for _, pageId := range pageIds {
+		b.pendingReleases[pageId] = false
+	}
+	for _, pageId := range chainPageIds {
+		b.pendingReleases[pageId] = true
+	}
+	return nil
+}
 
+// LogPendingReleases logs pages and page chains which are not released yet again.
+// it is called at checkpointing because log records before the checkpoint may not be read at recovery
+func (b *BufferPoolManager) LogPendingReleases() error {
+	if b.log_manager == nil || !b.log_manager.IsEnabledLogging() {
+		return nil
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if len(b.pendingReleases) == 0 {
+		return nil
+	}
+	pageIds, chainPageIds := b.getPendingReleases()
+	for _, log_record := range recovery.NewLogRecordsReleasePages(common.InvalidTxnID, pageIds, chainPageIds, b.log_manager.GetMaxLogRecordSize()) {
+		if _, err := b.log_manager.AppendLogRecord(log_record); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// GetFreePageIds returns content of free page list (used for checkpointing)
+func (b *BufferPoolManager) GetFreePageIds() []types.PageID {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.diskManager.GetFreePageIds()
+}
+
+// GetCatalogRootPageIds returns first pages of system catalogs recorded in header of db file
+func (b *BufferPoolManager) GetCatalogRootPageIds() (tableCatalogPageId types.PageID, columnsCatalogPageId types.PageID) {
+	header := b.diskManager.GetDBHeader()
+	return header.TableCatalogPageId, header.ColumnsCatalogPageId
+}
+
+// SetCatalogRootPageIds records first pages of system catalogs to header of db file
+func (b *BufferPoolManager) SetCatalogRootPageIds(tableCatalogPageId types.PageID, columnsCatalogPageId types.PageID) {
+	b.diskManager.SetCatalogRootPageIds(tableCatalogPageId, columnsCatalogPageId)
+}
+
+// WasShutDownCleanly returns whether all pages were written to disk at last shutdown of the db
+// (pages which are not logged, ex: pages of skip list index, are consistent on disk only then)
+func (b *BufferPoolManager) WasShutDownCleanly() bool {
+	return b.diskManager.WasShutDownCleanly()
+}
+
 // FlushAllPages flushes all the pages in the buffer pool to disk.
 func (b *BufferPoolManager) FlushAllPages() {
 	pageIDs := make([]types.PageID, 0)
-	b.mutex.Lock()
-	for pageID, _ := range b.pageTable {
-		pageIDs = append(pageIDs, pageID)
+	for _, shard := range b.shards {
+		shard.mutex.Lock()
+		for pageID, _ := range shard.pageTable {
+			pageIDs = append(pageIDs, pageID)
+		}
+		shard.mutex.Unlock()
 	}
-	b.mutex.Unlock()
 
 	for _, pageID := range pageIDs {
 		b.FlushPage(pageID)
@@ -282,61 +610,428 @@ func (b *BufferPoolManager) FlushAllPages() {
 // FlushAllDitryPages flushes all dirty pages in the buffer pool to disk.
 func (b *BufferPoolManager) FlushAllDirtyPages() {
 	pageIDs := make([]types.PageID, 0)
-	b.mutex.Lock()
-	for pageID, _ := range b.pageTable {
-		if frameID, ok := b.pageTable[pageID]; ok {
-			pg := b.pages[frameID]
+	for _, shard := range b.shards {
+		shard.mutex.Lock()
+		for pageID, frameID := range shard.pageTable {
+			pg := shard.pages[frameID]
 			pg.RLatch()
 			if pg.IsDirty() {
 				pageIDs = append(pageIDs, pageID)
 			}
 			pg.RUnlatch()
 		}
+		shard.mutex.Unlock()
 	}
-	b.mutex.Unlock()
 
 	for _, pageID := range pageIDs {
 		b.FlushPage(pageID)
 	}
 }
 
-func (b *BufferPoolManager) getFrameID() (*FrameID, bool) {
-	//b.mutex.WLock()
-	if len(b.freeList) > 0 {
-		frameID, newFreeList := b.freeList[0], b.freeList[1:]
-		b.freeList = newFreeList
+// FlushAllDirtyPagesConcurrently flushes all dirty pages in the buffer pool to disk
+// without blocking threads which use the pages. pin counts of pages are not changed.
+// (this is used for fuzzy checkpointing)
+func (b *BufferPoolManager) FlushAllDirtyPagesConcurrently() {
+	// pages of a structure modification which is going on are not written
+	// because only a part of the modification may be on disk at crash
+	b.smoLatch.Lock()
+	defer b.smoLatch.Unlock()
+
+	pages := make([]*page.Page, 0)
+	for _, shard := range b.shards {
+		shard.mutex.Lock()
+		for _, frameID := range shard.pageTable {
+			pg := shard.pages[frameID]
+			if pg.IsDirty() {
+				// pin the page to avoid eviction during flush. this is not an access to the page
+				pg.IncPinCount()
+				shard.replacer.PinWithoutAccess(frameID)
+				pages = append(pages, pg)
+			}
+		}
+		shard.mutex.Unlock()
+	}
+
+	for _, pg := range pages {
+		// read latch is enough because page data is only read
+		pg.RLatch()
+		pg.SetIsDirty(false)
+		atomic.AddUint64(&b.shardOf(pg.GetPageId()).stats.DirtyFlushes, 1)
+		b.flushLogForPage(pg)
+		data := pg.Data()
+		b.writePage(pg.GetPageId(), pg.GetLSN(), data[:])
+		pg.RUnlatch()
+		b.UnpinPage(pg.GetPageId(), false)
+	}
+}
+
+// BeginStructureModification must be called before a change over multiple pages which is not logged
+// and is made durable by writing the pages in specific order (ex: bucket split of hash index).
+// EndStructureModification must be called after all of the pages are written.
+// checkpoint does not flush pages between these calls, so it never writes only a part of the change
+func (b *BufferPoolManager) BeginStructureModification() {
+	b.smoLatch.RLock()
+}
+
+func (b *BufferPoolManager) EndStructureModification() {
+	b.smoLatch.RUnlock()
+}
+
+// GetDirtyPageTable returns page ids and recLSNs of pages whose on-disk image may be stale.
+// pinned pages are included because their modification may be going on.
+// evicted pages whose write back is not finished are also included.
+func (b *BufferPoolManager) GetDirtyPageTable() map[types.PageID]types.LSN {
+	ret := make(map[types.PageID]types.LSN)
+	for _, shard := range b.shards {
+		shard.mutex.Lock()
+		for pageID, frameID := range shard.pageTable {
+			pg := shard.pages[frameID]
+			if (pg.IsDirty() || pg.PinCount() > 0) && pg.GetRecLSN() != common.InvalidLSN {
+				ret[pageID] = pg.GetRecLSN()
+			}
+		}
+		for pageID, pg := range shard.evicting {
+			if pg.GetRecLSN() != common.InvalidLSN {
+				ret[pageID] = pg.GetRecLSN()
+			}
+		}
+		shard.mutex.Unlock()
+	}
+	return ret
+}
+
+/*
+* WAL protocol: log records of changes to a page must be durable before the page is written to disk.
+* log is flushed (until LSN of the page) only when the page has changes whose log records are not durable yet.
+* the page must not be modified during this (caller holds latch of the page or the page is not pinned)
+ */
+func (b *BufferPoolManager) flushLogForPage(pg *page.Page) {
+	if b.log_manager == nil || !b.log_manager.IsEnabledLogging() {
+		return
+	}
+	if pageLSN := pg.GetLSN(); pageLSN > b.log_manager.GetPersistentLSN() {
+		b.log_manager.FlushUntil(pageLSN)
+	}
+}
+
+// writes page data to disk. writing page ahead of its log records is detected here
+// (pageLSN which is not assigned yet can not be a LSN of log record. ex: page which does not use LSN field)
+func (b *BufferPoolManager) writePage(pageID types.PageID, pageLSN types.LSN, data []byte) {
+	if b.log_manager != nil && b.log_manager.IsEnabledLogging() {
+		common.SH_Assert(pageLSN <= b.log_manager.GetPersistentLSN() || pageLSN >= b.log_manager.GetNextLSN(),
+			"page is written before its log records are flushed!")
+	}
+	b.diskWriteLatch.RLock()
+	b.diskManager.WritePage(pageID, data)
+	b.diskWriteLatch.RUnlock()
+}
+
+// ReadPageFromDisk reads image of the page on disk to data without caching it.
+// pages are not written by the buffer pool during the read, so the image is not torn
+// by concurrent write back (this is used for online backup)
+func (b *BufferPoolManager) ReadPageFromDisk(pageID types.PageID, data []byte) error {
+	b.diskWriteLatch.Lock()
+	defer b.diskWriteLatch.Unlock()
+	return b.diskManager.ReadPage(pageID, data)
+}
+
+// remember the LSN from which log records may change the page which is not dirty
+// caller must hold latch of the shard which has the page
+func (b *BufferPoolManager) setRecLSNIfClean(pg *page.Page) {
+	if pg.GetRecLSN() == common.InvalidLSN && b.log_manager != nil {
+		pg.SetRecLSN(b.log_manager.GetNextLSN())
+	}
+}
+
+// writes back dirty page evicted by reserveFrame. this is called without latch of the shard
+func (b *BufferPoolManager) writeBackVictim(shard *bufferPoolShard, victim *page.Page) {
+	if victim == nil {
+		return
+	}
+	victim.WLatch()
+	b.flushLogForPage(victim)
+	data := victim.Data()
+	b.writePage(victim.ID(), victim.GetLSN(), data[:])
+	atomic.AddUint64(&shard.stats.DirtyFlushes, 1)
+	victim.WUnlatch()
+}
+
+// waitInflight waits until other thread finishes reading or writing back the page.
+// caller must hold s.mutex (it is released during waiting)
+func (s *bufferPoolShard) waitInflight(pageID types.PageID) {
+	for done, ok := s.inflight[pageID]; ok; done, ok = s.inflight[pageID] {
+		s.mutex.Unlock()
+		<-done
+		s.mutex.Lock()
+	}
+}
+
+// reserveFrame gets a frame for pageID and removes the page cached on it from page table.
+// pageID (and the evicted page if it is dirty) is registered as inflight with done until installPage is called.
+// returned page is the evicted dirty page which caller must write back. caller must hold s.mutex
+func (s *bufferPoolShard) reserveFrame(pageID types.PageID, done chan struct{}) (*FrameID, *page.Page) {
+	// get the id from free list or from replacer
+	frameID, isFromFreeList := s.getFrameID()
+	if frameID == nil {
+		return nil, nil
+	}
+
+	var victim *page.Page
+	if !isFromFreeList {
+		// remove page from current frame
+		currentPage := s.pages[*frameID]
+		if currentPage != nil {
+			if common.EnableDebug {
+				common.ShPrintf(common.DEBUG_INFO, "reserveFrame: page=%d is removed from pageTable.\n", currentPage.ID())
+			}
+			delete(s.pageTable, currentPage.ID())
+			if currentPage.IsDirty() {
+				s.inflight[currentPage.ID()] = done
+				s.evicting[currentPage.ID()] = currentPage
+				victim = currentPage
+			}
+		}
+	}
+	s.pages[*frameID] = nil
+	s.inflight[pageID] = done
+	return frameID, victim
+}
+
+// installPage places pg on the frame reserved by reserveFrame. caller must hold s.mutex
+func (s *bufferPoolShard) installPage(frameID FrameID, pg *page.Page, victim *page.Page) {
+	// notify the access to replacer
+	s.replacer.Pin(frameID)
+	s.placePage(frameID, pg, victim)
+}
+
+// installPrefetchedPage places pg loaded by read-ahead on the frame reserved by reserveFrame.
+// the page is not pinned and loading is not notified to replacer as an access. caller must hold s.mutex
+func (s *bufferPoolShard) installPrefetchedPage(frameID FrameID, pg *page.Page, victim *page.Page) {
+	pg.DecPinCount()
+	s.replacer.UnpinPrefetched(frameID)
+	s.placePage(frameID, pg, victim)
+	s.notifyFrameFreed()
+}
+
+// releaseReservedFrame returns the frame reserved by reserveFrame to free list when the page
+// could not be read. the evicted page was written back already. caller must hold s.mutex
+func (s *bufferPoolShard) releaseReservedFrame(frameID FrameID, pageID types.PageID, victim *page.Page) {
+	delete(s.inflight, pageID)
+	if victim != nil {
+		delete(s.inflight, victim.ID())
+		delete(s.evicting, victim.ID())
+	}
+	s.freeList = append(s.freeList, frameID)
+	s.notifyFrameFreed()
+}
+
+func (s *bufferPoolShard) placePage(frameID FrameID, pg *page.Page, victim *page.Page) {
+	s.pageTable[pg.GetPageId()] = frameID
+	s.pages[frameID] = pg
+	delete(s.inflight, pg.GetPageId())
+	if victim != nil {
+		delete(s.inflight, victim.ID())
+		delete(s.evicting, victim.ID())
+	}
+}
+
+func (s *bufferPoolShard) getFrameID() (*FrameID, bool) {
+	if len(s.freeList) > 0 {
+		frameID, newFreeList := s.freeList[0], s.freeList[1:]
+		s.freeList = newFreeList
 
-		//b.mutex.WUnlock()
 		return &frameID, true
 	}
 
-	ret := (*b.replacer).Victim()
-	//b.mutex.WUnlock()
-	if ret == nil {
-		fmt.Printf("getFrameID: Victime page is nil! len(b.freeList)=%d\n", len(b.freeList))
-		//panic("getFrameID: Victime page is nil!")
+	ret := s.replacer.Victim()
+	if ret != nil {
+		atomic.AddUint64(&s.stats.Evictions, 1)
 	}
 	return ret, false
 }
 
+// waitFrame waits until a frame of the shard is unpinned or freed. false is returned when deadline passed.
+// caller must hold s.mutex (it is released during waiting)
+func (s *bufferPoolShard) waitFrame(deadline time.Time) bool {
+	timeout := time.Until(deadline)
+	if timeout <= 0 {
+		return false
+	}
+	if s.frameFreed == nil {
+		s.frameFreed = make(chan struct{})
+	}
+	freed := s.frameFreed
+	s.waiterNum++
+	s.mutex.Unlock()
+
+	timer := time.NewTimer(timeout)
+	isFreed := false
+	select {
+	case <-freed:
+		isFreed = true
+	case <-timer.C:
+	}
+	timer.Stop()
+
+	s.mutex.Lock()
+	s.waiterNum--
+	return isFreed
+}
+
+// wakes up threads waiting in waitFrame. caller must hold s.mutex
+func (s *bufferPoolShard) notifyFrameFreed() {
+	if s.waiterNum > 0 {
+		close(s.frameFreed)
+		s.frameFreed = make(chan struct{})
+	}
+}
+
+// SetFrameWaitTimeout makes FetchPage and NewPage wait for a frame up to timeout
+// when all frames are pinned (default is 0: they return nil immediately)
+func (b *BufferPoolManager) SetFrameWaitTimeout(timeout time.Duration) {
+	b.frameWaitTimeout = timeout
+}
+
+// SetPinTracking enables or disables debug mode which records stack trace of the last pinner of each page.
+// pages pinned in the meantime are reported by GetPinLeaks and PoolExhaustedError
+// (and printed when the pool is exhausted in debug mode)
+func (b *BufferPoolManager) SetPinTracking(isEnable bool) {
+	for _, shard := range b.shards {
+		shard.mutex.Lock()
+	}
+	b.isPinTracking = isEnable
+	for _, shard := range b.shards {
+		shard.lastPinners = make(map[types.PageID]string)
+		shard.mutex.Unlock()
+	}
+}
+
+// caller must hold latch of shard
+func (b *BufferPoolManager) recordPinner(shard *bufferPoolShard, pageID types.PageID) {
+	if b.isPinTracking {
+		shard.lastPinners[pageID] = string(debug.Stack())
+	}
+}
+
+// GetPinLeaks returns pages which are pinned now in order of page id.
+// stack traces are available only when pin tracking is enabled (see SetPinTracking)
+func (b *BufferPoolManager) GetPinLeaks() []*PinLeak {
+	ret := make([]*PinLeak, 0)
+	for _, shard := range b.shards {
+		shard.mutex.Lock()
+		for pageID, frameID := range shard.pageTable {
+			pg := shard.pages[frameID]
+			if pg.PinCount() > 0 {
+				ret = append(ret, &PinLeak{pageID, pg.PinCount(), shard.lastPinners[pageID]})
+			}
+		}
+		shard.mutex.Unlock()
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].PageID < ret[j].PageID })
+	return ret
+}
+
+// prints pinned pages and their last pinners when pin tracking and debug mode are enabled
+func (b *BufferPoolManager) reportExhaustion() {
+	if !b.isPinTracking || !common.EnableDebug {
+		return
+	}
+	common.ShPrintf(common.DEBUG_INFO, "buffer pool is exhausted. pinned pages:\n")
+	for _, leak := range b.GetPinLeaks() {
+		common.ShPrintf(common.DEBUG_INFO, "PageId=%d PinCount=%d last pinner:\n%s\n", leak.PageID, leak.PinCount, leak.LastPinnerStack)
+	}
+}
+
+// returns the error which reports exhaustion. pinned pages are included when pin tracking is enabled
+func (b *BufferPoolManager) exhaustionError() error {
+	b.reportExhaustion()
+	if !b.isPinTracking {
+		return ErrBufferPoolExhausted
+	}
+	return &PoolExhaustedError{b.GetPinLeaks()}
+}
+
 func (b *BufferPoolManager) GetPages() []*page.Page {
-	return b.pages
+	ret := make([]*page.Page, 0)
+	for _, shard := range b.shards {
+		shard.mutex.Lock()
+		ret = append(ret, shard.pages...)
+		shard.mutex.Unlock()
+	}
+	return ret
+}
+
+// GetStats returns a snapshot of counters (sum of all shards)
+func (b *BufferPoolManager) GetStats() BufferPoolStats {
+	ret := BufferPoolStats{}
+	for _, shard := range b.shards {
+		ret.Hits += atomic.LoadUint64(&shard.stats.Hits)
+		ret.Misses += atomic.LoadUint64(&shard.stats.Misses)
+		ret.Evictions += atomic.LoadUint64(&shard.stats.Evictions)
+		ret.DirtyFlushes += atomic.LoadUint64(&shard.stats.DirtyFlushes)
+	}
+	return ret
 }
 
 func (b *BufferPoolManager) GetPoolSize() int {
-	return len(b.pageTable)
+	ret := 0
+	for _, shard := range b.shards {
+		shard.mutex.Lock()
+		ret += len(shard.pageTable)
+		shard.mutex.Unlock()
+	}
+	return ret
+}
+
+// GetPageSize returns page size of the db. length of data of pages on the pool is this
+func (b *BufferPoolManager) GetPageSize() int {
+	return b.pageSize
+}
+
+// GetNumShards returns the number of partitions of the buffer pool
+func (b *BufferPoolManager) GetNumShards() int {
+	return len(b.shards)
 }
 
-// NewBufferPoolManager returns a empty buffer pool manager
+// NewBufferPoolManager returns a empty buffer pool manager which uses ClockReplacer
 func NewBufferPoolManager(poolSize uint32, DiskManager disk.DiskManager, log_manager *recovery.LogManager) *BufferPoolManager {
-	freeList := make([]FrameID, poolSize)
-	pages := make([]*page.Page, poolSize)
-	for i := uint32(0); i < poolSize; i++ {
-		freeList[i] = FrameID(i)
-		pages[i] = nil
+	return NewBufferPoolManagerWithReplacer(poolSize, DiskManager, log_manager, REPLACER_KIND_CLOCK)
+}
+
+// NewBufferPoolManagerWithReplacer returns a empty buffer pool manager which uses specified kind of replacer.
+// the pool is partitioned to shards when it is large enough (see MinFramesPerShard)
+func NewBufferPoolManagerWithReplacer(poolSize uint32, DiskManager disk.DiskManager, log_manager *recovery.LogManager, replacerKind ReplacerKind) *BufferPoolManager {
+	numShards := poolSize / MinFramesPerShard
+	if numShards > MaxNumShards {
+		numShards = MaxNumShards
+	}
+	if numShards < 1 {
+		numShards = 1
+	}
+	return NewBufferPoolManagerWithShards(poolSize, DiskManager, log_manager, replacerKind, numShards)
+}
+
+// NewBufferPoolManagerWithShards returns a empty buffer pool manager whose frames are partitioned to numShards shards.
+// each shard has its own latch, page table and replacer of specified kind
+func NewBufferPoolManagerWithShards(poolSize uint32, DiskManager disk.DiskManager, log_manager *recovery.LogManager, replacerKind ReplacerKind, numShards uint32) *BufferPoolManager {
+	common.SH_Assert(numShards >= 1 && numShards <= poolSize, "invalid number of shards")
+
+	shards := make([]*bufferPoolShard, numShards)
+	for ii := uint32(0); ii < numShards; ii++ {
+		// frames are divided as evenly as possible
+		shardSize := poolSize / numShards
+		if ii < poolSize%numShards {
+			shardSize++
+		}
+		freeList := make([]FrameID, shardSize)
+		pages := make([]*page.Page, shardSize)
+		for i := uint32(0); i < shardSize; i++ {
+			freeList[i] = FrameID(i)
+			pages[i] = nil
+		}
+		replacer := NewReplacer(replacerKind, shardSize)
+		shards[ii] = &bufferPoolShard{pages, replacer, freeList, make(map[types.PageID]FrameID), make(map[types.PageID]chan struct{}), make(map[types.PageID]*page.Page), new(sync.Mutex), BufferPoolStats{}, nil, 0, make(map[types.PageID]string)}
 	}
 
-	replacer := NewClockReplacer(poolSize)
-	//return &BufferPoolManager{DiskManager, pages, replacer, freeList, make(map[types.PageID]FrameID), log_manager, new(sync.Mutex)}
-	return &BufferPoolManager{DiskManager, pages, replacer, freeList, make(map[types.PageID]FrameID), log_manager, new(sync.Mutex)}
+	return &BufferPoolManager{DiskManager, shards, log_manager, new(sync.Mutex), 0, false, DiskManager.GetPageSize(), new(sync.WaitGroup), new(sync.RWMutex), new(sync.RWMutex), make(map[types.PageID]bool)}
 }
@@ -5,7 +5,13 @@ package buffer
 
 import (
 	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/ryogrid/SamehadaDB/common"
 	"github.com/ryogrid/SamehadaDB/recovery"
@@ -36,13 +42,15 @@ func TestBinaryData(t *testing.T) {
 	// Insert terminal characters both in the middle and at end
 	randomBinaryData[common.PageSize/2] = '0'
 	randomBinaryData[common.PageSize-1] = '0'
+	// checksum field is cleared when page is read from disk
+	copy(randomBinaryData[page.OffsetChecksum:page.OffsetChecksum+common.SizeOfChecksum], make([]byte, common.SizeOfChecksum))
 
-	var fixedRandomBinaryData [common.PageSize]byte
-	copy(fixedRandomBinaryData[:], randomBinaryData[:common.PageSize])
+	fixedRandomBinaryData := make([]byte, common.PageSize)
+	copy(fixedRandomBinaryData, randomBinaryData[:common.PageSize])
 
 	// Scenario: Once we have a page, we should be able to read and write content.
 	page0.Copy(0, randomBinaryData)
-	testingpkg.Equals(t, fixedRandomBinaryData, *page0.Data())
+	testingpkg.Equals(t, fixedRandomBinaryData, page0.Data())
 
 	// Scenario: We should be able to create new pages until we fill up the buffer pool.
 	for i := uint32(1); i < poolSize; i++ {
@@ -68,7 +76,7 @@ func TestBinaryData(t *testing.T) {
 
 	// Scenario: We should be able to fetch the data we wrote a while ago.
 	page0 = bpm.FetchPage(types.PageID(0))
-	testingpkg.Equals(t, fixedRandomBinaryData, *page0.Data())
+	testingpkg.Equals(t, fixedRandomBinaryData, page0.Data())
 	testingpkg.Ok(t, bpm.UnpinPage(types.PageID(0), true))
 
 	common.TempSuppressOnMemStorage = false
@@ -92,7 +100,9 @@ func TestSample(t *testing.T) {
 
 	// Scenario: Once we have a page, we should be able to read and write content.
 	page0.Copy(0, []byte("Hello"))
-	testingpkg.Equals(t, [common.PageSize]byte{'H', 'e', 'l', 'l', 'o'}, *page0.Data())
+	helloPageData := make([]byte, common.PageSize)
+	copy(helloPageData, "Hello")
+	testingpkg.Equals(t, helloPageData, page0.Data())
 
 	// Scenario: We should be able to create new pages until we fill up the buffer pool.
 	for i := uint32(1); i < poolSize; i++ {
@@ -116,7 +126,7 @@ func TestSample(t *testing.T) {
 	}
 	// Scenario: We should be able to fetch the data we wrote a while ago.
 	page0 = bpm.FetchPage(types.PageID(0))
-	testingpkg.Equals(t, [common.PageSize]byte{'H', 'e', 'l', 'l', 'o'}, *page0.Data())
+	testingpkg.Equals(t, helloPageData, page0.Data())
 
 	// Scenario: If we unpin page 0 and then make a new page, all the buffer pages should
 	// now be pinned. Fetching page 0 should fail.
@@ -130,3 +140,514 @@ func TestSample(t *testing.T) {
 	dm.ShutDown()
 	common.TempSuppressOnMemStorageMutex.Unlock()
 }
+
+func TestWALOnPageWrite(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+
+	poolSize := uint32(2)
+
+	dm := disk.NewDiskManagerTest()
+	log_manager := recovery.NewLogManager(&dm)
+	log_manager.ActivateLogging()
+	bpm := NewBufferPoolManager(poolSize, dm, log_manager)
+
+	// Scenario: log record of change to the page is not durable yet. it must be flushed when the page is evicted.
+	page0 := bpm.NewPage()
+	lsn, err := log_manager.AppendLogRecord(recovery.NewLogRecordTxn(1, common.InvalidLSN, recovery.BEGIN))
+	testingpkg.Ok(t, err)
+	page0.SetLSN(lsn)
+	testingpkg.Assert(t, log_manager.GetPersistentLSN() < lsn, "")
+	bpm.UnpinPage(page0.GetPageId(), true)
+	page1 := bpm.NewPage()
+	page2 := bpm.NewPage()
+	testingpkg.Assert(t, log_manager.GetPersistentLSN() >= lsn, "log was not flushed before eviction")
+
+	// Scenario: change to the page is already durable. log is not flushed at eviction.
+	bpm.UnpinPage(page1.GetPageId(), true)
+	lsn, err = log_manager.AppendLogRecord(recovery.NewLogRecordCommit(1, lsn, 0))
+	testingpkg.Ok(t, err)
+	flushNum := dm.GetNumFlushes()
+	bpm.FetchPage(page0.GetPageId())
+	testingpkg.Equals(t, flushNum, dm.GetNumFlushes())
+	testingpkg.Assert(t, log_manager.GetPersistentLSN() < lsn, "")
+
+	// Scenario: FlushPage flushes log until LSN of the page
+	page2.SetLSN(lsn)
+	bpm.FlushPage(page2.GetPageId())
+	testingpkg.Assert(t, log_manager.GetPersistentLSN() >= lsn, "log was not flushed before FlushPage")
+
+	common.TempSuppressOnMemStorage = false
+	dm.ShutDown()
+	common.TempSuppressOnMemStorageMutex.Unlock()
+}
+
+func TestCheckpointFlushWaitsStructureModification(t *testing.T) {
+	poolSize := uint32(4)
+
+	dm := disk.NewDiskManagerTest()
+	defer dm.ShutDown()
+	bpm := NewBufferPoolManager(poolSize, dm, nil)
+
+	page0 := bpm.NewPage()
+	page0.Data()[0] = 1
+	bpm.UnpinPage(page0.GetPageId(), true)
+
+	// Scenario: dirty pages are not written while a structure modification is going on
+	bpm.BeginStructureModification()
+	done := make(chan struct{})
+	go func() {
+		bpm.FlushAllDirtyPagesConcurrently()
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("checkpoint flush finished during structure modification")
+	default:
+	}
+	testingpkg.Assert(t, page0.IsDirty(), "page was flushed during structure modification")
+
+	// Scenario: flush proceeds after the modification ends
+	bpm.EndStructureModification()
+	<-done
+	testingpkg.Assert(t, !page0.IsDirty(), "page was not flushed after structure modification")
+}
+
+func TestReadPageFromDiskWaitsPageWrite(t *testing.T) {
+	poolSize := uint32(4)
+
+	dm := disk.NewDiskManagerTest()
+	defer dm.ShutDown()
+	bpm := NewBufferPoolManager(poolSize, dm, nil)
+
+	page0 := bpm.NewPage()
+	copy(page0.Data()[:], []byte("backup"))
+	bpm.UnpinPage(page0.GetPageId(), true)
+	bpm.FlushPage(page0.GetPageId())
+
+	// Scenario: page is not read while a page is being written back
+	bpm.diskWriteLatch.RLock()
+	data := make([]byte, common.PageSize)
+	done := make(chan error)
+	go func() {
+		done <- bpm.ReadPageFromDisk(page0.GetPageId(), data)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("page was read during write back")
+	default:
+	}
+	bpm.diskWriteLatch.RUnlock()
+	testingpkg.Ok(t, <-done)
+	testingpkg.Equals(t, "backup", string(data[:6]))
+}
+
+// DiskManager which returns PageCorruptionError when corruptPageID is read
+type corruptingDiskManager struct {
+	disk.DiskManager
+	corruptPageID types.PageID
+}
+
+func (d *corruptingDiskManager) ReadPage(pageID types.PageID, pageData []byte) error {
+	if pageID == d.corruptPageID {
+		return &disk.PageCorruptionError{PageID: pageID, StoredChecksum: 0, ActualChecksum: 1}
+	}
+	return d.DiskManager.ReadPage(pageID, pageData)
+}
+
+func TestFetchCorruptedPage(t *testing.T) {
+	poolSize := uint32(2)
+
+	dm := disk.NewDiskManagerTest()
+	defer dm.ShutDown()
+	cdm := &corruptingDiskManager{dm, types.InvalidPageID}
+	bpm := NewBufferPoolManager(poolSize, cdm, nil)
+
+	pageIds := make([]types.PageID, 0)
+	for ii := 0; ii < 3; ii++ {
+		pg := bpm.NewPage()
+		pageIds = append(pageIds, pg.GetPageId())
+		bpm.UnpinPage(pg.GetPageId(), true)
+	}
+	bpm.FlushAllPages()
+	cdm.corruptPageID = pageIds[0]
+
+	// Scenario: the error is returned to caller instead of panic
+	pg, err := bpm.FetchPageWithErr(pageIds[0])
+	testingpkg.Assert(t, pg == nil, "corrupted page is returned")
+	var corruptionErr *disk.PageCorruptionError
+	testingpkg.Assert(t, errors.As(err, &corruptionErr), "corruption is not reported")
+	testingpkg.Equals(t, pageIds[0], corruptionErr.PageID)
+	testingpkg.Assert(t, bpm.FetchPage(pageIds[0]) == nil, "")
+
+	// Scenario: read-ahead stops at the corrupted page
+	result := <-bpm.PrefetchPages(pageIds[0], 2, func(*page.Page) types.PageID { return types.InvalidPageID })
+	testingpkg.Equals(t, 0, result.ReadNum)
+
+	// Scenario: frames reserved for the corrupted page are usable
+	page1 := bpm.FetchPage(pageIds[1])
+	page2 := bpm.FetchPage(pageIds[2])
+	testingpkg.Assert(t, page1 != nil && page2 != nil, "frames are leaked")
+	bpm.UnpinPage(pageIds[1], false)
+	bpm.UnpinPage(pageIds[2], false)
+}
+
+func TestPageReuse(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+
+	poolSize := uint32(10)
+	const pageNumPerRound = 20
+
+	dm := disk.NewDiskManagerTest()
+	log_manager := recovery.NewLogManager(&dm)
+	log_manager.ActivateLogging()
+	bpm := NewBufferPoolManager(poolSize, dm, log_manager)
+
+	// Scenario: pages allocated after deletion of pages reuse them. so size of db file does not grow
+	var sizeAfterFirstRound int64
+	for round := 0; round < 10; round++ {
+		pageIds := make([]types.PageID, 0)
+		for ii := 0; ii < pageNumPerRound; ii++ {
+			pg := bpm.NewPage()
+			testingpkg.Assert(t, pg != nil, "")
+			if round > 0 {
+				// REUSEPAGE record must be durable before the page is written
+				testingpkg.Assert(t, log_manager.GetPersistentLSN() == log_manager.GetNextLSN()-1, "")
+			}
+			pg.Copy(page.SizePageHeader, []byte("churn"))
+			pageIds = append(pageIds, pg.GetPageId())
+			bpm.UnpinPage(pg.GetPageId(), true)
+		}
+		bpm.FlushAllDirtyPages()
+		if round == 0 {
+			sizeAfterFirstRound = dm.Size()
+		}
+		testingpkg.Equals(t, sizeAfterFirstRound, dm.Size())
+
+		for _, pageId := range pageIds {
+			testingpkg.Ok(t, bpm.DeletePage(pageId))
+		}
+		testingpkg.Equals(t, pageNumPerRound, dm.GetNumFreePages())
+	}
+	testingpkg.Equals(t, int64(pageNumPerRound*common.PageSize), sizeAfterFirstRound)
+
+	// Scenario: pinned page can not be deleted
+	pg := bpm.NewPage()
+	testingpkg.Assert(t, bpm.DeletePage(pg.GetPageId()) != nil, "pinned page was deleted")
+	testingpkg.Equals(t, pageNumPerRound-1, dm.GetNumFreePages())
+	bpm.UnpinPage(pg.GetPageId(), true)
+
+	common.TempSuppressOnMemStorage = false
+	dm.ShutDown()
+	common.TempSuppressOnMemStorageMutex.Unlock()
+}
+
+// creates pages and returns their ids. all of them are unpinned
+func createPagesForTesting(bpm *BufferPoolManager, num int) []types.PageID {
+	pageIds := make([]types.PageID, 0, num)
+	for ii := 0; ii < num; ii++ {
+		pg := bpm.NewPage()
+		pageIds = append(pageIds, pg.GetPageId())
+		bpm.UnpinPage(pg.GetPageId(), true)
+	}
+	return pageIds
+}
+
+// fetches and unpins the page. returns true when the page was on the buffer pool
+func accessPageForTesting(bpm *BufferPoolManager, pageId types.PageID) bool {
+	shard := bpm.shardOf(pageId)
+	shard.mutex.Lock()
+	_, isHit := shard.pageTable[pageId]
+	shard.mutex.Unlock()
+	bpm.FetchPage(pageId)
+	bpm.UnpinPage(pageId, false)
+	return isHit
+}
+
+func TestScanResistantReplacers(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+
+	poolSize := uint32(10)
+
+	for _, replacerKind := range []ReplacerKind{REPLACER_KIND_LRU_K, REPLACER_KIND_2Q} {
+		dm := disk.NewDiskManagerTest()
+		bpm := NewBufferPoolManagerWithReplacer(poolSize, dm, recovery.NewLogManager(&dm), replacerKind)
+
+		hotPageIds := createPagesForTesting(bpm, 3)
+		scanPageIds := createPagesForTesting(bpm, 50)
+
+		// Scenario: pages accessed frequently (like catalog and index pages) are cached
+		for round := 0; round < 3; round++ {
+			for _, pageId := range hotPageIds {
+				accessPageForTesting(bpm, pageId)
+			}
+		}
+
+		// Scenario: a full scan over pages larger than the pool does not evict the hot pages
+		for _, pageId := range scanPageIds {
+			accessPageForTesting(bpm, pageId)
+		}
+		for _, pageId := range hotPageIds {
+			testingpkg.Assert(t, accessPageForTesting(bpm, pageId), "hot page %d was evicted (replacer kind: %d)", pageId, replacerKind)
+		}
+
+		dm.ShutDown()
+	}
+
+	common.TempSuppressOnMemStorage = false
+	common.TempSuppressOnMemStorageMutex.Unlock()
+}
+
+func TestPrefetchPages(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+
+	poolSize := uint32(10)
+	const readAheadNum = 4
+
+	for _, replacerKind := range []ReplacerKind{REPLACER_KIND_CLOCK, REPLACER_KIND_LRU_K, REPLACER_KIND_2Q} {
+		dm := disk.NewDiskManagerTest()
+		bpm := NewBufferPoolManagerWithReplacer(poolSize, dm, recovery.NewLogManager(&dm), replacerKind)
+
+		hotPageIds := createPagesForTesting(bpm, 3)
+		scanPageIds := createPagesForTesting(bpm, 50)
+		// scan pages are chained in order of their ids
+		lastPageId := scanPageIds[len(scanPageIds)-1]
+		getNextPageId := func(pg *page.Page) types.PageID {
+			if pg.GetPageId() == lastPageId {
+				return types.InvalidPageID
+			}
+			return pg.GetPageId() + 1
+		}
+		for round := 0; round < 3; round++ {
+			for _, pageId := range hotPageIds {
+				accessPageForTesting(bpm, pageId)
+			}
+		}
+
+		// Scenario: pages of the chain are read without pinning them and counting as accesses
+		statsBefore := bpm.GetStats()
+		ret := <-bpm.PrefetchPages(scanPageIds[0], readAheadNum, getNextPageId)
+		testingpkg.Equals(t, readAheadNum, ret.ReadNum)
+		testingpkg.Equals(t, scanPageIds[readAheadNum], ret.NextPageId)
+		testingpkg.Equals(t, statsBefore.Misses, bpm.GetStats().Misses)
+		testingpkg.Equals(t, 0, len(bpm.GetPinLeaks()))
+
+		// Scenario: read-ahead stops at a page which is on the pool
+		ret = <-bpm.PrefetchPages(scanPageIds[1], readAheadNum, getNextPageId)
+		testingpkg.Equals(t, 0, ret.ReadNum)
+		testingpkg.Equals(t, types.InvalidPageID, ret.NextPageId)
+
+		// Scenario: scan reads pages ahead. all pages read ahead are hit and hot pages are not evicted
+		// by the scan (clock is not scan resistant)
+		for ii := 0; ii < len(scanPageIds); ii++ {
+			if ii > 0 && ii%readAheadNum == 0 {
+				<-bpm.PrefetchPages(scanPageIds[ii], readAheadNum, getNextPageId)
+			}
+			testingpkg.Assert(t, accessPageForTesting(bpm, scanPageIds[ii]), "page %d read ahead was evicted (replacer kind: %d)", scanPageIds[ii], replacerKind)
+		}
+		if replacerKind != REPLACER_KIND_CLOCK {
+			for _, pageId := range hotPageIds {
+				testingpkg.Assert(t, accessPageForTesting(bpm, pageId), "hot page %d was evicted (replacer kind: %d)", pageId, replacerKind)
+			}
+		}
+
+		dm.ShutDown()
+	}
+
+	common.TempSuppressOnMemStorage = false
+	common.TempSuppressOnMemStorageMutex.Unlock()
+}
+
+// point lookups to hot pages mixed with full scans. hit ratio of lookups is reported
+func BenchmarkReplacerMixedWorkload(b *testing.B) {
+	const poolSize = 64
+	const hotPageNum = 32
+	const scanPageNum = 256
+	const lookupsPerScan = 256
+
+	replacerNames := []string{"Clock", "LRU-K", "2Q"}
+	for _, replacerKind := range []ReplacerKind{REPLACER_KIND_CLOCK, REPLACER_KIND_LRU_K, REPLACER_KIND_2Q} {
+		b.Run(replacerNames[replacerKind], func(b *testing.B) {
+			dm := disk.NewVirtualDiskManagerImpl("BenchmarkReplacerMixedWorkload.db")
+			defer dm.ShutDown()
+			bpm := NewBufferPoolManagerWithReplacer(poolSize, dm, recovery.NewLogManager(&dm), replacerKind)
+
+			hotPageIds := createPagesForTesting(bpm, hotPageNum)
+			scanPageIds := createPagesForTesting(bpm, scanPageNum)
+
+			hitCnt := 0
+			lookupCnt := 0
+			b.ResetTimer()
+			for ii := 0; ii < b.N; ii++ {
+				if ii%lookupsPerScan == 0 {
+					for _, pageId := range scanPageIds {
+						accessPageForTesting(bpm, pageId)
+					}
+				}
+				if accessPageForTesting(bpm, hotPageIds[ii%hotPageNum]) {
+					hitCnt++
+				}
+				lookupCnt++
+			}
+			b.ReportMetric(float64(hitCnt)/float64(lookupCnt), "hit-ratio")
+		})
+	}
+}
+
+func TestShardedBufferPoolManager(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+
+	poolSize := uint32(16)
+	const numShards = 4
+	const pageNum = 64
+	const threadNum = 8
+
+	dm := disk.NewDiskManagerTest()
+	log_manager := recovery.NewLogManager(&dm)
+	log_manager.ActivateLogging()
+	bpm := NewBufferPoolManagerWithShards(poolSize, dm, log_manager, REPLACER_KIND_CLOCK, numShards)
+	testingpkg.Equals(t, numShards, bpm.GetNumShards())
+
+	// Scenario: pages more than the pool are written and evicted dirty
+	pageIds := make([]types.PageID, 0, pageNum)
+	for ii := 0; ii < pageNum; ii++ {
+		pg := bpm.NewPage()
+		testingpkg.Assert(t, pg != nil, "")
+		buf := make([]byte, 4)
+		binary.LittleEndian.PutUint32(buf, uint32(pg.GetPageId()))
+		pg.Copy(page.SizePageHeader, buf)
+		pageIds = append(pageIds, pg.GetPageId())
+		testingpkg.Ok(t, bpm.UnpinPage(pg.GetPageId(), true))
+	}
+	testingpkg.Assert(t, bpm.GetStats().Evictions > 0, "")
+
+	// Scenario: concurrent readers get right contents while victims are written back
+	wg := new(sync.WaitGroup)
+	errCnt := int32(0)
+	mutex := new(sync.Mutex)
+	for th := 0; th < threadNum; th++ {
+		wg.Add(1)
+		go func(th int) {
+			defer wg.Done()
+			for ii := 0; ii < pageNum*4; ii++ {
+				pageId := pageIds[(ii*7+th)%pageNum]
+				pg := bpm.FetchPage(pageId)
+				if pg == nil {
+					// all frames of the shard are pinned by other threads
+					continue
+				}
+				if types.PageID(binary.LittleEndian.Uint32(pg.Data()[page.SizePageHeader:])) != pageId {
+					mutex.Lock()
+					errCnt++
+					mutex.Unlock()
+				}
+				// make the page dirty again for causing write back at eviction
+				bpm.UnpinPage(pageId, ii%2 == 0)
+			}
+		}(th)
+	}
+	wg.Wait()
+	testingpkg.Equals(t, int32(0), errCnt)
+
+	// Scenario: all pins are released
+	for _, pg := range bpm.GetPages() {
+		testingpkg.Assert(t, pg == nil || pg.PinCount() == 0, "page %d is still pinned", pg.GetPageId())
+	}
+
+	common.TempSuppressOnMemStorage = false
+	dm.ShutDown()
+	common.TempSuppressOnMemStorageMutex.Unlock()
+}
+
+func TestFrameWaitAndPinLeakReport(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+
+	poolSize := uint32(4)
+
+	dm := disk.NewDiskManagerTest()
+	bpm := NewBufferPoolManager(poolSize, dm, recovery.NewLogManager(&dm))
+	bpm.SetPinTracking(true)
+
+	pages := make([]*page.Page, 0)
+	for ii := uint32(0); ii < poolSize; ii++ {
+		pages = append(pages, bpm.NewPage())
+	}
+
+	// Scenario: all frames are pinned. nil is returned without waiting by default
+	testingpkg.Equals(t, (*page.Page)(nil), bpm.NewPage())
+	testingpkg.Equals(t, (*page.Page)(nil), bpm.FetchPage(types.PageID(100)))
+
+	// Scenario: pinned pages are reported with stack trace of the last pinner
+	leaks := bpm.GetPinLeaks()
+	testingpkg.Equals(t, int(poolSize), len(leaks))
+	testingpkg.Equals(t, pages[0].GetPageId(), leaks[0].PageID)
+	testingpkg.Equals(t, int32(1), leaks[0].PinCount)
+	testingpkg.Assert(t, strings.Contains(leaks[0].LastPinnerStack, "TestFrameWaitAndPinLeakReport"), "stack trace of pinner is not recorded")
+
+	// Scenario: pinned pages are returned with the error
+	_, err := bpm.FetchPageWithErr(types.PageID(100))
+	testingpkg.Assert(t, errors.Is(err, ErrBufferPoolExhausted), "exhaustion is not reported")
+	var exhaustedErr *PoolExhaustedError
+	testingpkg.Assert(t, errors.As(err, &exhaustedErr), "pinned pages are not reported")
+	testingpkg.Equals(t, int(poolSize), len(exhaustedErr.PinnedPages))
+	testingpkg.Equals(t, pages[0].GetPageId(), exhaustedErr.PinnedPages[0].PageID)
+
+	// Scenario: with wait timeout, NewPage gets a frame which is unpinned in the meantime
+	bpm.SetFrameWaitTimeout(10 * time.Second)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		bpm.UnpinPage(pages[0].GetPageId(), true)
+	}()
+	pg := bpm.NewPage()
+	testingpkg.Assert(t, pg != nil, "NewPage should get a frame after waiting")
+	testingpkg.Equals(t, int(poolSize), len(bpm.GetPinLeaks()))
+
+	// Scenario: the wait is bounded
+	bpm.SetFrameWaitTimeout(50 * time.Millisecond)
+	startTime := time.Now()
+	testingpkg.Equals(t, (*page.Page)(nil), bpm.FetchPage(pages[0].GetPageId()))
+	testingpkg.Assert(t, time.Since(startTime) >= 50*time.Millisecond, "FetchPage returned before timeout")
+
+	common.TempSuppressOnMemStorage = false
+	dm.ShutDown()
+	common.TempSuppressOnMemStorageMutex.Unlock()
+}
+
+// parallel point reads of cached pages. the global latch is bottleneck when the pool is not partitioned
+func BenchmarkParallelFetchPage(b *testing.B) {
+	const poolSize = 1024
+	const pageNum = 512
+
+	for _, numShards := range []uint32{1, 16} {
+		for _, threadNum := range []int{1, 2, 4, 8, 16} {
+			b.Run(fmt.Sprintf("shards=%d/goroutines=%d", numShards, threadNum), func(b *testing.B) {
+				dm := disk.NewVirtualDiskManagerImpl("BenchmarkParallelFetchPage.db")
+				defer dm.ShutDown()
+				bpm := NewBufferPoolManagerWithShards(poolSize, dm, recovery.NewLogManager(&dm), REPLACER_KIND_CLOCK, numShards)
+				pageIds := createPagesForTesting(bpm, pageNum)
+
+				b.ResetTimer()
+				wg := new(sync.WaitGroup)
+				for th := 0; th < threadNum; th++ {
+					wg.Add(1)
+					go func(th int) {
+						defer wg.Done()
+						for ii := th; ii < b.N; ii += threadNum {
+							pageId := pageIds[(ii*31)%pageNum]
+							bpm.FetchPage(pageId)
+							bpm.UnpinPage(pageId, false)
+						}
+					}(th)
+				}
+				wg.Wait()
+			})
+		}
+	}
+}
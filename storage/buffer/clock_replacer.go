@@ -4,7 +4,6 @@
 package buffer
 
 import (
-	"fmt"
 	"sync"
 )
 
@@ -17,7 +16,9 @@ type FrameID uint32
 type ClockReplacer struct {
 	cList     *circularList
 	clockHand **node
-	mutex     *sync.Mutex
+	// reference bits of frames pinned by PinWithoutAccess. they are restored at Unpin
+	heldRefs map[FrameID]bool
+	mutex    *sync.Mutex
 }
 
 // Victim removes the victim frame as defined by the replacement policy
@@ -25,7 +26,7 @@ func (c *ClockReplacer) Victim() *FrameID {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	if c.cList.size == 0 {
-		fmt.Println("Victim: page which can be cache out is not exist!")
+		// all frames are pinned. caller reports it as buffer.ErrBufferPoolExhausted
 		//panic("Victim: page which can be cache out is not exist!")
 		return nil
 	}
@@ -55,17 +56,48 @@ func (c *ClockReplacer) Unpin(id FrameID) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	if !c.cList.hasKey(id) {
-		c.cList.insert(id, true)
+		ref, isHeld := c.heldRefs[id]
+		delete(c.heldRefs, id)
+		c.cList.insert(id, !isHeld || ref)
 		if c.cList.size == 1 {
 			c.clockHand = &c.cList.head
 		}
 	}
 }
 
+// UnpinPrefetched makes a frame loaded by read-ahead victim candidate.
+// clock does not distinguish frequency of accesses, so this is same as Unpin
+func (c *ClockReplacer) UnpinPrefetched(id FrameID) {
+	c.Unpin(id)
+}
+
 // Pin pins a frame, indicating that it should not be victimized until it is unpinned
 func (c *ClockReplacer) Pin(id FrameID) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	delete(c.heldRefs, id)
+	c.removeFromClock(id)
+}
+
+// PinWithoutAccess pins a frame without recording an access (reference bit is kept until Unpin)
+func (c *ClockReplacer) PinWithoutAccess(id FrameID) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if node, ok := c.cList.supportMap[id]; ok {
+		c.heldRefs[id] = node.value
+		c.removeFromClock(id)
+	}
+}
+
+// Remove forgets a frame whose page is discarded
+func (c *ClockReplacer) Remove(id FrameID) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.heldRefs, id)
+	c.removeFromClock(id)
+}
+
+func (c *ClockReplacer) removeFromClock(id FrameID) {
 	//node := c.cList.find(id)
 	//if node == nil {
 	node, ok := c.cList.supportMap[id]
@@ -90,5 +122,5 @@ func (c *ClockReplacer) Size() uint32 {
 // NewClockReplacer instantiates a new clock replacer
 func NewClockReplacer(poolSize uint32) *ClockReplacer {
 	cList := newCircularList(poolSize)
-	return &ClockReplacer{cList, &cList.head, new(sync.Mutex)}
+	return &ClockReplacer{cList, &cList.head, make(map[FrameID]bool), new(sync.Mutex)}
 }
@@ -0,0 +1,83 @@
+package buffer
+
+import "container/heap"
+
+// order of a frame in frameHeap. a frame with smaller rank is taken first and ts breaks ties
+type frameKey struct {
+	rank int
+	ts   uint64
+}
+
+func (k frameKey) less(other frameKey) bool {
+	return k.rank < other.rank || (k.rank == other.rank && k.ts < other.ts)
+}
+
+/**
+ * frameHeap is a min-heap of frames which can be victim. replacers use it for finding the victim
+ * in O(log n) instead of scanning all frames. key of a frame must not change while it is on the heap.
+ */
+type frameHeap struct {
+	ids []FrameID
+	// key and position in ids of each frame on the heap
+	keys map[FrameID]frameKey
+	idxs map[FrameID]int
+}
+
+func newFrameHeap(poolSize uint32) *frameHeap {
+	return &frameHeap{make([]FrameID, 0, poolSize), make(map[FrameID]frameKey, poolSize), make(map[FrameID]int, poolSize)}
+}
+
+func (h *frameHeap) Len() int { return len(h.ids) }
+
+func (h *frameHeap) Less(i, j int) bool { return h.keys[h.ids[i]].less(h.keys[h.ids[j]]) }
+
+func (h *frameHeap) Swap(i, j int) {
+	h.ids[i], h.ids[j] = h.ids[j], h.ids[i]
+	h.idxs[h.ids[i]] = i
+	h.idxs[h.ids[j]] = j
+}
+
+// Push and Pop are called by container/heap only. use add, remove and popMin
+func (h *frameHeap) Push(x interface{}) {
+	id := x.(FrameID)
+	h.idxs[id] = len(h.ids)
+	h.ids = append(h.ids, id)
+}
+
+func (h *frameHeap) Pop() interface{} {
+	id := h.ids[len(h.ids)-1]
+	h.ids = h.ids[:len(h.ids)-1]
+	delete(h.idxs, id)
+	delete(h.keys, id)
+	return id
+}
+
+func (h *frameHeap) contains(id FrameID) bool {
+	_, ok := h.idxs[id]
+	return ok
+}
+
+// adds a frame. nothing is done when the frame is on the heap already
+func (h *frameHeap) add(id FrameID, key frameKey) {
+	if h.contains(id) {
+		return
+	}
+	h.keys[id] = key
+	heap.Push(h, id)
+}
+
+// removes a frame. nothing is done when the frame is not on the heap
+func (h *frameHeap) remove(id FrameID) {
+	if idx, ok := h.idxs[id]; ok {
+		heap.Remove(h, idx)
+	}
+}
+
+// removes and returns the frame which has the smallest key. nil is returned when the heap is empty
+func (h *frameHeap) popMin() *FrameID {
+	if len(h.ids) == 0 {
+		return nil
+	}
+	id := heap.Pop(h).(FrameID)
+	return &id
+}
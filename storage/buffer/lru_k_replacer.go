@@ -0,0 +1,118 @@
+package buffer
+
+import (
+	"sync"
+)
+
+/**
+ * LRUKReplacer implements the LRU-K replacement policy.
+ * the victim is the frame whose backward k-distance (time since the k-th most recent access) is the largest.
+ * frames accessed less than k times have infinite distance and the one accessed earliest among them is evicted.
+ * so pages touched only once by a sequential scan are evicted before frequently accessed pages.
+ */
+type LRUKReplacer struct {
+	k int
+	// timestamps of the last k accesses of each frame (oldest first)
+	history   map[FrameID][]uint64
+	evictable *frameHeap
+	// frames loaded by read-ahead and not accessed yet. their history has the time of loading
+	prefetched map[FrameID]bool
+	currentTs  uint64
+	mutex      *sync.Mutex
+}
+
+func (r *LRUKReplacer) recordAccess(id FrameID) {
+	r.currentTs++
+	if r.prefetched[id] {
+		// the first access. loading by read-ahead is not counted
+		delete(r.prefetched, id)
+		delete(r.history, id)
+	}
+	hist := append(r.history[id], r.currentTs)
+	if len(hist) > r.k {
+		hist = hist[1:]
+	}
+	r.history[id] = hist
+}
+
+// frames accessed less than k times (infinite distance) come first. frames are ordered by
+// the oldest access in history (the k-th most recent access or the first access)
+func (r *LRUKReplacer) keyOf(id FrameID) frameKey {
+	hist := r.history[id]
+	if len(hist) < r.k {
+		return frameKey{0, hist[0]}
+	}
+	return frameKey{1, hist[0]}
+}
+
+// Victim removes the victim frame as defined by the replacement policy
+func (r *LRUKReplacer) Victim() *FrameID {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	victimFrameID := r.evictable.popMin()
+	if victimFrameID != nil {
+		delete(r.history, *victimFrameID)
+		delete(r.prefetched, *victimFrameID)
+	}
+	return victimFrameID
+}
+
+// Pin pins a frame, indicating that it should not be victimized until it is unpinned
+func (r *LRUKReplacer) Pin(id FrameID) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.recordAccess(id)
+	r.evictable.remove(id)
+}
+
+// PinWithoutAccess pins a frame without recording an access
+func (r *LRUKReplacer) PinWithoutAccess(id FrameID) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.evictable.remove(id)
+}
+
+// Unpin unpins a frame, indicating that it can now be victimized
+func (r *LRUKReplacer) Unpin(id FrameID) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.history[id]; !ok {
+		r.recordAccess(id)
+	}
+	r.evictable.add(id, r.keyOf(id))
+}
+
+// UnpinPrefetched makes a frame loaded by read-ahead victim candidate without recording an access
+func (r *LRUKReplacer) UnpinPrefetched(id FrameID) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.history[id]; !ok {
+		// time of loading orders the frame among frames accessed less than k times
+		r.currentTs++
+		r.history[id] = []uint64{r.currentTs}
+		r.prefetched[id] = true
+	}
+	r.evictable.add(id, r.keyOf(id))
+}
+
+// Remove forgets a frame whose page is discarded. its access history is cleared
+func (r *LRUKReplacer) Remove(id FrameID) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.evictable.remove(id)
+	delete(r.history, id)
+	delete(r.prefetched, id)
+}
+
+// Size returns the number of frames which can be victim
+func (r *LRUKReplacer) Size() uint32 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return uint32(r.evictable.Len())
+}
+
+// NewLRUKReplacer instantiates a new LRU-K replacer
+func NewLRUKReplacer(poolSize uint32, k int) *LRUKReplacer {
+	return &LRUKReplacer{k, make(map[FrameID][]uint64, poolSize), newFrameHeap(poolSize), make(map[FrameID]bool), 0, new(sync.Mutex)}
+}
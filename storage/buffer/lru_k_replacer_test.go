@@ -0,0 +1,70 @@
+package buffer
+
+import (
+	"testing"
+
+	testingpkg "github.com/ryogrid/SamehadaDB/testing"
+)
+
+func TestLRUKReplacer(t *testing.T) {
+	lrukReplacer := NewLRUKReplacer(7, 2)
+
+	// Scenario: access frames. 1 and 2 are accessed twice, others once.
+	for _, id := range []FrameID{1, 2, 3, 4, 5, 6, 1, 2} {
+		lrukReplacer.Pin(id)
+	}
+	for id := FrameID(1); id <= 6; id++ {
+		lrukReplacer.Unpin(id)
+	}
+	testingpkg.Equals(t, uint32(6), lrukReplacer.Size())
+
+	// Scenario: frames accessed once (infinite backward k-distance) are victims first in order of access
+	var value *FrameID
+	value = lrukReplacer.Victim()
+	testingpkg.Equals(t, FrameID(3), *value)
+	value = lrukReplacer.Victim()
+	testingpkg.Equals(t, FrameID(4), *value)
+
+	// Scenario: pinned frame is not victim
+	lrukReplacer.Pin(5)
+	testingpkg.Equals(t, uint32(3), lrukReplacer.Size())
+	value = lrukReplacer.Victim()
+	testingpkg.Equals(t, FrameID(6), *value)
+
+	// Scenario: 5 has been accessed twice now. the one whose second most recent access is the oldest is victim
+	lrukReplacer.Unpin(5)
+	value = lrukReplacer.Victim()
+	testingpkg.Equals(t, FrameID(1), *value)
+	value = lrukReplacer.Victim()
+	testingpkg.Equals(t, FrameID(2), *value)
+	value = lrukReplacer.Victim()
+	testingpkg.Equals(t, FrameID(5), *value)
+
+	// Scenario: no frame can be victim
+	testingpkg.Equals(t, (*FrameID)(nil), lrukReplacer.Victim())
+
+	// Scenario: pinning without access (ex: write back by checkpoint) does not change the order
+	for _, id := range []FrameID{1, 2, 1, 2} {
+		lrukReplacer.Pin(id)
+	}
+	lrukReplacer.Unpin(1)
+	lrukReplacer.Unpin(2)
+	lrukReplacer.PinWithoutAccess(1)
+	testingpkg.Equals(t, uint32(1), lrukReplacer.Size())
+	lrukReplacer.Unpin(1)
+	value = lrukReplacer.Victim()
+	testingpkg.Equals(t, FrameID(1), *value)
+
+	// Scenario: history of removed frame is not inherited by the page loaded to the frame next
+	lrukReplacer.Pin(3)
+	lrukReplacer.Pin(3)
+	lrukReplacer.Unpin(3)
+	lrukReplacer.Remove(2)
+	testingpkg.Equals(t, uint32(1), lrukReplacer.Size())
+	lrukReplacer.Pin(2)
+	lrukReplacer.Unpin(2)
+	value = lrukReplacer.Victim()
+	testingpkg.Equals(t, FrameID(2), *value)
+	value = lrukReplacer.Victim()
+	testingpkg.Equals(t, FrameID(3), *value)
+}
@@ -0,0 +1,51 @@
+package buffer
+
+/**
+ * Replacer decides a frame whose page is cached out when the buffer pool has no free frame.
+ * Pin is called at every access to a frame (including the first access after a page is loaded to it)
+ * and Unpin is called when pin count of the page becomes zero. only unpinned frames can be victims.
+ */
+type Replacer interface {
+	// Victim removes the victim frame as defined by the replacement policy. nil is returned when no frame can be victim
+	Victim() *FrameID
+	// Pin pins a frame, indicating that it should not be victimized until it is unpinned
+	Pin(id FrameID)
+	// PinWithoutAccess pins a frame like Pin but it is not counted as an access
+	// (ex: a dirty page is pinned only for being written back by checkpoint)
+	PinWithoutAccess(id FrameID)
+	// Unpin unpins a frame, indicating that it can now be victimized
+	Unpin(id FrameID)
+	// UnpinPrefetched makes a frame whose page is loaded by read-ahead victim candidate.
+	// loading is not counted as an access (the first Pin after this is the first access of the page)
+	UnpinPrefetched(id FrameID)
+	// Remove forgets a frame whose page is discarded (ex: DeletePage). access history of the frame is cleared,
+	// so a page loaded to the frame next is not treated as accessed before
+	Remove(id FrameID)
+	// Size returns the number of frames which can be victim
+	Size() uint32
+}
+
+type ReplacerKind int32
+
+const (
+	REPLACER_KIND_CLOCK ReplacerKind = iota
+	REPLACER_KIND_LRU_K
+	REPLACER_KIND_2Q
+)
+
+// K of LRU-K replacer which is created by NewReplacer
+const DefaultLRUK = 2
+
+// NewReplacer instantiates a replacer of specified kind
+func NewReplacer(kind ReplacerKind, poolSize uint32) Replacer {
+	switch kind {
+	case REPLACER_KIND_CLOCK:
+		return NewClockReplacer(poolSize)
+	case REPLACER_KIND_LRU_K:
+		return NewLRUKReplacer(poolSize, DefaultLRUK)
+	case REPLACER_KIND_2Q:
+		return NewTwoQReplacer(poolSize)
+	default:
+		panic("invalid replacer kind!")
+	}
+}
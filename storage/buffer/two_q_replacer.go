@@ -0,0 +1,159 @@
+package buffer
+
+import (
+	"sync"
+)
+
+/**
+ * TwoQReplacer implements the simplified 2Q replacement policy (Johnson and Shasha, VLDB '94).
+ * a frame accessed first after its page is loaded is put on the A1 queue (FIFO)
+ * and moved to the Am queue (LRU) when it is accessed again.
+ * while A1 is larger than its threshold the victim is taken from A1, so pages read only once
+ * (by a sequential scan for example) don't evict hot pages on Am.
+ * ghost entries of the full version are not kept because a replacer only knows frames (not pages).
+ */
+type TwoQReplacer struct {
+	a1Threshold int
+	// number of frames on A1 (including pinned ones)
+	a1Len   int
+	entries map[FrameID]*twoQEntry
+	// evictable frames on each queue ordered by the time they were put at the back of the queue
+	evictableA1 *frameHeap
+	evictableAm *frameHeap
+	currentTs   uint64
+	mutex       *sync.Mutex
+}
+
+type twoQEntry struct {
+	isAm bool
+	// loaded by read-ahead and not accessed yet
+	isPrefetched bool
+	// time when the frame was put at the back of its queue
+	ts uint64
+}
+
+func (r *TwoQReplacer) recordAccess(id FrameID) {
+	r.currentTs++
+	entry, ok := r.entries[id]
+	if !ok {
+		r.entries[id] = &twoQEntry{false, false, r.currentTs}
+		r.a1Len++
+		return
+	}
+
+	if entry.isPrefetched {
+		// the first access. the frame stays on A1
+		entry.isPrefetched = false
+	} else if !entry.isAm {
+		r.a1Len--
+		entry.isAm = true
+	}
+	entry.ts = r.currentTs
+}
+
+// makes a frame victim candidate on the queue where it is
+func (r *TwoQReplacer) addEvictable(id FrameID) {
+	entry := r.entries[id]
+	if entry.isAm {
+		r.evictableAm.add(id, frameKey{0, entry.ts})
+	} else {
+		r.evictableA1.add(id, frameKey{0, entry.ts})
+	}
+}
+
+func (r *TwoQReplacer) removeEvictable(id FrameID) {
+	r.evictableA1.remove(id)
+	r.evictableAm.remove(id)
+}
+
+// Victim removes the victim frame as defined by the replacement policy
+func (r *TwoQReplacer) Victim() *FrameID {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	first, second := r.evictableAm, r.evictableA1
+	if r.a1Len > r.a1Threshold {
+		first, second = r.evictableA1, r.evictableAm
+	}
+
+	frameID := first.popMin()
+	if frameID == nil {
+		frameID = second.popMin()
+	}
+	if frameID == nil {
+		return nil
+	}
+
+	if !r.entries[*frameID].isAm {
+		r.a1Len--
+	}
+	delete(r.entries, *frameID)
+	return frameID
+}
+
+// Pin pins a frame, indicating that it should not be victimized until it is unpinned
+func (r *TwoQReplacer) Pin(id FrameID) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.removeEvictable(id)
+	r.recordAccess(id)
+}
+
+// PinWithoutAccess pins a frame without recording an access (the frame is not moved between queues)
+func (r *TwoQReplacer) PinWithoutAccess(id FrameID) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.removeEvictable(id)
+}
+
+// Unpin unpins a frame, indicating that it can now be victimized
+func (r *TwoQReplacer) Unpin(id FrameID) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.entries[id]; !ok {
+		r.recordAccess(id)
+	}
+	r.addEvictable(id)
+}
+
+// UnpinPrefetched puts a frame loaded by read-ahead on A1 without recording an access
+// (the first access does not move it to Am)
+func (r *TwoQReplacer) UnpinPrefetched(id FrameID) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.entries[id]; !ok {
+		r.currentTs++
+		r.entries[id] = &twoQEntry{false, true, r.currentTs}
+		r.a1Len++
+	}
+	r.addEvictable(id)
+}
+
+// Remove forgets a frame whose page is discarded. it is removed from its queue
+func (r *TwoQReplacer) Remove(id FrameID) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.removeEvictable(id)
+	if entry, ok := r.entries[id]; ok {
+		if !entry.isAm {
+			r.a1Len--
+		}
+		delete(r.entries, id)
+	}
+}
+
+// Size returns the number of frames which can be victim
+func (r *TwoQReplacer) Size() uint32 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return uint32(r.evictableA1.Len() + r.evictableAm.Len())
+}
+
+// NewTwoQReplacer instantiates a new 2Q replacer. threshold of A1 is 25% of the pool (recommended value in the paper)
+func NewTwoQReplacer(poolSize uint32) *TwoQReplacer {
+	a1Threshold := int(poolSize / 4)
+	if a1Threshold < 1 {
+		a1Threshold = 1
+	}
+	return &TwoQReplacer{a1Threshold, 0, make(map[FrameID]*twoQEntry, poolSize), newFrameHeap(poolSize), newFrameHeap(poolSize), 0, new(sync.Mutex)}
+}
@@ -0,0 +1,71 @@
+package buffer
+
+import (
+	"testing"
+
+	testingpkg "github.com/ryogrid/SamehadaDB/testing"
+)
+
+func TestTwoQReplacer(t *testing.T) {
+	// threshold of A1 is 2
+	twoQReplacer := NewTwoQReplacer(8)
+
+	// Scenario: 1 and 2 are accessed twice and moved to Am. others stay on A1
+	for _, id := range []FrameID{1, 2, 3, 4, 5, 6, 2, 1} {
+		twoQReplacer.Pin(id)
+	}
+	for id := FrameID(1); id <= 6; id++ {
+		twoQReplacer.Unpin(id)
+	}
+	testingpkg.Equals(t, uint32(6), twoQReplacer.Size())
+
+	// Scenario: while A1 is larger than the threshold, victims are taken from A1 in FIFO order
+	var value *FrameID
+	value = twoQReplacer.Victim()
+	testingpkg.Equals(t, FrameID(3), *value)
+	value = twoQReplacer.Victim()
+	testingpkg.Equals(t, FrameID(4), *value)
+
+	// Scenario: A1 is not larger than the threshold. the least recently used frame on Am is victim
+	value = twoQReplacer.Victim()
+	testingpkg.Equals(t, FrameID(2), *value)
+
+	// Scenario: pinned frame is not victim. Am has only pinned frame, so A1 is used
+	twoQReplacer.Pin(1)
+	value = twoQReplacer.Victim()
+	testingpkg.Equals(t, FrameID(5), *value)
+	twoQReplacer.Unpin(1)
+	value = twoQReplacer.Victim()
+	testingpkg.Equals(t, FrameID(1), *value)
+	value = twoQReplacer.Victim()
+	testingpkg.Equals(t, FrameID(6), *value)
+
+	// Scenario: no frame can be victim
+	testingpkg.Equals(t, (*FrameID)(nil), twoQReplacer.Victim())
+
+	// Scenario: pinning without access (ex: write back by checkpoint) does not move frame to Am
+	for _, id := range []FrameID{1, 2, 3} {
+		twoQReplacer.Pin(id)
+		twoQReplacer.Unpin(id)
+	}
+	twoQReplacer.PinWithoutAccess(1)
+	twoQReplacer.Unpin(1)
+	twoQReplacer.Pin(4)
+	twoQReplacer.Unpin(4)
+	value = twoQReplacer.Victim()
+	testingpkg.Equals(t, FrameID(1), *value)
+
+	// Scenario: removed frame is not on the queues. the page loaded to the frame next starts on A1
+	twoQReplacer.Pin(2)
+	twoQReplacer.Unpin(2)
+	twoQReplacer.Remove(2)
+	testingpkg.Equals(t, uint32(2), twoQReplacer.Size())
+	twoQReplacer.Pin(2)
+	twoQReplacer.Unpin(2)
+	value = twoQReplacer.Victim()
+	testingpkg.Equals(t, FrameID(3), *value)
+	value = twoQReplacer.Victim()
+	testingpkg.Equals(t, FrameID(4), *value)
+	value = twoQReplacer.Victim()
+	testingpkg.Equals(t, FrameID(2), *value)
+}
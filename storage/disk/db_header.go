@@ -0,0 +1,353 @@
+package disk
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/storage/page"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+/**
+ * DBHeader is stored at the head of db file and a region of the page size of the db is reserved for it.
+ * so page of PageID n is stored at offset (n + 1) * page size.
+ * header is read before page size is known. so its fields are placed in the first dbHeaderSize bytes.
+ *
+ * header format (size in byte):
+ * ----------------------------------------------------------------------------------------
+ * | Magic (8) | Checksum (4) | PageSize (4) | FormatVersion (4) | TableCatalogPageId (4) |
+ * ----------------------------------------------------------------------------------------
+ * | ColumnsCatalogPageId (4) | CreatedAt (8) | IsShutDownCleanly (4) |
+ * --------------------------------------------------------------------
+ * Checksum is CRC32C of the first dbHeaderSize bytes (checksum field is treated as zero)
+ * CreatedAt is unix time in nano seconds
+ * IsShutDownCleanly is 1 when all pages were written at last shutdown. it is cleared at open.
+ * (it is 0 in files written before the field was added. they are treated as crashed)
+ */
+type DBHeader struct {
+	FormatVersion uint32
+	PageSize      int
+	// zero value when it is unknown (db file was created with format version 0)
+	CreatedAt time.Time
+	// first pages of system catalogs. InvalidPageID until catalog is bootstrapped
+	TableCatalogPageId   types.PageID
+	ColumnsCatalogPageId types.PageID
+	// false while db is opened and after crash
+	IsShutDownCleanly bool
+}
+
+// DBFormatVersion is the format version of db files which are written by this code.
+// db file of older version is migrated at open (see RegisterDBFormatMigration)
+const DBFormatVersion = 2
+
+const dbHeaderMagic = "SAMEHADA"
+const dbHeaderSize = 512
+
+const (
+	offsetDBHeaderMagic                = 0
+	offsetDBHeaderChecksum             = 8
+	offsetDBHeaderPageSize             = 12
+	offsetDBHeaderFormatVersion        = 16
+	offsetDBHeaderTableCatalogPageId   = 20
+	offsetDBHeaderColumnsCatalogPageId = 24
+	offsetDBHeaderCreatedAt            = 28
+	offsetDBHeaderIsShutDownCleanly    = 36
+)
+
+// ErrNotSamehadaDBFile is returned when magic number is not found at the head of db file
+var ErrNotSamehadaDBFile = errors.New("db file does not have header of SamehadaDB (magic number mismatch)")
+
+// ErrPreChecksumDBFile is returned for header-less db file written before checksum field was added to page header.
+// page header was widened from 8 to 12 bytes and data of each page type was moved. pages can't be converted
+// without knowing their types, so such file is not migrated. data must be exported with older version of SamehadaDB
+var ErrPreChecksumDBFile = errors.New("db file was written before page checksum was added and it can't be opened")
+
+// offset of PrevPageId of table page in page format before checksum was added
+const offsetPreChecksumPrevPageId = 8
+
+/**
+ * DBHeaderCorruptionError is returned when checksum in header of db file does not match its content
+ */
+type DBHeaderCorruptionError struct {
+	StoredChecksum uint32
+	ActualChecksum uint32
+}
+
+func (e *DBHeaderCorruptionError) Error() string {
+	return fmt.Sprintf("header of db file is corrupted (stored checksum: %08x, actual checksum: %08x)", e.StoredChecksum, e.ActualChecksum)
+}
+
+/**
+ * DBFormatVersionError is returned when db file is written in format version which can not be handled.
+ * it is newer than DBFormatVersion or migration from it is not registered
+ */
+type DBFormatVersionError struct {
+	FileVersion      uint32
+	SupportedVersion uint32
+}
+
+func (e *DBFormatVersionError) Error() string {
+	if e.FileVersion > e.SupportedVersion {
+		return fmt.Sprintf("format version of db file (%d) is newer than supported version (%d)", e.FileVersion, e.SupportedVersion)
+	}
+	return fmt.Sprintf("format version of db file (%d) can not be migrated to supported version (%d)", e.FileVersion, e.SupportedVersion)
+}
+
+/**
+ * PageSizeMismatchError is returned when page size recorded in db file differs from requested one
+ */
+type PageSizeMismatchError struct {
+	FilePageSize      int
+	RequestedPageSize int
+}
+
+func (e *PageSizeMismatchError) Error() string {
+	return fmt.Sprintf("page size of db file (%d) differs from requested page size (%d)", e.FilePageSize, e.RequestedPageSize)
+}
+
+/**
+ * DBFormatMigration converts db file of format version header.FormatVersion to the next version.
+ * it updates pages in file and fields of header as needed. FormatVersion is incremented by caller
+ * and header is written to file after all migrations are done.
+ */
+type DBFormatMigration func(file *os.File, header *DBHeader) error
+
+// key is the format version which migration converts from.
+// db files written before header was added are converted to format version 0 by migrateHeaderlessDBFile
+// before these migrations are applied
+var dbFormatMigrations = map[uint32]DBFormatMigration{
+	0: migrateDBFormatV0,
+	1: migrateDBFormatV1,
+}
+
+// RegisterDBFormatMigration registers migration from fromVersion to fromVersion + 1.
+// it must be called before db files are opened (ex: init function of package which changes the format)
+func RegisterDBFormatMigration(fromVersion uint32, migration DBFormatMigration) {
+	dbFormatMigrations[fromVersion] = migration
+}
+
+// format version 0 header has only page size. catalogs are placed at the first and the second page
+func migrateDBFormatV0(file *os.File, header *DBHeader) error {
+	header.TableCatalogPageId = 0
+	header.ColumnsCatalogPageId = 1
+	return nil
+}
+
+// format version 2 changed format of tuples (null bitmap in tuple header instead of null flag of each value).
+// tuples can't be converted here because schemas of tables are needed. tuples of older format are readable
+// and they are converted after catalog is loaded (see Catalog::MigrateTupleFormat)
+func migrateDBFormatV1(file *os.File, header *DBHeader) error {
+	return nil
+}
+
+/**
+ * header-less db files were written before header was added. their pages have the default page size
+ * and page of PageID n is stored at offset n * page size. the file is copied to a temporary file
+ * after header of format version 0 and the copy replaces original file. so original file is kept as is
+ * when system crashes during the migration. nothing is done for db file which has header or does not exist.
+ * IsShutDownCleanly of the header is false. so log is replayed at open as after crash
+ */
+func migrateHeaderlessDBFile(dbFilename string) error {
+	file, err := os.Open(dbFilename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	isHeaderless, err := isHeaderlessDBFile(file, fileInfo.Size())
+	if err != nil || !isHeaderless {
+		return err
+	}
+
+	tmpFilename := dbFilename + ".migrating"
+	tmpFile, err := os.OpenFile(tmpFilename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFilename)
+	err = WriteDBHeader(tmpFile, newHeaderlessDBHeader())
+	if err == nil {
+		_, err = tmpFile.Seek(PageOffset(0, common.PageSize), io.SeekStart)
+	}
+	if err == nil {
+		_, err = io.Copy(tmpFile, file)
+	}
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("migration of header-less db file failed: %w", err)
+	}
+	if err = os.Rename(tmpFilename, dbFilename); err != nil {
+		return fmt.Errorf("migration of header-less db file failed: %w", err)
+	}
+	return nil
+}
+
+// header which is given to header-less db file. catalog root ids are set by migration from format version 0
+func newHeaderlessDBHeader() *DBHeader {
+	return &DBHeader{0, common.PageSize, time.Time{}, types.InvalidPageID, types.InvalidPageID, false}
+}
+
+// returns true when file is db file written before header was added.
+// page 0 (the first page of table catalog) is always written in it and its checksum is valid.
+// ErrPreChecksumDBFile is returned when page 0 is the first table page written before checksum was added
+// (its PageId is 0 and PrevPageId is InvalidPageID)
+func isHeaderlessDBFile(file *os.File, fileSize int64) (bool, error) {
+	if fileSize == 0 || fileSize%int64(common.PageSize) != 0 {
+		return false, nil
+	}
+	buf := make([]byte, common.PageSize)
+	if _, err := file.ReadAt(buf, 0); err != nil {
+		return false, err
+	}
+	if string(buf[offsetDBHeaderMagic:offsetDBHeaderMagic+len(dbHeaderMagic)]) == dbHeaderMagic || isZeroPage(buf) {
+		return false, nil
+	}
+	if verifyPageChecksum(0, buf) == nil {
+		return true, nil
+	}
+	if binary.LittleEndian.Uint32(buf[page.OffsetPageStart:]) == 0 &&
+		types.PageID(binary.LittleEndian.Uint32(buf[offsetPreChecksumPrevPageId:])) == types.InvalidPageID {
+		return false, ErrPreChecksumDBFile
+	}
+	return false, nil
+}
+
+// NewDBHeader returns header of db file which is newly created now
+func NewDBHeader(pageSize int) *DBHeader {
+	return &DBHeader{DBFormatVersion, pageSize, time.Now(), types.InvalidPageID, types.InvalidPageID, false}
+}
+
+// IsValidPageSize returns whether pageSize can be used as page size of a db
+func IsValidPageSize(pageSize int) bool {
+	return pageSize >= common.PageSize && pageSize <= common.MaxPageSize && pageSize&(pageSize-1) == 0
+}
+
+// returns header data of the size of page size (the region reserved for header)
+func serializeDBHeader(header *DBHeader) []byte {
+	buf := make([]byte, header.PageSize)
+	copy(buf[offsetDBHeaderMagic:], dbHeaderMagic)
+	binary.LittleEndian.PutUint32(buf[offsetDBHeaderPageSize:], uint32(header.PageSize))
+	binary.LittleEndian.PutUint32(buf[offsetDBHeaderFormatVersion:], header.FormatVersion)
+	binary.LittleEndian.PutUint32(buf[offsetDBHeaderTableCatalogPageId:], uint32(header.TableCatalogPageId))
+	binary.LittleEndian.PutUint32(buf[offsetDBHeaderColumnsCatalogPageId:], uint32(header.ColumnsCatalogPageId))
+	if !header.CreatedAt.IsZero() {
+		binary.LittleEndian.PutUint64(buf[offsetDBHeaderCreatedAt:], uint64(header.CreatedAt.UnixNano()))
+	}
+	if header.IsShutDownCleanly {
+		binary.LittleEndian.PutUint32(buf[offsetDBHeaderIsShutDownCleanly:], 1)
+	}
+	binary.LittleEndian.PutUint32(buf[offsetDBHeaderChecksum:], common.CalcChecksum(buf[:dbHeaderSize], offsetDBHeaderChecksum))
+	return buf
+}
+
+// data must have dbHeaderSize bytes at least.
+// header of older format version is returned as is when it can be migrated
+func deserializeDBHeader(data []byte) (*DBHeader, error) {
+	if string(data[offsetDBHeaderMagic:offsetDBHeaderMagic+len(dbHeaderMagic)]) != dbHeaderMagic {
+		return nil, ErrNotSamehadaDBFile
+	}
+	stored := binary.LittleEndian.Uint32(data[offsetDBHeaderChecksum:])
+	if actual := common.CalcChecksum(data[:dbHeaderSize], offsetDBHeaderChecksum); stored != actual {
+		return nil, &DBHeaderCorruptionError{stored, actual}
+	}
+	header := new(DBHeader)
+	header.FormatVersion = binary.LittleEndian.Uint32(data[offsetDBHeaderFormatVersion:])
+	if !isMigratable(header.FormatVersion) {
+		return nil, &DBFormatVersionError{header.FormatVersion, DBFormatVersion}
+	}
+	header.PageSize = int(binary.LittleEndian.Uint32(data[offsetDBHeaderPageSize:]))
+	if !IsValidPageSize(header.PageSize) {
+		return nil, fmt.Errorf("page size in header of db file is invalid: %d", header.PageSize)
+	}
+	header.TableCatalogPageId = types.PageID(binary.LittleEndian.Uint32(data[offsetDBHeaderTableCatalogPageId:]))
+	header.ColumnsCatalogPageId = types.PageID(binary.LittleEndian.Uint32(data[offsetDBHeaderColumnsCatalogPageId:]))
+	if createdAt := int64(binary.LittleEndian.Uint64(data[offsetDBHeaderCreatedAt:])); createdAt != 0 {
+		header.CreatedAt = time.Unix(0, createdAt)
+	}
+	header.IsShutDownCleanly = binary.LittleEndian.Uint32(data[offsetDBHeaderIsShutDownCleanly:]) == 1
+	return header, nil
+}
+
+// returns true when db file of version can be handled (migrations to DBFormatVersion are registered)
+func isMigratable(version uint32) bool {
+	if version > DBFormatVersion {
+		return false
+	}
+	for ; version < DBFormatVersion; version++ {
+		if _, ok := dbFormatMigrations[version]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// applies migrations to header of older format version. header is not written to file here
+func migrateDBFormat(file *os.File, header *DBHeader) error {
+	for header.FormatVersion < DBFormatVersion {
+		if err := dbFormatMigrations[header.FormatVersion](file, header); err != nil {
+			return fmt.Errorf("migration of db file from format version %d failed: %w", header.FormatVersion, err)
+		}
+		header.FormatVersion++
+	}
+	return nil
+}
+
+// ReadDBHeader reads and validates header of the db file without opening it as db.
+// for header-less db file, header of format version 0 which is written at its migration is returned
+func ReadDBHeader(dbFilename string) (*DBHeader, error) {
+	file, err := os.Open(dbFilename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, dbHeaderSize)
+	if _, err = io.ReadFull(file, buf); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrNotSamehadaDBFile
+		}
+		return nil, err
+	}
+	header, err := deserializeDBHeader(buf)
+	if err == ErrNotSamehadaDBFile {
+		fileInfo, err2 := file.Stat()
+		if err2 != nil {
+			return nil, err2
+		}
+		isHeaderless, err2 := isHeaderlessDBFile(file, fileInfo.Size())
+		if err2 != nil {
+			return nil, err2
+		}
+		if isHeaderless {
+			return newHeaderlessDBHeader(), nil
+		}
+	}
+	return header, err
+}
+
+// WriteDBHeader writes header to the head of db file which is made without DiskManager (ex: backup)
+func WriteDBHeader(file io.WriterAt, header *DBHeader) error {
+	_, err := file.WriteAt(serializeDBHeader(header), 0)
+	return err
+}
+
+// PageOffset returns offset of the page in db file whose page size is pageSize
+func PageOffset(pageID types.PageID, pageSize int) int64 {
+	return (int64(pageID) + 1) * int64(pageSize)
+}
@@ -0,0 +1,11 @@
+//go:build linux
+
+package disk
+
+import "syscall"
+
+// flag for opening db file without page cache of OS
+const oDirect = syscall.O_DIRECT
+
+// buffers and offsets of I/O with O_DIRECT must be aligned with this (logical block size)
+const directIOAlignment = 4096
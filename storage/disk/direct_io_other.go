@@ -0,0 +1,8 @@
+//go:build !linux
+
+package disk
+
+// O_DIRECT is not supported on this platform. db file is accessed through page cache of OS
+const oDirect = 0
+
+const directIOAlignment = 4096
@@ -14,16 +14,49 @@ import (
 type DiskManager interface {
 	ReadPage(types.PageID, []byte) error
 	WritePage(types.PageID, []byte) error
+	// page in free page list is reused first
 	AllocatePage() types.PageID
+	// add page to free page list
 	DeallocatePage(types.PageID)
+	// undo the last AllocatePage call (used when the allocated page can not be cached on buffer pool)
+	CancelAllocatePage(pageID types.PageID, isReused bool)
+	// free page list is kept on memory. it is persisted with log records and checkpoint record and
+	// rebuilt at recovery (see LogRecovery::analyze)
+	GetFreePageIds() []types.PageID
+	SetFreePageIds([]types.PageID)
+	GetNumFreePages() int
 	GetNumWrites() uint64
+	// number of writes of log data (each of them is done with fsync)
+	GetNumFlushes() uint64
 	ShutDown()
+	// size of the region of pages in byte
 	Size() int64
+	// page size of the db. length of page data passed to ReadPage and WritePage is this
+	GetPageSize() int
+	// header of db file (format version, page size, creation time and first pages of system catalogs)
+	GetDBHeader() DBHeader
+	// first pages of system catalogs are recorded to header (called when catalog is bootstrapped)
+	SetCatalogRootPageIds(tableCatalogPageId types.PageID, columnsCatalogPageId types.PageID)
+	// whether all pages were written at last shutdown. false after crash
+	// (flag in header of db file is cleared at open and it is set with MarkShutDownCleanly)
+	WasShutDownCleanly() bool
+	// records to header of db file that all pages are written (called at shutdown)
+	MarkShutDownCleanly()
 	RemoveDBFile()
 	RemoveLogFile()
 	//WriteLog([]byte, int32)
-	WriteLog([]byte)
+	// log data and LSN of the first and the last log record in it
+	WriteLog([]byte, types.LSN, types.LSN)
 	ReadLog([]byte, int32, *uint32) bool
 	GetLogFileSize() int64
-	GCLogFile() error
+	// total size of log segment files
+	GetLogDiskUsage() int64
+	// delete (or move to archive directory) log segments which have only log records older than passed LSN
+	TruncateLogBefore(types.LSN)
+	SetLogArchiveDir(string)
+	// discard log data at passed offset and after it (used at point-in-time recovery)
+	DiscardLogAfter(uint32)
+	// master record: offset in log file of the last complete checkpoint (-1 means no checkpoint)
+	WriteLastCheckpointOffset(int32)
+	ReadLastCheckpointOffset() int32
 }
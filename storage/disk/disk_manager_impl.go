@@ -4,13 +4,16 @@
 package disk
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"unsafe"
 
 	"github.com/ryogrid/SamehadaDB/common"
 	"github.com/ryogrid/SamehadaDB/types"
@@ -29,14 +32,67 @@ type DiskManagerImpl struct {
 	numFlushes   uint64
 	dbFileMutex  *sync.Mutex
 	logFileMutex *sync.Mutex
+	// file which stores offset of the last complete checkpoint in log file
+	fileName_ckpt string
+	// segments of log in order of offset. the last one is the active segment (written to log)
+	log_segments []*logSegment
+	// sealed segments which are truncated are moved to this directory (deleted when empty)
+	log_archive_dir string
+	// deallocated pages which can be reused
+	free_page_ids []types.PageID
+	// db file is opened with O_DIRECT (page cache of OS is bypassed)
+	isDirectIO bool
+	// page size of the db (recorded in header of db file)
+	pageSize int
+	// header of db file. updates are written to file with dbFileMutex
+	header *DBHeader
+	// value of IsShutDownCleanly in header at open
+	wasShutDownCleanly bool
 }
 
-// NewDiskManagerImpl returns a DiskManager instance
-func NewDiskManagerImpl(dbFilename string) DiskManager {
-	file, err := os.OpenFile(dbFilename, os.O_RDWR|os.O_CREATE, 0666)
+// NewDiskManagerImpl returns a DiskManager instance. new db file has the default page size.
+// error is returned when files can't be opened or header of db file is invalid
+func NewDiskManagerImpl(dbFilename string) (DiskManager, error) {
+	return newDiskManagerImpl(dbFilename, common.PageSize, false)
+}
+
+// NewDiskManagerImplWithPageSize returns a DiskManager instance. pageSize is used when db file is newly created.
+// existing db file is accessed with page size recorded in its header
+func NewDiskManagerImplWithPageSize(dbFilename string, pageSize int) (DiskManager, error) {
+	return newDiskManagerImpl(dbFilename, pageSize, false)
+}
+
+// NewDiskManagerImplWithDirectIO returns a DiskManager instance which reads and writes db file with O_DIRECT.
+// when the platform or the file system does not support O_DIRECT, db file is opened as usual
+func NewDiskManagerImplWithDirectIO(dbFilename string) (DiskManager, error) {
+	return newDiskManagerImpl(dbFilename, common.PageSize, true)
+}
+
+// header-less db file (written before header was added) is migrated before it is opened
+func newDiskManagerImpl(dbFilename string, pageSize int, isDirectIO bool) (DiskManager, error) {
+	if !IsValidPageSize(pageSize) {
+		return nil, fmt.Errorf("invalid page size: %d", pageSize)
+	}
+	if err := migrateHeaderlessDBFile(dbFilename); err != nil {
+		return nil, err
+	}
+
+	var file *os.File
+	var err error
+	if isDirectIO && oDirect != 0 {
+		file, err = os.OpenFile(dbFilename, os.O_RDWR|os.O_CREATE|oDirect, 0666)
+		if err != nil {
+			// ex: tmpfs returns EINVAL
+			isDirectIO = false
+		}
+	} else {
+		isDirectIO = false
+	}
+	if !isDirectIO {
+		file, err = os.OpenFile(dbFilename, os.O_RDWR|os.O_CREATE, 0666)
+	}
 	if err != nil {
-		log.Fatalln("can't open db file")
-		return nil
+		return nil, fmt.Errorf("can't open db file: %w", err)
 	}
 
 	period_idx := strings.LastIndex(dbFilename, ".")
@@ -44,33 +100,117 @@ func NewDiskManagerImpl(dbFilename string) DiskManager {
 	logfname := logfname_base + "." + "log"
 	file_1, err := os.OpenFile(logfname, os.O_RDWR|os.O_CREATE, 0666)
 	if err != nil {
-		log.Fatalln("can't open log file")
-		return nil
+		file.Close()
+		return nil, fmt.Errorf("can't open log file: %w", err)
 	}
+	// files are closed when initialization fails
+	isInitialized := false
+	defer func() {
+		if !isInitialized {
+			file.Close()
+			file_1.Close()
+		}
+	}()
 
 	fileInfo, err := file.Stat()
 	if err != nil {
-		log.Fatalln("file info error")
-		return nil
+		return nil, fmt.Errorf("file info error: %w", err)
 	}
 
 	fileInfo_1, err := file_1.Stat()
 	if err != nil {
-		log.Fatalln("file info error (log file)")
-		return nil
+		return nil, fmt.Errorf("file info error (log file): %w", err)
+	}
+
+	log_segments := listSealedLogSegments(logfname)
+	active := &logSegment{logfname, 0, 0, common.InvalidLSN, common.InvalidLSN, nil}
+	if len(log_segments) > 0 {
+		active.start_offset = log_segments[len(log_segments)-1].endOffset()
+	}
+	if fileInfo_1.Size() >= logSegmentHeaderSize {
+		header := make([]byte, logSegmentHeaderSize)
+		if _, err = file_1.ReadAt(header, 0); err != nil {
+			return nil, fmt.Errorf("read of log segment header failed: %w", err)
+		}
+		deserializeLogSegmentHeader(header, active)
+		active.size = fileInfo_1.Size() - logSegmentHeaderSize
+	} else {
+		// header is written with the first log data
+		file_1.Truncate(0)
+	}
+	log_segments = append(log_segments, active)
+
+	file_1.Seek(0, io.SeekEnd)
+
+	ckptfname := logfname_base + "." + "ckpt"
+	if len(log_segments) == 1 && active.size == 0 {
+		// checkpoint location is meaningless without log data
+		os.Remove(ckptfname)
+	}
+
+	header, err := initDBHeader(file, fileInfo.Size(), pageSize, isDirectIO)
+	if err != nil {
+		return nil, err
+	}
+	wasShutDownCleanly := header.IsShutDownCleanly
+	if wasShutDownCleanly {
+		// pages on file may be inconsistent after crash of this launch
+		header.IsShutDownCleanly = false
+		if err = writeDBHeader(file, header, isDirectIO); err != nil {
+			return nil, err
+		}
+	}
+	pageSize = header.PageSize
+	// size of the region of pages (header is not included)
+	fileSize := fileInfo.Size() - int64(pageSize)
+	if fileSize < 0 {
+		fileSize = 0
 	}
+	nPages := fileSize / int64(pageSize)
 
-	file_1.Seek(fileInfo_1.Size(), io.SeekStart)
+	// pages of PageID 0 to nPages - 1 are on the file
+	nextPageID := types.PageID(int32(nPages))
 
-	fileSize := fileInfo.Size()
-	nPages := fileSize / common.PageSize
+	isInitialized = true
+	return &DiskManagerImpl{file, dbFilename, file_1, logfname, nextPageID, 0, fileSize, false, 0, new(sync.Mutex), new(sync.Mutex), ckptfname, log_segments, "", make([]types.PageID, 0), isDirectIO, pageSize, header, wasShutDownCleanly}, nil
+}
 
-	nextPageID := types.PageID(0)
-	if nPages > 0 {
-		nextPageID = types.PageID(int32(nPages + 1))
+// writes header to empty db file or reads and validates header of existing db file.
+// db file of older format version is migrated to current version here
+func initDBHeader(file *os.File, fileSize int64, pageSize int, isDirectIO bool) (*DBHeader, error) {
+	if fileSize == 0 {
+		header := NewDBHeader(pageSize)
+		return header, writeDBHeader(file, header, isDirectIO)
+	}
+
+	// header is placed in the range of minimum page size
+	buf := alignedBuf(common.PageSize, isDirectIO)
+	if _, err := file.ReadAt(buf, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	header, err := deserializeDBHeader(buf)
+	if err != nil {
+		return nil, err
 	}
+	if header.FormatVersion < DBFormatVersion {
+		if err = migrateDBFormat(file, header); err != nil {
+			return nil, err
+		}
+		if err = writeDBHeader(file, header, isDirectIO); err != nil {
+			return nil, err
+		}
+	}
+	return header, nil
+}
 
-	return &DiskManagerImpl{file, dbFilename, file_1, logfname, nextPageID, 0, fileSize, false, 0, new(sync.Mutex), new(sync.Mutex)}
+// writes header to db file and makes it durable
+func writeDBHeader(file *os.File, header *DBHeader, isDirectIO bool) error {
+	buf := alignedBuf(header.PageSize, isDirectIO)
+	copy(buf, serializeDBHeader(header))
+	if _, err := file.WriteAt(buf, 0); err != nil {
+		return err
+	}
+	return file.Sync()
 }
 
 // ShutDown closes of the database file
@@ -91,69 +231,153 @@ func (d *DiskManagerImpl) ShutDown() {
 	d.logFileMutex.Unlock()
 }
 
-// Write a page to the database file
+// Write a page to the database file.
+// pages are written with pwrite and dbFileMutex is not acquired (writes to different pages can run in parallel)
 func (d *DiskManagerImpl) WritePage(pageId types.PageID, pageData []byte) error {
-	d.dbFileMutex.Lock()
-	defer d.dbFileMutex.Unlock()
-
-	offset := int64(pageId * common.PageSize)
-	d.db.Seek(offset, io.SeekStart)
-	bytesWritten, err := d.db.Write(pageData)
+	offset := PageOffset(pageId, d.pageSize)
+	// page data of caller is not modified
+	data := d.allocPageBuf()
+	copy(data, pageData)
+	SetPageChecksum(data)
+	bytesWritten, err := d.db.WriteAt(data, offset)
 	if err != nil {
 		fmt.Println(err)
-		panic("WritePge: d.db.Write returns err!")
+		panic("WritePge: d.db.WriteAt returns err!")
 		//return err
 	}
 
-	if bytesWritten != common.PageSize {
+	if bytesWritten != d.pageSize {
 		panic("bytes written not equals page size")
 		//return errors.New("bytes written not equals page size")
 	}
 
-	if offset >= d.size {
-		d.size = offset + int64(bytesWritten)
+	newSize := offset - int64(d.pageSize) + int64(bytesWritten)
+	for curSize := atomic.LoadInt64(&d.size); newSize > curSize; curSize = atomic.LoadInt64(&d.size) {
+		if atomic.CompareAndSwapInt64(&d.size, curSize, newSize) {
+			break
+		}
 	}
+	atomic.AddUint64(&d.numWrites, 1)
 
 	d.db.Sync()
 	return nil
 }
 
-// Read a page from the database file
+// Read a page from the database file.
+// pages are read with pread and dbFileMutex is not acquired (reads can run in parallel)
 func (d *DiskManagerImpl) ReadPage(pageID types.PageID, pageData []byte) error {
+	offset := PageOffset(pageID, d.pageSize)
+
+	if offset-int64(d.pageSize) > atomic.LoadInt64(&d.size) {
+		return errors.New("I/O error past end of file")
+	}
+
+	buf := pageData
+	if d.isDirectIO {
+		buf = d.allocPageBuf()
+	}
+	bytesRead, err := d.db.ReadAt(buf[:d.pageSize], offset)
+	if err != nil && err != io.EOF {
+		return errors.New("I/O error while reading")
+	}
+	if d.isDirectIO {
+		copy(pageData, buf[:bytesRead])
+	}
+
+	if bytesRead == 0 {
+		// page has not been written
+		for i := 0; i < d.pageSize; i++ {
+			pageData[i] = 0
+		}
+		return nil
+	}
+	if bytesRead < d.pageSize {
+		// tail of file was written partially
+		for i := bytesRead; i < d.pageSize; i++ {
+			pageData[i] = 0
+		}
+	}
+	return verifyPageChecksum(pageID, pageData)
+}
+
+// returns buffer for a page. the buffer is aligned for O_DIRECT when it is used
+func (d *DiskManagerImpl) allocPageBuf() []byte {
+	return alignedBuf(d.pageSize, d.isDirectIO)
+}
+
+// returns buffer of size bytes. the buffer is aligned for O_DIRECT when isDirectIO is true
+func alignedBuf(size int, isDirectIO bool) []byte {
+	if !isDirectIO {
+		return make([]byte, size)
+	}
+	buf := make([]byte, size+directIOAlignment)
+	gap := int(uintptr(unsafe.Pointer(&buf[0])) & uintptr(directIOAlignment-1))
+	if gap != 0 {
+		gap = directIOAlignment - gap
+	}
+	return buf[gap : gap+size]
+}
+
+// GetDBHeader returns a copy of header of db file
+func (d *DiskManagerImpl) GetDBHeader() DBHeader {
 	d.dbFileMutex.Lock()
 	defer d.dbFileMutex.Unlock()
+	return *d.header
+}
 
-	offset := int64(pageID * common.PageSize)
+// SetCatalogRootPageIds records first pages of system catalogs to header of db file
+func (d *DiskManagerImpl) SetCatalogRootPageIds(tableCatalogPageId types.PageID, columnsCatalogPageId types.PageID) {
+	d.dbFileMutex.Lock()
+	defer d.dbFileMutex.Unlock()
 
-	fileInfo, err := d.db.Stat()
-	if err != nil {
+	d.header.TableCatalogPageId = tableCatalogPageId
+	d.header.ColumnsCatalogPageId = columnsCatalogPageId
+	if err := writeDBHeader(d.db, d.header, d.isDirectIO); err != nil {
 		fmt.Println(err)
-		return errors.New("file info error")
+		panic("write of db file header failed")
 	}
+}
 
-	if offset > fileInfo.Size() {
-		return errors.New("I/O error past end of file")
-	}
+// WasShutDownCleanly returns whether all pages were written at last shutdown
+func (d *DiskManagerImpl) WasShutDownCleanly() bool {
+	return d.wasShutDownCleanly
+}
 
-	d.db.Seek(offset, io.SeekStart)
+// MarkShutDownCleanly records to header of db file that all pages are written.
+// pages must not be written after this call
+func (d *DiskManagerImpl) MarkShutDownCleanly() {
+	d.dbFileMutex.Lock()
+	defer d.dbFileMutex.Unlock()
 
-	bytesRead, err := d.db.Read(pageData)
-	if err != nil {
-		return errors.New("I/O error while reading")
+	d.header.IsShutDownCleanly = true
+	if err := writeDBHeader(d.db, d.header, d.isDirectIO); err != nil {
+		fmt.Println(err)
+		panic("write of db file header failed")
 	}
+}
 
-	if bytesRead < common.PageSize {
-		for i := 0; i < common.PageSize; i++ {
-			pageData[i] = 0
-		}
-	}
-	return nil
+// GetPageSize returns page size of the db
+func (d *DiskManagerImpl) GetPageSize() int {
+	return d.pageSize
+}
+
+// IsDirectIO returns whether db file is accessed with O_DIRECT
+func (d *DiskManagerImpl) IsDirectIO() bool {
+	return d.isDirectIO
 }
 
 // AllocatePage allocates a new page
 func (d *DiskManagerImpl) AllocatePage() types.PageID {
 	d.dbFileMutex.Lock()
 
+	if len(d.free_page_ids) > 0 {
+		// reuse deallocated page
+		ret := d.free_page_ids[len(d.free_page_ids)-1]
+		d.free_page_ids = d.free_page_ids[:len(d.free_page_ids)-1]
+		d.dbFileMutex.Unlock()
+		return ret
+	}
+
 	ret := d.nextPageID
 
 	//// extend db file for avoiding later ReadPage and WritePage fails
@@ -168,21 +392,79 @@ func (d *DiskManagerImpl) AllocatePage() types.PageID {
 	return ret
 }
 
-// DeallocatePage deallocates page
-// Need bitmap in header page for tracking pages
-// This does not actually need to do anything for now.
-func (d *DiskManagerImpl) DeallocatePage(pageID types.PageID) {}
+// CancelAllocatePage undoes the last AllocatePage call which returned pageID (isReused is true when
+// the page was taken from free page list). caller must guarantee that no page is allocated after the call
+func (d *DiskManagerImpl) CancelAllocatePage(pageID types.PageID, isReused bool) {
+	d.dbFileMutex.Lock()
+	defer d.dbFileMutex.Unlock()
+
+	if !isReused {
+		d.nextPageID--
+		return
+	}
+	// reused page is pushed back to the position it was popped from
+	d.free_page_ids = append(d.free_page_ids, pageID)
+}
+
+// DeallocatePage adds page to free page list. the page is reused by AllocatePage
+func (d *DiskManagerImpl) DeallocatePage(pageID types.PageID) {
+	d.dbFileMutex.Lock()
+	defer d.dbFileMutex.Unlock()
+
+	for _, freePageId := range d.free_page_ids {
+		if freePageId == pageID {
+			// already deallocated
+			return
+		}
+	}
+	d.free_page_ids = append(d.free_page_ids, pageID)
+}
+
+func (d *DiskManagerImpl) GetFreePageIds() []types.PageID {
+	d.dbFileMutex.Lock()
+	defer d.dbFileMutex.Unlock()
+
+	ret := make([]types.PageID, len(d.free_page_ids))
+	copy(ret, d.free_page_ids)
+	return ret
+}
+
+// replaces free page list (used at recovery)
+func (d *DiskManagerImpl) SetFreePageIds(pageIds []types.PageID) {
+	d.dbFileMutex.Lock()
+	defer d.dbFileMutex.Unlock()
+
+	d.free_page_ids = make([]types.PageID, len(pageIds))
+	copy(d.free_page_ids, pageIds)
+	for _, pageId := range pageIds {
+		// free page may be not written to file yet
+		if pageId >= d.nextPageID {
+			d.nextPageID = pageId + 1
+		}
+	}
+}
+
+func (d *DiskManagerImpl) GetNumFreePages() int {
+	d.dbFileMutex.Lock()
+	defer d.dbFileMutex.Unlock()
+
+	return len(d.free_page_ids)
+}
 
 // GetNumWrites returns the number of disk writes
 func (d *DiskManagerImpl) GetNumWrites() uint64 {
-	return d.numWrites
+	return atomic.LoadUint64(&d.numWrites)
+}
+
+func (d *DiskManagerImpl) GetNumFlushes() uint64 {
+	d.logFileMutex.Lock()
+	defer d.logFileMutex.Unlock()
+	return d.numFlushes
 }
 
-// Size returns the size of the file in disk
+// Size returns the size of the region of pages in db file (header is not included)
 func (d *DiskManagerImpl) Size() int64 {
-	d.dbFileMutex.Lock()
-	defer d.dbFileMutex.Unlock()
-	return d.size
+	return atomic.LoadInt64(&d.size)
 }
 
 // ATTENTION: this method can be call after calling of Shutdown method
@@ -207,66 +489,37 @@ func (d *DiskManagerImpl) RemoveLogFile() {
 		fmt.Println(err)
 		panic("file remove failed")
 	}
-}
-
-// erase needless data from log file (use this when db recovery finishes or snapshot finishes)
-// file content becomes empty
-func (d *DiskManagerImpl) GCLogFile() error {
-	d.logFileMutex.Lock()
-
-	d.log.Close()
-	d.logFileMutex.Unlock()
-	d.RemoveLogFile()
-	d.logFileMutex.Lock()
-	defer d.logFileMutex.Unlock()
-
-	logfname := d.fileName_log
-	file_, err := os.OpenFile(logfname, os.O_RDWR|os.O_CREATE, 0666)
-	if err != nil {
-		log.Fatalln("can't open log file")
-		return err
-	}
-
-	_, err = file_.Stat()
-	if err != nil {
-		log.Fatalln("file info error")
-		return err
+	for _, seg := range d.log_segments[:len(d.log_segments)-1] {
+		os.Remove(seg.fileName)
 	}
-
-	d.log = file_
-
-	return nil
+	os.Remove(d.fileName_ckpt)
 }
 
 /**
  * Write the contents of the log into disk file
  * Only return when sync is done, and only perform sequence write
+ * first_lsn and last_lsn are LSN of the first and the last log record in log_data
  */
-func (d *DiskManagerImpl) WriteLog(log_data []byte) {
+func (d *DiskManagerImpl) WriteLog(log_data []byte, first_lsn types.LSN, last_lsn types.LSN) {
 	d.logFileMutex.Lock()
 	defer d.logFileMutex.Unlock()
 
-	// enforce swap log buffer
-
-	//assert(log_data != buffer_used)
-	//buffer_used := log_data
-
-	// if size == 0 { // no effect on num_flushes_ if log buffer is empty
-	// 	return
-	// }
+	if len(log_data) == 0 {
+		return
+	}
 
 	d.flush_log = true
 
-	// Note: current implementation does not use non-blocking I/O
-	// if flush_log_f_ != nullptr {
-	//   // used for checking non-blocking flushing
-	//   assert(flush_log_f_.wait_for(std::chrono::seconds(10)) == std::future_status::ready)
-	// }
-
 	d.numFlushes += 1
+	active := d.log_segments[len(d.log_segments)-1]
+	buf := log_data
+	if active.size == 0 {
+		// head of new segment
+		active.first_lsn = first_lsn
+		buf = append(serializeLogSegmentHeader(active), log_data...)
+	}
 	// sequence write
-	//disk_manager.log.write(log_data, size)
-	_, err := d.log.Write(log_data)
+	_, err := d.log.Write(buf)
 
 	// check for I/O error
 	if err != nil {
@@ -274,9 +527,34 @@ func (d *DiskManagerImpl) WriteLog(log_data []byte) {
 		return
 	}
 	// needs to flush to keep disk file in sync
-	//disk_manager.log.Flush()
 	d.log.Sync()
+	active.size += int64(len(log_data))
+	active.last_lsn = last_lsn
 	d.flush_log = false
+
+	if active.size >= common.LogSegmentSize {
+		d.sealActiveLogSegment()
+	}
+}
+
+// rename active segment to the name which has its LSN range and start new active segment
+func (d *DiskManagerImpl) sealActiveLogSegment() {
+	active := d.log_segments[len(d.log_segments)-1]
+	d.log.Close()
+	active.fileName = logSegmentFileName(d.fileName_log, active.first_lsn, active.last_lsn)
+	err := os.Rename(d.fileName_log, active.fileName)
+	if err != nil {
+		fmt.Println(err)
+		panic("rename of log segment file failed")
+	}
+
+	file_, err := os.OpenFile(d.fileName_log, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		fmt.Println(err)
+		panic("can't open log file")
+	}
+	d.log = file_
+	d.log_segments = append(d.log_segments, &logSegment{d.fileName_log, active.endOffset(), 0, common.InvalidLSN, common.InvalidLSN, nil})
 }
 
 /**
@@ -285,27 +563,35 @@ func (d *DiskManagerImpl) WriteLog(log_data []byte) {
 * @return: false means already reach the end
  */
 // Attention: len(log_data) specifies read data length
+// read data does not exceed the end of segment which contains offset
 func (d *DiskManagerImpl) ReadLog(log_data []byte, offset int32, retReadBytes *uint32) bool {
-	if int64(offset) >= d.GetLogFileSize() {
-		// fmt.Println("end of log file")
-		// fmt.Printf("file size is %d\n", d.GetLogFileSize())
-		return false
-	}
-
 	d.logFileMutex.Lock()
 	defer d.logFileMutex.Unlock()
 
-	d.log.Seek(int64(offset), io.SeekStart)
-	readBytes, err := d.log.Read(log_data)
-	*retReadBytes = uint32(readBytes)
+	seg := findLogSegment(d.log_segments, uint32(offset))
+	if seg == nil {
+		// end of log or the segment has been truncated
+		return false
+	}
 
-	//// if log file ends before reading "size"
-	//if readBytes < len(log_data) {
-	//	d.log.Close()
-	//	//zeroClear(log_data+read_count, 0, size-read_count)
-	//	log_data[readBytes] = byte(len(log_data) - readBytes)
-	//	return false
-	//}
+	readLen := uint32(len(log_data))
+	if seg.endOffset()-uint32(offset) < readLen {
+		readLen = seg.endOffset() - uint32(offset)
+	}
+	pos := int64(uint32(offset)-seg.start_offset) + logSegmentHeaderSize
+
+	file_ := d.log
+	if seg != d.log_segments[len(d.log_segments)-1] {
+		var err error
+		file_, err = os.Open(seg.fileName)
+		if err != nil {
+			fmt.Println("can't open log segment file")
+			return false
+		}
+		defer file_.Close()
+	}
+	readBytes, err := file_.ReadAt(log_data[:readLen], pos)
+	*retReadBytes = uint32(readBytes)
 
 	if err != nil {
 		fmt.Println("I/O error at log data reading")
@@ -316,21 +602,128 @@ func (d *DiskManagerImpl) ReadLog(log_data []byte, offset int32, retReadBytes *u
 }
 
 /**
- * Private helper function to get disk file size
+ * returns offset of the end of log. offsets are continuous over log segments
  */
 func (d *DiskManagerImpl) GetLogFileSize() int64 {
 	d.logFileMutex.Lock()
 	defer d.logFileMutex.Unlock()
 
-	/*
-		struct stat stat_buf;
-		int rc = stat(file_name.c_str(), &stat_buf);
-		return rc == 0 ? static_cast<int>(stat_buf.st_size) : -1;
-	*/
-	fileInfo, err := d.log.Stat()
+	return int64(d.log_segments[len(d.log_segments)-1].endOffset())
+}
+
+// returns total size of log segment files in byte
+func (d *DiskManagerImpl) GetLogDiskUsage() int64 {
+	d.logFileMutex.Lock()
+	defer d.logFileMutex.Unlock()
+
+	ret := int64(0)
+	for _, seg := range d.log_segments {
+		ret += seg.diskUsage()
+	}
+	return ret
+}
+
+// sealed segments which have only log records older than lsn are deleted or moved to archive directory.
+// the active segment is not truncated
+func (d *DiskManagerImpl) TruncateLogBefore(lsn types.LSN) {
+	d.logFileMutex.Lock()
+	defer d.logFileMutex.Unlock()
+
+	for len(d.log_segments) > 1 && d.log_segments[0].last_lsn < lsn {
+		seg := d.log_segments[0]
+		var err error
+		if d.log_archive_dir != "" {
+			err = os.MkdirAll(d.log_archive_dir, 0777)
+			if err == nil {
+				err = os.Rename(seg.fileName, filepath.Join(d.log_archive_dir, filepath.Base(seg.fileName)))
+			}
+		} else {
+			err = os.Remove(seg.fileName)
+		}
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		d.log_segments = d.log_segments[1:]
+	}
+}
+
+// log data at offset and after it are discarded. segments after offset are removed
+// and the segment which contains offset becomes the active segment
+func (d *DiskManagerImpl) DiscardLogAfter(offset uint32) {
+	d.logFileMutex.Lock()
+	defer d.logFileMutex.Unlock()
+
+	for len(d.log_segments) > 1 && d.log_segments[len(d.log_segments)-1].start_offset >= offset {
+		d.log.Close()
+		os.Remove(d.fileName_log)
+		d.log_segments = d.log_segments[:len(d.log_segments)-1]
+		active := d.log_segments[len(d.log_segments)-1]
+		err := os.Rename(active.fileName, d.fileName_log)
+		if err != nil {
+			fmt.Println(err)
+			panic("rename of log segment file failed")
+		}
+		active.fileName = d.fileName_log
+		file_, err := os.OpenFile(d.fileName_log, os.O_RDWR, 0666)
+		if err != nil {
+			fmt.Println(err)
+			panic("can't open log file")
+		}
+		d.log = file_
+	}
+
+	active := d.log_segments[len(d.log_segments)-1]
+	if offset < active.endOffset() {
+		active.size = int64(offset - active.start_offset)
+		active.last_lsn = common.InvalidLSN
+		if active.size == 0 {
+			// header is written again with the next log data
+			d.log.Truncate(0)
+		} else {
+			d.log.Truncate(logSegmentHeaderSize + active.size)
+		}
+	}
+	d.log.Seek(0, io.SeekEnd)
+}
+
+// truncated log segments are moved to dir. they are deleted when dir is empty string (default)
+func (d *DiskManagerImpl) SetLogArchiveDir(dir string) {
+	d.logFileMutex.Lock()
+	defer d.logFileMutex.Unlock()
+
+	d.log_archive_dir = dir
+}
+
+// persist offset of the last complete checkpoint in log file
+func (d *DiskManagerImpl) WriteLastCheckpointOffset(offset int32) {
+	d.logFileMutex.Lock()
+	defer d.logFileMutex.Unlock()
+
+	file_, err := os.OpenFile(d.fileName_ckpt, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
-		return -1
+		fmt.Println(err)
+		panic("can't open checkpoint file")
 	}
+	defer file_.Close()
 
-	return fileInfo.Size()
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, uint32(offset))
+	if _, err = file_.Write(buf); err != nil {
+		fmt.Println(err)
+		panic("write of checkpoint file failed")
+	}
+	file_.Sync()
+}
+
+// returns offset of the last complete checkpoint in log file. -1 is returned when checkpoint has not been done
+func (d *DiskManagerImpl) ReadLastCheckpointOffset() int32 {
+	d.logFileMutex.Lock()
+	defer d.logFileMutex.Unlock()
+
+	buf, err := os.ReadFile(d.fileName_ckpt)
+	if err != nil || len(buf) < 4 {
+		return -1
+	}
+	return int32(binary.LittleEndian.Uint32(buf))
 }
@@ -0,0 +1,102 @@
+package disk
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+// db file is mapped with this size at least. mapping is extended to double of the size of db file when it is short
+const minMmapSize = 1024 * 1024
+
+/**
+ * DiskManagerMmap is a DiskManager which reads pages from memory mapped db file.
+ * pages are written with pwrite same as DiskManagerImpl. the mapping shares page cache of OS
+ * with the file, so written data is seen through it. log file is handled by DiskManagerImpl.
+ * mapping may be longer than db file. region beyond the end of file is not accessed
+ * (it causes SIGBUS) because reads are checked with the size of the region of pages.
+ */
+type DiskManagerMmap struct {
+	*DiskManagerImpl
+	mapping []byte
+	// readers of mapping hold read lock. remapping is done with write lock
+	mapMutex *sync.RWMutex
+}
+
+// NewDiskManagerMmap returns a DiskManager instance which uses mmap for reading db file.
+// pageSize is used when db file is newly created. DiskManagerImpl is returned when the platform does not support mmap
+func NewDiskManagerMmap(dbFilename string, pageSize int) (DiskManager, error) {
+	dm, err := newDiskManagerImpl(dbFilename, pageSize, false)
+	if !isMmapSupported || err != nil {
+		return dm, err
+	}
+	ret := &DiskManagerMmap{dm.(*DiskManagerImpl), nil, new(sync.RWMutex)}
+	if err = ret.remap(0); err != nil {
+		dm.ShutDown()
+		return nil, err
+	}
+	return ret, nil
+}
+
+// remaps db file when current mapping does not cover minSize bytes
+func (d *DiskManagerMmap) remap(minSize int64) error {
+	d.mapMutex.Lock()
+	defer d.mapMutex.Unlock()
+
+	if d.mapping != nil && int64(len(d.mapping)) >= minSize {
+		// other thread remapped
+		return nil
+	}
+	mapSize := 2 * (atomic.LoadInt64(&d.size) + int64(d.pageSize))
+	if mapSize < minSize {
+		mapSize = 2 * minSize
+	}
+	if mapSize < minMmapSize {
+		mapSize = minMmapSize
+	}
+	mapping, err := mmapFile(d.db, int(mapSize))
+	if err != nil {
+		return err
+	}
+	if d.mapping != nil {
+		munmapFile(d.mapping)
+	}
+	d.mapping = mapping
+	return nil
+}
+
+// Read a page from the mapping of db file
+func (d *DiskManagerMmap) ReadPage(pageID types.PageID, pageData []byte) error {
+	offset := PageOffset(pageID, d.pageSize)
+	end := offset + int64(d.pageSize)
+	if end-int64(d.pageSize) > atomic.LoadInt64(&d.size) {
+		// the page is not written to db file yet or is written partially
+		return d.DiskManagerImpl.ReadPage(pageID, pageData)
+	}
+
+	d.mapMutex.RLock()
+	if end > int64(len(d.mapping)) {
+		d.mapMutex.RUnlock()
+		if err := d.remap(end); err != nil {
+			fmt.Println(err)
+			panic("remap of db file failed")
+		}
+		d.mapMutex.RLock()
+	}
+	copy(pageData, d.mapping[offset:end])
+	d.mapMutex.RUnlock()
+	return verifyPageChecksum(pageID, pageData)
+}
+
+// ShutDown unmaps and closes db file
+func (d *DiskManagerMmap) ShutDown() {
+	d.mapMutex.Lock()
+	if d.mapping != nil {
+		munmapFile(d.mapping)
+		d.mapping = nil
+	}
+	d.mapMutex.Unlock()
+	d.DiskManagerImpl.ShutDown()
+}
@@ -4,10 +4,19 @@
 package disk
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/storage/page"
 	testingpkg "github.com/ryogrid/SamehadaDB/testing"
+	"github.com/ryogrid/SamehadaDB/types"
 )
 
 func zeroClear(buffer []byte) {
@@ -26,7 +35,7 @@ func TestReadWritePage(t *testing.T) {
 	data := make([]byte, common.PageSize)
 	buffer := make([]byte, common.PageSize)
 
-	copy(data, "A test string.")
+	copy(data[page.SizePageHeader:], "A test string.")
 
 	dm.ReadPage(0, buffer) // tolerate empty read
 	dm.WritePage(0, data)
@@ -36,7 +45,7 @@ func TestReadWritePage(t *testing.T) {
 	testingpkg.Equals(t, data, buffer)
 
 	zeroClear(buffer)
-	copy(data, "Another test string.")
+	copy(data[page.SizePageHeader:], "Another test string.")
 
 	dm.WritePage(5, data)
 	dm.ReadPage(5, buffer)
@@ -48,3 +57,297 @@ func TestReadWritePage(t *testing.T) {
 	common.TempSuppressOnMemStorage = false
 	common.TempSuppressOnMemStorageMutex.Unlock()
 }
+
+func TestPageCorruption(t *testing.T) {
+	common.TempSuppressOnMemStorageMutex.Lock()
+	common.TempSuppressOnMemStorage = true
+
+	dm := NewDiskManagerTest()
+	defer dm.ShutDown()
+
+	data := make([]byte, common.PageSize)
+	buffer := make([]byte, common.PageSize)
+	copy(data[page.SizePageHeader:], "A test string.")
+	dm.WritePage(0, data)
+	dm.WritePage(1, data)
+
+	// flip a byte of page 1 on disk
+	dbFile := dm.(*DiskManagerTest).DiskManager.(*DiskManagerImpl).db
+	dbFile.WriteAt([]byte{0xff}, PageOffset(1, common.PageSize)+100)
+
+	testingpkg.Ok(t, dm.ReadPage(0, buffer))
+	err := dm.ReadPage(1, buffer)
+	var corruptionErr *PageCorruptionError
+	testingpkg.Assert(t, errors.As(err, &corruptionErr), "corruption is not detected")
+	testingpkg.Equals(t, types.PageID(1), corruptionErr.PageID)
+
+	common.TempSuppressOnMemStorage = false
+	common.TempSuppressOnMemStorageMutex.Unlock()
+}
+
+func TestLogSegments(t *testing.T) {
+	dbFileName := t.Name() + ".db"
+	logFileName := t.Name() + ".log"
+	archiveDir := t.Name() + "_archive"
+	os.Remove(dbFileName)
+	os.Remove(logFileName)
+	os.RemoveAll(archiveDir)
+	defer os.RemoveAll(archiveDir)
+
+	dm, err := NewDiskManagerImpl(dbFileName)
+	testingpkg.Ok(t, err)
+
+	// each chunk has 10 log records and a segment is sealed at every LogSegmentSizeBase chunks
+	chunk := make([]byte, common.LogBufferSize)
+	for ii := 0; ii < 20; ii++ {
+		for jj := range chunk {
+			chunk[jj] = byte(ii)
+		}
+		dm.WriteLog(chunk, types.LSN(ii*10), types.LSN(ii*10+9))
+	}
+
+	seg1Name := logSegmentFileName(logFileName, 0, 79)
+	seg2Name := logSegmentFileName(logFileName, 80, 159)
+	_, err = os.Stat(seg1Name)
+	testingpkg.Ok(t, err)
+	_, err = os.Stat(seg2Name)
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, int64(20*common.LogBufferSize), dm.GetLogFileSize())
+	testingpkg.Equals(t, int64(20*common.LogBufferSize+3*logSegmentHeaderSize), dm.GetLogDiskUsage())
+
+	// offsets are continuous over segments
+	buf := make([]byte, common.LogBufferSize)
+	var readBytes uint32
+	testingpkg.Assert(t, dm.ReadLog(buf, int32(9*common.LogBufferSize+5), &readBytes), "ReadLog failed")
+	testingpkg.Equals(t, uint32(common.LogBufferSize), readBytes)
+	testingpkg.Equals(t, byte(9), buf[0])
+	testingpkg.Equals(t, byte(10), buf[readBytes-1])
+	// read data does not exceed the end of segment
+	testingpkg.Assert(t, dm.ReadLog(buf, int32(8*common.LogBufferSize-10), &readBytes), "ReadLog failed")
+	testingpkg.Equals(t, uint32(10), readBytes)
+
+	// segments which have only log records older than passed LSN are moved to archive directory
+	dm.SetLogArchiveDir(archiveDir)
+	dm.TruncateLogBefore(85)
+	_, err = os.Stat(seg1Name)
+	testingpkg.Assert(t, os.IsNotExist(err), "truncated segment remains")
+	_, err = os.Stat(filepath.Join(archiveDir, filepath.Base(seg1Name)))
+	testingpkg.Ok(t, err)
+	_, err = os.Stat(seg2Name)
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, int64(12*common.LogBufferSize+2*logSegmentHeaderSize), dm.GetLogDiskUsage())
+	testingpkg.Assert(t, !dm.ReadLog(buf, 0, &readBytes), "truncated segment is read")
+
+	// segments are found and offsets are kept after reopen
+	dm.ShutDown()
+	dm, err = NewDiskManagerImpl(dbFileName)
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, int64(20*common.LogBufferSize), dm.GetLogFileSize())
+	testingpkg.Equals(t, int64(12*common.LogBufferSize+2*logSegmentHeaderSize), dm.GetLogDiskUsage())
+	testingpkg.Assert(t, dm.ReadLog(buf, int32(17*common.LogBufferSize), &readBytes), "ReadLog failed")
+	testingpkg.Equals(t, byte(17), buf[0])
+
+	for jj := range chunk {
+		chunk[jj] = byte(20)
+	}
+	dm.WriteLog(chunk, 200, 209)
+	testingpkg.Assert(t, dm.ReadLog(buf, int32(20*common.LogBufferSize), &readBytes), "ReadLog failed")
+	testingpkg.Equals(t, byte(20), buf[0])
+
+	dm.ShutDown()
+	dm.RemoveDBFile()
+	dm.RemoveLogFile()
+	_, err = os.Stat(seg2Name)
+	testingpkg.Assert(t, os.IsNotExist(err), "segment remains after RemoveLogFile")
+}
+
+func TestDirectIOAndConcurrentReadWritePage(t *testing.T) {
+	dbFileName := t.Name() + ".db"
+	os.Remove(dbFileName)
+	os.Remove(t.Name() + ".log")
+
+	// file system which does not support O_DIRECT falls back to usual I/O
+	dm, err := NewDiskManagerImplWithDirectIO(dbFileName)
+	testingpkg.Ok(t, err)
+	t.Logf("direct I/O: %v", dm.(*DiskManagerImpl).IsDirectIO())
+
+	// pages are read and written concurrently without dbFileMutex
+	const pageNum = 32
+	done := make(chan bool)
+	for ii := 0; ii < pageNum; ii++ {
+		go func(pageId types.PageID) {
+			data := make([]byte, common.PageSize)
+			copy(data[page.SizePageHeader:], fmt.Sprintf("page %d", pageId))
+			dm.WritePage(pageId, data)
+			buffer := make([]byte, common.PageSize)
+			err := dm.ReadPage(pageId, buffer)
+			done <- err == nil && bytes.Equal(data, buffer)
+		}(types.PageID(ii))
+	}
+	for ii := 0; ii < pageNum; ii++ {
+		testingpkg.Assert(t, <-done, "read data differs from written data")
+	}
+	testingpkg.Equals(t, int64(pageNum*common.PageSize), dm.Size())
+	testingpkg.Equals(t, uint64(pageNum), dm.GetNumWrites())
+
+	// unwritten page is read as zero cleared page
+	buffer := make([]byte, common.PageSize)
+	buffer[0] = 1
+	dm.ReadPage(pageNum, buffer)
+	testingpkg.Equals(t, make([]byte, common.PageSize), buffer)
+
+	dm.ShutDown()
+	dm.RemoveDBFile()
+	dm.RemoveLogFile()
+}
+
+func TestPageSizeInHeaderAndMmap(t *testing.T) {
+	dbFileName := t.Name() + ".db"
+	os.Remove(dbFileName)
+	os.Remove(t.Name() + ".log")
+
+	pageSize := 4 * common.PageSize
+	dm, err := NewDiskManagerImplWithPageSize(dbFileName, pageSize)
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, pageSize, dm.GetPageSize())
+
+	data := make([]byte, pageSize)
+	for ii := 0; ii < 8; ii++ {
+		// data at the tail of page is also kept
+		copy(data[page.SizePageHeader:], fmt.Sprintf("page %d", ii))
+		copy(data[pageSize-16:], fmt.Sprintf("tail %d", ii))
+		testingpkg.Ok(t, dm.WritePage(types.PageID(ii), data))
+	}
+	testingpkg.Equals(t, int64(8*pageSize), dm.Size())
+	dm.ShutDown()
+
+	// header is placed before pages
+	fileInfo, err := os.Stat(dbFileName)
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, int64(9*pageSize), fileInfo.Size())
+
+	// Scenario: page size recorded in header is used (not passed one) and pages are read through mmap
+	dm, err = NewDiskManagerMmap(dbFileName, common.PageSize)
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, pageSize, dm.GetPageSize())
+	testingpkg.Equals(t, int64(8*pageSize), dm.Size())
+	buffer := make([]byte, pageSize)
+	for ii := 0; ii < 8; ii++ {
+		testingpkg.Ok(t, dm.ReadPage(types.PageID(ii), buffer))
+		testingpkg.Equals(t, fmt.Sprintf("page %d", ii), string(buffer[page.SizePageHeader:page.SizePageHeader+6]))
+		testingpkg.Equals(t, fmt.Sprintf("tail %d", ii), string(buffer[pageSize-16:pageSize-10]))
+	}
+
+	// Scenario: pages written after mapping are read (mapping is extended when db file grows beyond it)
+	for _, pageId := range []types.PageID{8, types.PageID(2*minMmapSize/pageSize + 1)} {
+		copy(data[page.SizePageHeader:], fmt.Sprintf("page %d", pageId))
+		testingpkg.Ok(t, dm.WritePage(pageId, data))
+		testingpkg.Ok(t, dm.ReadPage(pageId, buffer))
+		testingpkg.Equals(t, data, buffer)
+	}
+	// page which is not written yet is read as zero cleared page
+	testingpkg.Ok(t, dm.ReadPage(types.PageID(2*minMmapSize/pageSize+2), buffer))
+	testingpkg.Equals(t, make([]byte, pageSize), buffer)
+
+	dm.ShutDown()
+	dm.RemoveDBFile()
+	dm.RemoveLogFile()
+}
+
+func TestDBHeaderValidationAndMigration(t *testing.T) {
+	dbFileName := t.Name() + ".db"
+	os.Remove(dbFileName)
+	os.Remove(t.Name() + ".log")
+	defer os.Remove(dbFileName)
+	defer os.Remove(t.Name() + ".log")
+
+	dm, err := NewDiskManagerImpl(dbFileName)
+	testingpkg.Ok(t, err)
+	header := dm.GetDBHeader()
+	testingpkg.Equals(t, uint32(DBFormatVersion), header.FormatVersion)
+	testingpkg.Equals(t, common.PageSize, header.PageSize)
+	testingpkg.SimpleAssert(t, !header.CreatedAt.IsZero())
+	testingpkg.Equals(t, types.InvalidPageID, header.TableCatalogPageId)
+
+	data := make([]byte, common.PageSize)
+	for ii := 0; ii < 3; ii++ {
+		testingpkg.Equals(t, types.PageID(ii), dm.AllocatePage())
+		testingpkg.Ok(t, dm.WritePage(types.PageID(ii), data))
+	}
+	dm.SetCatalogRootPageIds(1, 2)
+	dm.ShutDown()
+
+	// Scenario: header is kept at reopen and page next to the last one on file is allocated
+	dm, err = NewDiskManagerImpl(dbFileName)
+	testingpkg.Ok(t, err)
+	header2 := dm.GetDBHeader()
+	testingpkg.Equals(t, header.CreatedAt.UnixNano(), header2.CreatedAt.UnixNano())
+	testingpkg.Equals(t, types.PageID(1), header2.TableCatalogPageId)
+	testingpkg.Equals(t, types.PageID(2), header2.ColumnsCatalogPageId)
+	testingpkg.Equals(t, types.PageID(3), dm.AllocatePage())
+	dm.ShutDown()
+
+	dbFile, err := os.OpenFile(dbFileName, os.O_RDWR, 0666)
+	testingpkg.Ok(t, err)
+	defer dbFile.Close()
+
+	// Scenario: broken header is detected
+	dbFile.WriteAt([]byte{0xff}, offsetDBHeaderCreatedAt)
+	_, err = ReadDBHeader(dbFileName)
+	var corruptionErr *DBHeaderCorruptionError
+	testingpkg.SimpleAssert(t, errors.As(err, &corruptionErr))
+
+	// Scenario: db file written by newer version is rejected
+	testingpkg.Ok(t, WriteDBHeader(dbFile, &DBHeader{DBFormatVersion + 1, common.PageSize, header.CreatedAt, 1, 2, false}))
+	_, err = ReadDBHeader(dbFileName)
+	var versionErr *DBFormatVersionError
+	testingpkg.SimpleAssert(t, errors.As(err, &versionErr))
+	testingpkg.Equals(t, uint32(DBFormatVersion+1), versionErr.FileVersion)
+
+	// Scenario: format version 0 header (it has only page size) is migrated at open
+	testingpkg.Ok(t, WriteDBHeader(dbFile, &DBHeader{0, common.PageSize, time.Time{}, 0, 0, false}))
+	dm, err = NewDiskManagerImpl(dbFileName)
+	testingpkg.Ok(t, err)
+	header3 := dm.GetDBHeader()
+	testingpkg.Equals(t, uint32(DBFormatVersion), header3.FormatVersion)
+	testingpkg.Equals(t, types.PageID(0), header3.TableCatalogPageId)
+	testingpkg.Equals(t, types.PageID(1), header3.ColumnsCatalogPageId)
+	dm.ShutDown()
+	header4, err := ReadDBHeader(dbFileName)
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, *header4, header3)
+
+	// Scenario: file which is not db file of SamehadaDB is rejected
+	copy(data, "this is not a db file")
+	dbFile.WriteAt(data, 0)
+	_, err = ReadDBHeader(dbFileName)
+	testingpkg.SimpleAssert(t, err == ErrNotSamehadaDBFile)
+	_, err = NewDiskManagerImpl(dbFileName)
+	testingpkg.SimpleAssert(t, err == ErrNotSamehadaDBFile)
+}
+
+func TestPreChecksumDBFileIsRejected(t *testing.T) {
+	dbFileName := t.Name() + ".db"
+	os.Remove(dbFileName)
+	os.Remove(t.Name() + ".log")
+	defer os.Remove(dbFileName)
+	defer os.Remove(t.Name() + ".log")
+
+	// header-less db file whose page header has no checksum field.
+	// page 0 is the first table page of table catalog: | PageId (4) | LSN (4) | PrevPageId (4) | NextPageId (4) | ...
+	data := make([]byte, 2*common.PageSize)
+	binary.LittleEndian.PutUint32(data[4:], 10)
+	binary.LittleEndian.PutUint32(data[8:], 0xFFFFFFFF)  // InvalidPageID
+	binary.LittleEndian.PutUint32(data[12:], 0xFFFFFFFF) // InvalidPageID
+	binary.LittleEndian.PutUint32(data[common.PageSize:], 1)
+	testingpkg.Ok(t, os.WriteFile(dbFileName, data, 0666))
+
+	_, err := ReadDBHeader(dbFileName)
+	testingpkg.SimpleAssert(t, err == ErrPreChecksumDBFile)
+	_, err = NewDiskManagerImpl(dbFileName)
+	testingpkg.SimpleAssert(t, err == ErrPreChecksumDBFile)
+	// file is not modified
+	data2, err := os.ReadFile(dbFileName)
+	testingpkg.Ok(t, err)
+	testingpkg.Equals(t, data, data2)
+}
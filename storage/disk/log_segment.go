@@ -0,0 +1,130 @@
+package disk
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+/**
+ * log data is split into segment files. offsets in log are continuous over segments
+ * and a log buffer chunk written at one flush is never split into two segments.
+ * the active segment is "<base>.log" and a segment is renamed to "<base>.log.<first LSN>-<last LSN>"
+ * when it is sealed.
+ *
+ * segment file format:
+ * -------------------------------------------------------------------
+ * | start offset in log (4) | first LSN (4) | log data ...
+ * -------------------------------------------------------------------
+ */
+const logSegmentHeaderSize = 8
+
+type logSegment struct {
+	fileName string
+	// offset in log of the head of log data in this segment
+	start_offset uint32
+	// size of log data in this segment (header is not included)
+	size int64
+	// LSN range of log records in this segment
+	// (last_lsn of active segment is not known until log is written after reopen)
+	first_lsn types.LSN
+	last_lsn  types.LSN
+	// log data of the segment (used by VirtualDiskManagerImpl only)
+	data []byte
+}
+
+func (seg *logSegment) endOffset() uint32 {
+	return seg.start_offset + uint32(seg.size)
+}
+
+func (seg *logSegment) diskUsage() int64 {
+	if seg.size == 0 {
+		return 0
+	}
+	return logSegmentHeaderSize + seg.size
+}
+
+func logSegmentFileName(logfname string, first_lsn types.LSN, last_lsn types.LSN) string {
+	return fmt.Sprintf("%s.%010d-%010d", logfname, first_lsn, last_lsn)
+}
+
+func serializeLogSegmentHeader(seg *logSegment) []byte {
+	buf := make([]byte, logSegmentHeaderSize)
+	binary.LittleEndian.PutUint32(buf[0:], seg.start_offset)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(seg.first_lsn))
+	return buf
+}
+
+func deserializeLogSegmentHeader(buf []byte, seg *logSegment) {
+	seg.start_offset = binary.LittleEndian.Uint32(buf[0:])
+	seg.first_lsn = types.LSN(binary.LittleEndian.Uint32(buf[4:]))
+}
+
+// returns segment which contains offset. nil is returned when offset is not in log
+func findLogSegment(segments []*logSegment, offset uint32) *logSegment {
+	for _, seg := range segments {
+		if seg.start_offset <= offset && offset < seg.endOffset() {
+			return seg
+		}
+	}
+	return nil
+}
+
+// reads header and size of a segment file
+func readLogSegmentFile(fileName string) (*logSegment, error) {
+	file_, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file_.Close()
+	fileInfo, err := file_.Stat()
+	if err != nil {
+		return nil, err
+	}
+	seg := &logSegment{fileName, 0, 0, common.InvalidLSN, common.InvalidLSN, nil}
+	if fileInfo.Size() < logSegmentHeaderSize {
+		return seg, nil
+	}
+	header := make([]byte, logSegmentHeaderSize)
+	if _, err = file_.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+	deserializeLogSegmentHeader(header, seg)
+	seg.size = fileInfo.Size() - logSegmentHeaderSize
+	return seg, nil
+}
+
+// lists sealed segment files of logfname in order of offset
+func listSealedLogSegments(logfname string) []*logSegment {
+	ret := make([]*logSegment, 0)
+	dir := filepath.Dir(logfname)
+	prefix := filepath.Base(logfname) + "."
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ret
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		var first_lsn, last_lsn int32
+		if n, err := fmt.Sscanf(entry.Name()[len(prefix):], "%d-%d", &first_lsn, &last_lsn); n != 2 || err != nil {
+			continue
+		}
+		seg, err := readLogSegmentFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			fmt.Println(err)
+			panic("read of log segment file failed")
+		}
+		seg.last_lsn = types.LSN(last_lsn)
+		ret = append(ret, seg)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].start_offset < ret[j].start_offset })
+	return ret
+}
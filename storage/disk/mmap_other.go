@@ -0,0 +1,19 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package disk
+
+import (
+	"errors"
+	"os"
+)
+
+// mmap is not supported on this platform. NewDiskManagerMmap returns DiskManagerImpl
+const isMmapSupported = false
+
+func mmapFile(file *os.File, size int) ([]byte, error) {
+	return nil, errors.New("mmap is not supported")
+}
+
+func munmapFile(mapping []byte) error {
+	return nil
+}
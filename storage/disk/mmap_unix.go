@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package disk
+
+import (
+	"os"
+	"syscall"
+)
+
+const isMmapSupported = true
+
+// maps size bytes from the head of file (shared mapping for read)
+func mmapFile(file *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(file.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func munmapFile(mapping []byte) error {
+	return syscall.Munmap(mapping)
+}
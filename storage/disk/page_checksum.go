@@ -0,0 +1,56 @@
+package disk
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/storage/page"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+/**
+ * PageCorruptionError is returned by ReadPage when data of the page read from disk is broken
+ * (checksum mismatch caused by torn write, bit flip and so on)
+ */
+type PageCorruptionError struct {
+	PageID types.PageID
+	// checksum stored in page header
+	StoredChecksum uint32
+	// checksum calculated from page data read
+	ActualChecksum uint32
+}
+
+func (e *PageCorruptionError) Error() string {
+	return fmt.Sprintf("page %d is corrupted (stored checksum: %08x, actual checksum: %08x)",
+		e.PageID, e.StoredChecksum, e.ActualChecksum)
+}
+
+// sets CRC32C checksum of pageData to its header
+func SetPageChecksum(pageData []byte) {
+	binary.LittleEndian.PutUint32(pageData[page.OffsetChecksum:], common.CalcChecksum(pageData, page.OffsetChecksum))
+}
+
+/*
+* returns PageCorruptionError when checksum in header of pageData does not match its content.
+* page which is filled with zero (not written yet) is valid.
+* checksum field is cleared after verification because it is meaningful only on disk
+ */
+func verifyPageChecksum(pageID types.PageID, pageData []byte) error {
+	stored := binary.LittleEndian.Uint32(pageData[page.OffsetChecksum:])
+	actual := common.CalcChecksum(pageData, page.OffsetChecksum)
+	if stored != actual && !(stored == 0 && isZeroPage(pageData)) {
+		return &PageCorruptionError{pageID, stored, actual}
+	}
+	binary.LittleEndian.PutUint32(pageData[page.OffsetChecksum:], 0)
+	return nil
+}
+
+func isZeroPage(pageData []byte) bool {
+	for _, b := range pageData {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+package disk
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+// returns true when fileName is name of active segment ("*.log") or sealed segment ("*.log.<first LSN>-<last LSN>")
+func isLogSegmentFileName(fileName string) bool {
+	if strings.HasSuffix(fileName, ".log") {
+		return true
+	}
+	idx := strings.LastIndex(fileName, ".log.")
+	if idx < 0 {
+		return false
+	}
+	var first_lsn, last_lsn int32
+	n, err := fmt.Sscanf(fileName[idx+len(".log."):], "%d-%d", &first_lsn, &last_lsn)
+	return n == 2 && err == nil
+}
+
+func copyFile(dst string, src string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	dstFile, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+	if _, err = io.Copy(dstFile, srcFile); err != nil {
+		return err
+	}
+	return dstFile.Sync()
+}
+
+// copies log data of seg to dst. start offset in header is moved back by base
+func copyLogSegment(dst string, seg *logSegment, base uint32) error {
+	srcFile, err := os.Open(seg.fileName)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	dstFile, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+
+	header := &logSegment{start_offset: seg.start_offset - base, first_lsn: seg.first_lsn}
+	if _, err = dstFile.Write(serializeLogSegmentHeader(header)); err != nil {
+		return err
+	}
+	if _, err = io.Copy(dstFile, io.NewSectionReader(srcFile, logSegmentHeaderSize, seg.size)); err != nil {
+		return err
+	}
+	return dstFile.Sync()
+}
+
+/**
+ * prepare files of dbFilename for point-in-time recovery.
+ * db file is replaced with a copy of snapshotFile and log segment files in archiveDir
+ * (archived segments and a copy of the active segment of the source db) are copied as log of dbFilename.
+ * offsets in log are moved so that the oldest segment starts at 0 and checkpoint location is removed,
+ * so recovery starts from the head of the oldest segment
+ */
+func PrepareFilesForRestore(dbFilename string, snapshotFile string, archiveDir string) error {
+	period_idx := strings.LastIndex(dbFilename, ".")
+	logfname_base := dbFilename[:period_idx]
+	logfname := logfname_base + "." + "log"
+	ckptfname := logfname_base + "." + "ckpt"
+
+	entries, err := os.ReadDir(archiveDir)
+	if err != nil {
+		return err
+	}
+	// start offset -> segment. when same segment is found twice (ex: a copy of active segment
+	// and the sealed one), longer one is used
+	segMap := make(map[uint32]*logSegment)
+	for _, entry := range entries {
+		if entry.IsDir() || !isLogSegmentFileName(entry.Name()) {
+			continue
+		}
+		seg, err := readLogSegmentFile(filepath.Join(archiveDir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		if seg.size == 0 {
+			continue
+		}
+		if found, ok := segMap[seg.start_offset]; !ok || found.size < seg.size {
+			segMap[seg.start_offset] = seg
+		}
+	}
+	if len(segMap) == 0 {
+		return errors.New("log segment is not found in archive directory")
+	}
+	segments := make([]*logSegment, 0, len(segMap))
+	for _, seg := range segMap {
+		segments = append(segments, seg)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].start_offset < segments[j].start_offset })
+	for ii := 1; ii < len(segments); ii++ {
+		if segments[ii].start_offset != segments[ii-1].endOffset() {
+			return errors.New("log segment is missing in archive directory")
+		}
+	}
+
+	// remove current files
+	for _, seg := range listSealedLogSegments(logfname) {
+		os.Remove(seg.fileName)
+	}
+	os.Remove(logfname)
+	os.Remove(ckptfname)
+
+	if err = copyFile(dbFilename, snapshotFile); err != nil {
+		return err
+	}
+	base := segments[0].start_offset
+	for ii, seg := range segments {
+		dst := logfname
+		if ii < len(segments)-1 {
+			// LSNs are continuous over segments
+			dst = logSegmentFileName(logfname, seg.first_lsn, segments[ii+1].first_lsn-1)
+		}
+		if err = copyLogSegment(dst, seg, base); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copies log data in [start_offset, end_offset) of dm to a log segment file (used for backup).
+// first_lsn is LSN of the log record at start_offset
+func CopyLogToFile(dm DiskManager, fileName string, start_offset uint32, end_offset uint32, first_lsn types.LSN) error {
+	file_, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer file_.Close()
+
+	if start_offset == end_offset {
+		// no log data
+		return nil
+	}
+	header := &logSegment{start_offset: start_offset, first_lsn: first_lsn}
+	if _, err = file_.Write(serializeLogSegmentHeader(header)); err != nil {
+		return err
+	}
+	buf := make([]byte, common.LogBufferSize)
+	offset := start_offset
+	for offset < end_offset {
+		readLen := uint32(len(buf))
+		if end_offset-offset < readLen {
+			readLen = end_offset - offset
+		}
+		var readBytes uint32
+		if !dm.ReadLog(buf[:readLen], int32(offset), &readBytes) || readBytes == 0 {
+			return errors.New("log data to copy is not found")
+		}
+		if _, err = file_.Write(buf[:readBytes]); err != nil {
+			return err
+		}
+		offset += readBytes
+	}
+	return file_.Sync()
+}
@@ -27,7 +27,10 @@ func NewDiskManagerTest() DiskManager {
 	os.Remove(path)
 
 	if !common.EnableOnMemStorage || common.TempSuppressOnMemStorage {
-		diskManager := NewDiskManagerImpl(path)
+		diskManager, err := NewDiskManagerImpl(path)
+		if err != nil {
+			panic(err)
+		}
 		return &DiskManagerTest{path, diskManager}
 	} else {
 		diskManager := NewVirtualDiskManagerImpl(path)
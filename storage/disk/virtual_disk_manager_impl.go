@@ -15,7 +15,6 @@ import (
 type VirtualDiskManagerImpl struct {
 	db           *memfile.File //[]byte
 	fileName     string
-	log          *memfile.File //[]byte
 	fileName_log string
 	nextPageID   types.PageID
 	numWrites    uint64
@@ -24,21 +23,38 @@ type VirtualDiskManagerImpl struct {
 	numFlushes   uint64
 	dbFileMutex  *sync.Mutex
 	logFileMutex *sync.Mutex
+	// offset of the last complete checkpoint in log file
+	lastCheckpointOffset int32
+	// segments of log in order of offset. the last one is the active segment
+	log_segments []*logSegment
+	// deallocated pages which can be reused
+	free_page_ids []types.PageID
+	pageSize      int
+	// header is kept on memory only
+	header *DBHeader
 }
 
 func NewVirtualDiskManagerImpl(dbFilename string) DiskManager {
+	return NewVirtualDiskManagerImplWithPageSize(dbFilename, common.PageSize)
+}
+
+// NewVirtualDiskManagerImplWithPageSize returns a DiskManager instance on memory whose page size is pageSize
+func NewVirtualDiskManagerImplWithPageSize(dbFilename string, pageSize int) DiskManager {
+	if !IsValidPageSize(pageSize) {
+		panic(fmt.Sprintf("invalid page size: %d", pageSize))
+	}
 	file := memfile.New(make([]byte, 0))
 
 	period_idx := strings.LastIndex(dbFilename, ".")
 	logfname_base := dbFilename[:period_idx]
 	logfname := logfname_base + "." + "log"
 
-	file_1 := memfile.New(make([]byte, 0))
+	active := &logSegment{logfname, 0, 0, common.InvalidLSN, common.InvalidLSN, make([]byte, 0)}
 
 	fileSize := int64(0)
 	nextPageID := types.PageID(0)
 
-	return &VirtualDiskManagerImpl{file, dbFilename, file_1, logfname, nextPageID, 0, fileSize, false, 0, new(sync.Mutex), new(sync.Mutex)}
+	return &VirtualDiskManagerImpl{file, dbFilename, logfname, nextPageID, 0, fileSize, false, 0, new(sync.Mutex), new(sync.Mutex), -1, []*logSegment{active}, make([]types.PageID, 0), pageSize, NewDBHeader(pageSize)}
 }
 
 // ShutDown closes of the database file
@@ -51,8 +67,11 @@ func (d *VirtualDiskManagerImpl) WritePage(pageId types.PageID, pageData []byte)
 	d.dbFileMutex.Lock()
 	defer d.dbFileMutex.Unlock()
 
-	offset := int64(pageId * common.PageSize)
-	d.db.WriteAt(pageData, offset)
+	offset := int64(pageId) * int64(d.pageSize)
+	data := make([]byte, len(pageData))
+	copy(data, pageData)
+	SetPageChecksum(data)
+	d.db.WriteAt(data, offset)
 
 	if offset >= d.size {
 		d.size = offset + int64(len(pageData))
@@ -66,7 +85,7 @@ func (d *VirtualDiskManagerImpl) ReadPage(pageID types.PageID, pageData []byte)
 	d.dbFileMutex.Lock()
 	defer d.dbFileMutex.Unlock()
 
-	offset := int64(pageID * common.PageSize)
+	offset := int64(pageID) * int64(d.pageSize)
 
 	//currentSize := int64(len(d.db.Bytes()))
 	//if offset > currentSize || offset+int64(len(pageData)) > currentSize {
@@ -82,13 +101,21 @@ func (d *VirtualDiskManagerImpl) ReadPage(pageID types.PageID, pageData []byte)
 		fmt.Println(err)
 		panic("file read error!")
 	}
-	return err
+	return verifyPageChecksum(pageID, pageData)
 }
 
 // AllocatePage allocates a new page
 func (d *VirtualDiskManagerImpl) AllocatePage() types.PageID {
 	d.dbFileMutex.Lock()
 
+	if len(d.free_page_ids) > 0 {
+		// reuse deallocated page
+		ret := d.free_page_ids[len(d.free_page_ids)-1]
+		d.free_page_ids = d.free_page_ids[:len(d.free_page_ids)-1]
+		d.dbFileMutex.Unlock()
+		return ret
+	}
+
 	ret := d.nextPageID
 
 	//// extend db file for avoiding later ReadPage and WritePage fails
@@ -103,16 +130,108 @@ func (d *VirtualDiskManagerImpl) AllocatePage() types.PageID {
 	return ret
 }
 
-// DeallocatePage deallocates page
-// Need bitmap in header page for tracking pages
-// This does not actually need to do anything for now.
-func (d *VirtualDiskManagerImpl) DeallocatePage(pageID types.PageID) {}
+// CancelAllocatePage undoes the last AllocatePage call which returned pageID (isReused is true when
+// the page was taken from free page list). caller must guarantee that no page is allocated after the call
+func (d *VirtualDiskManagerImpl) CancelAllocatePage(pageID types.PageID, isReused bool) {
+	d.dbFileMutex.Lock()
+	defer d.dbFileMutex.Unlock()
+
+	if !isReused {
+		d.nextPageID--
+		return
+	}
+	// reused page is pushed back to the position it was popped from
+	d.free_page_ids = append(d.free_page_ids, pageID)
+}
+
+// DeallocatePage adds page to free page list. the page is reused by AllocatePage
+func (d *VirtualDiskManagerImpl) DeallocatePage(pageID types.PageID) {
+	d.dbFileMutex.Lock()
+	defer d.dbFileMutex.Unlock()
+
+	for _, freePageId := range d.free_page_ids {
+		if freePageId == pageID {
+			// already deallocated
+			return
+		}
+	}
+	d.free_page_ids = append(d.free_page_ids, pageID)
+}
+
+func (d *VirtualDiskManagerImpl) GetFreePageIds() []types.PageID {
+	d.dbFileMutex.Lock()
+	defer d.dbFileMutex.Unlock()
+
+	ret := make([]types.PageID, len(d.free_page_ids))
+	copy(ret, d.free_page_ids)
+	return ret
+}
+
+// replaces free page list (used at recovery)
+func (d *VirtualDiskManagerImpl) SetFreePageIds(pageIds []types.PageID) {
+	d.dbFileMutex.Lock()
+	defer d.dbFileMutex.Unlock()
+
+	d.free_page_ids = make([]types.PageID, len(pageIds))
+	copy(d.free_page_ids, pageIds)
+	for _, pageId := range pageIds {
+		// free page may be not written to file yet
+		if pageId >= d.nextPageID {
+			d.nextPageID = pageId + 1
+		}
+	}
+}
+
+func (d *VirtualDiskManagerImpl) GetNumFreePages() int {
+	d.dbFileMutex.Lock()
+	defer d.dbFileMutex.Unlock()
+
+	return len(d.free_page_ids)
+}
 
 // GetNumWrites returns the number of disk writes
 func (d *VirtualDiskManagerImpl) GetNumWrites() uint64 {
 	return d.numWrites
 }
 
+func (d *VirtualDiskManagerImpl) GetNumFlushes() uint64 {
+	d.logFileMutex.Lock()
+	defer d.logFileMutex.Unlock()
+	return d.numFlushes
+}
+
+// GetDBHeader returns a copy of header of the db
+func (d *VirtualDiskManagerImpl) GetDBHeader() DBHeader {
+	d.dbFileMutex.Lock()
+	defer d.dbFileMutex.Unlock()
+	return *d.header
+}
+
+// SetCatalogRootPageIds records first pages of system catalogs to header of the db
+func (d *VirtualDiskManagerImpl) SetCatalogRootPageIds(tableCatalogPageId types.PageID, columnsCatalogPageId types.PageID) {
+	d.dbFileMutex.Lock()
+	defer d.dbFileMutex.Unlock()
+	d.header.TableCatalogPageId = tableCatalogPageId
+	d.header.ColumnsCatalogPageId = columnsCatalogPageId
+}
+
+// WasShutDownCleanly always returns false because the db is never reopened
+func (d *VirtualDiskManagerImpl) WasShutDownCleanly() bool {
+	return false
+}
+
+// MarkShutDownCleanly records it to header on memory
+func (d *VirtualDiskManagerImpl) MarkShutDownCleanly() {
+	d.dbFileMutex.Lock()
+	defer d.dbFileMutex.Unlock()
+	d.header.IsShutDownCleanly = true
+}
+
+// GetPageSize returns page size of the db
+func (d *VirtualDiskManagerImpl) GetPageSize() int {
+	return d.pageSize
+}
+
 // Size returns the size of the file in disk
 func (d *VirtualDiskManagerImpl) Size() int64 {
 	d.dbFileMutex.Lock()
@@ -130,31 +249,35 @@ func (d *VirtualDiskManagerImpl) RemoveLogFile() {
 	// do nothing
 }
 
-// erase needless data from log file (use this when db recovery finishes or snapshot finishes)
-// file content becomes empty
-func (d *VirtualDiskManagerImpl) GCLogFile() error {
-	d.logFileMutex.Lock()
-
-	d.log = memfile.New(make([]byte, 0))
-	defer d.logFileMutex.Unlock()
-
-	return nil
-}
-
 /**
  * Write the contents of the log into disk file
  * Only return when sync is done, and only perform sequence write
  */
-func (d *VirtualDiskManagerImpl) WriteLog(log_data []byte) {
+func (d *VirtualDiskManagerImpl) WriteLog(log_data []byte, first_lsn types.LSN, last_lsn types.LSN) {
 	d.logFileMutex.Lock()
 	defer d.logFileMutex.Unlock()
 
+	if len(log_data) == 0 {
+		return
+	}
+
 	d.flush_log = true
 
 	d.numFlushes += 1
+	active := d.log_segments[len(d.log_segments)-1]
+	if active.size == 0 {
+		active.first_lsn = first_lsn
+	}
 	// sequence write
-	d.log.Write(log_data)
+	active.data = append(active.data, log_data...)
+	active.size += int64(len(log_data))
+	active.last_lsn = last_lsn
 	d.flush_log = false
+
+	if active.size >= common.LogSegmentSize {
+		active.fileName = logSegmentFileName(d.fileName_log, active.first_lsn, active.last_lsn)
+		d.log_segments = append(d.log_segments, &logSegment{d.fileName_log, active.endOffset(), 0, common.InvalidLSN, common.InvalidLSN, make([]byte, 0)})
+	}
 }
 
 /**
@@ -164,26 +287,80 @@ func (d *VirtualDiskManagerImpl) WriteLog(log_data []byte) {
  */
 // Attention: len(log_data) specifies read data length
 func (d *VirtualDiskManagerImpl) ReadLog(log_data []byte, offset int32, retReadBytes *uint32) bool {
-	if int64(offset) >= d.GetLogFileSize() {
-		return false
-	}
-
 	d.logFileMutex.Lock()
 	defer d.logFileMutex.Unlock()
 
-	readLen := int32(len(log_data))
-	d.log.ReadAt(log_data, int64(offset))
-	*retReadBytes = uint32(readLen)
+	seg := findLogSegment(d.log_segments, uint32(offset))
+	if seg == nil {
+		return false
+	}
+
+	*retReadBytes = uint32(copy(log_data, seg.data[uint32(offset)-seg.start_offset:]))
 
 	return true
 }
 
 /**
- * Private helper function to get disk file size
+ * returns offset of the end of log. offsets are continuous over log segments
  */
 func (d *VirtualDiskManagerImpl) GetLogFileSize() int64 {
 	d.logFileMutex.Lock()
 	defer d.logFileMutex.Unlock()
 
-	return int64(len(d.log.Bytes()))
+	return int64(d.log_segments[len(d.log_segments)-1].endOffset())
+}
+
+func (d *VirtualDiskManagerImpl) GetLogDiskUsage() int64 {
+	d.logFileMutex.Lock()
+	defer d.logFileMutex.Unlock()
+
+	ret := int64(0)
+	for _, seg := range d.log_segments {
+		ret += seg.size
+	}
+	return ret
+}
+
+// archiving is not supported. truncated segments are always discarded
+func (d *VirtualDiskManagerImpl) TruncateLogBefore(lsn types.LSN) {
+	d.logFileMutex.Lock()
+	defer d.logFileMutex.Unlock()
+
+	for len(d.log_segments) > 1 && d.log_segments[0].last_lsn < lsn {
+		d.log_segments = d.log_segments[1:]
+	}
+}
+
+func (d *VirtualDiskManagerImpl) SetLogArchiveDir(dir string) {
+	// do nothing
+}
+
+func (d *VirtualDiskManagerImpl) WriteLastCheckpointOffset(offset int32) {
+	d.logFileMutex.Lock()
+	defer d.logFileMutex.Unlock()
+
+	d.lastCheckpointOffset = offset
+}
+
+func (d *VirtualDiskManagerImpl) ReadLastCheckpointOffset() int32 {
+	d.logFileMutex.Lock()
+	defer d.logFileMutex.Unlock()
+
+	return d.lastCheckpointOffset
+}
+
+func (d *VirtualDiskManagerImpl) DiscardLogAfter(offset uint32) {
+	d.logFileMutex.Lock()
+	defer d.logFileMutex.Unlock()
+
+	for len(d.log_segments) > 1 && d.log_segments[len(d.log_segments)-1].start_offset >= offset {
+		d.log_segments = d.log_segments[:len(d.log_segments)-1]
+	}
+	active := d.log_segments[len(d.log_segments)-1]
+	active.fileName = d.fileName_log
+	if offset < active.endOffset() {
+		active.size = int64(offset - active.start_offset)
+		active.data = active.data[:active.size]
+		active.last_lsn = common.InvalidLSN
+	}
 }
@@ -10,12 +10,16 @@ import (
 	"github.com/ryogrid/SamehadaDB/recovery/log_recovery"
 	"github.com/ryogrid/SamehadaDB/samehada"
 	"github.com/ryogrid/SamehadaDB/samehada/samehada_util"
+	"github.com/ryogrid/SamehadaDB/storage/access"
+	"github.com/ryogrid/SamehadaDB/storage/index"
 	"github.com/ryogrid/SamehadaDB/storage/index/index_constants"
 	"github.com/ryogrid/SamehadaDB/storage/table/column"
 	"github.com/ryogrid/SamehadaDB/storage/table/schema"
+	"github.com/ryogrid/SamehadaDB/storage/tuple"
 	"github.com/ryogrid/SamehadaDB/types"
 	"os"
 	"testing"
+	"unsafe"
 
 	"github.com/ryogrid/SamehadaDB/storage/page"
 	testingpkg "github.com/ryogrid/SamehadaDB/testing"
@@ -26,12 +30,164 @@ func TestPackAndUnpackRID(t *testing.T) {
 	rid.PageId = 55
 	rid.SlotNum = 1027
 
-	packed_val := samehada_util.PackRIDtoUint32(rid)
+	packed_val := samehada_util.PackRIDtoUint64(rid)
 	fmt.Println(packed_val)
-	unpacked_val := samehada_util.UnpackUint32toRID(packed_val)
+	unpacked_val := samehada_util.UnpackUint64toRID(packed_val)
 
 	testingpkg.Assert(t, unpacked_val.PageId == 55, "")
 	testingpkg.Assert(t, unpacked_val.SlotNum == 1027, "")
+
+	// values which don't fit in 16bit
+	rid.PageId = 70000
+	rid.SlotNum = 65536 + 3
+	unpacked_val = samehada_util.UnpackUint64toRID(samehada_util.PackRIDtoUint64(rid))
+	testingpkg.Equals(t, *rid, unpacked_val)
+}
+
+func TestIndexLookupBeyond16bitPageId(t *testing.T) {
+	shi := samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	bpm := shi.GetBufferPoolManager()
+
+	columnA := column.NewColumn("a", types.Integer, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	columnB := column.NewColumn("b", types.Varchar, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	schema_ := schema.NewSchema([]*column.Column{columnA, columnB})
+	im := index.NewIndexMetadata("a_index", "test_1", schema_, []uint32{0})
+
+	hashIdx := index.NewLinearProbeHashTableIndex(im, bpm, shi.GetLogManager(), 0, common.BucketSizeOfHashIndex, types.InvalidPageID)
+	slIdx := index.NewSkipListIndex(im, bpm, 0, types.InvalidPageID)
+	indexes := []index.Index{hashIdx, slIdx}
+
+	txn := shi.GetTransactionManager().Begin(nil)
+	tableHeap := access.NewTableHeap(bpm, shi.GetLogManager(), shi.GetLockManager(), txn)
+	keyNum := int32(300)
+	rowOf := func(key int32) *tuple.Tuple {
+		return tuple.NewTupleFromSchema([]types.Value{types.NewInteger(key), types.NewVarchar(fmt.Sprintf("row of key %d", key))}, schema_)
+	}
+	ridsOfKey := make(map[int32][]page.RID)
+	insertRow := func(key int32) page.RID {
+		row := rowOf(key)
+		rid, err := tableHeap.InsertTuple(row, txn)
+		testingpkg.Ok(t, err)
+		for _, idx := range indexes {
+			idx.InsertEntry(row, *rid, txn)
+		}
+		ridsOfKey[key] = append(ridsOfKey[key], *rid)
+		return *rid
+	}
+
+	// first rows are placed on pages whose id is less than 65536
+	for ii := int32(0); ii < keyNum; ii++ {
+		rid := insertRow(ii)
+		testingpkg.SimpleAssert(t, rid.PageId < 65536)
+	}
+
+	// page ids are consumed without writing pages. so pages allocated
+	// for following rows have id beyond 65535 and some of them share same
+	// low 16bit with pages of first rows. old 32bit packing mixed up these rows
+	for shi.GetDiskManager().AllocatePage() < 65535 {
+	}
+	isBeyond16bit := false
+	for ii := int32(0); !isBeyond16bit || ii < 20*keyNum; ii++ {
+		rid := insertRow(ii % keyNum)
+		isBeyond16bit = isBeyond16bit || rid.PageId >= 65536
+	}
+	testingpkg.Equals(t, access.GROWING, txn.GetState())
+
+	for _, idx := range indexes {
+		for ii := int32(0); ii < keyNum; ii++ {
+			rids := idx.ScanKey(rowOf(ii), txn)
+			testingpkg.Equals(t, len(ridsOfKey[ii]), len(rids))
+			for _, rid := range ridsOfKey[ii] {
+				testingpkg.Assert(t, containsRID(rids, rid), "wrong RIDs are returned")
+			}
+		}
+	}
+
+	// entries of rows on pages beyond 65535 are removed
+	for ii := int32(0); ii < keyNum; ii++ {
+		for _, rid := range ridsOfKey[ii][1:] {
+			for _, idx := range indexes {
+				idx.DeleteEntry(rowOf(ii), rid, txn)
+			}
+		}
+	}
+	for _, idx := range indexes {
+		for ii := int32(0); ii < keyNum; ii++ {
+			testingpkg.Equals(t, []page.RID{ridsOfKey[ii][0]}, idx.ScanKey(rowOf(ii), txn))
+		}
+	}
+	shi.GetTransactionManager().Commit(txn)
+
+	shi.CloseFilesForTesting()
+}
+
+func containsRID(rids []page.RID, rid page.RID) bool {
+	for _, r := range rids {
+		if r == rid {
+			return true
+		}
+	}
+	return false
+}
+
+func TestHashIndexErrorAbortsTransaction(t *testing.T) {
+	shi := samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	bpm := shi.GetBufferPoolManager()
+
+	columnA := column.NewColumn("a", types.Integer, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	schema_ := schema.NewSchema([]*column.Column{columnA})
+	im := index.NewIndexMetadata("a_index", "test_1", schema_, []uint32{0})
+
+	hashIdx := index.NewLinearProbeHashTableIndex(im, bpm, shi.GetLogManager(), 0, common.BucketSizeOfHashIndex, types.InvalidPageID)
+	keyTuple := tuple.NewTupleFromSchema([]types.Value{types.NewInteger(1)}, schema_)
+	rid := page.RID{PageId: 10, SlotNum: 1}
+
+	txn := shi.GetTransactionManager().Begin(nil)
+	hashIdx.InsertEntry(keyTuple, rid, txn)
+	testingpkg.Assert(t, txn.GetState() != access.ABORTED, "")
+
+	// errors other than buffer pool exhaustion are also reported with abort of the transaction
+	hashIdx.InsertEntry(keyTuple, rid, txn)
+	testingpkg.Equals(t, access.ABORTED, txn.GetState())
+	testingpkg.Assert(t, txn.GetAbortReason() != nil, "abort reason should be set")
+	shi.GetTransactionManager().Abort(txn)
+
+	shi.CloseFilesForTesting()
+}
+
+func TestMigrationOfOldFormatHashIndex(t *testing.T) {
+	shi := samehada.NewSamehadaInstance(t.Name(), common.BufferPoolMaxFrameNumForTest)
+	bpm := shi.GetBufferPoolManager()
+
+	columnA := column.NewColumn("a", types.Integer, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	schema_ := schema.NewSchema([]*column.Column{columnA})
+	im := index.NewIndexMetadata("a_index", "test_1", schema_, []uint32{0})
+
+	hashIdx := index.NewLinearProbeHashTableIndex(im, bpm, shi.GetLogManager(), 0, common.BucketSizeOfHashIndex, types.InvalidPageID)
+	testingpkg.Assert(t, !hashIdx.IsFormatMigrated(), "")
+	keyTuple := tuple.NewTupleFromSchema([]types.Value{types.NewInteger(1)}, schema_)
+	hashIdx.InsertEntry(keyTuple, page.RID{PageId: 100000, SlotNum: 1}, nil)
+
+	// rewrite format version to the one of 32bit packed values
+	headerPageId := hashIdx.GetHeaderPageId()
+	headerPage := (*page.HashTableHeaderPage)(unsafe.Pointer(&bpm.FetchPage(headerPageId).Data()[0]))
+	headerPage.SetFormatVersion(0)
+	bpm.UnpinPage(headerPageId, true)
+
+	// reopen. old index data is discarded and index must be rebuilt by caller
+	reopened := index.NewLinearProbeHashTableIndex(im, bpm, shi.GetLogManager(), 0, common.BucketSizeOfHashIndex, headerPageId)
+	testingpkg.Assert(t, reopened.IsFormatMigrated(), "old format index should be migrated")
+	testingpkg.Equals(t, 0, len(reopened.ScanKey(keyTuple, nil)))
+
+	reopened.InsertEntry(keyTuple, page.RID{PageId: 100000, SlotNum: 1}, nil)
+	testingpkg.Equals(t, []page.RID{{PageId: 100000, SlotNum: 1}}, reopened.ScanKey(keyTuple, nil))
+
+	// migration does not happen again
+	reopened = index.NewLinearProbeHashTableIndex(im, bpm, shi.GetLogManager(), 0, common.BucketSizeOfHashIndex, headerPageId)
+	testingpkg.Assert(t, !reopened.IsFormatMigrated(), "")
+	testingpkg.Equals(t, []page.RID{{PageId: 100000, SlotNum: 1}}, reopened.ScanKey(keyTuple, nil))
+
+	shi.CloseFilesForTesting()
 }
 
 func TestRecounstructionOfHashIndex(t *testing.T) {
@@ -159,7 +315,6 @@ func TestRecounstructionOfHashIndex(t *testing.T) {
 	log_recovery.Undo()
 
 	dman := shi.GetDiskManager()
-	dman.GCLogFile()
 	shi.GetLogManager().SetNextLSN(greatestLSN + 1)
 	c = catalog.RecoveryCatalogFromCatalogPage(shi.GetBufferPoolManager(), shi.GetLogManager(), shi.GetLockManager(), txn)
 
@@ -1,6 +1,7 @@
 package index
 
 import (
+	"github.com/ryogrid/SamehadaDB/recovery"
 	"github.com/ryogrid/SamehadaDB/samehada/samehada_util"
 	"github.com/ryogrid/SamehadaDB/types"
 
@@ -22,11 +23,11 @@ type LinearProbeHashTableIndex struct {
 	col_idx uint32
 }
 
-func NewLinearProbeHashTableIndex(metadata *IndexMetadata, buffer_pool_manager *buffer.BufferPoolManager, col_idx uint32,
+func NewLinearProbeHashTableIndex(metadata *IndexMetadata, buffer_pool_manager *buffer.BufferPoolManager, log_manager *recovery.LogManager, col_idx uint32,
 	num_buckets int, headerPageId types.PageID) *LinearProbeHashTableIndex {
 	ret := new(LinearProbeHashTableIndex)
 	ret.metadata = metadata
-	ret.container = *hash.NewLinearProbeHashTable(buffer_pool_manager, num_buckets, headerPageId)
+	ret.container = *hash.NewLinearProbeHashTable(buffer_pool_manager, log_manager, num_buckets, headerPageId)
 	ret.col_idx = col_idx
 	return ret
 }
@@ -47,28 +48,54 @@ func (htidx *LinearProbeHashTableIndex) InsertEntry(key *tuple.Tuple, rid page.R
 	tupleSchema_ := htidx.GetTupleSchema()
 	keyDataInBytes := key.GetValueInBytes(tupleSchema_, htidx.col_idx)
 
-	htidx.container.Insert(keyDataInBytes, samehada_util.PackRIDtoUint32(&rid))
+	err := htidx.container.Insert(keyDataInBytes, samehada_util.PackRIDtoUint64(&rid), transaction)
+	abortIfFailed(err, transaction)
 }
 
 func (htidx *LinearProbeHashTableIndex) DeleteEntry(key *tuple.Tuple, rid page.RID, transaction *access.Transaction) {
 	tupleSchema_ := htidx.GetTupleSchema()
 	keyDataInBytes := key.GetValueInBytes(tupleSchema_, htidx.col_idx)
 
-	htidx.container.Remove(keyDataInBytes, samehada_util.PackRIDtoUint32(&rid))
+	err := htidx.container.Remove(keyDataInBytes, samehada_util.PackRIDtoUint64(&rid), transaction)
+	abortIfFailed(err, transaction)
 }
 
 func (htidx *LinearProbeHashTableIndex) ScanKey(key *tuple.Tuple, transaction *access.Transaction) []page.RID {
 	tupleSchema_ := htidx.GetTupleSchema()
 	keyDataInBytes := key.GetValueInBytes(tupleSchema_, htidx.col_idx)
 
-	packed_values := htidx.container.GetValue(keyDataInBytes)
+	packed_values, err := htidx.container.GetValueWithErr(keyDataInBytes)
+	if abortIfFailed(err, transaction) {
+		return nil
+	}
 	var ret_arr []page.RID
 	for _, packed_val := range packed_values {
-		ret_arr = append(ret_arr, samehada_util.UnpackUint32toRID(packed_val))
+		ret_arr = append(ret_arr, samehada_util.UnpackUint64toRID(packed_val))
 	}
 	return ret_arr
 }
 
+// returns true when index data of old on-disk format was discarded at loading.
+// in this case, all entries should be inserted again
+func (htidx *LinearProbeHashTableIndex) IsFormatMigrated() bool {
+	return htidx.container.IsFormatMigrated()
+}
+
 func (htidx *LinearProbeHashTableIndex) GetHeaderPageId() types.PageID {
 	return htidx.container.GetHeaderPageId()
 }
+
+// aborts transaction when operation to index failed (e.g. buffer pool exhaustion).
+// err is recorded as abort reason of the transaction. returns true in that case
+func abortIfFailed(err error, transaction *access.Transaction) bool {
+	if err == nil {
+		return false
+	}
+	if transaction == nil {
+		// index data may be inconsistent with table and there is no way to report it
+		panic("operation to hash index failed: " + err.Error())
+	}
+	transaction.SetState(access.ABORTED)
+	transaction.SetAbortReason(err)
+	return true
+}
@@ -12,16 +12,23 @@ import (
 )
 
 type SkipListIndex struct {
-	container skip_list.SkipList
+	container *skip_list.SkipList
 	metadata  *IndexMetadata
 	// idx of target column on table
 	col_idx uint32
 }
 
-func NewSkipListIndex(metadata *IndexMetadata, buffer_pool_manager *buffer.BufferPoolManager, col_idx uint32) *SkipListIndex {
+// when headerPageId is not InvalidPageID, index is made on the header page of the index made at last launch.
+// entries are not loaded from it and pages of old entries are freed if db was shut down cleanly
+func NewSkipListIndex(metadata *IndexMetadata, buffer_pool_manager *buffer.BufferPoolManager, col_idx uint32, headerPageId types.PageID) *SkipListIndex {
 	ret := new(SkipListIndex)
 	ret.metadata = metadata
-	ret.container = *skip_list.NewSkipList(buffer_pool_manager, ret.metadata.GetTupleSchema().GetColumn(col_idx).GetType())
+	keyType := ret.metadata.GetTupleSchema().GetColumn(col_idx).GetType()
+	if headerPageId == types.InvalidPageID {
+		ret.container = skip_list.NewSkipList(buffer_pool_manager, keyType)
+	} else {
+		ret.container = skip_list.NewSkipListOnHeaderPage(buffer_pool_manager, keyType, headerPageId, buffer_pool_manager.WasShutDownCleanly())
+	}
 	ret.col_idx = col_idx
 	return ret
 }
@@ -45,33 +52,47 @@ func (slidx *SkipListIndex) GetHeaderPageId() types.PageID {
 	return slidx.container.GetHeaderPageId()
 }
 
+// NULL keys are not stored because NULL has no order with other values.
+// rows whose key is NULL never match conditions on the key, so they are not needed on the index
 func (slidx *SkipListIndex) InsertEntry(key *tuple.Tuple, rid page.RID, transaction *access.Transaction) {
 	tupleSchema_ := slidx.GetTupleSchema()
 	keyVal := key.GetValue(tupleSchema_, slidx.col_idx)
+	if keyVal.IsNull() {
+		return
+	}
 
-	slidx.container.Insert(&keyVal, samehada_util.PackRIDtoUint32(&rid))
+	slidx.container.Insert(&keyVal, samehada_util.PackRIDtoUint64(&rid))
 }
 
 func (slidx *SkipListIndex) DeleteEntry(key *tuple.Tuple, rid page.RID, transaction *access.Transaction) {
 	tupleSchema_ := slidx.GetTupleSchema()
 	keyVal := key.GetValue(tupleSchema_, slidx.col_idx)
+	if keyVal.IsNull() {
+		return
+	}
 
-	slidx.container.Remove(&keyVal, samehada_util.PackRIDtoUint32(&rid))
+	slidx.container.Remove(&keyVal, samehada_util.PackRIDtoUint64(&rid))
 }
 
 func (slidx *SkipListIndex) ScanKey(key *tuple.Tuple, transaction *access.Transaction) []page.RID {
 	tupleSchema_ := slidx.GetTupleSchema()
 	keyVal := key.GetValue(tupleSchema_, slidx.col_idx)
+	if keyVal.IsNull() {
+		return nil
+	}
 
-	packed_value := slidx.container.GetValue(&keyVal)
+	packed_values := slidx.container.GetValues(&keyVal)
 	var ret_arr []page.RID
-	ret_arr = append(ret_arr, samehada_util.UnpackUint32toRID(packed_value))
+	for _, packed_value := range packed_values {
+		ret_arr = append(ret_arr, samehada_util.UnpackUint64toRID(packed_value))
+	}
 	return ret_arr
 }
 
 // get iterator which iterates entry in key sorted order
 // and iterates specified key range.
 // when start_key arg is nil , start point is head of entry list. when end_key, end point is tail of the list
+// (entries of NULL keys are not stored. see InsertEntry)
 func (slidx *SkipListIndex) Iterator(start_key *tuple.Tuple, end_key *tuple.Tuple, transaction *access.Transaction) *skip_list.SkipListIterator {
 	tupleSchema_ := slidx.GetTupleSchema()
 	var start_val *types.Value = nil
@@ -3,32 +3,154 @@
 
 package page
 
-import "github.com/ryogrid/SamehadaDB/common"
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/types"
+)
 
+// max length of key which is stored in a slot of block page.
+// longer key is stored on overflow page and location of it is stored in the slot instead
+const HashTableInlineKeySize = 16
+
+/**
+ * key is hash of original key and it is used as fingerprint.
+ * original key data is kept on keyData or overflow page for checking
+ * whether a entry is for searched key really.
+ *
+ * keyData format:
+ *   keyLen <= HashTableInlineKeySize: key itself
+ *   keyLen >  HashTableInlineKeySize: | overflow PageId(4) | offset in overflow page(4) |
+ *
+ * value is packed RID (see samehada_util.PackRIDtoUint64)
+ */
 type HashTablePair struct {
-	key   uint32
-	value uint32
+	key     uint32
+	keyLen  uint32
+	value   uint64
+	keyData [HashTableInlineKeySize]byte
+}
+
+const sizeOfHashTablePair = 16 + HashTableInlineKeySize
+const sizeOfBlockPageHeader = 24
+const BlockArraySize = 4 * (common.PageSize - sizeOfBlockPageHeader) / (4*sizeOfHashTablePair + 1) //126
+
+// overflowPageId and overflowOffset are used only when length of key is larger than HashTableInlineKeySize
+func NewHashTablePair(hash uint32, value uint64, key []byte, overflowPageId types.PageID, overflowOffset uint32) HashTablePair {
+	ret := HashTablePair{key: hash, value: value, keyLen: uint32(len(key))}
+	if ret.IsInlineKey() {
+		copy(ret.keyData[:], key)
+	} else {
+		binary.LittleEndian.PutUint32(ret.keyData[0:], uint32(overflowPageId))
+		binary.LittleEndian.PutUint32(ret.keyData[4:], overflowOffset)
+	}
+	return ret
 }
 
-const sizeOfHashTablePair = 8
-const BlockArraySize = 4 * common.PageSize / (4*sizeOfHashTablePair + 1) //496
+func (pair HashTablePair) GetKey() uint32 {
+	return pair.key
+}
+
+func (pair HashTablePair) GetValue() uint64 {
+	return pair.value
+}
+
+func (pair HashTablePair) GetKeyLen() uint32 {
+	return pair.keyLen
+}
+
+func (pair HashTablePair) IsInlineKey() bool {
+	return pair.keyLen <= HashTableInlineKeySize
+}
+
+// returns key data which is stored in the slot. pair must have inline key
+func (pair HashTablePair) GetInlineKey() []byte {
+	return pair.keyData[:pair.keyLen]
+}
+
+// returns location of key data on overflow page. pair must not have inline key
+func (pair HashTablePair) GetOverflowLocation() (types.PageID, uint32) {
+	return types.PageID(binary.LittleEndian.Uint32(pair.keyData[0:])), binary.LittleEndian.Uint32(pair.keyData[4:])
+}
+
+func (pair HashTablePair) IsSameInlineKey(key []byte) bool {
+	return pair.IsInlineKey() && bytes.Equal(pair.GetInlineKey(), key)
+}
 
 /**
  * Store indexed key and value together within block page. Supports
- * non-unique keys.
+ * non-unique keys. A block page is a bucket of extendible hash table.
  *
  * Block page format (keys are stored in order):
- *  ----------------------------------------------------------------
- * | KEY(1) + VALUE(1) | KEY(2) + VALUE(2) | ... | KEY(n) + VALUE(n)
- *  ----------------------------------------------------------------
+ *  -----------------------------------------------------------------------------------------------------------------------------------------------------------
+ * | PageId(4) | LSN(4) | Checksum(4) | LocalDepth(4) | OverflowPageId(4) | NextBucketPageId(4) | Occupied | Readable | KEY(1) + VALUE(1) + KEY_DATA(1) | ...
+ *  -----------------------------------------------------------------------------------------------------------------------------------------------------------
  *
  *  Here '+' means concatenation.
+ *  PageId, LSN and Checksum are placed at same position with other page types
+ *  because LSN is used at redo of hash index operations.
+ *  OverflowPageId is the overflow page where long keys of this bucket are appended.
+ *  NextBucketPageId is the next block page of the bucket. block pages are chained when
+ *  entries of the bucket can not be separated by bucket split (e.g. many values of same key).
  *
  */
 type HashTableBlockPage struct {
-	occuppied [(BlockArraySize-1)/8 + 1]byte // 62 bytes (496 bits)
-	readable  [(BlockArraySize-1)/8 + 1]byte // 62 bytes (496 bits)
-	array     [BlockArraySize]HashTablePair  // 496 * 8 bytes
+	pageId           types.PageID
+	lsn              types.LSN
+	checksum         uint32
+	localDepth       uint32 // number of hash bits which are shared by keys in this bucket
+	overflowPageId   types.PageID
+	nextBucketPageId types.PageID
+	occuppied        [(BlockArraySize-1)/8 + 1]byte // 16 bytes (126 bits)
+	readable         [(BlockArraySize-1)/8 + 1]byte // 16 bytes (126 bits)
+	array            [BlockArraySize]HashTablePair  // 126 * 32 bytes
+}
+
+func (page *HashTableBlockPage) GetPageId() types.PageID {
+	return page.pageId
+}
+
+func (page *HashTableBlockPage) SetPageId(pageId types.PageID) {
+	page.pageId = pageId
+}
+
+func (page *HashTableBlockPage) GetLSN() types.LSN {
+	return page.lsn
+}
+
+func (page *HashTableBlockPage) SetLSN(lsn types.LSN) {
+	page.lsn = lsn
+}
+
+func (page *HashTableBlockPage) GetLocalDepth() uint32 {
+	return page.localDepth
+}
+
+func (page *HashTableBlockPage) SetLocalDepth(localDepth uint32) {
+	page.localDepth = localDepth
+}
+
+func (page *HashTableBlockPage) GetOverflowPageId() types.PageID {
+	return page.overflowPageId
+}
+
+func (page *HashTableBlockPage) SetOverflowPageId(pageId types.PageID) {
+	page.overflowPageId = pageId
+}
+
+func (page *HashTableBlockPage) GetNextBucketPageId() types.PageID {
+	return page.nextBucketPageId
+}
+
+func (page *HashTableBlockPage) SetNextBucketPageId(pageId types.PageID) {
+	page.nextBucketPageId = pageId
+}
+
+// clears all slots
+func (page *HashTableBlockPage) Reset() {
+	page.occuppied = [(BlockArraySize-1)/8 + 1]byte{}
+	page.readable = [(BlockArraySize-1)/8 + 1]byte{}
 }
 
 // Gets the key at an index in the block
@@ -37,17 +159,22 @@ func (page *HashTableBlockPage) KeyAt(index uint32) uint32 {
 }
 
 // Gets the value at an index in the block
-func (page *HashTableBlockPage) ValueAt(index uint32) uint32 {
+func (page *HashTableBlockPage) ValueAt(index uint32) uint64 {
 	return page.array[index].value
 }
 
-// Attempts to insert a key and value into an index in the baccess.
-func (page *HashTableBlockPage) Insert(index uint32, key uint32, value uint32) bool {
+// Gets the pair at an index in the block
+func (page *HashTableBlockPage) PairAt(index uint32) HashTablePair {
+	return page.array[index]
+}
+
+// Attempts to insert a pair into an index in the baccess.
+func (page *HashTableBlockPage) Insert(index uint32, pair HashTablePair) bool {
 	if page.IsOccupied(index) && page.IsReadable(index) {
 		return false
 	}
 
-	page.array[index] = HashTablePair{key, value}
+	page.array[index] = pair
 	page.occuppied[index/8] |= (1 << (index % 8))
 	page.readable[index/8] |= (1 << (index % 8))
 	return true
@@ -0,0 +1,55 @@
+package page
+
+import (
+	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+const DirectoryArraySize = (common.PageSize - 12) / 4 // 1021
+
+// max global depth which entries of directory can be stored
+// in directory pages listed on header page (2^19 <= 1018 * 1021)
+const HashTableMaxGlobalDepth = 19
+
+/**
+ *
+ * Directory Page for extendible hash table.
+ * directory entry of index i is stored at (i % DirectoryArraySize) of
+ * (i / DirectoryArraySize)th directory page.
+ *
+ * Directory page format (size in byte):
+ * -------------------------------------------------------------------------
+ * |  PageId(4) | LSN(4) | Checksum(4) | BucketPageIds (4) x 1021
+ * -------------------------------------------------------------------------
+ * all Page content size: 12 + 4 * 1021 = 4096
+ */
+type HashTableDirectoryPage struct {
+	pageId        types.PageID
+	lsn           types.LSN
+	checksum      uint32
+	bucketPageIds [DirectoryArraySize]types.PageID
+}
+
+func (page *HashTableDirectoryPage) GetPageId() types.PageID {
+	return page.pageId
+}
+
+func (page *HashTableDirectoryPage) SetPageId(pageId types.PageID) {
+	page.pageId = pageId
+}
+
+func (page *HashTableDirectoryPage) GetLSN() types.LSN {
+	return page.lsn
+}
+
+func (page *HashTableDirectoryPage) SetLSN(lsn types.LSN) {
+	page.lsn = lsn
+}
+
+func (page *HashTableDirectoryPage) GetBucketPageId(index uint32) types.PageID {
+	return page.bucketPageIds[index]
+}
+
+func (page *HashTableDirectoryPage) SetBucketPageId(index uint32, pageId types.PageID) {
+	page.bucketPageIds[index] = pageId
+}
@@ -5,26 +5,37 @@ package page
 
 import "github.com/ryogrid/SamehadaDB/types"
 
+const HeaderDirectoryPageIdsSize = 1018
+
+// version of on-disk format of hash index pages.
+// version 0 (FormatVersion field did not exist) stores values as 32bit packed RIDs
+// version 1 stores values as 64bit packed RIDs
+// version 2 adds NextBucketPageId to block pages
+const HashTableFormatVersion = 2
+
 /**
  *
- * Header Page for linear probing hash table.
+ * Header Page for extendible hash table.
+ *
+ * Header format (size in byte, 20 bytes in total):
+ * -------------------------------------------------------------------------------------------------------------------------------
+ * |  PageId(4) | LSN(4) | Checksum(4) | GlobalDepth(4) | NumDirectoryPages(4) | DirectoryPageIds (4) x 1018 | FormatVersion(4)
+ * -------------------------------------------------------------------------------------------------------------------------------
+ * all Page content size: 20 + 4 * 1018 + 4 = 4096
  *
- * Header format (size in byte, 12 bytes in total):
- * ----------------------------------------------------------------------
- * |  PageId(4) | NextBlockIndex(4) | Size (4) | BlockPageIds (4) x 1020
- * ----------------------------------------------------------------------
- * all Page content size: 12 + 4 * 1020 = 4092
+ * FormatVersion is placed at tail of page because the area was unused in old format
+ *
+ * directory of the hash table has 2^GlobalDepth entries and it is stored
+ * in directory pages (HashTableDirectoryPage) which are listed in this page
  */
 type HashTableHeaderPage struct {
-	pageId types.PageID
-	//lsn          int    // log sequence number
-	nextIndex    uint32 // the next index to add a new entry to blockPageIds
-	size         int    // the number of key/value pairs the hash table can hold
-	blockPageIds [1020]types.PageID
-}
-
-func (page *HashTableHeaderPage) GetBlockPageId(index uint32) types.PageID {
-	return page.blockPageIds[index]
+	pageId            types.PageID
+	lsn               types.LSN // log sequence number
+	checksum          uint32    // set by DiskManager
+	globalDepth       uint32    // number of hash bits used for indexing the directory
+	numDirectoryPages uint32    // the next index to add a new entry to directoryPageIds
+	directoryPageIds  [HeaderDirectoryPageIdsSize]types.PageID
+	formatVersion     uint32
 }
 
 func (page *HashTableHeaderPage) GetPageId() types.PageID {
@@ -35,27 +46,51 @@ func (page *HashTableHeaderPage) SetPageId(pageId types.PageID) {
 	page.pageId = pageId
 }
 
-//func (page *HashTableHeaderPage) GetLSN() int {
-//	return page.lsn
-//}
-//
-//func (page *HashTableHeaderPage) SetLSN(lsn int) {
-//	page.lsn = lsn
-//}
+func (page *HashTableHeaderPage) GetLSN() types.LSN {
+	return page.lsn
+}
+
+func (page *HashTableHeaderPage) SetLSN(lsn types.LSN) {
+	page.lsn = lsn
+}
+
+func (page *HashTableHeaderPage) GetFormatVersion() uint32 {
+	return page.formatVersion
+}
+
+func (page *HashTableHeaderPage) SetFormatVersion(version uint32) {
+	page.formatVersion = version
+}
+
+// clears directory. pages which are listed in this page are not reused
+func (page *HashTableHeaderPage) Reset() {
+	page.globalDepth = 0
+	page.numDirectoryPages = 0
+	page.directoryPageIds = [HeaderDirectoryPageIdsSize]types.PageID{}
+}
+
+func (page *HashTableHeaderPage) GetGlobalDepth() uint32 {
+	return page.globalDepth
+}
+
+func (page *HashTableHeaderPage) SetGlobalDepth(globalDepth uint32) {
+	page.globalDepth = globalDepth
+}
 
-func (page *HashTableHeaderPage) AddBlockPageId(pageId types.PageID) {
-	page.blockPageIds[page.nextIndex] = pageId
-	page.nextIndex++
+// returns number of entries of directory
+func (page *HashTableHeaderPage) GetDirectorySize() uint32 {
+	return 1 << page.globalDepth
 }
 
-func (page *HashTableHeaderPage) NumBlocks() uint32 {
-	return page.nextIndex
+func (page *HashTableHeaderPage) GetDirectoryPageId(index uint32) types.PageID {
+	return page.directoryPageIds[index]
 }
 
-func (page *HashTableHeaderPage) SetSize(size int) {
-	page.size = size
+func (page *HashTableHeaderPage) AddDirectoryPageId(pageId types.PageID) {
+	page.directoryPageIds[page.numDirectoryPages] = pageId
+	page.numDirectoryPages++
 }
 
-func (page *HashTableHeaderPage) GetSize() int {
-	return page.size
+func (page *HashTableHeaderPage) NumDirectoryPages() uint32 {
+	return page.numDirectoryPages
 }
@@ -0,0 +1,80 @@
+package page
+
+import (
+	"github.com/ryogrid/SamehadaDB/common"
+	"github.com/ryogrid/SamehadaDB/types"
+)
+
+const OverflowPageDataSize = common.PageSize - 20 // 4076
+
+/**
+ *
+ * Overflow page of extendible hash table.
+ * key data which is longer than HashTableInlineKeySize is appended to
+ * this page and slots of block pages point the data with (PageId, offset).
+ * overflow pages of a bucket are chained with NextPageId.
+ *
+ * Overflow page format (size in byte):
+ * -----------------------------------------------------------------------------------------
+ * |  PageId(4) | LSN(4) | Checksum(4) | NextPageId(4) | FreeSpacePointer(4) | KeyData ...
+ * -----------------------------------------------------------------------------------------
+ * all Page content size: 20 + 4076 = 4096
+ */
+type HashTableOverflowPage struct {
+	pageId           types.PageID
+	lsn              types.LSN
+	checksum         uint32
+	nextPageId       types.PageID
+	freeSpacePointer uint32 // offset in data where next key is appended
+	data             [OverflowPageDataSize]byte
+}
+
+func (page *HashTableOverflowPage) GetPageId() types.PageID {
+	return page.pageId
+}
+
+func (page *HashTableOverflowPage) SetPageId(pageId types.PageID) {
+	page.pageId = pageId
+}
+
+func (page *HashTableOverflowPage) GetLSN() types.LSN {
+	return page.lsn
+}
+
+func (page *HashTableOverflowPage) SetLSN(lsn types.LSN) {
+	page.lsn = lsn
+}
+
+func (page *HashTableOverflowPage) GetNextPageId() types.PageID {
+	return page.nextPageId
+}
+
+func (page *HashTableOverflowPage) SetNextPageId(pageId types.PageID) {
+	page.nextPageId = pageId
+}
+
+func (page *HashTableOverflowPage) GetFreeSpacePointer() uint32 {
+	return page.freeSpacePointer
+}
+
+func (page *HashTableOverflowPage) SetFreeSpacePointer(offset uint32) {
+	page.freeSpacePointer = offset
+}
+
+func (page *HashTableOverflowPage) GetFreeSpaceRemaining() uint32 {
+	return OverflowPageDataSize - page.freeSpacePointer
+}
+
+// writes key data at offset. free space pointer is moved to end of the data if needed
+func (page *HashTableOverflowPage) WriteKey(offset uint32, key []byte) {
+	copy(page.data[offset:], key)
+	if offset+uint32(len(key)) > page.freeSpacePointer {
+		page.freeSpacePointer = offset + uint32(len(key))
+	}
+}
+
+func (page *HashTableOverflowPage) ReadKey(offset uint32, keyLen uint32) []byte {
+	ret := make([]byte, keyLen)
+	copy(ret, page.data[offset:offset+keyLen])
+	return ret
+}
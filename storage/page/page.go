@@ -9,11 +9,16 @@ import (
 	"sync/atomic"
 )
 
-// PageSize is the size of a page in disk (4KB)
-// const PageSize = 4096
-const SizePageHeader = 8
+// size of a page is decided per database (see DiskManager::GetPageSize). common.PageSize is the default
+// every page starts with this header. checksum is set by DiskManager when the page is written.
+// (header was 8 bytes before checksum was added. db files of the format are rejected at open)
+// -------------------------------------------
+// | PageId (4) | LSN (4) | Checksum (4) | ...
+// -------------------------------------------
+const SizePageHeader = 12
 const OffsetPageStart = 0
 const OffsetLSN = 4
+const OffsetChecksum = 8
 
 /**
  * Page is the basic unit of storage within the database system. Page provides a wrapper for actual data pages being
@@ -25,15 +30,17 @@ const OffsetLSN = 4
 type PageIF interface {
 	DecPinCount()
 	IncPinCount()
+	GetPageId() types.PageID
 }
 
 // Page represents an abstract page on disk
 type Page struct {
-	id       types.PageID           // idenfies the page. It is used to find the offset of the page on disk
-	pinCount int32                  //int32                 // counts how many goroutines are acessing it
-	isDirty  bool                   // the page was modified but not flushed
-	data     *[common.PageSize]byte // bytes stored in disk
+	id       types.PageID // idenfies the page. It is used to find the offset of the page on disk
+	pinCount int32        //int32                 // counts how many goroutines are acessing it
+	isDirty  bool         // the page was modified but not flushed
+	data     []byte       // bytes stored in disk (length is page size of the database)
 	rwlatch_ common.ReaderWriterLatch
+	recLSN   types.LSN // LSN of the oldest log record which may be not reflected to the page on disk
 }
 
 // IncPinCount increments pin count
@@ -65,7 +72,7 @@ func (p *Page) ID() types.PageID {
 }
 
 // Data returns the data of the page
-func (p *Page) Data() *[common.PageSize]byte {
+func (p *Page) Data() []byte {
 	return p.data
 }
 
@@ -84,21 +91,26 @@ func (p *Page) Copy(offset uint32, data []byte) {
 	copy(p.data[offset:], data)
 }
 
-// New creates a new page
-func New(id types.PageID, isDirty bool, data *[common.PageSize]byte) *Page {
+// New creates a new page. length of data is the page size
+func New(id types.PageID, isDirty bool, data []byte) *Page {
 	//return &Page{id, int32(1), isDirty, data, common.NewUpgradableMutex()}
 
-	return &Page{id, int32(1), isDirty, data, common.NewRWLatch()}
+	return &Page{id, int32(1), isDirty, data, common.NewRWLatch(), common.InvalidLSN}
 
 	//// TODO: (SDB) customized RWMutex for concurrent skip list debug
 	//return &Page{id, uint32(1), isDirty, data, common.NewRWLatchDebug()}
 }
 
-// New creates a new empty page
+// New creates a new empty page of the default page size
 func NewEmpty(id types.PageID) *Page {
+	return NewEmptyWithSize(id, common.PageSize)
+}
+
+// NewEmptyWithSize creates a new empty page of pageSize bytes
+func NewEmptyWithSize(id types.PageID, pageSize int) *Page {
 	//return &Page{id, int32(1), false, &[common.PageSize]byte{}, common.NewUpgradableMutex()}
 
-	return &Page{id, int32(1), false, &[common.PageSize]byte{}, common.NewRWLatch()}
+	return &Page{id, int32(1), false, make([]byte, pageSize), common.NewRWLatch(), common.InvalidLSN}
 
 	//// TODO: (SDB) customized RWMutex for concurrent skip list debug
 	//return &Page{id, uint32(1), false, &[common.PageSize]byte{}, common.NewRWLatchDebug()}
@@ -117,9 +129,14 @@ func (p *Page) SetLSN(lsn types.LSN) {
 	copy(p.data[OffsetLSN:OffsetLSN+types.SizeOfLSN], lsn.Serialize())
 }
 
+/** recLSN is InvalidLSN when the page on disk is up to date and nobody pins the page. */
+func (p *Page) GetRecLSN() types.LSN { return p.recLSN }
+
+func (p *Page) SetRecLSN(lsn types.LSN) { p.recLSN = lsn }
+
 func (p *Page) GetPageId() types.PageID { return p.id }
 
-func (p *Page) GetData() *[common.PageSize]byte {
+func (p *Page) GetData() []byte {
 	return p.data
 }
 
@@ -12,7 +12,7 @@ import (
 )
 
 func TestNewPage(t *testing.T) {
-	p := New(types.PageID(0), false, &[common.PageSize]byte{})
+	p := New(types.PageID(0), false, make([]byte, common.PageSize))
 
 	testingpkg.Equals(t, types.PageID(0), p.ID())
 	testingpkg.Equals(t, uint32(1), p.PinCount())
@@ -26,7 +26,9 @@ func TestNewPage(t *testing.T) {
 	p.SetIsDirty(true)
 	testingpkg.Equals(t, true, p.IsDirty())
 	p.Copy(0, []byte{'H', 'E', 'L', 'L', 'O'})
-	testingpkg.Equals(t, [common.PageSize]byte{'H', 'E', 'L', 'L', 'O'}, *p.Data())
+	expected := make([]byte, common.PageSize)
+	copy(expected, "HELLO")
+	testingpkg.Equals(t, expected, p.Data())
 }
 
 func TestEmptyPage(t *testing.T) {
@@ -35,5 +37,5 @@ func TestEmptyPage(t *testing.T) {
 	testingpkg.Equals(t, types.PageID(0), p.ID())
 	testingpkg.Equals(t, uint32(1), p.PinCount())
 	testingpkg.Equals(t, false, p.IsDirty())
-	testingpkg.Equals(t, [common.PageSize]byte{}, *p.Data())
+	testingpkg.Equals(t, make([]byte, common.PageSize), p.Data())
 }
@@ -3,7 +3,6 @@ package skip_list_page
 import (
 	"bytes"
 	"encoding/binary"
-	"fmt"
 	"github.com/ryogrid/SamehadaDB/common"
 	"github.com/ryogrid/SamehadaDB/storage/buffer"
 	"github.com/ryogrid/SamehadaDB/storage/page"
@@ -19,9 +18,9 @@ import (
 //                                free space pointer
 //
 //  Header format (size in bytes):
-//  ----------------------------------------------------------------------------------------------------------
-//  | PageId (4)| LSN (4) | level (4)| entryCnt (4)| forward (4 * MAX_FOWARD_LIST_LEN) | FreeSpacePointer(4) |
-//  ---------------------------------------------------------------------------------------------------------
+//  ------------------------------------------------------------------------------------------------------------------------
+//  | PageId (4)| LSN (4) | Checksum (4) | level (4)| entryCnt (4)| forward (4 * MAX_FOWARD_LIST_LEN) | FreeSpacePointer(4) |
+//  ------------------------------------------------------------------------------------------------------------------------
 //  -------------------------------------------------------------
 //  | Entry_0 offset (2) | Entry_0 size (2) | ..................|
 //  ------------------------------------------------------------
@@ -29,7 +28,7 @@ import (
 //
 //  Entries format (size in bytes):
 //  ----------------------------------------------------------------------------------------------------------------------------------
-//  | HEADER | ... FREE SPACE ... | ....more entries....| Entry1_key (1+x) | Entry_1 value (4) | Entry0_key (1+x) | Entry_0 value (4)|
+//  | HEADER | ... FREE SPACE ... | ....more entries....| Entry1_key (1+x) | Entry_1 value (8) | Entry0_key (1+x) | Entry_0 value (8)|
 //  ---------------------------------------------------------------------------------------------------------------------------------
 //                                ^                    ^ <-------------- size ---------------> ^ <-------------- size --------------->
 //                                freeSpacePointer     offset(from page head)                  offset(...)
@@ -56,17 +55,17 @@ const (
 	sizeEntryInfo                       = sizeEntryInfoOffset + sizeEntryInfoSize
 	sizeBlockPageHeaderExceptEntryInfos = sizePageId + sizeLevel + sizeEntryCnt + sizeForward + sizeFreeSpacePointer
 	offsetPageId                        = int32(0)
-	offsetLevel                         = sizePageId + types.SizeOfLSN
+	offsetLevel                         = uint32(page.SizePageHeader)
 	offsetEntryCnt                      = offsetLevel + sizeLevel
 	offsetForward                       = offsetEntryCnt + sizeEntryCnt
 	offsetFreeSpacePointer              = offsetForward + sizeForward
 	offsetEntryInfos                    = offsetFreeSpacePointer + sizeFreeSpacePointer
-	sizeEntryValue                      = uint32(4)
+	sizeEntryValue                      = uint32(8)
 )
 
 type SkipListPair struct {
 	Key   types.Value
-	Value uint32
+	Value uint64 // packed RID (see samehada_util.PackRIDtoUint64)
 }
 
 type SkipListCornerInfo struct {
@@ -90,10 +89,29 @@ func NewSkipListPairFromBytes(buf []byte, keyType types.TypeID) *SkipListPair {
 	dataLen := len(buf)
 	valPartOffset := dataLen - int(sizeEntryValue)
 	key := types.NewValueFromBytes(buf[:valPartOffset], keyType)
-	value := uint32(types.NewUInt32FromBytes(buf[valPartOffset:]))
+	value := binary.LittleEndian.Uint64(buf[valPartOffset:])
 	return &SkipListPair{*key, value}
 }
 
+// entries of skip list are ordered by Key first and Value second.
+// Value works as tie-breaker, so same key can be stored with different values
+func (sp SkipListPair) CompareLessThan(right SkipListPair) bool {
+	if sp.Key.CompareLessThan(right.Key) {
+		return true
+	} else if right.Key.CompareLessThan(sp.Key) {
+		return false
+	}
+	return sp.Value < right.Value
+}
+
+func (sp SkipListPair) CompareEquals(right SkipListPair) bool {
+	return !sp.CompareLessThan(right) && !right.CompareLessThan(sp)
+}
+
+func (sp SkipListPair) CompareLessThanOrEqual(right SkipListPair) bool {
+	return !right.CompareLessThan(sp)
+}
+
 func (sp SkipListPair) GetDataSize() uint32 {
 	keyInBytes := sp.Key.Serialize()
 
@@ -118,7 +136,7 @@ func NewSkipListBlockPage(bpm *buffer.BufferPoolManager, level int32, smallestLi
 	ret.SetEntryCnt(0)
 	ret.SetLevel(level)
 	ret.initForwardEntries()
-	ret.SetFreeSpacePointer(common.PageSize)
+	ret.SetFreeSpacePointer(uint32(len(ret.Data())))
 	tmpSmallestListPair := smallestListPair
 	// EntryCnt is incremented to 1
 	ret.SetEntry(0, &tmpSmallestListPair)
@@ -142,26 +160,29 @@ func (node *SkipListBlockPage) KeyAt(idx int32, keyType types.TypeID) *types.Val
 }
 
 // Gets the value at an index in this node
-func (node *SkipListBlockPage) ValueAt(idx int32, keyType types.TypeID) uint32 {
+func (node *SkipListBlockPage) ValueAt(idx int32, keyType types.TypeID) uint64 {
 	val := node.GetEntry(int(idx), keyType).Value
 	return val
 }
 
-// if not found, returns info of nearest smaller key
+// if not found, returns info of nearest smaller entry
+// entries are ordered by (Key, Value) pair, so entries which have same key are stored
+// in order of Value
 // binary search is used for search
 // https://www.cs.usfca.edu/~galles/visualization/Search.html
-func (node *SkipListBlockPage) FindEntryByKey(key *types.Value) (found bool, entry *SkipListPair, index int32) {
+func (node *SkipListBlockPage) FindEntry(target *SkipListPair) (found bool, entry *SkipListPair, index int32) {
+	keyType := target.Key.ValueType()
 	if node.GetEntryCnt() == 1 {
-		if node.GetEntry(0, key.ValueType()).Key.CompareEquals(*key) {
-			return true, node.GetEntry(0, key.ValueType()), 0
+		if node.GetEntry(0, keyType).CompareEquals(*target) {
+			return true, node.GetEntry(0, keyType), 0
 		} else {
-			if node.GetEntry(0, key.ValueType()).Key.IsInfMin() {
-				return false, node.GetEntry(0, key.ValueType()), 0
+			if node.GetEntry(0, keyType).Key.IsInfMin() {
+				return false, node.GetEntry(0, keyType), 0
 			} else {
-				if node.GetEntry(0, key.ValueType()).Key.CompareLessThan(*key) {
-					return false, node.GetEntry(0, key.ValueType()), 0
+				if node.GetEntry(0, keyType).CompareLessThan(*target) {
+					return false, node.GetEntry(0, keyType), 0
 				} else {
-					return false, node.GetEntry(0, key.ValueType()), -1
+					return false, node.GetEntry(0, keyType), -1
 				}
 
 			}
@@ -173,21 +194,22 @@ func (node *SkipListBlockPage) FindEntryByKey(key *types.Value) (found bool, ent
 
 		for lowIdx <= highIdx {
 			midIdx = (lowIdx + highIdx) / 2
-			if node.KeyAt(midIdx, key.ValueType()).CompareEquals(*key) {
-				return true, node.GetEntry(int(midIdx), key.ValueType()), midIdx
-			} else if node.KeyAt(midIdx, key.ValueType()).CompareLessThan(*key) {
+			midEntry := node.GetEntry(int(midIdx), keyType)
+			if midEntry.CompareEquals(*target) {
+				return true, midEntry, midIdx
+			} else if midEntry.CompareLessThan(*target) {
 				lowIdx = midIdx + 1
 			} else {
 				highIdx = midIdx - 1
 			}
 		}
 		if lowIdx < highIdx {
-			return false, node.GetEntry(int(lowIdx), key.ValueType()), lowIdx
+			return false, node.GetEntry(int(lowIdx), keyType), lowIdx
 		} else {
 			if highIdx < 0 {
-				return false, node.GetEntry(0, key.ValueType()), 0
+				return false, node.GetEntry(0, keyType), 0
 			} else {
-				return false, node.GetEntry(int(highIdx), key.ValueType()), highIdx
+				return false, node.GetEntry(int(highIdx), keyType), highIdx
 			}
 		}
 	}
@@ -239,7 +261,7 @@ func (node *SkipListBlockPage) InsertInner(idx int, slp *SkipListPair) {
 }
 
 func (node *SkipListBlockPage) getSplitIdxForNotFixed() (splitIdx_ int32, isNeedSplit bool) {
-	halfOfmaxSize := int((common.PageSize - offsetEntryInfos) / 2)
+	halfOfmaxSize := (len(node.Data()) - int(offsetEntryInfos)) / 2
 	curSize := 0
 	entryCnt := int(node.GetEntryCnt())
 	splitIdx := -1
@@ -261,43 +283,24 @@ func (node *SkipListBlockPage) getSplitIdxForNotFixed() (splitIdx_ int32, isNeed
 
 // Attempts to insert a key and value into an index in the baccess
 // return value is whether newNode is created or not
-func (node *SkipListBlockPage) Insert(key *types.Value, value uint32, bpm *buffer.BufferPoolManager, corners []SkipListCornerInfo,
+func (node *SkipListBlockPage) Insert(key *types.Value, value uint64, bpm *buffer.BufferPoolManager, corners []SkipListCornerInfo,
 	level int32) (isNeedRetry_ bool) {
 	if common.EnableDebug {
 		common.ShPrintf(common.DEBUG_INFO, "Insert of SkipListBlockPage called! : key=%v\n", key.ToIFValue())
 	}
 
-	found, _, foundIdx := node.FindEntryByKey(key)
+	found, _, foundIdx := node.FindEntry(&SkipListPair{*key, value})
 	isSuccess := false
 	isSplited := false
 	var lockedAndPinnedNodes []*SkipListBlockPage = nil
 	var splitIdx int32 = -1
 	if found {
-		//fmt.Println("found at Insert")
-		// over write exsiting entry
-		if !node.GetEntry(int(foundIdx), key.ValueType()).Key.CompareEquals(*key) {
-			panic("overwriting wrong entry!")
-		}
-
-		fmt.Println("Insert: key duplicatin occured")
-		// TODO: (SDB) for concurrent running test
-		//if node.GetEntry(int(foundIdx), key.ValueType()).Key.CompareEquals(*key) {
-		//	panic("key duplication is not supported yet!")
-		//}
-		//
-		//node.SetEntry(int(foundIdx), &SkipListPair{*key, value})
-		////fmt.Printf("end of Insert of SkipListBlockPage called! : key=%d page.entryCnt=%d len(page.entries)=%d\n", key.ToInteger(), node.entryCnt, len(node.entries))
-		//
-		//if node.GetEntry(int(foundIdx), key.ValueType()).Key.CompareEquals(*key) {
-		//	node.SetEntryCnt(node.GetEntryCnt() - 1)
-		//}
-		//
-		//node.SetLSN(node.GetLSN() + 1)
-
-		bpm.UnpinPage(node.GetPageId(), true)
+		// same key and value pair is already stored. so nothing to do
+		// (entries which have same key and different value can be stored)
+		bpm.UnpinPage(node.GetPageId(), false)
 		node.WUnlatch()
 		if common.EnableDebug {
-			common.ShPrintf(common.DEBUG_INFO, "SkipListBlockPage::Insert: finish (replace). key=%v\n", key.ToIFValue())
+			common.ShPrintf(common.DEBUG_INFO, "SkipListBlockPage::Insert: finish (already exist). key=%v\n", key.ToIFValue())
 		}
 		return false
 	} else { // !found
@@ -584,13 +587,15 @@ func unlockAndUnpinNodes(bpm *buffer.BufferPoolManager, checkedNodes []*SkipList
 	common.ShPrintf(common.DEBUG_INFO, "unlockAndUnpinNodes: finished. len(checkNodes)=%d\n", len(checkedNodes))
 }
 
-func (node *SkipListBlockPage) Remove(bpm *buffer.BufferPoolManager, key *types.Value, predOfCorners []SkipListCornerInfo, corners []SkipListCornerInfo) (isNodeShouldBeDeleted bool, isDeleted bool, isNeedRetry bool) {
+// only the entry which has same key and value is removed
+func (node *SkipListBlockPage) Remove(bpm *buffer.BufferPoolManager, key *types.Value, value uint64, predOfCorners []SkipListCornerInfo, corners []SkipListCornerInfo) (isNodeShouldBeDeleted bool, isDeleted bool, isNeedRetry bool) {
 	if common.EnableDebug {
 		common.ShPrintf(common.DEBUG_INFO, "SkipListBlockPage::Remove: start. key=%v\n", key.ToIFValue())
 	}
-	found, _, foundIdx := node.FindEntryByKey(key)
+	target := &SkipListPair{*key, value}
+	found, _, foundIdx := node.FindEntry(target)
 	if found && (node.GetEntryCnt() == 1) {
-		if !node.GetEntry(0, key.ValueType()).Key.CompareEquals(*key) {
+		if !node.GetEntry(0, key.ValueType()).CompareEquals(*target) {
 			panic("removing wrong entry!")
 		}
 
@@ -647,7 +652,7 @@ func (node *SkipListBlockPage) Remove(bpm *buffer.BufferPoolManager, key *types.
 
 		return true, true, false
 	} else if found {
-		if !node.GetEntry(int(foundIdx), key.ValueType()).Key.CompareEquals(*key) {
+		if !node.GetEntry(int(foundIdx), key.ValueType()).CompareEquals(*target) {
 			panic("removing wrong entry!")
 		}
 
@@ -807,6 +812,10 @@ func (node *SkipListBlockPage) GetSmallestKey(keyType types.TypeID) types.Value
 	return node.GetEntry(0, keyType).Key
 }
 
+func (node *SkipListBlockPage) GetSmallestEntry(keyType types.TypeID) SkipListPair {
+	return *node.GetEntry(0, keyType)
+}
+
 func (node *SkipListBlockPage) GetForwardEntry(idx int) types.PageID {
 	return types.NewPageIDFromBytes(node.Data()[offsetForward+uint32(idx)*sizeForwardEntry:])
 }
@@ -926,12 +935,12 @@ func (node *SkipListBlockPage) SetEntries(entries []*SkipListPair) {
 	}
 	entriesInBytes := buf.Bytes()
 	copySize := len(entriesInBytes)
-	offset := common.PageSize - copySize
+	offset := len(node.Data()) - copySize
 	copy(node.Data()[offset:], entriesInBytes)
 
 	// set entry offset infos here
 	// because offset info can't calculate above loop efficiently
-	entryOffset := uint32(common.PageSize)
+	entryOffset := uint32(len(node.Data()))
 	for ii := 0; ii < entryNum; ii++ {
 		entryOffset = entryOffset - entrySizes[ii]
 		node.SetEntryOffset(ii, uint16(entryOffset))
@@ -12,7 +12,7 @@ import (
 
 const (
 	hOffsetPageId     = 0
-	offsetStartPageId = page.OffsetLSN + types.SizeOfLSN
+	offsetStartPageId = page.SizePageHeader
 	offsetKeyType     = offsetStartPageId + sizeStartPageId
 	hSizePageId       = 4
 	sizeStartPageId   = 4
@@ -24,10 +24,10 @@ const (
  * Header Page for Skip list.
  * (Header Page is placed page memory area. so serialization/desirialization of each member is not needed)
  *
- * page format (size in byte, 12 bytes in total):
- * -----------------------------------------------------------
- * | pageID (4) | LSN(4) | listStartPageId (4) | keyType (4) |
- * ----------------------------------------------------------
+ * page format (size in byte, 20 bytes in total):
+ * --------------------------------------------------------------------------
+ * | pageID (4) | LSN(4) | Checksum(4) | listStartPageId (4) | keyType (4) |
+ * --------------------------------------------------------------------------
  */
 
 const (
@@ -135,6 +135,10 @@ func NewSkipListHeaderPage(bpm *buffer.BufferPoolManager, keyType types.TypeID)
 	startNode, sentinelNode := NewSkipListStartBlockPage(bpm, keyType)
 	headerPage.SetListStartPageId(startNode.GetPageId())
 	headerPage.SetKeyType(keyType)
+	// page id of header page is recorded in catalog and it is fetched at relaunch. so it is written to disk here
+	bpm.FlushPage(headerPage.GetPageId())
+	// increment pin count because pin count is decremented on FlushPage
+	bpm.IncPinOfPage(headerPage)
 
 	//retPageID := headerPage.GetPageId()
 	//bpm.UnpinPage(headerPage.GetPageId(), true)
@@ -4,6 +4,10 @@
 package column
 
 import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
 	"github.com/ryogrid/SamehadaDB/storage/index/index_constants"
 	"github.com/ryogrid/SamehadaDB/types"
 )
@@ -12,7 +16,8 @@ type Column struct {
 	columnName        string
 	columnType        types.TypeID
 	fixedLength       uint32 // For a non-inlined column, this is the size of a pointer. Otherwise, the size of the fixed length column
-	variableLength    uint32 // For an inlined column, 0. Otherwise, the length of the variable length column
+	variableLength    uint32 // For an inlined column, 0. Otherwise, the declared max length (in characters) of the variable length column. 0 means no limit
+	isFixedChar       bool   // CHAR(n) column. values are padded with spaces to variableLength when they are stored
 	columnOffset      uint32 // Column offset in the tuple
 	hasIndex          bool   // whether the column has index data
 	indexKind         index_constants.IndexKind
@@ -26,10 +31,23 @@ type Column struct {
 // expr argument should be pointer of subtype of expression.Expression
 func NewColumn(name string, columnType types.TypeID, hasIndex bool, indexKind index_constants.IndexKind, indexHeaderPageID types.PageID, expr interface{}) *Column {
 	if columnType != types.Varchar {
-		return &Column{name, columnType, columnType.Size(), 0, 0, hasIndex, indexKind, indexHeaderPageID, true, expr}
+		return &Column{name, columnType, columnType.Size(), 0, false, 0, hasIndex, indexKind, indexHeaderPageID, true, expr}
 	}
 
-	return &Column{name, types.Varchar, 4, 255, 0, hasIndex, indexKind, indexHeaderPageID, true, expr}
+	return &Column{name, types.Varchar, 4, 0, false, 0, hasIndex, indexKind, indexHeaderPageID, true, expr}
+}
+
+/**
+ * ValueTooLongError is returned when a value is longer than the declared length of the column
+ */
+type ValueTooLongError struct {
+	ColumnName string
+	MaxLength  uint32
+	Length     uint32
+}
+
+func (e *ValueTooLongError) Error() string {
+	return fmt.Sprintf("value is too long for column %s (length: %d, max length: %d)", e.ColumnName, e.Length, e.MaxLength)
 }
 
 func (c *Column) IsInlined() bool {
@@ -64,6 +82,51 @@ func (c *Column) SetVariableLength(variableLength uint32) {
 	c.variableLength = variableLength
 }
 
+func (c *Column) IsFixedChar() bool {
+	return c.isFixedChar
+}
+
+func (c *Column) SetIsFixedChar(isFixedChar bool) {
+	c.isFixedChar = isFixedChar
+}
+
+// CheckValueLength returns ValueTooLongError when val exceeds the declared length of the column.
+// length is counted in characters and trailing spaces are not counted for CHAR(n) column
+func (c *Column) CheckValueLength(val types.Value) error {
+	if c.columnType != types.Varchar || c.variableLength == 0 || val.IsNull() {
+		return nil
+	}
+	str := val.ToVarchar()
+	if c.isFixedChar {
+		str = strings.TrimRight(str, " ")
+	}
+	if length := uint32(utf8.RuneCountInString(str)); length > c.variableLength {
+		return &ValueTooLongError{c.columnName, c.variableLength, length}
+	}
+	return nil
+}
+
+// PadValue returns val padded with spaces to the declared length when the column is CHAR(n).
+// otherwise val is returned as is
+func (c *Column) PadValue(val types.Value) types.Value {
+	if !c.isFixedChar || val.IsNull() {
+		return val
+	}
+	str := strings.TrimRight(val.ToVarchar(), " ")
+	if padLen := int(c.variableLength) - utf8.RuneCountInString(str); padLen > 0 {
+		str += strings.Repeat(" ", padLen)
+	}
+	return types.NewVarchar(str)
+}
+
+// TrimPadding removes padding added by PadValue (trailing spaces of CHAR(n) value are not returned)
+func (c *Column) TrimPadding(val types.Value) types.Value {
+	if !c.isFixedChar || val.IsNull() {
+		return val
+	}
+	return types.NewVarchar(strings.TrimRight(val.ToVarchar(), " "))
+}
+
 func (c *Column) GetColumnName() string {
 	return c.columnName
 }
@@ -15,11 +15,24 @@ import (
 
 var TupleSizeOffsetInLogrecord = 4 // payload size info in Bytes
 
+const tupleHeaderMagic = uint16(0xFFFE)
+const tupleHeaderSize = uint32(2)
+
 /**
  * Tuple format:
+ * -------------------------------------------------------------------------------------------------------
+ * | HEADER (magic, 2 bytes) | NULL BITMAP | FIXED-SIZE or VARIED-SIZED OFFSET | PAYLOAD OF VARIED-SIZED FIELD |
+ * -------------------------------------------------------------------------------------------------------
+ * bit i of NULL BITMAP (bit i%8 of byte i/8) is set when value of column i is NULL.
+ * NULL value is stored as zero value of the column type (varchar has no payload).
+ *
+ * Legacy tuple format (db format version 1 and older):
  * ---------------------------------------------------------------------
  * | FIXED-SIZE or VARIED-SIZED OFFSET | PAYLOAD OF VARIED-SIZED FIELD |
  * ---------------------------------------------------------------------
+ * each value (inlined value and payload of varchar) has a leading null flag byte.
+ * legacy tuple is distinguished by absence of the magic. the first byte of it is a null flag (0 or 1),
+ * or an offset of varchar payload which can't be 0xFFFE because fixed-size part of tuple is shorter than it.
  */
 type Tuple struct {
 	rid  *page.RID
@@ -33,31 +46,62 @@ func NewTuple(rid *page.RID, size uint32, data []byte) *Tuple {
 
 // NewTupleFromSchema creates a new tuple based on input value
 func NewTupleFromSchema(values []types.Value, schema_ *schema.Schema) *Tuple {
+	// values of CHAR(n) columns are stored with padding (values passed by caller are not modified)
+	isCopied := false
+	for i, column_ := range schema_.GetColumns() {
+		if column_.IsFixedChar() {
+			if !isCopied {
+				values = append([]types.Value{}, values...)
+				isCopied = true
+			}
+			values[i] = column_.PadValue(values[i])
+		}
+	}
+
 	// calculate tuple size considering varchar columns
-	tupleSize := schema_.Length()
+	colCount := schema_.GetColumnCount()
+	fixedSizePartOffset := tupleHeaderSize + nullBitmapSize(colCount)
+	tupleSize := fixedSizePartOffset + schema_.Length()
 	for _, colIndex := range schema_.GetUnlinedColumns() {
-		tupleSize += values[colIndex].Size()
+		if !values[colIndex].IsNull() {
+			tupleSize += values[colIndex].Size()
+		}
 	}
 	tuple_ := &Tuple{}
 	tuple_.size = tupleSize
 
 	// allocate memory
 	tuple_.data = make([]byte, tupleSize)
+	binary.LittleEndian.PutUint16(tuple_.data, tupleHeaderMagic)
 
 	// serialize each attribute base on the input value
-	tupleEndOffset := schema_.Length()
-	for i := uint32(0); i < schema_.GetColumnCount(); i++ {
-		if schema_.GetColumn(i).IsInlined() {
-			tuple_.Copy((*(schema_.GetColumn(i))).GetOffset(), values[i].Serialize())
+	tupleEndOffset := fixedSizePartOffset + schema_.Length()
+	for i := uint32(0); i < colCount; i++ {
+		column_ := schema_.GetColumn(i)
+		if values[i].IsNull() {
+			// zero value is left on fixed-size part
+			tuple_.data[tupleHeaderSize+i/8] |= 1 << (i % 8)
+		}
+		if column_.IsInlined() {
+			if !values[i].IsNull() {
+				tuple_.Copy(fixedSizePartOffset+column_.GetOffset(), values[i].SerializeWithoutNullFlag())
+			}
 		} else {
-			tuple_.Copy((*(schema_.GetColumn(i))).GetOffset(), types.UInt32(tupleEndOffset).Serialize())
-			tuple_.Copy(tupleEndOffset, values[i].Serialize())
-			tupleEndOffset += values[i].Size()
+			tuple_.Copy(fixedSizePartOffset+column_.GetOffset(), types.UInt32(tupleEndOffset).Serialize())
+			if !values[i].IsNull() {
+				tuple_.Copy(tupleEndOffset, values[i].SerializeWithoutNullFlag())
+				tupleEndOffset += values[i].Size()
+			}
 		}
 	}
 	return tuple_
 }
 
+// returns size of null bitmap of tuple which has colCount columns
+func nullBitmapSize(colCount uint32) uint32 {
+	return (colCount + 7) / 8
+}
+
 // generate tuple obj for hash index search
 // generated tuple filled only specifed column only due to use methods
 // defined on Index interface
@@ -91,76 +135,60 @@ func GenTupleForHashIndexSearch(schema_ *schema.Schema, colIndex uint32, keyVal
 
 func (t *Tuple) GetValue(schema *schema.Schema, colIndex uint32) types.Value {
 	column := *(schema.GetColumn(colIndex))
-	offset := column.GetOffset()
+	return column.TrimPadding(t.getStoredValue(schema, colIndex))
+}
+
+// GetValueInBytes returns serialized value with null flag (see types.Value::Serialize). it is used as key of index.
+// values of CHAR(n) columns are returned with padding
+func (t *Tuple) GetValueInBytes(schema *schema.Schema, colIndex uint32) []byte {
+	return t.getStoredValue(schema, colIndex).Serialize()
+}
+
+// returns value as it is stored (values of CHAR(n) columns have padding)
+func (t *Tuple) getStoredValue(schema *schema.Schema, colIndex uint32) types.Value {
+	if t.IsLegacyFormat() {
+		return t.getStoredValueOfLegacyFormat(schema, colIndex)
+	}
+
+	column := *(schema.GetColumn(colIndex))
+	if t.data[tupleHeaderSize+colIndex/8]&(1<<(colIndex%8)) != 0 {
+		return types.NewNull(column.GetType())
+	}
+
+	offset := tupleHeaderSize + nullBitmapSize(schema.GetColumnCount()) + column.GetOffset()
 	if !column.IsInlined() {
 		offset = uint32(types.NewUInt32FromBytes(t.data[offset : offset+column.FixedLength()]))
 	}
 
-	value := types.NewValueFromBytes(t.data[offset:], column.GetType())
+	value := types.NewValueFromBytesWithoutNullFlag(t.data[offset:], column.GetType())
 	if value == nil {
 		panic(value)
 	}
 	return *value
 }
 
-func (t *Tuple) GetValueInBytes(schema *schema.Schema, colIndex uint32) []byte {
+// IsLegacyFormat returns true when the tuple is stored in legacy tuple format (see comment of Tuple)
+func (t *Tuple) IsLegacyFormat() bool {
+	return t.size < tupleHeaderSize || binary.LittleEndian.Uint16(t.data) != tupleHeaderMagic
+}
+
+func (t *Tuple) getStoredValueOfLegacyFormat(schema *schema.Schema, colIndex uint32) types.Value {
+	// fixed-size part of legacy format has null flag for each inlined value
+	offset := uint32(0)
+	for i := uint32(0); i < colIndex; i++ {
+		column_ := schema.GetColumn(i)
+		if column_.IsInlined() {
+			offset += 1 + column_.FixedLength()
+		} else {
+			offset += column_.FixedLength()
+		}
+	}
+
 	column := *(schema.GetColumn(colIndex))
-	offset := column.GetOffset()
 	if !column.IsInlined() {
 		offset = uint32(types.NewUInt32FromBytes(t.data[offset : offset+column.FixedLength()]))
 	}
-
-	switch column.GetType() {
-	case types.Integer:
-		buf := bytes.NewBuffer(t.data[offset:])
-		isNull := new(bool)
-		binary.Read(buf, binary.LittleEndian, isNull)
-		v := new(int32)
-		binary.Read(buf, binary.LittleEndian, v)
-		retBuf := new(bytes.Buffer)
-		binary.Write(retBuf, binary.LittleEndian, *isNull)
-		binary.Write(retBuf, binary.LittleEndian, *v)
-		return retBuf.Bytes()
-	case types.Float:
-		buf := bytes.NewBuffer(t.data[offset:])
-		isNull := new(bool)
-		binary.Read(buf, binary.LittleEndian, isNull)
-		v := new(int32)
-		binary.Read(buf, binary.LittleEndian, v)
-		retBuf := new(bytes.Buffer)
-		binary.Write(retBuf, binary.LittleEndian, *isNull)
-		binary.Write(retBuf, binary.LittleEndian, *v)
-		return retBuf.Bytes()
-	case types.Boolean:
-		buf := bytes.NewBuffer(t.data[offset:])
-		isNull := new(bool)
-		binary.Read(buf, binary.LittleEndian, isNull)
-		v := new(bool)
-		binary.Read(buf, binary.LittleEndian, v)
-		retBuf := new(bytes.Buffer)
-		binary.Write(retBuf, binary.LittleEndian, *isNull)
-		binary.Write(retBuf, binary.LittleEndian, *v)
-		return retBuf.Bytes()
-	case types.Varchar:
-		buf := bytes.NewBuffer(t.data[offset:])
-		isNull := new(bool)
-		binary.Read(buf, binary.LittleEndian, isNull)
-		//data := t.data[offset:]
-		//lengthInBytes := data[0:2]
-		length := new(int16)
-		binary.Read(buf, binary.LittleEndian, length)
-		//binary.Read(bytes.NewBuffer(lengthInBytes), binary.LittleEndian, length)
-		retBuf := new(bytes.Buffer)
-		binary.Write(retBuf, binary.LittleEndian, *isNull)
-		binary.Write(retBuf, binary.LittleEndian, *length)
-		retArr := make([]byte, 0)
-		retArr = append(retArr, retBuf.Bytes()...)
-		retArr = append(retArr, t.data[offset+(1+2):offset+(uint32(*length)+(1+2))]...)
-		return retArr
-		//return data[2:(*length + 2)]
-	default:
-		panic("illegal type column found in schema")
-	}
+	return *types.NewValueFromBytes(t.data[offset:], column.GetType())
 }
 
 func (t *Tuple) Size() uint32 {
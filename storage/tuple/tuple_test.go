@@ -5,6 +5,7 @@
 package tuple
 
 import (
+	"fmt"
 	"github.com/ryogrid/SamehadaDB/storage/index/index_constants"
 	"testing"
 
@@ -40,6 +41,68 @@ func TestTuple(t *testing.T) {
 	testingpkg.Equals(t, expE, tuple.GetValue(schema, 4).ToVarchar())
 
 	//testingpkg.Equals(t, uint32(96), tuple.Size())
-	// added info of isNull(bool, 1byte) * 5 to 96(hos no info of isNull)
-	testingpkg.Equals(t, uint32(101), tuple.Size())
+	//// added info of isNull(bool, 1byte) * 5 to 96(hos no info of isNull)
+	//testingpkg.Equals(t, uint32(101), tuple.Size())
+	// added header (2 bytes) and null bitmap (1 byte) to 96
+	testingpkg.Equals(t, uint32(99), tuple.Size())
+}
+
+func TestTupleNullBitmap(t *testing.T) {
+	// 10 columns needs 2 bytes of null bitmap
+	columns := make([]*column.Column, 0)
+	row := make([]types.Value, 0)
+	for ii := 0; ii < 10; ii++ {
+		if ii%2 == 0 {
+			columns = append(columns, column.NewColumn(fmt.Sprintf("c%d", ii), types.Integer, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil))
+			row = append(row, types.NewInteger(int32(ii)))
+		} else {
+			columns = append(columns, column.NewColumn(fmt.Sprintf("c%d", ii), types.Varchar, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil))
+			row = append(row, types.NewVarchar(fmt.Sprintf("val%d", ii)))
+		}
+	}
+	schema_ := schema.NewSchema(columns)
+	row[3] = types.NewNull(types.Varchar)
+	row[8] = types.NewNull(types.Integer)
+	row[9] = types.NewNull(types.Null)
+
+	tuple_ := NewTupleFromSchema(row, schema_)
+	testingpkg.SimpleAssert(t, !tuple_.IsLegacyFormat())
+
+	for ii := uint32(0); ii < 10; ii++ {
+		val := tuple_.GetValue(schema_, ii)
+		// NULL value keeps type of the column
+		testingpkg.Equals(t, schema_.GetColumn(ii).GetType(), val.ValueType())
+		if ii == 3 || ii == 8 || ii == 9 {
+			testingpkg.SimpleAssert(t, val.IsNull())
+		} else {
+			testingpkg.SimpleAssert(t, !val.IsNull())
+			testingpkg.SimpleAssert(t, val.CompareEquals(row[ii]))
+		}
+	}
+
+	// key of index has null flag
+	testingpkg.Equals(t, []byte{1, 0, 0, 0, 0}, tuple_.GetValueInBytes(schema_, 8))
+	testingpkg.Equals(t, []byte{0, 4, 0, 0, 0}, tuple_.GetValueInBytes(schema_, 4))
+}
+
+func TestLegacyFormatTuple(t *testing.T) {
+	columnA := column.NewColumn("a", types.Varchar, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	columnB := column.NewColumn("b", types.Integer, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	columnC := column.NewColumn("c", types.Boolean, false, index_constants.INDEX_KIND_INVAID, types.PageID(-1), nil)
+	schema_ := schema.NewSchema([]*column.Column{columnA, columnB, columnC})
+
+	// a = 'abc', b = NULL, c = true in legacy format: each value has null flag
+	data := []byte{
+		11, 0, 0, 0, // offset of varchar payload
+		1, 0, 0, 0, 0, // null flag and integer
+		0, 1, // null flag and boolean
+		0, 3, 0, 'a', 'b', 'c', // null flag, length and string
+	}
+	tuple_ := NewTuple(nil, uint32(len(data)), data)
+	testingpkg.SimpleAssert(t, tuple_.IsLegacyFormat())
+	testingpkg.Equals(t, "abc", tuple_.GetValue(schema_, 0).ToVarchar())
+	testingpkg.SimpleAssert(t, tuple_.GetValue(schema_, 1).IsNull())
+	testingpkg.Equals(t, types.Integer, tuple_.GetValue(schema_, 1).ValueType())
+	testingpkg.Equals(t, true, tuple_.GetValue(schema_, 2).ToBoolean())
+	testingpkg.Equals(t, []byte{0, 3, 0, 'a', 'b', 'c'}, tuple_.GetValueInBytes(schema_, 0))
 }
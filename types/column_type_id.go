@@ -30,14 +30,16 @@ const (
 //	return 0
 //}
 
+// Size returns the size in bytes that value of the type occupies inside the tuple.
+// NULL is recorded in null bitmap of the tuple, so the size does not include space for it
 func (t TypeID) Size() uint32 {
 	switch t {
 	case Integer:
-		return 1 + 4
+		return 4
 	case Float:
-		return 1 + 4
+		return 4
 	case Boolean:
-		return 1 + 1
+		return 1
 	}
 	return 0
 }
@@ -23,6 +23,28 @@ type Value struct {
 	float     *float32
 }
 
+// length of varchar value which is not less than this is stored as uint32 following this marker
+// (uint16 length field is used for shorter ones)
+const varcharLongLengthMarker = uint16(0xFFFF)
+
+// returns size of the length field of varchar value of the length
+func varcharLengthFieldSize(length int) uint32 {
+	if length >= int(varcharLongLengthMarker) {
+		return 2 + 4
+	}
+	return 2
+}
+
+// DecodeVarcharLength reads the length field of serialized varchar value. data starts at the length field.
+// returns length of the string and size of the length field
+func DecodeVarcharLength(data []byte) (length uint32, fieldSize uint32) {
+	shortLength := binary.LittleEndian.Uint16(data)
+	if shortLength == varcharLongLengthMarker {
+		return binary.LittleEndian.Uint32(data[2:]), 2 + 4
+	}
+	return uint32(shortLength), 2
+}
+
 func NewInteger(value int32) Value {
 	tmpBool := false
 	return Value{Integer, &tmpBool, &value, nil, nil, nil}
@@ -63,63 +85,59 @@ func NewValue(value interface{}) Value {
 	}
 }
 
-// it can be used only when you can not know value type to be compared or something
-func NewNull() Value {
-	tmpTrue := true
-	tmpVal := int32(0)
-	return Value{Integer, &tmpTrue, &tmpVal, nil, nil, nil}
+// NewNull returns NULL value of valueType.
+// Null can be passed as valueType when type of the value is not known (ex: NULL literal in a query)
+func NewNull(valueType TypeID) Value {
+	var ret Value
+	switch valueType {
+	case Integer:
+		ret = NewInteger(0)
+	case Float:
+		ret = NewFloat(0)
+	case Varchar:
+		ret = NewVarchar("")
+	case Boolean:
+		ret = NewBoolean(false)
+	case Null:
+		tmpBool := false
+		ret = Value{Null, &tmpBool, nil, nil, nil, nil}
+	default:
+		panic("not supported type passed")
+	}
+	*ret.isNull = true
+	return ret
 }
 
-// NewValueFromBytes is used for deserialization
+// NewValueFromBytes is used for deserialization of data made by Serialize
 func NewValueFromBytes(data []byte, valueType TypeID) (ret *Value) {
+	ret = NewValueFromBytesWithoutNullFlag(data[1:], valueType)
+	if data[0] != 0 {
+		ret.SetNull()
+	}
+	return ret
+}
+
+// NewValueFromBytesWithoutNullFlag is used for deserialization of data made by SerializeWithoutNullFlag
+func NewValueFromBytesWithoutNullFlag(data []byte, valueType TypeID) (ret *Value) {
 	switch valueType {
 	case Integer:
-		buf := bytes.NewBuffer(data)
-		isNull := new(bool)
-		binary.Read(buf, binary.LittleEndian, isNull)
-		v := new(int32)
-		binary.Read(buf, binary.LittleEndian, v)
-		vInteger := NewInteger(*v)
-		if *isNull {
-			vInteger.SetNull()
-		}
+		v := int32(binary.LittleEndian.Uint32(data))
+		vInteger := NewInteger(v)
 		ret = &vInteger
 	case Float:
-		buf := bytes.NewBuffer(data)
-		isNull := new(bool)
-		binary.Read(buf, binary.LittleEndian, isNull)
-		v := new(float32)
-		binary.Read(buf, binary.LittleEndian, v)
-		vFloat := NewFloat(*v)
-		if *isNull {
-			vFloat.SetNull()
-		}
+		v := math.Float32frombits(binary.LittleEndian.Uint32(data))
+		vFloat := NewFloat(v)
 		ret = &vFloat
 	case Varchar:
-		buf := bytes.NewBuffer(data)
-		isNull := new(bool)
-		binary.Read(buf, binary.LittleEndian, isNull)
-		//lengthInBytes := data[0:2]
-		//length := new(int16)
-		length := new(uint16)
-		binary.Read(buf, binary.LittleEndian, length)
-		//varchar := NewVarchar(string(data[1+2 : (*length + (1 + 2))]))
-		varchar := NewVarchar(string(data[1+2 : (*length + (1 + 2))]))
-		if *isNull {
-			varchar.SetNull()
-		}
+		length, fieldSize := DecodeVarcharLength(data)
+		varchar := NewVarchar(string(data[fieldSize : fieldSize+length]))
 		ret = &varchar
 	case Boolean:
-		buf := bytes.NewBuffer(data)
-		isNull := new(bool)
-		binary.Read(buf, binary.LittleEndian, isNull)
-		v := new(bool)
-		binary.Read(buf, binary.LittleEndian, v)
-		vBoolean := NewBoolean(*v)
-		if *isNull {
-			vBoolean.SetNull()
-		}
+		vBoolean := NewBoolean(data[0] != 0)
 		ret = &vBoolean
+	case Null:
+		vNull := NewNull(Null)
+		ret = &vNull
 	default:
 		fmt.Printf("%v is illegal\n", valueType)
 		panic("")
@@ -176,7 +194,7 @@ func (v Value) CompareNotEquals(right Value) bool {
 }
 
 func (v Value) CompareGreaterThan(right Value) bool {
-	if v.IsNull() {
+	if v.IsNull() || right.IsNull() {
 		return false
 	}
 	if v.IsInfMax() && right.IsInfMax() {
@@ -242,7 +260,7 @@ func (v Value) CompareGreaterThanOrEqual(right Value) bool {
 }
 
 func (v Value) CompareLessThan(right Value) bool {
-	if v.IsNull() {
+	if v.IsNull() || right.IsNull() {
 		return false
 	}
 	if v.IsInfMax() && right.IsInfMax() {
@@ -308,27 +326,39 @@ func (v Value) CompareLessThanOrEqual(right Value) bool {
 	}
 }
 
+// Serialize returns null flag and data of the value. it is used for keys of indexes
 func (v Value) Serialize() []byte {
+	isNullFlag := byte(0)
+	if v.IsNull() {
+		isNullFlag = 1
+	}
+	return append([]byte{isNullFlag}, v.SerializeWithoutNullFlag()...)
+}
+
+// SerializeWithoutNullFlag returns data of the value which is stored in a tuple.
+// NULL is recorded in null bitmap of the tuple and it is serialized as zero value of the type
+func (v Value) SerializeWithoutNullFlag() []byte {
 	switch v.valueType {
 	case Integer:
 		buf := new(bytes.Buffer)
-		binary.Write(buf, binary.LittleEndian, *v.isNull)
 		binary.Write(buf, binary.LittleEndian, v.ToInteger())
 		return buf.Bytes()
 	case Float:
 		buf := new(bytes.Buffer)
-		binary.Write(buf, binary.LittleEndian, *v.isNull)
 		binary.Write(buf, binary.LittleEndian, v.ToFloat())
 		return buf.Bytes()
 	case Varchar:
 		buf := new(bytes.Buffer)
-		binary.Write(buf, binary.LittleEndian, *v.isNull)
-		binary.Write(buf, binary.LittleEndian, uint16(len(v.ToVarchar())))
-		isNullAndLength := buf.Bytes()
-		return append(isNullAndLength, []byte(v.ToVarchar())...)
+		if length := len(v.ToVarchar()); length >= int(varcharLongLengthMarker) {
+			binary.Write(buf, binary.LittleEndian, varcharLongLengthMarker)
+			binary.Write(buf, binary.LittleEndian, uint32(length))
+		} else {
+			binary.Write(buf, binary.LittleEndian, uint16(length))
+		}
+		length := buf.Bytes()
+		return append(length, []byte(v.ToVarchar())...)
 	case Boolean:
 		buf := new(bytes.Buffer)
-		binary.Write(buf, binary.LittleEndian, *v.isNull)
 		binary.Write(buf, binary.LittleEndian, v.ToBoolean())
 		return buf.Bytes()
 	}
@@ -337,16 +367,17 @@ func (v Value) Serialize() []byte {
 
 // Size returns the size in bytes that the type will occupy inside the tuple
 func (v Value) Size() uint32 {
-	// all type occupies the whether NULL or not + 1 byte for the info storage
 	switch v.valueType {
 	case Integer:
 		return v.valueType.Size()
 	case Float:
 		return v.valueType.Size()
 	case Varchar:
-		return uint32(len(*v.varchar)) + 1 + 2 // varchar occupies the size of the string + 2 bytes for length storage
+		return uint32(len(*v.varchar)) + varcharLengthFieldSize(len(*v.varchar)) // varchar occupies the size of the string + bytes for length storage
 	case Boolean:
 		return v.valueType.Size()
+	case Null:
+		return 0
 	}
 	panic("not implemented")
 }
@@ -366,6 +397,8 @@ func (v Value) ToString() string {
 		} else {
 			return "false"
 		}
+	case Null:
+		return "NULL"
 	}
 	panic("not implemented")
 }
@@ -430,6 +463,8 @@ func (v Value) SetNull() *Value {
 	case Boolean:
 		*v.boolean = false
 		return &v
+	case Null:
+		return &v
 	}
 	panic("not implemented")
 }
@@ -484,6 +519,8 @@ func (v Value) IsInfMax() bool {
 		return *v.varchar == "SamehadaDBInfMaxValue"
 	case Boolean:
 		return *v.boolean == true
+	case Null:
+		return false
 	}
 	panic("not implemented")
 }
@@ -498,6 +535,8 @@ func (v Value) IsInfMin() bool {
 		return *v.varchar == "SamehadaDBInfMinValue"
 	case Boolean:
 		return *v.boolean == false
+	case Null:
+		return false
 	}
 	panic("not implemented")
 }